@@ -10,12 +10,14 @@ import (
 
 	"github.com/ethereum/go-ethereum/arbitrum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/offchainlabs/nitro/arbos/arbosState"
 	"github.com/offchainlabs/nitro/arbos/l2pricing"
 	"github.com/offchainlabs/nitro/arbos/retryables"
+	"github.com/offchainlabs/nitro/das"
 	"github.com/offchainlabs/nitro/validator"
 	"github.com/pkg/errors"
 )
@@ -53,6 +55,123 @@ func (a *BlockValidatorAPI) LatestValidatedBlockHash(ctx context.Context) (commo
 	return hash, nil
 }
 
+type DASAggregatorAPI struct {
+	aggregator *das.Aggregator
+}
+
+func (a *DASAggregatorAPI) BackendStatus(ctx context.Context) ([]das.BackendStatus, error) {
+	return a.aggregator.BackendStatus(), nil
+}
+
+type BatchPosterAPI struct {
+	batchPoster *BatchPoster
+}
+
+func (a *BatchPosterAPI) BatchPostingRecord(ctx context.Context, batchSeqNum uint64) (*BatchPostingRecord, error) {
+	record := a.batchPoster.BatchPostingRecord(batchSeqNum)
+	if record == nil {
+		return nil, fmt.Errorf("no record of batch %v being posted by this node", batchSeqNum)
+	}
+	return record, nil
+}
+
+func (a *BatchPosterAPI) RecentBatchPostingRecords(ctx context.Context, count uint64) ([]*BatchPostingRecord, error) {
+	if count > uint64(a.batchPoster.config.DASFallback.RecordHistory) {
+		count = uint64(a.batchPoster.config.DASFallback.RecordHistory)
+	}
+	return a.batchPoster.RecentBatchPostingRecords(int(count)), nil
+}
+
+func (a *BatchPosterAPI) DryRunBatch(ctx context.Context) (*BatchDryRun, error) {
+	return a.batchPoster.DryRunBatch(ctx)
+}
+
+// SequencerTxPoolAPI introspects the sequencer's txpool, like geth's txpool API.
+type SequencerTxPoolAPI struct {
+	sequencer *Sequencer
+}
+
+func (a *SequencerTxPoolAPI) Status(ctx context.Context) (map[string]hexutil.Uint, error) {
+	pending, queued, err := a.sequencer.TxPoolContent()
+	if err != nil {
+		return nil, err
+	}
+	count := func(txs map[common.Address]types.Transactions) hexutil.Uint {
+		total := 0
+		for _, senderTxs := range txs {
+			total += len(senderTxs)
+		}
+		return hexutil.Uint(total)
+	}
+	return map[string]hexutil.Uint{
+		"pending": count(pending),
+		"queued":  count(queued),
+	}, nil
+}
+
+func txPoolContentByNonce(txs types.Transactions) map[string]*types.Transaction {
+	byNonce := make(map[string]*types.Transaction, len(txs))
+	for _, tx := range txs {
+		byNonce[fmt.Sprint(tx.Nonce())] = tx
+	}
+	return byNonce
+}
+
+func (a *SequencerTxPoolAPI) Content(ctx context.Context) (map[string]map[common.Address]map[string]*types.Transaction, error) {
+	pending, queued, err := a.sequencer.TxPoolContent()
+	if err != nil {
+		return nil, err
+	}
+	content := map[string]map[common.Address]map[string]*types.Transaction{
+		"pending": make(map[common.Address]map[string]*types.Transaction, len(pending)),
+		"queued":  make(map[common.Address]map[string]*types.Transaction, len(queued)),
+	}
+	for sender, txs := range pending {
+		content["pending"][sender] = txPoolContentByNonce(txs)
+	}
+	for sender, txs := range queued {
+		content["queued"][sender] = txPoolContentByNonce(txs)
+	}
+	return content, nil
+}
+
+func (a *SequencerTxPoolAPI) ContentFrom(ctx context.Context, sender common.Address) (map[string]map[string]*types.Transaction, error) {
+	pending, queued, err := a.sequencer.TxPoolContent()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]map[string]*types.Transaction{
+		"pending": txPoolContentByNonce(pending[sender]),
+		"queued":  txPoolContentByNonce(queued[sender]),
+	}, nil
+}
+
+// Inspect summarizes the txpool's transactions, in the same format as geth.
+func (a *SequencerTxPoolAPI) Inspect(ctx context.Context) (map[string]map[common.Address]map[string]string, error) {
+	pending, queued, err := a.sequencer.TxPoolContent()
+	if err != nil {
+		return nil, err
+	}
+	summarize := func(txs map[common.Address]types.Transactions) map[common.Address]map[string]string {
+		summaries := make(map[common.Address]map[string]string, len(txs))
+		for sender, senderTxs := range txs {
+			summaries[sender] = make(map[string]string, len(senderTxs))
+			for _, tx := range senderTxs {
+				to := "contract creation"
+				if tx.To() != nil {
+					to = tx.To().Hex()
+				}
+				summaries[sender][fmt.Sprint(tx.Nonce())] = fmt.Sprintf("%s: %v wei + %v gas × %v wei", to, tx.Value(), tx.Gas(), tx.GasFeeCap())
+			}
+		}
+		return summaries
+	}
+	return map[string]map[common.Address]map[string]string{
+		"pending": summarize(pending),
+		"queued":  summarize(queued),
+	}, nil
+}
+
 type ArbDebugAPI struct {
 	blockchain *core.BlockChain
 }
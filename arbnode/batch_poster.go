@@ -14,16 +14,19 @@ import (
 	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/das"
 	"github.com/offchainlabs/nitro/solgen/go/bridgegen"
-	"github.com/offchainlabs/nitro/util/arbmath"
 	"github.com/offchainlabs/nitro/util/stopwaiter"
 )
 
@@ -34,20 +37,37 @@ type BatchPoster struct {
 	streamer      *TransactionStreamer
 	config        *BatchPosterConfig
 	inboxContract *bridgegen.SequencerInbox
+	seqInboxAddr  common.Address
 	gasRefunder   common.Address
-	transactOpts  *bind.TransactOpts
+	dataPoster    *DataPoster
 	building      *buildingBatch
 	das           das.DataAvailabilityService
+	dasFallback   dasFallbackTracker
+	records       *batchPostingRecords
+	executionGas  uint64
+	l1Cost        *l1CostTracker
+}
+
+// batchPosterPosition is the metadata the batch poster stores with each batch
+// it posts, saying where the next batch starts.
+type batchPosterPosition struct {
+	MessageCount        arbutil.MessageIndex
+	DelayedMessageCount uint64
+	NextSeqNum          uint64
 }
 
 type BatchPosterConfig struct {
-	Enable               bool          `koanf:"enable"`
-	MaxBatchSize         int           `koanf:"max-size"`
-	MaxBatchPostInterval time.Duration `koanf:"max-interval"`
-	BatchPollDelay       time.Duration `koanf:"poll-delay"`
-	PostingErrorDelay    time.Duration `koanf:"error-delay"`
-	CompressionLevel     int           `koanf:"compression-level"`
-	DASRetentionPeriod   time.Duration `koanf:"das-retention-period"`
+	Enable               bool              `koanf:"enable"`
+	MaxBatchSize         int               `koanf:"max-size"`
+	MaxBatchPostInterval time.Duration     `koanf:"max-interval"`
+	BatchPollDelay       time.Duration     `koanf:"poll-delay"`
+	PostingErrorDelay    time.Duration     `koanf:"error-delay"`
+	CompressionLevel     int               `koanf:"compression-level"`
+	DASRetentionPeriod   time.Duration     `koanf:"das-retention-period"`
+	DASFallback          DASFallbackConfig `koanf:"das-fallback"`
+	ExtraBatchGas        uint64            `koanf:"extra-batch-gas"`
+	DataPoster           DataPosterConfig  `koanf:"data-poster"`
+	L1Cost               L1CostConfig      `koanf:"l1-cost"`
 }
 
 func BatchPosterConfigAddOptions(prefix string, f *flag.FlagSet) {
@@ -58,6 +78,10 @@ func BatchPosterConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Duration(prefix+".error-delay", DefaultBatchPosterConfig.PostingErrorDelay, "how long to delay after error posting batch")
 	f.Int(prefix+".compression-level", DefaultBatchPosterConfig.CompressionLevel, "batch compression level")
 	f.Duration(prefix+".das-retention-period", DefaultBatchPosterConfig.DASRetentionPeriod, "In AnyTrust mode, the period which DASes are requested to retain the stored batches.")
+	DASFallbackConfigAddOptions(prefix+".das-fallback", f)
+	f.Uint64(prefix+".extra-batch-gas", DefaultBatchPosterConfig.ExtraBatchGas, "use this much more gas than estimated for batch posting transactions")
+	DataPosterConfigAddOptions(prefix+".data-poster", f)
+	L1CostConfigAddOptions(prefix+".l1-cost", f)
 }
 
 var DefaultBatchPosterConfig = BatchPosterConfig{
@@ -68,6 +92,10 @@ var DefaultBatchPosterConfig = BatchPosterConfig{
 	MaxBatchPostInterval: time.Hour,
 	CompressionLevel:     brotli.DefaultCompression,
 	DASRetentionPeriod:   time.Hour * 24 * 15,
+	DASFallback:          DefaultDASFallbackConfig,
+	ExtraBatchGas:        50_000,
+	DataPoster:           DefaultDataPosterConfig,
+	L1Cost:               DefaultL1CostConfig,
 }
 
 var TestBatchPosterConfig = BatchPosterConfig{
@@ -78,26 +106,92 @@ var TestBatchPosterConfig = BatchPosterConfig{
 	MaxBatchPostInterval: 0,
 	CompressionLevel:     2,
 	DASRetentionPeriod:   time.Hour * 24 * 15,
+	DASFallback:          TestDASFallbackConfig,
+	ExtraBatchGas:        10_000,
+	DataPoster:           TestDataPosterConfig,
+	L1Cost:               TestL1CostConfig,
 }
 
-func NewBatchPoster(l1Reader *L1Reader, inbox *InboxTracker, streamer *TransactionStreamer, config *BatchPosterConfig, contractAddress common.Address, refunder common.Address, transactOpts *bind.TransactOpts, das das.DataAvailabilityService) (*BatchPoster, error) {
+// Gas used executing a batch posting transaction, other than for its calldata,
+// assumed until a batch's gas has been estimated.
+const defaultBatchExecutionGas = 200_000
+
+func NewBatchPoster(l1Reader *L1Reader, inbox *InboxTracker, streamer *TransactionStreamer, config *BatchPosterConfig, contractAddress common.Address, refunder common.Address, transactOpts *bind.TransactOpts, das das.DataAvailabilityService, dataPosterDB ethdb.Database) (*BatchPoster, error) {
+	if err := config.DASFallback.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.L1Cost.Validate(); err != nil {
+		return nil, err
+	}
 	inboxContract, err := bridgegen.NewSequencerInbox(contractAddress, l1Reader.Client())
 	if err != nil {
 		return nil, err
 	}
-	return &BatchPoster{
+	b := &BatchPoster{
 		l1Reader:      l1Reader,
 		inbox:         inbox,
 		streamer:      streamer,
 		config:        config,
 		inboxContract: inboxContract,
-		transactOpts:  transactOpts,
+		seqInboxAddr:  contractAddress,
 		gasRefunder:   refunder,
 		das:           das,
-	}, nil
+		dasFallback:   dasFallbackTracker{config: &config.DASFallback},
+		records:       newBatchPostingRecords(config.DASFallback.RecordHistory),
+		executionGas:  defaultBatchExecutionGas,
+		l1Cost:        &l1CostTracker{config: &config.L1Cost},
+	}
+	b.dataPoster, err = NewDataPoster(l1Reader, transactOpts, dataPosterDB, &config.DataPoster, b.getBatchPosterPosition)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// BatchPostingRecord returns where the data of the given batch was posted, if
+// it was posted recently by this node.
+func (b *BatchPoster) BatchPostingRecord(batchSeqNum uint64) *BatchPostingRecord {
+	return b.records.get(batchSeqNum)
+}
+
+// RecentBatchPostingRecords returns up to count records of the batches most
+// recently posted by this node, most recent first.
+func (b *BatchPoster) RecentBatchPostingRecords(count int) []*BatchPostingRecord {
+	return b.records.recent(count)
 }
 
 var errBatchAlreadyClosed = errors.New("batch segments already closed")
+var errDASStoreRetry = errors.New("DAS store failed, retrying")
+var errInboxTrackerBehind = errors.New("inbox tracker hasn't read all the batches posted")
+
+// getBatchPosterPosition returns where the next batch starts, as of the given
+// L1 block, for the data poster to use while no batches are in flight.
+func (b *BatchPoster) getBatchPosterPosition(ctx context.Context, blockNum *big.Int) ([]byte, error) {
+	bigInboxBatchCount, err := b.inboxContract.BatchCount(&bind.CallOpts{Context: ctx, BlockNumber: blockNum})
+	if err != nil {
+		return nil, err
+	}
+	inboxBatchCount := bigInboxBatchCount.Uint64()
+	trackerBatchCount, err := b.inbox.GetBatchCount()
+	if err != nil {
+		return nil, err
+	}
+	if trackerBatchCount < inboxBatchCount {
+		return nil, fmt.Errorf("%w: contract has %v batches but inbox tracker has %v", errInboxTrackerBehind, inboxBatchCount, trackerBatchCount)
+	}
+	var prevBatchMeta BatchMetadata
+	if inboxBatchCount > 0 {
+		prevBatchMeta, err = b.inbox.GetBatchMetadata(inboxBatchCount - 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rlp.EncodeToBytes(batchPosterPosition{
+		MessageCount:        prevBatchMeta.MessageCount,
+		DelayedMessageCount: prevBatchMeta.DelayedMessageCount,
+		NextSeqNum:          inboxBatchCount,
+	})
+}
 
 type batchSegments struct {
 	compressedBuffer    *bytes.Buffer
@@ -110,6 +204,7 @@ type batchSegments struct {
 	compressionLevel    int
 	newUncompressedSize int
 	lastCompressedSize  int
+	lastFlushedSize     int // uncompressed size of the data written before the last flush
 	trailingHeaders     int // how many trailing segments are headers
 	isDone              bool
 }
@@ -139,6 +234,8 @@ func (s *batchSegments) recompressAll() error {
 	s.compressedBuffer = bytes.NewBuffer(make([]byte, 0, s.sizeLimit*2))
 	s.compressedWriter = brotli.NewWriterLevel(s.compressedBuffer, s.compressionLevel)
 	s.newUncompressedSize = 0
+	s.lastCompressedSize = 0
+	s.lastFlushedSize = 0
 	for _, segment := range s.rawSegments {
 		err := s.addSegmentToCompressed(segment)
 		if err != nil {
@@ -162,6 +259,7 @@ func (s *batchSegments) testForOverflow() (bool, error) {
 		return true, err
 	}
 	s.lastCompressedSize = s.compressedBuffer.Len()
+	s.lastFlushedSize += s.newUncompressedSize
 	s.newUncompressedSize = 0
 	if s.lastCompressedSize >= s.sizeLimit {
 		return true, nil
@@ -278,6 +376,22 @@ func (s *batchSegments) AddMessage(msg *arbstate.MessageWithMetadata) (bool, err
 	return s.addL2Msg(msg.Message.L2msg)
 }
 
+// compressedSize estimates the compressed size of the segments added so far,
+// without flushing the compressed writer, as that would worsen its compression.
+// Data written since the last flush is taken to compress as well as the data
+// before it, or not at all if there's been no flush yet, but the estimate is no
+// less than what the writer has output already.
+func (s *batchSegments) compressedSize() (int, error) {
+	estimate := s.lastCompressedSize + s.newUncompressedSize
+	if s.lastFlushedSize > 0 {
+		estimate = s.lastCompressedSize + s.newUncompressedSize*s.lastCompressedSize/s.lastFlushedSize
+	}
+	if compressed := s.compressedBuffer.Len(); compressed > estimate {
+		return compressed, nil
+	}
+	return estimate, nil
+}
+
 func (s *batchSegments) IsDone() bool {
 	return s.isDone
 }
@@ -303,35 +417,61 @@ func (s *batchSegments) CloseAndGetBytes() ([]byte, error) {
 	return fullMsg, nil
 }
 
-func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, timeSinceBatchPosted time.Duration) (*types.Transaction, error) {
-	batchSeqNum, err := b.inbox.GetBatchCount()
+// calldataGas returns the L1 gas charged for data in a transaction's calldata.
+func calldataGas(data []byte) uint64 {
+	gas := uint64(0)
+	for _, b := range data {
+		if b == 0 {
+			gas += params.TxDataZeroGas
+		} else {
+			gas += params.TxDataNonZeroGasEIP2028
+		}
+	}
+	return gas
+}
+
+// estimateGas returns the gas limit to post a batch with. While earlier batches
+// are in flight the contract would reject this one, so rather than estimating
+// it, its gas is worked out from its calldata and the execution gas of the last
+// batch which was estimated.
+func (b *BatchPoster) estimateGas(ctx context.Context, calldata []byte, inFlight bool) (uint64, error) {
+	dataGas := params.TxGas + calldataGas(calldata)
+	if inFlight {
+		return dataGas + b.executionGas + b.config.ExtraBatchGas, nil
+	}
+	gas, err := b.l1Reader.Client().EstimateGas(ctx, ethereum.CallMsg{
+		From: b.dataPoster.From(),
+		To:   &b.seqInboxAddr,
+		Data: calldata,
+	})
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	if gas > dataGas {
+		b.executionGas = gas - dataGas
 	}
-	inboxContractCount, err := b.inboxContract.BatchCount(&bind.CallOpts{Context: ctx, Pending: true})
+	return gas + b.config.ExtraBatchGas, nil
+}
+
+func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, timeSinceBatchPosted time.Duration) (*types.Transaction, error) {
+	inFlight := b.dataPoster.QueueLength()
+	if uint64(inFlight) >= b.config.DataPoster.MaxMempoolTransactions {
+		// wait for some of the batches in flight to be confirmed
+		return nil, nil
+	}
+	nonce, batchPositionBytes, err := b.dataPoster.GetNextNonceAndMeta(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if !arbmath.BigEquals(inboxContractCount, arbmath.UintToBig(batchSeqNum)) {
-		// If it's been under a minute since the last batch was posted, and the inbox tracker is exactly one batch behind,
-		// then there isn't an error. We're just waiting for the inbox tracker to read the most recently posted batch.
-		if timeSinceBatchPosted <= time.Minute && arbmath.BigEquals(inboxContractCount, arbmath.UintToBig(batchSeqNum+1)) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("inbox tracker not synced: contract has %v batches but inbox tracker has %v", inboxContractCount, batchSeqNum)
-	}
-	var prevBatchMeta BatchMetadata
-	if batchSeqNum > 0 {
-		var err error
-		prevBatchMeta, err = b.inbox.GetBatchMetadata(batchSeqNum - 1)
-		if err != nil {
-			return nil, err
-		}
+	var batchPosition batchPosterPosition
+	if err := rlp.DecodeBytes(batchPositionBytes, &batchPosition); err != nil {
+		return nil, fmt.Errorf("failed to decode batch poster position: %w", err)
 	}
+	batchSeqNum := batchPosition.NextSeqNum
 	if b.building == nil || b.building.batchSeqNum != batchSeqNum {
 		b.building = &buildingBatch{
-			segments:    newBatchSegments(prevBatchMeta.DelayedMessageCount, b.config),
-			msgCount:    prevBatchMeta.MessageCount,
+			segments:    newBatchSegments(batchPosition.DelayedMessageCount, b.config),
+			msgCount:    batchPosition.MessageCount,
 			batchSeqNum: batchSeqNum,
 		}
 	}
@@ -339,8 +479,9 @@ func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, timeSinceBatc
 	if err != nil {
 		return nil, err
 	}
-	forcePostBatch := timeSinceBatchPosted >= b.config.MaxBatchPostInterval
-	for b.building.msgCount < msgCount {
+	// a full batch has already been closed, if its posting was delayed
+	forcePostBatch := b.building.segments.IsDone() || timeSinceBatchPosted >= b.config.MaxBatchPostInterval
+	for !b.building.segments.IsDone() && b.building.msgCount < msgCount {
 		msg, err := b.streamer.GetMessage(b.building.msgCount)
 		if err != nil {
 			log.Error("error getting message from streamer", "error", err)
@@ -357,8 +498,15 @@ func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, timeSinceBatc
 		}
 		b.building.msgCount++
 	}
+	postingReason := PostingReasonDue
+	if b.config.L1Cost.Enable {
+		forcePostBatch, postingReason, err = b.l1Cost.decide(time.Now(), forcePostBatch, b.building.segments.compressedSize, params.TxGas+b.executionGas)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if !forcePostBatch {
-		// the batch isn't full yet and we've posted a batch recently
+		// the batch isn't due or cheap to post yet, or L1 fees are spiking
 		// don't post anything for now
 		return nil, nil
 	}
@@ -367,48 +515,184 @@ func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, timeSinceBatc
 		return nil, err
 	}
 	if sequencerMsg == nil {
-		log.Debug("BatchPoster: batch nil", "sequence nr.", batchSeqNum, "from", prevBatchMeta.MessageCount, "prev delayed", prevBatchMeta.DelayedMessageCount)
+		log.Debug("BatchPoster: batch nil", "sequence nr.", batchSeqNum, "from", batchPosition.MessageCount, "prev delayed", batchPosition.DelayedMessageCount)
 		b.building = nil // a closed batchSegments can't be reused
 		return nil, nil
 	}
 
+	record := &BatchPostingRecord{
+		BatchSequenceNumber: batchSeqNum,
+		Destination:         BatchDestinationOnChain,
+		DataHash:            crypto.Keccak256Hash(sequencerMsg),
+		Size:                len(sequencerMsg),
+	}
 	if b.das != nil {
 		cert, err := b.das.Store(ctx, sequencerMsg, uint64(time.Now().Add(b.config.DASRetentionPeriod).Unix()))
 		if err != nil {
-			log.Warn("Unable to batch to DAS, falling back to storing data on chain", "err", err)
+			now := time.Now()
+			b.dasFallback.recordFailure(now)
+			record.DASFailures = b.dasFallback.consecutiveFailures
+			fallBack, reason := b.dasFallback.shouldFallBack(now)
+			if !fallBack {
+				dasRetryCounter.Inc(1)
+				log.Warn("Unable to store batch to DAS, retrying", "sequence nr.", batchSeqNum, "policy", b.config.DASFallback.Policy, "failures", record.DASFailures, "retryDelay", b.dasFallback.retryDelay(), "err", err)
+				return nil, fmt.Errorf("%w: %v", errDASStoreRetry, err)
+			}
+			dasFallbackCounter.Inc(1)
+			dasFallbackBytesCount.Inc(int64(len(sequencerMsg)))
+			log.Warn("Unable to store batch to DAS, falling back to posting data on chain", "sequence nr.", batchSeqNum, "size", len(sequencerMsg), "policy", b.config.DASFallback.Policy, "failures", record.DASFailures, "reason", reason, "err", err)
+			record.FallbackReason = reason
 		} else {
+			record.DASFailures = b.dasFallback.consecutiveFailures
+			b.dasFallback.recordSuccess()
+			record.Destination = BatchDestinationDAS
 			sequencerMsg = das.Serialize(*cert)
 		}
 	}
 
-	txOpts := *b.transactOpts
-	txOpts.Context = ctx
-	tx, err := b.inboxContract.AddSequencerL2BatchFromOrigin(&txOpts, new(big.Int).SetUint64(batchSeqNum), sequencerMsg, new(big.Int).SetUint64(b.building.segments.delayedMsg), b.gasRefunder)
-	if err == nil {
-		log.Info("BatchPoster: batch sent", "sequence nr.", batchSeqNum, "from", prevBatchMeta.MessageCount, "to", b.building.msgCount, "prev delayed", prevBatchMeta.DelayedMessageCount, "current delayed", b.building.segments.delayedMsg, "total segments", len(b.building.segments.rawSegments))
+	calldata, err := sequencerBridgeABI.Pack("addSequencerL2BatchFromOrigin", new(big.Int).SetUint64(batchSeqNum), sequencerMsg, new(big.Int).SetUint64(b.building.segments.delayedMsg), b.gasRefunder)
+	if err != nil {
+		return nil, err
+	}
+	gasLimit, err := b.estimateGas(ctx, calldata, inFlight > 0)
+	if err != nil {
+		return nil, err
+	}
+	newMeta, err := rlp.EncodeToBytes(batchPosterPosition{
+		MessageCount:        b.building.msgCount,
+		DelayedMessageCount: b.building.segments.delayedMsg,
+		NextSeqNum:          batchSeqNum + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tx, err := b.dataPoster.PostTransaction(ctx, nonce, newMeta, b.seqInboxAddr, calldata, gasLimit)
+	if err != nil {
+		return nil, err
+	}
+	record.Timestamp = uint64(time.Now().Unix())
+	record.TxHash = tx.Hash()
+	b.records.add(record)
+	if b.config.L1Cost.Enable {
+		b.l1Cost.posted(postingReason)
+	}
+	log.Info("BatchPoster: batch sent", "sequence nr.", batchSeqNum, "nonce", nonce, "in flight", inFlight+1, "reason", postingReason, "destination", record.Destination, "from", batchPosition.MessageCount, "to", b.building.msgCount, "prev delayed", batchPosition.DelayedMessageCount, "current delayed", b.building.segments.delayedMsg, "total segments", len(b.building.segments.rawSegments))
+	return tx, nil
+}
+
+// BatchDryRun shows how the messages waiting to be posted would be packed into
+// the next batch.
+type BatchDryRun struct {
+	BatchSequenceNumber uint64                 `json:"batchSequenceNumber"`
+	FirstMessage        arbutil.MessageIndex   `json:"firstMessage"`
+	AfterMessage        arbutil.MessageIndex   `json:"afterMessage"`
+	PendingMessages     uint64                 `json:"pendingMessages"`
+	Full                bool                   `json:"full"`
+	Size                int                    `json:"size"`
+	CalldataGas         uint64                 `json:"calldataGas"`
+	Batch               *arbstate.DecodedBatch `json:"batch,omitempty"`
+}
+
+// DryRunBatch packs the streamer's messages which haven't been posted into a
+// batch the way maybePostSequencerBatch would, without storing or posting it.
+// The batch is always shown as it'd be posted on chain, even with a DAS.
+func (b *BatchPoster) DryRunBatch(ctx context.Context) (*BatchDryRun, error) {
+	_, batchPositionBytes, err := b.dataPoster.GetNextNonceAndMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var batchPosition batchPosterPosition
+	if err := rlp.DecodeBytes(batchPositionBytes, &batchPosition); err != nil {
+		return nil, fmt.Errorf("failed to decode batch poster position: %w", err)
+	}
+	msgCount, err := b.streamer.GetMessageCount()
+	if err != nil {
+		return nil, err
+	}
+	dryRun := &BatchDryRun{
+		BatchSequenceNumber: batchPosition.NextSeqNum,
+		FirstMessage:        batchPosition.MessageCount,
+		AfterMessage:        batchPosition.MessageCount,
+	}
+	if msgCount > batchPosition.MessageCount {
+		dryRun.PendingMessages = uint64(msgCount - batchPosition.MessageCount)
+	}
+	segments := newBatchSegments(batchPosition.DelayedMessageCount, b.config)
+	for dryRun.AfterMessage < msgCount {
+		msg, err := b.streamer.GetMessage(dryRun.AfterMessage)
+		if err != nil {
+			return nil, err
+		}
+		success, err := segments.AddMessage(&msg)
+		if err != nil {
+			return nil, err
+		}
+		if !success {
+			dryRun.Full = true
+			break
+		}
+		dryRun.AfterMessage++
+	}
+	sequencerMsg, err := segments.CloseAndGetBytes()
+	if err != nil || sequencerMsg == nil {
+		return dryRun, err
+	}
+	dryRun.Size = len(sequencerMsg)
+	dryRun.CalldataGas = calldataGas(sequencerMsg)
+	dryRun.Batch, err = arbstate.DecodeBatchData(ctx, sequencerMsg, nil, batchPosition.DelayedMessageCount, b.streamer.bc.Config().ChainID)
+	return dryRun, err
+}
+
+// watchL1BaseFee follows the L1 base fee for deciding when to post batches.
+func (b *BatchPoster) watchL1BaseFee(ctx context.Context) {
+	headerChan, unsubscribe := b.l1Reader.Subscribe(false)
+	defer unsubscribe()
+	for {
+		select {
+		case header, ok := <-headerChan:
+			if !ok {
+				return
+			}
+			b.l1Cost.observe(header)
+		case <-ctx.Done():
+			return
+		}
 	}
-	return tx, err
 }
 
 func (b *BatchPoster) Start(ctxIn context.Context) {
+	b.dataPoster.Start(ctxIn)
 	b.StopWaiter.Start(ctxIn)
+	if b.config.L1Cost.Enable {
+		b.LaunchThread(b.watchL1BaseFee)
+	}
 	var lastBatchPosted time.Time
 	b.CallIteratively(func(ctx context.Context) time.Duration {
 		tx, err := b.maybePostSequencerBatch(ctx, time.Since(lastBatchPosted))
 		if err != nil {
 			b.building = nil
+			if errors.Is(err, errDASStoreRetry) {
+				// already logged
+				return b.dasFallback.retryDelay()
+			}
+			// If it's been under a minute since the last batch was posted, then there isn't an error.
+			// We're just waiting for the inbox tracker to read the most recently confirmed batches.
+			if errors.Is(err, errInboxTrackerBehind) && time.Since(lastBatchPosted) <= time.Minute {
+				log.Debug("waiting for inbox tracker to read posted batches", "err", err)
+				return b.config.BatchPollDelay
+			}
 			log.Error("error posting batch", "err", err)
 			return b.config.PostingErrorDelay
 		}
 		if tx != nil {
 			b.building = nil
-			_, err = b.l1Reader.WaitForTxApproval(ctx, tx)
-			if err != nil {
-				log.Error("failed ensuring batch tx succeeded", "err", err)
-			} else {
-				lastBatchPosted = time.Now()
-			}
+			lastBatchPosted = time.Now()
 		}
 		return b.config.BatchPollDelay
 	})
 }
+
+func (b *BatchPoster) StopAndWait() {
+	b.StopWaiter.StopAndWait()
+	b.dataPoster.StopAndWait()
+}
@@ -0,0 +1,239 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/offchainlabs/nitro/arbos"
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/zeroheavy"
+)
+
+// testInboxBackend serves sequencer batches to an InboxMultiplexer.
+type testInboxBackend struct {
+	batchSeqNum           uint64
+	batches               [][]byte
+	positionWithinMessage uint64
+}
+
+func (b *testInboxBackend) PeekSequencerInbox() ([]byte, error) {
+	if len(b.batches) == 0 {
+		return nil, errors.New("read past end of specified sequencer batches")
+	}
+	return b.batches[0], nil
+}
+
+func (b *testInboxBackend) GetSequencerInboxPosition() uint64 {
+	return b.batchSeqNum
+}
+
+func (b *testInboxBackend) AdvanceSequencerInbox() {
+	b.batchSeqNum++
+	if len(b.batches) > 0 {
+		b.batches = b.batches[1:]
+	}
+}
+
+func (b *testInboxBackend) GetPositionWithinMessage() uint64 {
+	return b.positionWithinMessage
+}
+
+func (b *testInboxBackend) SetPositionWithinMessage(pos uint64) {
+	b.positionWithinMessage = pos
+}
+
+func (b *testInboxBackend) ReadDelayedInbox(seqNum uint64) ([]byte, error) {
+	return nil, errors.New("no delayed messages")
+}
+
+// testDASReader serves the same payload for any cert.
+type testDASReader struct {
+	payload []byte
+}
+
+func (r *testDASReader) Retrieve(ctx context.Context, cert []byte) ([]byte, error) {
+	return r.payload, nil
+}
+
+func batchPosterTestMessages(count int, random *rand.Rand) []*arbstate.MessageWithMetadata {
+	var messages []*arbstate.MessageWithMetadata
+	for i := 0; i < count; i++ {
+		// Like transactions' ABI encoded calldata, mostly zero padding
+		l2msg := make([]byte, 4+32*random.Intn(8))
+		for j := 0; j < len(l2msg); j += 32 {
+			random.Read(l2msg[j : j+4])
+		}
+		messages = append(messages, &arbstate.MessageWithMetadata{
+			Message: &arbos.L1IncomingMessage{
+				Header: &arbos.L1IncomingMessageHeader{
+					Kind:        arbos.L1MessageType_L2Message,
+					BlockNumber: 100 + uint64(i/4),
+					Timestamp:   1000 + uint64(i/2),
+					L1BaseFee:   big.NewInt(0),
+				},
+				L2msg: l2msg,
+			},
+		})
+	}
+	return messages
+}
+
+func buildTestBatch(t *testing.T, messages []*arbstate.MessageWithMetadata) []byte {
+	t.Helper()
+	config := TestBatchPosterConfig
+	segments := newBatchSegments(0, &config)
+	for _, msg := range messages {
+		success, err := segments.AddMessage(msg)
+		Require(t, err)
+		if !success {
+			Fail(t, "batch unexpectedly full")
+		}
+	}
+	sequencerMsg, err := segments.CloseAndGetBytes()
+	Require(t, err)
+	return sequencerMsg
+}
+
+// expectBatchMessages checks the messages read from the batch by an
+// InboxMultiplexer, after giving it the header the sequencer inbox would.
+func expectBatchMessages(t *testing.T, sequencerMsg []byte, messages []*arbstate.MessageWithMetadata) {
+	t.Helper()
+	header := make([]byte, 40)
+	binary.BigEndian.PutUint64(header[8:16], math.MaxUint64)
+	binary.BigEndian.PutUint64(header[24:32], math.MaxUint64)
+	backend := &testInboxBackend{batches: [][]byte{append(header, sequencerMsg...)}}
+	multiplexer := arbstate.NewInboxMultiplexer(backend, 0, nil)
+	for i, expected := range messages {
+		msg, err := multiplexer.Pop(context.Background())
+		Require(t, err)
+		header := msg.Message.Header
+		if header.Kind != expected.Message.Header.Kind || !bytes.Equal(msg.Message.L2msg, expected.Message.L2msg) {
+			Fail(t, "message", i, "read from batch doesn't match")
+		}
+		if header.Timestamp != expected.Message.Header.Timestamp || header.BlockNumber != expected.Message.Header.BlockNumber {
+			Fail(t, "message", i, "read from batch has timestamp", header.Timestamp, "and block", header.BlockNumber)
+		}
+	}
+	if backend.batchSeqNum != 1 {
+		Fail(t, "expected the whole batch to be read")
+	}
+}
+
+func TestBatchRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	messages := batchPosterTestMessages(100, random)
+	sequencerMsg := buildTestBatch(t, messages)
+	if sequencerMsg[0] != 0 {
+		Fail(t, "expected batch to have a plain header, got", sequencerMsg[0])
+	}
+	expectBatchMessages(t, sequencerMsg, messages)
+
+	// Only batches stored in the DAS are read zeroheavy encoded
+	encoded, err := io.ReadAll(zeroheavy.NewZeroheavyEncoder(bytes.NewReader(sequencerMsg)))
+	Require(t, err)
+	zeroheavyMsg := append([]byte{arbstate.ZeroheavyMessageHeaderFlag}, encoded...)
+	expectBatchMessages(t, zeroheavyMsg, []*arbstate.MessageWithMetadata{{
+		Message: arbstate.InvalidL1Message,
+	}})
+}
+
+func TestDecodeBatchMatchesInboxMultiplexer(t *testing.T) {
+	ctx := context.Background()
+	random := rand.New(rand.NewSource(1))
+	messages := batchPosterTestMessages(50, random)
+	// Read a delayed message after the first L2 message
+	delayed := &arbstate.MessageWithMetadata{DelayedMessagesRead: 1}
+	withDelayed := append([]*arbstate.MessageWithMetadata{messages[0], delayed}, messages[1:]...)
+	sequencerMsg := buildTestBatch(t, withDelayed)
+
+	header := make([]byte, 40)
+	binary.BigEndian.PutUint64(header[8:16], math.MaxUint64)
+	binary.BigEndian.PutUint64(header[24:32], math.MaxUint64)
+	binary.BigEndian.PutUint64(header[32:40], 3)
+
+	expectDecoded := func(batch *arbstate.DecodedBatch, format string) {
+		t.Helper()
+		if batch.Format != format || len(batch.Messages) != len(withDelayed) {
+			Fail(t, "decoded", format, "batch has format", batch.Format, "and", len(batch.Messages), "messages")
+		}
+		for i, msg := range batch.Messages {
+			expected := withDelayed[i]
+			if expected == delayed {
+				if msg.Kind != arbstate.DecodedMessageKindDelayed || msg.DelayedMessage == nil || *msg.DelayedMessage != 2 {
+					Fail(t, "expected message", i, "to read delayed message 2, got", msg.Kind, msg.DelayedMessage)
+				}
+				continue
+			}
+			if msg.Kind != arbstate.DecodedMessageKindL2 || !bytes.Equal(msg.L2Msg, expected.Message.L2msg) {
+				Fail(t, "decoded message", i, "doesn't match")
+			}
+			if msg.Timestamp != expected.Message.Header.Timestamp || msg.L1BlockNumber != expected.Message.Header.BlockNumber {
+				Fail(t, "decoded message", i, "has timestamp", msg.Timestamp, "and block", msg.L1BlockNumber)
+			}
+		}
+	}
+	decoded, err := arbstate.DecodeBatch(ctx, append(header, sequencerMsg...), nil, 2, nil)
+	Require(t, err)
+	expectDecoded(decoded, "brotli")
+	if decoded.Header.AfterDelayedMessages != 3 || decoded.TrailingDelayedMessages != 0 {
+		Fail(t, "decoded batch header has", decoded.Header.AfterDelayedMessages, "delayed messages, with", decoded.TrailingDelayedMessages, "trailing")
+	}
+
+	decoded, err = arbstate.DecodeBatchData(ctx, sequencerMsg, nil, 2, nil)
+	Require(t, err)
+	expectDecoded(decoded, "brotli")
+
+	// Without enough delayed messages in the header, the delayed message is invalid
+	binary.BigEndian.PutUint64(header[32:40], 2)
+	decoded, err = arbstate.DecodeBatch(ctx, append(header, sequencerMsg...), nil, 2, nil)
+	Require(t, err)
+	if decoded.Messages[1].Kind != arbstate.DecodedMessageKindInvalid {
+		Fail(t, "expected reading past the batch's delayed message count to be invalid, got", decoded.Messages[1].Kind)
+	}
+
+	// A batch which can't be decoded is returned with the error
+	decoded, err = arbstate.DecodeBatchData(ctx, sequencerMsg[:len(sequencerMsg)/2], nil, 0, nil)
+	if err == nil || decoded == nil || decoded.Error == "" {
+		Fail(t, "expected truncated batch to fail decoding, got", err)
+	}
+
+	// As is a batch whose payload zeroheavy decodes to nothing
+	zeroheavyDASHeader := arbstate.DASMessageHeaderFlag | arbstate.ZeroheavyMessageHeaderFlag
+	decoded, err = arbstate.DecodeBatchData(ctx, []byte{zeroheavyDASHeader}, &testDASReader{payload: []byte{0}}, 0, nil)
+	if err == nil || decoded == nil || decoded.Error == "" {
+		Fail(t, "expected batch with an empty payload to fail decoding, got", err)
+	}
+}
+
+func TestBatchCompressedSizeDoesntFlush(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	messages := batchPosterTestMessages(200, random)
+	config := TestBatchPosterConfig
+	segments := newBatchSegments(0, &config)
+	for _, msg := range messages {
+		success, err := segments.AddMessage(msg)
+		Require(t, err)
+		if !success {
+			Fail(t, "batch unexpectedly full")
+		}
+		compressedLen := segments.compressedBuffer.Len()
+		size, err := segments.compressedSize()
+		Require(t, err)
+		if segments.compressedBuffer.Len() != compressedLen {
+			Fail(t, "estimating the compressed size flushed the compressed writer")
+		}
+		if size < compressedLen {
+			Fail(t, "expected compressed size estimate", size, "to include the", compressedLen, "bytes compressed so far")
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// Post the full batch on chain whenever the DAS fails to store it.
+	DASFallbackAlways = "always"
+	// Never post a batch on chain, retry the DAS until it stores the batch.
+	DASFallbackNever = "never"
+	// Retry the DAS, falling back once too many consecutive stores have failed
+	// or the DAS has been failing for too long.
+	DASFallbackThreshold = "threshold"
+)
+
+const (
+	BatchDestinationDAS     = "das"
+	BatchDestinationOnChain = "onchain"
+)
+
+var (
+	dasStoreSuccessCounter = metrics.NewRegisteredCounter("arb/batchposter/das/store/success", nil)
+	dasStoreFailureCounter = metrics.NewRegisteredCounter("arb/batchposter/das/store/failure", nil)
+	dasFallbackCounter     = metrics.NewRegisteredCounter("arb/batchposter/das/fallback", nil)
+	dasFallbackBytesCount  = metrics.NewRegisteredCounter("arb/batchposter/das/fallback/bytes", nil)
+	dasRetryCounter        = metrics.NewRegisteredCounter("arb/batchposter/das/retry", nil)
+)
+
+type DASFallbackConfig struct {
+	Policy                 string        `koanf:"policy"`
+	MaxConsecutiveFailures int           `koanf:"max-consecutive-failures"`
+	FailureWindow          time.Duration `koanf:"failure-window"`
+	RetryDelay             time.Duration `koanf:"retry-delay"`
+	MaxRetryDelay          time.Duration `koanf:"max-retry-delay"`
+	RecordHistory          int           `koanf:"record-history"`
+}
+
+func DASFallbackConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".policy", DefaultDASFallbackConfig.Policy, "when to post batches on chain if the DAS fails to store them, one of \"always\", \"never\" or \"threshold\"")
+	f.Int(prefix+".max-consecutive-failures", DefaultDASFallbackConfig.MaxConsecutiveFailures, "with the threshold policy, fall back after this many consecutive DAS failures (0 = no limit)")
+	f.Duration(prefix+".failure-window", DefaultDASFallbackConfig.FailureWindow, "with the threshold policy, fall back once the DAS has been failing for this long (0 = no limit)")
+	f.Duration(prefix+".retry-delay", DefaultDASFallbackConfig.RetryDelay, "delay before retrying the DAS after its first failure, doubling with each further failure")
+	f.Duration(prefix+".max-retry-delay", DefaultDASFallbackConfig.MaxRetryDelay, "maximum delay before retrying the DAS")
+	f.Int(prefix+".record-history", DefaultDASFallbackConfig.RecordHistory, "number of recent batches to keep a record of where their data was posted")
+}
+
+var DefaultDASFallbackConfig = DASFallbackConfig{
+	Policy:                 DASFallbackAlways,
+	MaxConsecutiveFailures: 3,
+	FailureWindow:          10 * time.Minute,
+	RetryDelay:             10 * time.Second,
+	MaxRetryDelay:          5 * time.Minute,
+	RecordHistory:          1000,
+}
+
+var TestDASFallbackConfig = DASFallbackConfig{
+	Policy:                 DASFallbackAlways,
+	MaxConsecutiveFailures: 3,
+	FailureWindow:          time.Second,
+	RetryDelay:             time.Millisecond * 10,
+	MaxRetryDelay:          time.Millisecond * 100,
+	RecordHistory:          1000,
+}
+
+func (c *DASFallbackConfig) Validate() error {
+	switch c.Policy {
+	case DASFallbackAlways, DASFallbackNever, DASFallbackThreshold:
+	default:
+		return fmt.Errorf("invalid DAS fallback policy \"%s\"", c.Policy)
+	}
+	if c.MaxConsecutiveFailures < 0 || c.RecordHistory < 0 {
+		return fmt.Errorf("invalid DAS fallback config %+v", *c)
+	}
+	return nil
+}
+
+// dasFallbackTracker keeps track of consecutive DAS store failures to decide,
+// according to the configured policy, whether a batch should be posted on chain.
+type dasFallbackTracker struct {
+	config              *DASFallbackConfig
+	consecutiveFailures int
+	firstFailure        time.Time
+}
+
+func (t *dasFallbackTracker) recordSuccess() {
+	dasStoreSuccessCounter.Inc(1)
+	t.consecutiveFailures = 0
+	t.firstFailure = time.Time{}
+}
+
+func (t *dasFallbackTracker) recordFailure(now time.Time) {
+	dasStoreFailureCounter.Inc(1)
+	if t.consecutiveFailures == 0 {
+		t.firstFailure = now
+	}
+	t.consecutiveFailures++
+}
+
+// shouldFallBack returns whether to post on chain after a failure, and why.
+func (t *dasFallbackTracker) shouldFallBack(now time.Time) (bool, string) {
+	switch t.config.Policy {
+	case DASFallbackAlways:
+		return true, "DAS store failed"
+	case DASFallbackThreshold:
+		if t.config.MaxConsecutiveFailures > 0 && t.consecutiveFailures >= t.config.MaxConsecutiveFailures {
+			return true, fmt.Sprintf("DAS store failed %d consecutive times", t.consecutiveFailures)
+		}
+		if t.config.FailureWindow > 0 && now.Sub(t.firstFailure) >= t.config.FailureWindow {
+			return true, fmt.Sprintf("DAS store has been failing for %v", now.Sub(t.firstFailure).Round(time.Second))
+		}
+	}
+	return false, ""
+}
+
+// retryDelay is how long to wait before retrying the DAS, with exponential backoff.
+func (t *dasFallbackTracker) retryDelay() time.Duration {
+	delay := t.config.RetryDelay
+	for i := 1; i < t.consecutiveFailures && delay < t.config.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.config.MaxRetryDelay {
+		delay = t.config.MaxRetryDelay
+	}
+	return delay
+}
+
+// BatchPostingRecord records where the data of a posted batch went.
+type BatchPostingRecord struct {
+	BatchSequenceNumber uint64      `json:"batchSequenceNumber"`
+	Destination         string      `json:"destination"`
+	DataHash            common.Hash `json:"dataHash"`
+	Size                int         `json:"size"`
+	DASFailures         int         `json:"dasFailures"`
+	FallbackReason      string      `json:"fallbackReason,omitempty"`
+	Timestamp           uint64      `json:"timestamp"`
+	TxHash              common.Hash `json:"txHash"`
+}
+
+// batchPostingRecords keeps the records of the most recently posted batches.
+type batchPostingRecords struct {
+	mutex   sync.Mutex
+	limit   int
+	records map[uint64]*BatchPostingRecord
+	order   []uint64
+}
+
+func newBatchPostingRecords(limit int) *batchPostingRecords {
+	return &batchPostingRecords{
+		limit:   limit,
+		records: make(map[uint64]*BatchPostingRecord),
+	}
+}
+
+func (r *batchPostingRecords) add(record *BatchPostingRecord) {
+	if r.limit == 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.records[record.BatchSequenceNumber]; !exists {
+		r.order = append(r.order, record.BatchSequenceNumber)
+	}
+	r.records[record.BatchSequenceNumber] = record
+	for len(r.order) > r.limit {
+		delete(r.records, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *batchPostingRecords) get(batchSeqNum uint64) *BatchPostingRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.records[batchSeqNum]
+}
+
+// recent returns up to count records, most recent first.
+func (r *batchPostingRecords) recent(count int) []*BatchPostingRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var records []*BatchPostingRecord
+	for i := len(r.order) - 1; i >= 0 && len(records) < count; i-- {
+		records = append(records, r.records[r.order[i]])
+	}
+	return records
+}
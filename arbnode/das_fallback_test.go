@@ -0,0 +1,70 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDASFallbackPolicies(t *testing.T) {
+	start := time.Now()
+	for _, tc := range []struct {
+		policy    string
+		failures  int
+		elapsed   time.Duration
+		fallsBack bool
+	}{
+		{DASFallbackAlways, 1, 0, true},
+		{DASFallbackNever, 1, 0, false},
+		{DASFallbackNever, 100, time.Hour, false},
+		{DASFallbackThreshold, 1, 0, false},
+		{DASFallbackThreshold, 3, 0, true},
+		{DASFallbackThreshold, 2, time.Minute, true},
+	} {
+		config := TestDASFallbackConfig
+		config.Policy = tc.policy
+		config.MaxConsecutiveFailures = 3
+		config.FailureWindow = time.Minute
+		tracker := dasFallbackTracker{config: &config}
+		for i := 0; i < tc.failures; i++ {
+			tracker.recordFailure(start)
+		}
+		fallsBack, _ := tracker.shouldFallBack(start.Add(tc.elapsed))
+		if fallsBack != tc.fallsBack {
+			t.Error("policy", tc.policy, "with", tc.failures, "failures over", tc.elapsed, "expected fallback", tc.fallsBack, "got", fallsBack)
+		}
+		tracker.recordSuccess()
+		if fallsBack, _ := tracker.shouldFallBack(start); fallsBack && tc.policy == DASFallbackThreshold {
+			t.Error("threshold policy still falling back after a successful store")
+		}
+	}
+}
+
+func TestDASFallbackRetryDelay(t *testing.T) {
+	config := TestDASFallbackConfig
+	config.RetryDelay = time.Second
+	config.MaxRetryDelay = 5 * time.Second
+	tracker := dasFallbackTracker{config: &config}
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		tracker.recordFailure(time.Now())
+		if delay := tracker.retryDelay(); delay != expected {
+			t.Error("after", tracker.consecutiveFailures, "failures expected retry delay", expected, "got", delay)
+		}
+	}
+}
+
+func TestBatchPostingRecordsLimit(t *testing.T) {
+	records := newBatchPostingRecords(3)
+	for i := uint64(0); i < 5; i++ {
+		records.add(&BatchPostingRecord{BatchSequenceNumber: i, Destination: BatchDestinationDAS})
+	}
+	if records.get(1) != nil || records.get(2) == nil || records.get(4) == nil {
+		t.Error("expected only the 3 most recent records to be kept")
+	}
+	recent := records.recent(10)
+	if len(recent) != 3 || recent[0].BatchSequenceNumber != 4 || recent[2].BatchSequenceNumber != 2 {
+		t.Error("unexpected recent records", recent)
+	}
+}
@@ -0,0 +1,553 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/util/arbmath"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
+)
+
+var (
+	dataPosterQueueGauge          = metrics.NewRegisteredGauge("arb/dataposter/queue", nil)
+	dataPosterReplacementsCounter = metrics.NewRegisteredCounter("arb/dataposter/replacements", nil)
+	dataPosterSendErrorsCounter   = metrics.NewRegisteredCounter("arb/dataposter/send/errors", nil)
+	dataPosterRevertsCounter      = metrics.NewRegisteredCounter("arb/dataposter/reverts", nil)
+	dataPosterReorgsCounter       = metrics.NewRegisteredCounter("arb/dataposter/reorgs", nil)
+)
+
+// Nodes only accept a replacement transaction that raises both its fee cap and
+// its tip cap by at least 10%.
+var replacementFeeBump = arbmath.PercentToBips(110)
+
+var ErrDataPosterQueueFull = errors.New("too many transactions in flight")
+
+type DataPosterConfig struct {
+	ReplacementTimes       string  `koanf:"replacement-times"`
+	MaxMempoolTransactions uint64  `koanf:"max-mempool-transactions"`
+	MinTipCapGwei          float64 `koanf:"min-tip-cap-gwei"`
+	MaxFeeCapGwei          float64 `koanf:"max-fee-cap-gwei"`
+	ConfirmationDepth      uint64  `koanf:"confirmation-depth"`
+}
+
+func DataPosterConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".replacement-times", DefaultDataPosterConfig.ReplacementTimes, "comma-separated list of how long after a transaction was first sent to replace it with higher fees")
+	f.Uint64(prefix+".max-mempool-transactions", DefaultDataPosterConfig.MaxMempoolTransactions, "maximum number of transactions to have in flight at once")
+	f.Float64(prefix+".min-tip-cap-gwei", DefaultDataPosterConfig.MinTipCapGwei, "the minimum tip cap to post transactions at")
+	f.Float64(prefix+".max-fee-cap-gwei", DefaultDataPosterConfig.MaxFeeCapGwei, "the maximum fee cap to post transactions at, however long they've been waiting")
+	f.Uint64(prefix+".confirmation-depth", DefaultDataPosterConfig.ConfirmationDepth, "how many L1 blocks deep a transaction must be before it's forgotten, rather than resent if it's reorged out")
+}
+
+var DefaultDataPosterConfig = DataPosterConfig{
+	ReplacementTimes:       "5m,10m,20m,30m,1h,2h,4h,6h,8h,12h,16h,18h,20h,22h",
+	MaxMempoolTransactions: 10,
+	MinTipCapGwei:          0.05,
+	MaxFeeCapGwei:          500,
+	ConfirmationDepth:      64,
+}
+
+var TestDataPosterConfig = DataPosterConfig{
+	ReplacementTimes:       "1s,2s,5s,10s,20s",
+	MaxMempoolTransactions: 10,
+	MinTipCapGwei:          0.05,
+	MaxFeeCapGwei:          500,
+	ConfirmationDepth:      1,
+}
+
+// ParseReplacementTimes returns the replacement times in increasing order.
+func (c *DataPosterConfig) ParseReplacementTimes() ([]time.Duration, error) {
+	var replacementTimes []time.Duration
+	var lastReplacementTime time.Duration
+	for _, s := range strings.Split(c.ReplacementTimes, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		t, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data poster replacement time \"%v\": %w", s, err)
+		}
+		if t <= lastReplacementTime {
+			return nil, errors.New("data poster replacement times must be positive and increasing")
+		}
+		replacementTimes = append(replacementTimes, t)
+		lastReplacementTime = t
+	}
+	return replacementTimes, nil
+}
+
+func (c *DataPosterConfig) Validate() error {
+	if _, err := c.ParseReplacementTimes(); err != nil {
+		return err
+	}
+	if c.MaxMempoolTransactions == 0 {
+		return errors.New("data poster max-mempool-transactions must be positive")
+	}
+	if c.MinTipCapGwei < 0 || c.MaxFeeCapGwei <= 0 || c.MinTipCapGwei > c.MaxFeeCapGwei {
+		return fmt.Errorf("invalid data poster fee caps: min tip cap %v gwei, max fee cap %v gwei", c.MinTipCapGwei, c.MaxFeeCapGwei)
+	}
+	return nil
+}
+
+func gweiToWei(gwei float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(gwei), big.NewFloat(params.GWei)).Int(nil)
+	return wei
+}
+
+// queuedTransaction is a transaction sent by the data poster that isn't
+// confirmation-depth blocks deep in L1 yet, as stored in the database.
+type queuedTransaction struct {
+	FullTx       *types.Transaction
+	Meta         []byte
+	PrevMeta     []byte // the metadata before the transaction, or nil if it was retrieved from L1
+	Sent         bool
+	Created      uint64        // unix milliseconds
+	Replacements uint64        // how many of the replacement times have passed
+	Replaced     []common.Hash // the transactions FullTx replaced, one of which may be included instead
+	Included     bool          // whether it's been seen in an L1 block, which may yet be reorged out
+	Reverted     bool          // whether it, or a transaction before it, reverted
+}
+
+// DataPoster posts transactions to L1 from a single account, keeping track of
+// its nonce itself so that several transactions can be in flight at once.
+// Transactions are stored in the database until they're confirmation-depth
+// blocks deep, so that they're still replaced and resent after a restart, or
+// if they're reorged out. Transactions which haven't been included are
+// replaced with higher fees on a schedule, up to the configured max fee cap.
+//
+// Each transaction carries metadata, which the poster uses to know where the
+// next transaction should start from. While transactions are queued that's
+// the metadata of the last one; otherwise it's retrieved from L1 using the
+// metadataRetriever, at the same block as the account's nonce. If a
+// transaction reverts, the next one starts from the metadata before it
+// instead, and the transactions queued after it are taken to revert too.
+type DataPoster struct {
+	stopwaiter.StopWaiter
+	headerReader      *L1Reader
+	client            arbutil.L1Interface
+	auth              *bind.TransactOpts
+	db                ethdb.Database
+	config            *DataPosterConfig
+	replacementTimes  []time.Duration
+	metadataRetriever func(ctx context.Context, blockNum *big.Int) ([]byte, error)
+
+	mutex sync.Mutex
+	queue []*queuedTransaction // in nonce order, without gaps
+
+	now func() time.Time
+}
+
+func NewDataPoster(headerReader *L1Reader, auth *bind.TransactOpts, db ethdb.Database, config *DataPosterConfig, metadataRetriever func(ctx context.Context, blockNum *big.Int) ([]byte, error)) (*DataPoster, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	replacementTimes, err := config.ParseReplacementTimes()
+	if err != nil {
+		return nil, err
+	}
+	p := &DataPoster{
+		headerReader:      headerReader,
+		client:            headerReader.Client(),
+		auth:              auth,
+		db:                db,
+		config:            config,
+		replacementTimes:  replacementTimes,
+		metadataRetriever: metadataRetriever,
+		now:               time.Now,
+	}
+	if err := p.loadQueue(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *DataPoster) From() common.Address {
+	return p.auth.From
+}
+
+// loadQueue reads the transactions which were queued when the node was last
+// stopped. If there's a nonce gap between them, those before it are stale, and
+// are dropped.
+func (p *DataPoster) loadQueue() error {
+	iter := p.db.NewIterator(nil, nil)
+	defer iter.Release()
+	var stale []*queuedTransaction
+	for iter.Next() {
+		var tx queuedTransaction
+		if err := rlp.DecodeBytes(iter.Value(), &tx); err != nil {
+			return fmt.Errorf("failed to decode queued data poster transaction: %w", err)
+		}
+		if len(p.queue) > 0 && tx.FullTx.Nonce() != p.queue[len(p.queue)-1].FullTx.Nonce()+1 {
+			log.Warn("DataPoster: dropping stale queued transactions before a nonce gap", "first nonce", p.queue[0].FullTx.Nonce(), "count", len(p.queue), "next nonce", tx.FullTx.Nonce())
+			stale = append(stale, p.queue...)
+			p.queue = nil
+		}
+		p.queue = append(p.queue, &tx)
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	for _, tx := range stale {
+		if err := p.db.Delete(uint64ToBytes(tx.FullTx.Nonce())); err != nil {
+			return err
+		}
+	}
+	if len(p.queue) > 0 {
+		log.Info("DataPoster: restored queued transactions", "first nonce", p.queue[0].FullTx.Nonce(), "count", len(p.queue))
+	}
+	dataPosterQueueGauge.Update(int64(p.pendingCount()))
+	return nil
+}
+
+func (p *DataPoster) saveTx(tx *queuedTransaction) error {
+	value, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return err
+	}
+	return p.db.Put(uint64ToBytes(tx.FullTx.Nonce()), value)
+}
+
+// QueueLength returns the number of transactions in flight, which haven't been
+// seen included in L1 yet.
+func (p *DataPoster) QueueLength() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.pendingCount()
+}
+
+func (p *DataPoster) pendingCount() int {
+	pending := 0
+	for _, tx := range p.queue {
+		if !tx.Included {
+			pending++
+		}
+	}
+	return pending
+}
+
+// queuedMeta returns the metadata the next transaction starts from, according
+// to the queue, or nil if it has to be retrieved from L1.
+func (p *DataPoster) queuedMeta() []byte {
+	if len(p.queue) == 0 {
+		return nil
+	}
+	last := p.queue[len(p.queue)-1]
+	if last.Reverted {
+		return last.PrevMeta
+	}
+	return last.Meta
+}
+
+// GetNextNonceAndMeta returns the nonce the next transaction should be posted
+// with, and the metadata it should start from.
+func (p *DataPoster) GetNextNonceAndMeta(ctx context.Context) (uint64, []byte, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var nonce uint64
+	if len(p.queue) > 0 {
+		last := p.queue[len(p.queue)-1]
+		nonce = last.FullTx.Nonce() + 1
+		if !last.Reverted || last.PrevMeta != nil {
+			return nonce, p.queuedMeta(), nil
+		}
+		// Nothing was queued before the reverted transactions, so start from L1's metadata
+	}
+	header, err := p.headerReader.LastHeader(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(p.queue) == 0 {
+		nonce, err = p.client.NonceAt(ctx, p.auth.From, header.Number)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	meta, err := p.metadataRetriever(ctx, header.Number)
+	if err != nil {
+		return 0, nil, err
+	}
+	return nonce, meta, nil
+}
+
+// getFeeAndTipCaps returns the fee and tip caps to post a transaction at, given
+// the transaction it replaces, if any. The second return value is false if the
+// max fee cap doesn't leave room to raise the replaced transaction's fees.
+func (p *DataPoster) getFeeAndTipCaps(ctx context.Context, replacing *types.Transaction) (*big.Int, *big.Int, bool, error) {
+	header, err := p.headerReader.LastHeader(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if header.BaseFee == nil {
+		return nil, nil, false, errors.New("latest L1 block has no base fee")
+	}
+	tipCap, err := p.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if minTipCap := gweiToWei(p.config.MinTipCapGwei); arbmath.BigLessThan(tipCap, minTipCap) {
+		tipCap = minTipCap
+	}
+	feeCap := arbmath.BigAdd(arbmath.BigMulByUint(header.BaseFee, 2), tipCap)
+
+	var minTipCap, minFeeCap *big.Int
+	if replacing != nil {
+		minTipCap = arbmath.BigMulByBips(replacing.GasTipCap(), replacementFeeBump)
+		minFeeCap = arbmath.BigMulByBips(replacing.GasFeeCap(), replacementFeeBump)
+		if arbmath.BigLessThan(tipCap, minTipCap) {
+			tipCap = minTipCap
+		}
+		if arbmath.BigLessThan(feeCap, minFeeCap) {
+			feeCap = minFeeCap
+		}
+	}
+
+	if maxFeeCap := gweiToWei(p.config.MaxFeeCapGwei); arbmath.BigGreaterThan(feeCap, maxFeeCap) {
+		feeCap = maxFeeCap
+	}
+	if arbmath.BigGreaterThan(tipCap, feeCap) {
+		tipCap = feeCap
+	}
+	if replacing != nil && (arbmath.BigLessThan(tipCap, minTipCap) || arbmath.BigLessThan(feeCap, minFeeCap)) {
+		return feeCap, tipCap, false, nil
+	}
+	return feeCap, tipCap, true, nil
+}
+
+// PostTransaction signs and sends a transaction with the given nonce, which
+// must follow on from the transactions in flight. Once the transaction has been
+// stored it's returned even if sending it failed, as it will be resent.
+func (p *DataPoster) PostTransaction(ctx context.Context, nonce uint64, meta []byte, to common.Address, calldata []byte, gasLimit uint64) (*types.Transaction, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.queue) > 0 {
+		expectedNonce := p.queue[len(p.queue)-1].FullTx.Nonce() + 1
+		if nonce != expectedNonce {
+			return nil, fmt.Errorf("data poster expected nonce %v but got %v", expectedNonce, nonce)
+		}
+	}
+	if uint64(p.pendingCount()) >= p.config.MaxMempoolTransactions {
+		return nil, ErrDataPosterQueueFull
+	}
+	feeCap, tipCap, _, err := p.getFeeAndTipCaps(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	fullTx, err := p.auth.Signer(p.auth.From, types.NewTx(&types.DynamicFeeTx{
+		Nonce:     nonce,
+		GasTipCap: tipCap,
+		GasFeeCap: feeCap,
+		Gas:       gasLimit,
+		To:        &to,
+		Data:      calldata,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	tx := &queuedTransaction{
+		FullTx:   fullTx,
+		Meta:     meta,
+		PrevMeta: p.queuedMeta(),
+		Created:  uint64(p.now().UnixMilli()),
+	}
+	if err := p.saveTx(tx); err != nil {
+		return nil, err
+	}
+	p.queue = append(p.queue, tx)
+	dataPosterQueueGauge.Update(int64(p.pendingCount()))
+	if err := p.sendTx(ctx, tx); err != nil {
+		log.Warn("DataPoster: failed to send transaction, will retry", "nonce", nonce, "tx", fullTx.Hash(), "err", err)
+	}
+	return fullTx, nil
+}
+
+func (p *DataPoster) sendTx(ctx context.Context, tx *queuedTransaction) error {
+	err := p.client.SendTransaction(ctx, tx.FullTx)
+	// The transaction may have been sent before the node was restarted, or
+	// already confirmed
+	if err != nil && !strings.Contains(err.Error(), "already known") && !strings.Contains(err.Error(), "nonce too low") {
+		dataPosterSendErrorsCounter.Inc(1)
+		return err
+	}
+	if !tx.Sent {
+		tx.Sent = true
+		return p.saveTx(tx)
+	}
+	return nil
+}
+
+// replaceTx replaces the transaction with one raising its fees, unless the max
+// fee cap doesn't allow it.
+func (p *DataPoster) replaceTx(ctx context.Context, tx *queuedTransaction) error {
+	tx.Replacements++
+	feeCap, tipCap, canBump, err := p.getFeeAndTipCaps(ctx, tx.FullTx)
+	if err != nil {
+		return err
+	}
+	if !canBump {
+		log.Warn("DataPoster: can't raise fees of transaction in flight past the max fee cap", "nonce", tx.FullTx.Nonce(), "tx", tx.FullTx.Hash(), "feeCap", tx.FullTx.GasFeeCap(), "tipCap", tx.FullTx.GasTipCap())
+		return p.saveTx(tx)
+	}
+	newTx, err := p.auth.Signer(p.auth.From, types.NewTx(&types.DynamicFeeTx{
+		Nonce:      tx.FullTx.Nonce(),
+		GasTipCap:  tipCap,
+		GasFeeCap:  feeCap,
+		Gas:        tx.FullTx.Gas(),
+		To:         tx.FullTx.To(),
+		Value:      tx.FullTx.Value(),
+		Data:       tx.FullTx.Data(),
+		AccessList: tx.FullTx.AccessList(),
+	}))
+	if err != nil {
+		return err
+	}
+	log.Info("DataPoster: replacing transaction with higher fees", "nonce", newTx.Nonce(), "old", tx.FullTx.Hash(), "new", newTx.Hash(), "feeCap", feeCap, "tipCap", tipCap)
+	tx.Replaced = append(tx.Replaced, tx.FullTx.Hash())
+	tx.FullTx = newTx
+	tx.Sent = false
+	dataPosterReplacementsCounter.Inc(1)
+	return p.saveTx(tx)
+}
+
+// checkIncluded looks up the receipt of a transaction seen included in L1, or of
+// the transaction it replaced which was included instead. If it reverted, it
+// and the transactions queued after it, which start from its metadata, are
+// marked as reverted, so that the next transaction starts from the metadata
+// before it.
+func (p *DataPoster) checkIncluded(ctx context.Context, index int) error {
+	tx := p.queue[index]
+	var receipt *types.Receipt
+	for _, hash := range append([]common.Hash{tx.FullTx.Hash()}, tx.Replaced...) {
+		var err error
+		receipt, err = p.client.TransactionReceipt(ctx, hash)
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+	if receipt == nil {
+		// The L1 node hasn't indexed it yet, so it's checked again next time
+		return nil
+	}
+	tx.Included = true
+	if receipt.Status != types.ReceiptStatusSuccessful && !tx.Reverted {
+		log.Error("DataPoster: transaction reverted, posting again from before it", "nonce", tx.FullTx.Nonce(), "tx", receipt.TxHash, "block", receipt.BlockNumber, "following", len(p.queue)-index-1)
+		dataPosterRevertsCounter.Inc(1)
+		for _, following := range p.queue[index+1:] {
+			following.Reverted = true
+			following.PrevMeta = tx.PrevMeta
+			if err := p.saveTx(following); err != nil {
+				return err
+			}
+		}
+		tx.Reverted = true
+	}
+	return p.saveTx(tx)
+}
+
+// update checks the transactions included as of the header, resending those
+// reorged out, forgets those confirmation-depth blocks deep, and replaces or
+// resends the rest as needed.
+func (p *DataPoster) update(ctx context.Context, header *types.Header) error {
+	includedNonce, err := p.client.NonceAt(ctx, p.auth.From, header.Number)
+	if err != nil {
+		return err
+	}
+	var confirmedNonce uint64
+	if header.Number.Uint64() >= p.config.ConfirmationDepth {
+		confirmedBlock := new(big.Int).SetUint64(header.Number.Uint64() - p.config.ConfirmationDepth)
+		confirmedNonce, err = p.client.NonceAt(ctx, p.auth.From, confirmedBlock)
+		if err != nil {
+			return err
+		}
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i, tx := range p.queue {
+		if tx.FullTx.Nonce() < includedNonce {
+			if !tx.Included {
+				if err := p.checkIncluded(ctx, i); err != nil {
+					return err
+				}
+			}
+		} else if tx.Included {
+			log.Warn("DataPoster: transaction reorged out of L1, resending it", "nonce", tx.FullTx.Nonce(), "tx", tx.FullTx.Hash())
+			dataPosterReorgsCounter.Inc(1)
+			tx.Included = false
+			tx.Sent = false
+			if err := p.saveTx(tx); err != nil {
+				return err
+			}
+		}
+	}
+	for len(p.queue) > 0 && p.queue[0].Included && p.queue[0].FullTx.Nonce() < confirmedNonce {
+		if err := p.db.Delete(uint64ToBytes(p.queue[0].FullTx.Nonce())); err != nil {
+			return err
+		}
+		p.queue = p.queue[1:]
+	}
+	dataPosterQueueGauge.Update(int64(p.pendingCount()))
+	now := p.now()
+	for _, tx := range p.queue {
+		if tx.Included {
+			continue
+		}
+		created := time.UnixMilli(int64(tx.Created))
+		if tx.Replacements < uint64(len(p.replacementTimes)) && !now.Before(created.Add(p.replacementTimes[tx.Replacements])) {
+			if err := p.replaceTx(ctx, tx); err != nil {
+				return err
+			}
+		}
+		if !tx.Sent {
+			if err := p.sendTx(ctx, tx); err != nil {
+				log.Warn("DataPoster: failed to send transaction, will retry", "nonce", tx.FullTx.Nonce(), "tx", tx.FullTx.Hash(), "err", err)
+				// Later nonces can't be confirmed before this one
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (p *DataPoster) Start(ctxIn context.Context) {
+	p.StopWaiter.Start(ctxIn)
+	p.LaunchThread(func(ctx context.Context) {
+		headerChan, unsubscribe := p.headerReader.Subscribe(false)
+		defer unsubscribe()
+		for {
+			select {
+			case header, ok := <-headerChan:
+				if !ok {
+					return
+				}
+				if err := p.update(ctx, header); err != nil {
+					log.Error("DataPoster: error updating transactions in flight", "err", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
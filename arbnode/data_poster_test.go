@@ -0,0 +1,291 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/offchainlabs/nitro/arbutil"
+)
+
+// testDataPosterClient is an L1 client which includes transactions up to the
+// nonce it's given, and as of blocks before its header, up to confirmedNonce.
+type testDataPosterClient struct {
+	arbutil.L1Interface
+	mutex          sync.Mutex
+	header         *types.Header
+	nonce          uint64
+	confirmedNonce uint64
+	reverted       map[common.Hash]bool
+	sent           []*types.Transaction
+	sendErr        error
+}
+
+func (c *testDataPosterClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.header, nil
+}
+
+func (c *testDataPosterClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if blockNumber.Cmp(c.header.Number) < 0 {
+		return c.confirmedNonce, nil
+	}
+	return c.nonce, nil
+}
+
+func (c *testDataPosterClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	status := types.ReceiptStatusSuccessful
+	if c.reverted[txHash] {
+		status = types.ReceiptStatusFailed
+	}
+	return &types.Receipt{TxHash: txHash, Status: status, BlockNumber: c.header.Number}, nil
+}
+
+func (c *testDataPosterClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(params.GWei / 10), nil
+}
+
+func (c *testDataPosterClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.sendErr != nil {
+		return c.sendErr
+	}
+	c.sent = append(c.sent, tx)
+	return nil
+}
+
+func (c *testDataPosterClient) takeSent() []*types.Transaction {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	sent := c.sent
+	c.sent = nil
+	return sent
+}
+
+func newTestDataPoster(t *testing.T, client *testDataPosterClient, auth *bind.TransactOpts, db ethdb.Database, config *DataPosterConfig, now *time.Time) *DataPoster {
+	t.Helper()
+	metadataRetriever := func(ctx context.Context, blockNum *big.Int) ([]byte, error) {
+		return []byte("confirmed"), nil
+	}
+	p, err := NewDataPoster(NewL1Reader(client, TestL1ReaderConfig), auth, db, config, metadataRetriever)
+	Require(t, err)
+	p.now = func() time.Time { return *now }
+	return p
+}
+
+func expectNextNonceAndMeta(t *testing.T, p *DataPoster, nonce uint64, meta string) {
+	t.Helper()
+	nextNonce, nextMeta, err := p.GetNextNonceAndMeta(context.Background())
+	Require(t, err)
+	if nextNonce != nonce || string(nextMeta) != meta {
+		Fail(t, "expected next nonce", nonce, "and meta", meta, "got", nextNonce, "and", string(nextMeta))
+	}
+}
+
+func TestDataPosterPipelinesAndReplaces(t *testing.T) {
+	ctx := context.Background()
+	chainId := big.NewInt(1337)
+	key, err := crypto.GenerateKey()
+	Require(t, err)
+	auth, err := bind.NewKeyedTransactorWithChainID(key, chainId)
+	Require(t, err)
+	signer := types.LatestSignerForChainID(chainId)
+	header := &types.Header{Number: big.NewInt(100), BaseFee: big.NewInt(params.GWei)}
+	client := &testDataPosterClient{header: header, nonce: 5}
+	db := rawdb.NewMemoryDatabase()
+	config := TestDataPosterConfig
+	config.ReplacementTimes = "1m,2m"
+	config.MaxMempoolTransactions = 3
+	// Included transactions are forgotten straight away
+	config.ConfirmationDepth = 0
+	// Only leaves room for one replacement of a transaction posted at 2.1 gwei
+	config.MaxFeeCapGwei = 2.4
+	now := time.Now()
+
+	p := newTestDataPoster(t, client, auth, db, &config, &now)
+	expectNextNonceAndMeta(t, p, 5, "confirmed")
+	to := common.HexToAddress("0x1234")
+	for i, meta := range []string{"a", "b", "c"} {
+		if i == 1 {
+			client.sendErr = errors.New("L1 unavailable")
+		}
+		tx, err := p.PostTransaction(ctx, uint64(5+i), []byte(meta), to, []byte{byte(i)}, 100000)
+		Require(t, err)
+		client.sendErr = nil
+		if tx.Nonce() != uint64(5+i) || tx.GasFeeCap().Cmp(big.NewInt(2.1*params.GWei)) != 0 {
+			Fail(t, "posted tx has nonce", tx.Nonce(), "and fee cap", tx.GasFeeCap())
+		}
+		sender, err := types.Sender(signer, tx)
+		Require(t, err)
+		if sender != auth.From {
+			Fail(t, "posted tx was signed by", sender)
+		}
+	}
+	expectNextNonceAndMeta(t, p, 8, "c")
+	if _, err := p.PostTransaction(ctx, 8, []byte("d"), to, nil, 100000); !errors.Is(err, ErrDataPosterQueueFull) {
+		Fail(t, "expected too many transactions in flight, got", err)
+	}
+	if sent := client.takeSent(); len(sent) != 2 || sent[0].Nonce() != 5 || sent[1].Nonce() != 7 {
+		Fail(t, "expected the txs which could be sent to have been sent, got", sent)
+	}
+
+	// After a restart, the tx which failed to send is sent once an L1 block
+	// confirms the first
+	p = newTestDataPoster(t, client, auth, db, &config, &now)
+	expectNextNonceAndMeta(t, p, 8, "c")
+	if _, err := p.PostTransaction(ctx, 9, nil, to, nil, 100000); err == nil {
+		Fail(t, "expected a tx leaving a nonce gap to be rejected")
+	}
+	client.nonce = 6
+	Require(t, p.update(ctx, header))
+	if p.QueueLength() != 2 {
+		Fail(t, "expected the confirmed tx to be removed from the queue, got", p.QueueLength(), "in flight")
+	}
+	originalTxs := make(map[uint64]*types.Transaction)
+	for _, tx := range p.queue {
+		originalTxs[tx.FullTx.Nonce()] = tx.FullTx
+	}
+	if sent := client.takeSent(); len(sent) != 1 || sent[0].Nonce() != 6 {
+		Fail(t, "expected the tx which failed to send to be resent, got", sent)
+	}
+
+	// The txs in flight are replaced with higher fees once they've been waiting
+	now = now.Add(time.Minute)
+	Require(t, p.update(ctx, header))
+	sent := client.takeSent()
+	if len(sent) != 2 {
+		Fail(t, "expected the txs in flight to be replaced, got", sent)
+	}
+	for _, tx := range sent {
+		original := originalTxs[tx.Nonce()]
+		if tx.Hash() == original.Hash() || tx.GasFeeCap().Cmp(big.NewInt(2.31*params.GWei)) != 0 || tx.GasTipCap().Cmp(big.NewInt(0.11*params.GWei)) != 0 {
+			Fail(t, "expected tx", tx.Nonce(), "to be replaced with 10% higher fees, got fee cap", tx.GasFeeCap(), "and tip cap", tx.GasTipCap())
+		}
+		if tx.Gas() != original.Gas() || string(tx.Data()) != string(original.Data()) || *tx.To() != to {
+			Fail(t, "expected replacement of tx", tx.Nonce(), "to keep its gas limit, calldata and destination")
+		}
+	}
+
+	// but not past the max fee cap
+	now = now.Add(time.Minute)
+	Require(t, p.update(ctx, header))
+	if sent := client.takeSent(); len(sent) != 0 {
+		Fail(t, "expected txs not to be replaced past the max fee cap, got", sent)
+	}
+
+	// Replacements are stored, so they're what's resent after a restart
+	p = newTestDataPoster(t, client, auth, db, &config, &now)
+	for i, tx := range p.queue {
+		if tx.FullTx.Hash() != sent[i].Hash() || !tx.Sent || tx.Replacements != 2 {
+			Fail(t, "expected stored tx", tx.FullTx.Nonce(), "to be the replacement")
+		}
+	}
+	expectNextNonceAndMeta(t, p, 8, "c")
+
+	client.nonce = 8
+	Require(t, p.update(ctx, header))
+	if p.QueueLength() != 0 {
+		Fail(t, "expected all txs to be confirmed, got", p.QueueLength(), "in flight")
+	}
+	expectNextNonceAndMeta(t, p, 8, "confirmed")
+	p = newTestDataPoster(t, client, auth, db, &config, &now)
+	if p.QueueLength() != 0 {
+		Fail(t, "expected confirmed txs to be removed from the database")
+	}
+}
+
+func TestDataPosterReorgsAndReverts(t *testing.T) {
+	ctx := context.Background()
+	chainId := big.NewInt(1337)
+	key, err := crypto.GenerateKey()
+	Require(t, err)
+	auth, err := bind.NewKeyedTransactorWithChainID(key, chainId)
+	Require(t, err)
+	header := &types.Header{Number: big.NewInt(100), BaseFee: big.NewInt(params.GWei)}
+	client := &testDataPosterClient{header: header, nonce: 5, confirmedNonce: 5, reverted: make(map[common.Hash]bool)}
+	db := rawdb.NewMemoryDatabase()
+	config := TestDataPosterConfig
+	config.ConfirmationDepth = 10
+	now := time.Now()
+
+	p := newTestDataPoster(t, client, auth, db, &config, &now)
+	to := common.HexToAddress("0x1234")
+	var txs []*types.Transaction
+	for i, meta := range []string{"a", "b", "c"} {
+		tx, err := p.PostTransaction(ctx, uint64(5+i), []byte(meta), to, nil, 100000)
+		Require(t, err)
+		txs = append(txs, tx)
+	}
+	client.takeSent()
+
+	// Included txs are kept until they're confirmed, but no longer in flight
+	client.nonce = 7
+	Require(t, p.update(ctx, header))
+	if p.QueueLength() != 1 || len(p.queue) != 3 {
+		Fail(t, "expected 1 of 3 queued txs to be in flight, got", p.QueueLength(), "of", len(p.queue))
+	}
+
+	// so they're resent if they're reorged out
+	client.nonce = 6
+	Require(t, p.update(ctx, header))
+	if sent := client.takeSent(); len(sent) != 1 || sent[0].Hash() != txs[1].Hash() {
+		Fail(t, "expected the tx reorged out to be resent, got", sent)
+	}
+	if p.QueueLength() != 2 {
+		Fail(t, "expected 2 txs in flight after the reorg, got", p.QueueLength())
+	}
+
+	// If a tx reverts, the next one starts from the metadata before it
+	client.reverted[txs[1].Hash()] = true
+	client.nonce = 8
+	Require(t, p.update(ctx, header))
+	expectNextNonceAndMeta(t, p, 8, "a")
+	_, err = p.PostTransaction(ctx, 8, []byte("b2"), to, nil, 100000)
+	Require(t, err)
+	expectNextNonceAndMeta(t, p, 9, "b2")
+
+	// Txs are forgotten once they're confirmed, as they are after a restart
+	client.confirmedNonce = 8
+	Require(t, p.update(ctx, header))
+	if p.QueueLength() != 1 || len(p.queue) != 1 {
+		Fail(t, "expected only the tx in flight to be queued, got", len(p.queue))
+	}
+	p = newTestDataPoster(t, client, auth, db, &config, &now)
+	if len(p.queue) != 1 || p.queue[0].FullTx.Nonce() != 8 {
+		Fail(t, "expected only the tx in flight to be stored")
+	}
+
+	// Stale txs before a nonce gap are dropped when they're loaded
+	_, err = p.PostTransaction(ctx, 9, []byte("c2"), to, nil, 100000)
+	Require(t, err)
+	_, err = p.PostTransaction(ctx, 10, []byte("d2"), to, nil, 100000)
+	Require(t, err)
+	Require(t, db.Delete(uint64ToBytes(9)))
+	p = newTestDataPoster(t, client, auth, db, &config, &now)
+	if len(p.queue) != 1 || p.queue[0].FullTx.Nonce() != 10 {
+		Fail(t, "expected the txs before the nonce gap to be dropped, got", len(p.queue), "queued")
+	}
+	expectNextNonceAndMeta(t, p, 11, "d2")
+	if has, err := db.Has(uint64ToBytes(8)); err != nil || has {
+		Fail(t, "expected the stale tx to be removed from the database")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// The batch is full or the max posting interval has passed.
+	PostingReasonDue = "due"
+	// L1 is cheap and the batch has enough data to amortize its fixed cost.
+	PostingReasonCheap = "cheap"
+	// Posting was delayed by a base fee spike for the max delay.
+	PostingReasonMaxDelay = "max-delay"
+)
+
+var (
+	l1CostBaseFeeGauge        = metrics.NewRegisteredGauge("arb/batchposter/l1cost/basefee", nil)
+	l1CostAverageBaseFeeGauge = metrics.NewRegisteredGauge("arb/batchposter/l1cost/basefee/average", nil)
+	l1CostDelayGauge          = metrics.NewRegisteredGauge("arb/batchposter/l1cost/delay", nil)
+	l1CostDelayedCounter      = metrics.NewRegisteredCounter("arb/batchposter/l1cost/delayed", nil)
+	l1CostPostedCounters      = map[string]metrics.Counter{
+		PostingReasonDue:      metrics.NewRegisteredCounter("arb/batchposter/l1cost/posted/due", nil),
+		PostingReasonCheap:    metrics.NewRegisteredCounter("arb/batchposter/l1cost/posted/cheap", nil),
+		PostingReasonMaxDelay: metrics.NewRegisteredCounter("arb/batchposter/l1cost/posted/maxdelay", nil),
+	}
+)
+
+type L1CostConfig struct {
+	Enable           bool          `koanf:"enable"`
+	AverageBlocks    uint64        `koanf:"average-blocks"`
+	SpikeRatio       float64       `koanf:"spike-ratio"`
+	MaxDelay         time.Duration `koanf:"max-delay"`
+	CheapRatio       float64       `koanf:"cheap-ratio"`
+	CheapMaxOverhead float64       `koanf:"cheap-max-overhead"`
+}
+
+func L1CostConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultL1CostConfig.Enable, "decide when to post batches based on the L1 base fee, as well as their size and the max interval")
+	f.Uint64(prefix+".average-blocks", DefaultL1CostConfig.AverageBlocks, "number of L1 blocks the base fee is averaged over")
+	f.Float64(prefix+".spike-ratio", DefaultL1CostConfig.SpikeRatio, "delay posting batches while the L1 base fee is at least this many times its average")
+	f.Duration(prefix+".max-delay", DefaultL1CostConfig.MaxDelay, "maximum time to delay posting a batch which is due while the L1 base fee is spiking")
+	f.Float64(prefix+".cheap-ratio", DefaultL1CostConfig.CheapRatio, "post batches early while the L1 base fee is at most this many times its average")
+	f.Float64(prefix+".cheap-max-overhead", DefaultL1CostConfig.CheapMaxOverhead, "only post a batch early once the gas it uses other than for its data is at most this fraction of its total gas")
+}
+
+var DefaultL1CostConfig = L1CostConfig{
+	Enable:           false,
+	AverageBlocks:    300,
+	SpikeRatio:       1.5,
+	MaxDelay:         time.Hour,
+	CheapRatio:       0.8,
+	CheapMaxOverhead: 0.25,
+}
+
+var TestL1CostConfig = L1CostConfig{
+	Enable:           false,
+	AverageBlocks:    10,
+	SpikeRatio:       1.5,
+	MaxDelay:         time.Second,
+	CheapRatio:       0.8,
+	CheapMaxOverhead: 0.25,
+}
+
+func (c *L1CostConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+	if c.AverageBlocks == 0 || c.SpikeRatio <= 1 || c.CheapRatio <= 0 || c.CheapRatio > c.SpikeRatio || c.CheapMaxOverhead <= 0 || c.CheapMaxOverhead > 1 || c.MaxDelay < 0 {
+		return fmt.Errorf("invalid batch poster L1 cost config %+v", *c)
+	}
+	return nil
+}
+
+// l1CostTracker follows the L1 base fee, to decide whether a batch should be
+// posted now or when fees are more favorable.
+type l1CostTracker struct {
+	config *L1CostConfig
+
+	mutex          sync.Mutex
+	lastBlock      uint64
+	baseFee        float64
+	averageBaseFee float64
+	delayedSince   time.Time
+}
+
+// observe adds the base fee of a new L1 block to the average.
+func (t *l1CostTracker) observe(header *types.Header) {
+	if header.BaseFee == nil || !header.Number.IsUint64() {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	blockNum := header.Number.Uint64()
+	if t.averageBaseFee != 0 && blockNum <= t.lastBlock {
+		return
+	}
+	baseFee, _ := new(big.Float).SetInt(header.BaseFee).Float64()
+	if t.averageBaseFee == 0 {
+		t.averageBaseFee = baseFee
+	} else {
+		// An exponential moving average, weighting each block as a simple
+		// moving average over AverageBlocks would
+		weight := 2 / (float64(t.config.AverageBlocks) + 1)
+		t.averageBaseFee += weight * (baseFee - t.averageBaseFee)
+	}
+	t.baseFee = baseFee
+	t.lastBlock = blockNum
+	l1CostBaseFeeGauge.Update(int64(t.baseFee))
+	l1CostAverageBaseFeeGauge.Update(int64(t.averageBaseFee))
+}
+
+// decide returns whether to post the batch being built now, and why. A batch
+// which is due is delayed while the base fee is spiking, for up to the max
+// delay, and one which isn't is posted early while the base fee is low if the
+// gas it uses other than for its data is a small enough share of its total.
+// Its size is only worked out when that's needed.
+func (t *l1CostTracker) decide(now time.Time, due bool, size func() (int, error), fixedGas uint64) (bool, string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.averageBaseFee == 0 {
+		// No L1 blocks have been seen yet
+		return due, PostingReasonDue, nil
+	}
+	log.Debug("BatchPoster: deciding whether to post batch", "due", due, "baseFee", t.baseFee, "averageBaseFee", t.averageBaseFee, "delayedSince", t.delayedSince)
+	if due {
+		if t.baseFee < t.averageBaseFee*t.config.SpikeRatio {
+			return true, PostingReasonDue, nil
+		}
+		if t.delayedSince.IsZero() {
+			t.delayedSince = now
+			l1CostDelayedCounter.Inc(1)
+			log.Info("BatchPoster: delaying batch while the L1 base fee is spiking", "baseFee", t.baseFee, "averageBaseFee", t.averageBaseFee, "spikeRatio", t.config.SpikeRatio, "maxDelay", t.config.MaxDelay)
+		}
+		delay := now.Sub(t.delayedSince)
+		l1CostDelayGauge.Update(delay.Milliseconds())
+		if delay >= t.config.MaxDelay {
+			log.Warn("BatchPoster: posting batch despite the L1 base fee spiking, as it's been delayed for the max delay", "baseFee", t.baseFee, "averageBaseFee", t.averageBaseFee, "delay", delay)
+			return true, PostingReasonMaxDelay, nil
+		}
+		return false, "", nil
+	}
+	if t.baseFee > t.averageBaseFee*t.config.CheapRatio {
+		return false, "", nil
+	}
+	batchSize, err := size()
+	if err != nil || batchSize == 0 {
+		return false, "", err
+	}
+	dataGas := uint64(batchSize) * params.TxDataNonZeroGasEIP2028
+	overhead := float64(fixedGas) / float64(fixedGas+dataGas)
+	if overhead > t.config.CheapMaxOverhead {
+		return false, "", nil
+	}
+	log.Info("BatchPoster: posting batch early while the L1 base fee is low", "baseFee", t.baseFee, "averageBaseFee", t.averageBaseFee, "size", batchSize, "overhead", overhead)
+	return true, PostingReasonCheap, nil
+}
+
+// posted records that a batch was posted for the given reason.
+func (t *l1CostTracker) posted(reason string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.delayedSince = time.Time{}
+	l1CostDelayGauge.Update(0)
+	if counter, ok := l1CostPostedCounters[reason]; ok {
+		counter.Inc(1)
+	}
+}
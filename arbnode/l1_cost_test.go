@@ -0,0 +1,71 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestL1CostPostingDecisions(t *testing.T) {
+	config := TestL1CostConfig
+	config.Enable = true
+	tracker := &l1CostTracker{config: &config}
+	fixedGas := params.TxGas + defaultBatchExecutionGas
+	sizeOf := func(size int) func() (int, error) {
+		return func() (int, error) { return size, nil }
+	}
+	unexpectedSize := func() (int, error) {
+		t.Fatal("batch size worked out when it wasn't needed")
+		return 0, nil
+	}
+	expectDecision := func(now time.Time, due bool, size func() (int, error), post bool, reason string) {
+		t.Helper()
+		decidedPost, decidedReason, err := tracker.decide(now, due, size, fixedGas)
+		Require(t, err)
+		if decidedPost != post || (post && decidedReason != reason) {
+			Fail(t, "expected post", post, "for reason", reason, "got", decidedPost, decidedReason)
+		}
+	}
+	block := int64(0)
+	observe := func(baseFeeGwei int64) {
+		block++
+		tracker.observe(&types.Header{Number: big.NewInt(block), BaseFee: big.NewInt(baseFeeGwei * params.GWei)})
+	}
+
+	// Without any L1 blocks, batches are posted when due
+	start := time.Now()
+	expectDecision(start, true, unexpectedSize, true, PostingReasonDue)
+	expectDecision(start, false, unexpectedSize, false, "")
+
+	for i := 0; i < 20; i++ {
+		observe(10)
+	}
+	expectDecision(start, true, unexpectedSize, true, PostingReasonDue)
+	expectDecision(start, false, unexpectedSize, false, "")
+
+	// A spike delays a batch which is due, up to the max delay
+	observe(20)
+	tracker.observe(&types.Header{Number: big.NewInt(block), BaseFee: big.NewInt(params.GWei)})
+	expectDecision(start, true, unexpectedSize, false, "")
+	expectDecision(start.Add(config.MaxDelay/2), true, unexpectedSize, false, "")
+	expectDecision(start.Add(config.MaxDelay), true, unexpectedSize, true, PostingReasonMaxDelay)
+	tracker.posted(PostingReasonMaxDelay)
+	later := start.Add(2 * config.MaxDelay)
+	expectDecision(later, true, unexpectedSize, false, "")
+	observe(10)
+	expectDecision(later, true, unexpectedSize, true, PostingReasonDue)
+	tracker.posted(PostingReasonDue)
+
+	// Low fees post a batch early, once it has enough data to amortize its
+	// fixed cost
+	observe(5)
+	expectDecision(later, false, sizeOf(0), false, "")
+	expectDecision(later, false, sizeOf(1000), false, "")
+	expectDecision(later, false, sizeOf(50000), true, PostingReasonCheap)
+}
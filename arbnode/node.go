@@ -489,6 +489,7 @@ type SequencerConfig struct {
 	MaxBlockSpeed               time.Duration            `koanf:"max-block-speed"`
 	MaxRevertGasReject          uint64                   `koanf:"max-revert-gas-reject"`
 	MaxAcceptableTimestampDelta time.Duration            `koanf:"max-acceptable-timestamp-delta"`
+	TxPool                      SequencerTxPoolConfig    `koanf:"txpool"`
 	Dangerous                   DangerousSequencerConfig `koanf:"dangerous"`
 }
 
@@ -497,6 +498,7 @@ var DefaultSequencerConfig = SequencerConfig{
 	MaxBlockSpeed:               time.Millisecond * 100,
 	MaxRevertGasReject:          params.TxGas + 10000,
 	MaxAcceptableTimestampDelta: time.Hour,
+	TxPool:                      DefaultSequencerTxPoolConfig,
 	Dangerous:                   DefaultDangerousSequencerConfig,
 }
 
@@ -505,6 +507,7 @@ var TestSequencerConfig = SequencerConfig{
 	MaxBlockSpeed:               time.Millisecond * 10,
 	MaxRevertGasReject:          params.TxGas + 10000,
 	MaxAcceptableTimestampDelta: time.Hour,
+	TxPool:                      TestSequencerTxPoolConfig,
 	Dangerous:                   TestDangerousSequencerConfig,
 }
 
@@ -513,6 +516,7 @@ func SequencerConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Duration(prefix+".max-block-speed", DefaultSequencerConfig.MaxBlockSpeed, "minimum delay between blocks (sets a maximum speed of block production)")
 	f.Uint64(prefix+".max-revert-gas-reject", DefaultSequencerConfig.MaxRevertGasReject, "maximum gas executed in a revert for the sequencer to reject the transaction instead of posting it (anti-DOS)")
 	f.Duration(prefix+".max-acceptable-timestamp-delta", DefaultSequencerConfig.MaxAcceptableTimestampDelta, "maximum acceptable time difference between the local time and the latest L1 block's timestamp")
+	SequencerTxPoolConfigAddOptions(prefix+".txpool", f)
 	DangerousSequencerConfigAddOptions(prefix+".dangerous", f)
 }
 
@@ -529,27 +533,33 @@ var DefaultWasmConfig = WasmConfig{
 }
 
 type Node struct {
-	Backend          *arbitrum.Backend
-	ArbInterface     *ArbInterface
-	L1Reader         *L1Reader
-	TxStreamer       *TransactionStreamer
-	TxPublisher      TransactionPublisher
-	DeployInfo       *RollupAddresses
-	InboxReader      *InboxReader
-	InboxTracker     *InboxTracker
-	DelayedSequencer *DelayedSequencer
-	BatchPoster      *BatchPoster
-	BlockValidator   *validator.BlockValidator
-	Staker           *validator.Staker
-	BroadcastServer  *broadcaster.Broadcaster
-	BroadcastClients []*broadcastclient.BroadcastClient
-	SeqCoordinator   *SeqCoordinator
+	Backend             *arbitrum.Backend
+	ArbInterface        *ArbInterface
+	L1Reader            *L1Reader
+	TxStreamer          *TransactionStreamer
+	TxPublisher         TransactionPublisher
+	DeployInfo          *RollupAddresses
+	InboxReader         *InboxReader
+	InboxTracker        *InboxTracker
+	DelayedSequencer    *DelayedSequencer
+	BatchPoster         *BatchPoster
+	BlockValidator      *validator.BlockValidator
+	Staker              *validator.Staker
+	BroadcastServer     *broadcaster.Broadcaster
+	BroadcastClients    []*broadcastclient.BroadcastClient
+	SeqCoordinator      *SeqCoordinator
+	DASLifecycleManager *das.LifecycleManager
+	DASAggregator       *das.Aggregator
 }
 
 func createNodeImpl(stack *node.Node, chainDb ethdb.Database, config *Config, l2BlockChain *core.BlockChain, l1client arbutil.L1Interface, deployInfo *RollupAddresses, txOpts *bind.TransactOpts) (*Node, error) {
 	var broadcastServer *broadcaster.Broadcaster
 	if config.Feed.Output.Enable {
-		broadcastServer = broadcaster.NewBroadcaster(config.Feed.Output)
+		var err error
+		broadcastServer, err = broadcaster.NewBroadcaster(config.Feed.Output)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	dataAvailabilityMode, err := config.DataAvailability.Mode()
@@ -557,20 +567,43 @@ func createNodeImpl(stack *node.Node, chainDb ethdb.Database, config *Config, l2
 		return nil, err
 	}
 	var dataAvailabilityService das.DataAvailabilityService
+	var dasAggregator *das.Aggregator
+	dasLifecycleManager := &das.LifecycleManager{}
 	switch dataAvailabilityMode {
 	case das.LocalDataAvailability:
-		var err error
-		dataAvailabilityService, err = das.NewLocalDiskDAS(config.DataAvailability.LocalDiskDASConfig)
+		localDiskDAS, err := das.NewLocalDiskDAS(config.DataAvailability.LocalDiskDASConfig)
+		if err != nil {
+			return nil, err
+		}
+		dasLifecycleManager.Register(localDiskDAS)
+		dataAvailabilityService = localDiskDAS
+	case das.LocalDBDataAvailability:
+		localDBDAS, err := das.NewLocalDBDAS(config.DataAvailability.LocalDBDASConfig)
 		if err != nil {
 			return nil, err
 		}
+		dasLifecycleManager.Register(localDBDAS)
+		dataAvailabilityService = localDBDAS
 	case das.AggregatorDataAvailability:
-		dataAvailabilityService, err = dasrpc.NewRPCAggregator(config.DataAvailability.AggregatorConfig)
+		dasAggregator, err = dasrpc.NewRPCAggregator(config.DataAvailability.AggregatorConfig)
+		if err != nil {
+			return nil, err
+		}
+		dasLifecycleManager.Register(dasAggregator)
+		dataAvailabilityService = dasAggregator
+	case das.RestfulDataAvailability:
+		if config.BatchPoster.Enable {
+			return nil, errors.New("batch poster requires a data availability mode that can store, rest mirrors are read-only")
+		}
+		dataAvailabilityService, err = das.NewRestfulClientAggregator(config.DataAvailability.RestfulClientAggregatorConfig)
 		if err != nil {
 			return nil, err
 		}
 	default:
 	}
+	if dataAvailabilityService != nil && config.DataAvailability.CacheConfig.Enable {
+		dataAvailabilityService = das.NewCacheWrapper(config.DataAvailability.CacheConfig, dataAvailabilityService)
+	}
 
 	var l1Reader *L1Reader
 	if config.L1Reader.Enable {
@@ -631,11 +664,15 @@ func createNodeImpl(stack *node.Node, chainDb ethdb.Database, config *Config, l2
 	var broadcastClients []*broadcastclient.BroadcastClient
 	if config.Feed.Input.Enable() {
 		for _, address := range config.Feed.Input.URLs {
-			broadcastClients = append(broadcastClients, broadcastclient.NewBroadcastClient(address, nil, config.Feed.Input.Timeout, txStreamer))
+			client, err := broadcastclient.NewBroadcastClient(address, nil, &config.Feed.Input, txStreamer)
+			if err != nil {
+				return nil, err
+			}
+			broadcastClients = append(broadcastClients, client)
 		}
 	}
 	if !config.L1Reader.Enable {
-		return &Node{backend, arbInterface, nil, txStreamer, txPublisher, nil, nil, nil, nil, nil, nil, nil, broadcastServer, broadcastClients, coordinator}, nil
+		return &Node{backend, arbInterface, nil, txStreamer, txPublisher, nil, nil, nil, nil, nil, nil, nil, broadcastServer, broadcastClients, coordinator, dasLifecycleManager, dasAggregator}, nil
 	}
 
 	if deployInfo == nil {
@@ -698,7 +735,7 @@ func createNodeImpl(stack *node.Node, chainDb ethdb.Database, config *Config, l2
 		if txOpts == nil {
 			return nil, errors.New("batchposter, but no TxOpts")
 		}
-		batchPoster, err = NewBatchPoster(l1Reader, inboxTracker, txStreamer, &config.BatchPoster, deployInfo.SequencerInbox, common.Address{}, txOpts, dataAvailabilityService)
+		batchPoster, err = NewBatchPoster(l1Reader, inboxTracker, txStreamer, &config.BatchPoster, deployInfo.SequencerInbox, common.Address{}, txOpts, dataAvailabilityService, rawdb.NewTable(chainDb, dataPosterPrefix))
 		if err != nil {
 			return nil, err
 		}
@@ -712,7 +749,7 @@ func createNodeImpl(stack *node.Node, chainDb ethdb.Database, config *Config, l2
 		return nil, errors.New("sequencer and l1 reader, without delayed sequencer")
 	}
 
-	return &Node{backend, arbInterface, l1Reader, txStreamer, txPublisher, deployInfo, inboxReader, inboxTracker, delayedSequencer, batchPoster, blockValidator, staker, broadcastServer, broadcastClients, coordinator}, nil
+	return &Node{backend, arbInterface, l1Reader, txStreamer, txPublisher, deployInfo, inboxReader, inboxTracker, delayedSequencer, batchPoster, blockValidator, staker, broadcastServer, broadcastClients, coordinator, dasLifecycleManager, dasAggregator}, nil
 }
 
 type arbNodeLifecycle struct {
@@ -748,6 +785,30 @@ func CreateNode(stack *node.Node, chainDb ethdb.Database, config *Config, l2Bloc
 		Service:   &ArbDebugAPI{blockchain: l2BlockChain},
 		Public:    false,
 	})
+	if currentNode.DASAggregator != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "arbdas",
+			Version:   "1.0",
+			Service:   &DASAggregatorAPI{aggregator: currentNode.DASAggregator},
+			Public:    false,
+		})
+	}
+	if currentNode.BatchPoster != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "arbbatchposter",
+			Version:   "1.0",
+			Service:   &BatchPosterAPI{batchPoster: currentNode.BatchPoster},
+			Public:    false,
+		})
+	}
+	if sequencer, ok := currentNode.TxPublisher.(*Sequencer); ok {
+		apis = append(apis, rpc.API{
+			Namespace: "arbtxpool",
+			Version:   "1.0",
+			Service:   &SequencerTxPoolAPI{sequencer: sequencer},
+			Public:    false,
+		})
+	}
 	stack.RegisterAPIs(apis)
 
 	stack.RegisterLifecycle(arbNodeLifecycle{currentNode})
@@ -774,6 +835,7 @@ func (n *Node) Start(ctx context.Context) error {
 			return err
 		}
 	}
+	n.DASLifecycleManager.Start(ctx)
 	n.TxStreamer.Start(ctx)
 	if n.InboxReader != nil {
 		err = n.InboxReader.Start(ctx)
@@ -855,6 +917,7 @@ func (n *Node) StopAndWait() {
 		n.SeqCoordinator.StopAndWait()
 	}
 	n.TxStreamer.StopAndWait()
+	n.DASLifecycleManager.StopAndWait()
 	n.ArbInterface.BlockChain().Stop()
 	if err := n.Backend.Stop(); err != nil {
 		log.Error("backend stop", "err", err)
@@ -6,6 +6,7 @@ package arbnode
 var (
 	arbitrumPrefix           string = "\t"                 // the prefix for all Arbitrum specific keys
 	blockValidatorPrefix     string = arbitrumPrefix + "v" // the prefix for all block validator keys
+	dataPosterPrefix         string = arbitrumPrefix + "p" // the prefix for all data poster keys, which map a nonce to a queued transaction
 	messagePrefix            []byte = []byte("m")          // maps a message sequence number to a message
 	delayedMessagePrefix     []byte = []byte("d")          // maps a delayed sequence number to an accumulator and a message
 	sequencerBatchMetaPrefix []byte = []byte("s")          // maps a batch sequence number to BatchMetadata
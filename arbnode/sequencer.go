@@ -41,7 +41,7 @@ type Sequencer struct {
 	stopwaiter.StopWaiter
 
 	txStreamer *TransactionStreamer
-	txQueue    chan txQueueItem
+	txPool     *sequencerTxPool
 	l1Reader   *L1Reader
 	config     SequencerConfig
 
@@ -54,27 +54,49 @@ type Sequencer struct {
 }
 
 func NewSequencer(txStreamer *TransactionStreamer, l1Reader *L1Reader, config SequencerConfig) (*Sequencer, error) {
-	return &Sequencer{
+	if err := config.TxPool.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Sequencer{
 		txStreamer:    txStreamer,
-		txQueue:       make(chan txQueueItem, 128),
 		l1Reader:      l1Reader,
 		config:        config,
 		l1BlockNumber: 0,
 		l1Timestamp:   0,
-	}, nil
+	}
+	s.txPool = newSequencerTxPool(&s.config.TxPool)
+	return s, nil
 }
 
 func (s *Sequencer) PublishTransaction(ctx context.Context, tx *types.Transaction) error {
+	txBytes, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if len(txBytes) > int(maxTxDataSize) {
+		// This tx is too large
+		return core.ErrOversizedData
+	}
+	sender, err := types.Sender(types.LatestSigner(s.txStreamer.bc.Config()), tx)
+	if err != nil {
+		return err
+	}
+	statedb, err := s.txStreamer.bc.State()
+	if err != nil {
+		return err
+	}
 	resultChan := make(chan error, 1)
-	queueItem := txQueueItem{
-		tx,
-		resultChan,
-		ctx,
+	queueItem := &txPoolItem{
+		txQueueItem: txQueueItem{
+			tx,
+			resultChan,
+			ctx,
+		},
+		sender: sender,
+		size:   len(txBytes),
 	}
-	select {
-	case s.txQueue <- queueItem:
-	case <-ctx.Done():
-		return ctx.Err()
+	if err := s.txPool.add(queueItem, statedb.GetNonce(sender)); err != nil {
+		return err
 	}
 	select {
 	case res := <-resultChan:
@@ -84,6 +106,17 @@ func (s *Sequencer) PublishTransaction(ctx context.Context, tx *types.Transactio
 	}
 }
 
+// TxPoolContent returns the transactions waiting to be sequenced by sender,
+// split into those which are pending and those queued behind a nonce gap.
+func (s *Sequencer) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions, error) {
+	statedb, err := s.txStreamer.bc.State()
+	if err != nil {
+		return nil, nil, err
+	}
+	pending, queued := s.txPool.content(statedb.GetNonce)
+	return pending, queued, nil
+}
+
 func (s *Sequencer) preTxFilter(state *arbosState.ArbosState, tx *types.Transaction, sender common.Address) error {
 	agg, err := state.L1PricingState().ReimbursableAggregatorForSender(sender)
 	if err != nil {
@@ -128,75 +161,50 @@ func (s *Sequencer) DontForward() {
 	s.forwarder = nil
 }
 
-func (s *Sequencer) forwardIfSet(queueItems []txQueueItem) bool {
+// forwardIfSet forwards the given transactions, along with all of those in the
+// txpool, if a forwarding target is set.
+func (s *Sequencer) forwardIfSet(queueItems []*txPoolItem) bool {
 	s.forwarderMutex.Lock()
 	defer s.forwarderMutex.Unlock()
 	if s.forwarder == nil {
 		return false
 	}
-	for _, item := range queueItems {
-		item.resultChan <- s.forwarder.PublishTransaction(item.ctx, item.tx)
+	for _, item := range append(queueItems, s.txPool.takeAll()...) {
+		item.returnResult(s.forwarder.PublishTransaction(item.ctx, item.tx))
 	}
 	return true
 }
 
 func (s *Sequencer) sequenceTransactions(ctx context.Context) {
-	var txes types.Transactions
-	var queueItems []txQueueItem
-	var totalBatchSize int
-	for {
-		var queueItem txQueueItem
-		if len(txes) == 0 {
-			select {
-			case queueItem = <-s.txQueue:
-			case <-ctx.Done():
-				return
-			}
-		} else {
-			done := false
-			select {
-			case queueItem = <-s.txQueue:
-			default:
-				done = true
-			}
-			if done {
-				break
-			}
-		}
-		err := queueItem.ctx.Err()
-		if err != nil {
-			queueItem.returnResult(err)
-			continue
-		}
-		txBytes, err := queueItem.tx.MarshalBinary()
-		if err != nil {
-			queueItem.returnResult(err)
-			continue
-		}
-		if len(txBytes) > int(maxTxDataSize) {
-			// This tx is too large
-			queueItem.returnResult(core.ErrOversizedData)
-			continue
-		}
-		if totalBatchSize+len(txBytes) > int(maxTxDataSize) {
-			// This tx would be too large to add to this batch.
-			// Attempt to put it back in the queue, but error if the queue is full.
-			// Then, end the batch here.
-			select {
-			case s.txQueue <- queueItem:
-			default:
-				queueItem.returnResult(core.ErrOversizedData)
-			}
-			break
-		}
-		totalBatchSize += len(txBytes)
-		txes = append(txes, queueItem.tx)
-		queueItems = append(queueItems, queueItem)
+	var queuedTimeout <-chan time.Time
+	if s.txPool.Len() > 0 {
+		// Come back to expire transactions held behind nonce gaps
+		queuedTimeout = time.After(s.config.TxPool.MaxQueuedTime)
+	}
+	select {
+	case <-s.txPool.notify:
+	case <-queuedTimeout:
+	case <-ctx.Done():
+		return
+	}
+
+	if s.forwardIfSet(nil) {
+		return
 	}
 
-	if s.forwardIfSet(queueItems) {
+	statedb, err := s.txStreamer.bc.State()
+	if err != nil {
+		log.Error("error reading state to sequence transactions", "err", err)
+		return
+	}
+	queueItems := s.txPool.takeReady(statedb.GetNonce, int(maxTxDataSize))
+	if len(queueItems) == 0 {
 		return
 	}
+	txes := make(types.Transactions, 0, len(queueItems))
+	for _, queueItem := range queueItems {
+		txes = append(txes, queueItem.tx)
+	}
 
 	timestamp := time.Now().Unix()
 	s.L1BlockAndTimeMutex.Lock()
@@ -211,6 +219,7 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 			"l1Timestamp", l1Timestamp,
 			"localTimestamp", timestamp,
 		)
+		s.txPool.requeue(queueItems)
 		return
 	}
 
@@ -229,7 +238,7 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 		RequireDataGas: true,
 		TxErrors:       []error{},
 	}
-	err := s.txStreamer.SequenceTransactions(header, txes, hooks)
+	err = s.txStreamer.SequenceTransactions(header, txes, hooks)
 	if err == nil && len(hooks.TxErrors) != len(txes) {
 		err = fmt.Errorf("unexpected number of error results: %v vs number of txes %v", len(hooks.TxErrors), len(txes))
 	}
@@ -239,14 +248,8 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 		if s.forwardIfSet(queueItems) {
 			return
 		}
-		// try to add back to queue otherwise
-		for _, item := range queueItems {
-			select {
-			case s.txQueue <- item:
-			default:
-				item.resultChan <- errors.New("queue full")
-			}
-		}
+		// add back to the txpool otherwise
+		s.txPool.requeue(queueItems)
 		return
 	}
 	if err != nil {
@@ -257,20 +260,28 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 		return
 	}
 
+	var requeue []*txPoolItem
+	// senders with a tx which wasn't included, so neither were their later txs
+	failedSenders := make(map[common.Address]bool)
 	for i, err := range hooks.TxErrors {
 		queueItem := queueItems[i]
+		if err != nil && failedSenders[queueItem.sender] {
+			// A tx before it from the same sender wasn't included. Requeue it
+			// to wait for that nonce to be used.
+			requeue = append(requeue, queueItem)
+			continue
+		}
+		if err != nil {
+			failedSenders[queueItem.sender] = true
+		}
 		if errors.Is(err, core.ErrGasLimit) {
-			// There's not enough gas left in the block for this tx.
-			// Attempt to re-queue the transaction.
-			// If the queue is full, fall through to returning an error.
-			select {
-			case s.txQueue <- queueItem:
-				continue
-			default:
-			}
+			// There's not enough gas left in the block. Requeue it for the next one.
+			requeue = append(requeue, queueItem)
+			continue
 		}
 		queueItem.returnResult(err)
 	}
+	s.txPool.requeue(requeue)
 }
 
 func (s *Sequencer) updateLatestL1Block(header *types.Header) {
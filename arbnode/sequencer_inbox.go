@@ -13,6 +13,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/pkg/errors"
 
@@ -196,8 +197,31 @@ func (i *SequencerInbox) LookupBatchesInRange(ctx context.Context, from, to *big
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	return i.parseBatchDeliveredLogs(logs, false)
+}
+
+// LookupBatchesInTx returns the batches posted by an L1 transaction, which is
+// usually one unless it was posted through another contract.
+func (i *SequencerInbox) LookupBatchesInTx(ctx context.Context, txHash common.Hash) ([]*SequencerInboxBatch, error) {
+	receipt, err := i.client.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	logs := make([]types.Log, 0, len(receipt.Logs))
+	for _, log := range receipt.Logs {
+		logs = append(logs, *log)
+	}
+	return i.parseBatchDeliveredLogs(logs, true)
+}
+
+// parseBatchDeliveredLogs returns the batches delivered by the given logs,
+// skipping logs of other events and contracts if skipOthers is set.
+func (i *SequencerInbox) parseBatchDeliveredLogs(logs []types.Log, skipOthers bool) ([]*SequencerInboxBatch, error) {
 	messages := make([]*SequencerInboxBatch, 0, len(logs))
 	for _, log := range logs {
+		if skipOthers && (log.Address != i.address || len(log.Topics) == 0 || log.Topics[0] != batchDeliveredID) {
+			continue
+		}
 		if log.Topics[0] != batchDeliveredID {
 			return nil, errors.New("unexpected log selector")
 		}
@@ -229,3 +253,21 @@ func (i *SequencerInbox) LookupBatchesInRange(ctx context.Context, from, to *big
 	}
 	return messages, nil
 }
+
+// LookupSequencerMessagesInRange returns the serialized sequencer messages of the
+// batches posted in blocks [from, to], as read by the inbox multiplexer.
+func (i *SequencerInbox) LookupSequencerMessagesInRange(ctx context.Context, from, to uint64) ([][]byte, error) {
+	batches, err := i.LookupBatchesInRange(ctx, new(big.Int).SetUint64(from), new(big.Int).SetUint64(to))
+	if err != nil {
+		return nil, err
+	}
+	messages := make([][]byte, 0, len(batches))
+	for _, batch := range batches {
+		message, err := batch.Serialize(ctx, i.client)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
@@ -0,0 +1,353 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"bytes"
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	flag "github.com/spf13/pflag"
+
+	"github.com/offchainlabs/nitro/util/arbmath"
+)
+
+var (
+	txPoolSizeGauge       = metrics.NewRegisteredGauge("arb/sequencer/txpool/size", nil)
+	txPoolReplacedCounter = metrics.NewRegisteredCounter("arb/sequencer/txpool/replaced", nil)
+	txPoolEvictedCounter  = metrics.NewRegisteredCounter("arb/sequencer/txpool/evicted", nil)
+	txPoolExpiredCounter  = metrics.NewRegisteredCounter("arb/sequencer/txpool/expired", nil)
+)
+
+var (
+	ErrTxReplaced            = errors.New("transaction replaced by one with the same nonce and higher fees")
+	ErrTxEvicted             = errors.New("transaction evicted from the full sequencer txpool by one with higher fees")
+	ErrTxPoolAccountLimit    = errors.New("too many transactions from sender in the sequencer txpool")
+	errTxPoolNonceGapExpired = fmt.Errorf("%w: the transactions before it weren't received in time", core.ErrNonceTooHigh)
+)
+
+type SequencerTxPoolConfig struct {
+	MaxTxs           int           `koanf:"max-txs"`
+	MaxTxsPerAccount int           `koanf:"max-txs-per-account"`
+	MaxQueuedTime    time.Duration `koanf:"max-queued-time"`
+	PriceBump        uint64        `koanf:"price-bump"`
+}
+
+func SequencerTxPoolConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Int(prefix+".max-txs", DefaultSequencerTxPoolConfig.MaxTxs, "maximum number of transactions waiting to be sequenced")
+	f.Int(prefix+".max-txs-per-account", DefaultSequencerTxPoolConfig.MaxTxsPerAccount, "maximum number of transactions from one sender waiting to be sequenced")
+	f.Duration(prefix+".max-queued-time", DefaultSequencerTxPoolConfig.MaxQueuedTime, "how long to hold a transaction whose nonce is ahead of its sender's, waiting for the transactions before it")
+	f.Uint64(prefix+".price-bump", DefaultSequencerTxPoolConfig.PriceBump, "percent by which a transaction must raise both fee caps to replace one with the same nonce")
+}
+
+var DefaultSequencerTxPoolConfig = SequencerTxPoolConfig{
+	MaxTxs:           4096,
+	MaxTxsPerAccount: 64,
+	MaxQueuedTime:    time.Second * 10,
+	PriceBump:        10,
+}
+
+var TestSequencerTxPoolConfig = SequencerTxPoolConfig{
+	MaxTxs:           256,
+	MaxTxsPerAccount: 16,
+	MaxQueuedTime:    time.Second,
+	PriceBump:        10,
+}
+
+func (c *SequencerTxPoolConfig) Validate() error {
+	if c.MaxTxs <= 0 || c.MaxTxsPerAccount <= 0 || c.MaxQueuedTime <= 0 {
+		return fmt.Errorf("invalid sequencer txpool config %+v", *c)
+	}
+	return nil
+}
+
+type txPoolItem struct {
+	txQueueItem
+	sender  common.Address
+	size    int
+	arrival time.Time
+}
+
+// sequencerTxPool holds the transactions waiting to be sequenced. A sender's
+// transactions are pending while their nonces follow on from the sender's
+// nonce, and queued behind a nonce gap otherwise, until the gap is filled or
+// they've been held for the max queued time.
+type sequencerTxPool struct {
+	config *SequencerTxPoolConfig
+
+	mutex    sync.Mutex
+	accounts map[common.Address]map[uint64]*txPoolItem
+	count    int
+	// signaled when there may be transactions ready to sequence
+	notify chan struct{}
+	now    func() time.Time
+}
+
+func newSequencerTxPool(config *SequencerTxPoolConfig) *sequencerTxPool {
+	return &sequencerTxPool{
+		config:   config,
+		accounts: make(map[common.Address]map[uint64]*txPoolItem),
+		notify:   make(chan struct{}, 1),
+		now:      time.Now,
+	}
+}
+
+// txPoolPriorityCmp compares the fees offered by two transactions, by their
+// tip caps and then their fee caps.
+func txPoolPriorityCmp(a, b *types.Transaction) int {
+	if cmp := a.GasTipCapCmp(b); cmp != 0 {
+		return cmp
+	}
+	return a.GasFeeCapCmp(b)
+}
+
+func (p *sequencerTxPool) signal() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (p *sequencerTxPool) setCount(count int) {
+	p.count = count
+	txPoolSizeGauge.Update(int64(count))
+}
+
+func (p *sequencerTxPool) remove(item *txPoolItem, err error) {
+	txs := p.accounts[item.sender]
+	delete(txs, item.tx.Nonce())
+	if len(txs) == 0 {
+		delete(p.accounts, item.sender)
+	}
+	p.setCount(p.count - 1)
+	if err != nil {
+		item.returnResult(err)
+	}
+}
+
+func (p *sequencerTxPool) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.count
+}
+
+// add adds a transaction to the pool, given its sender's nonce. It replaces a
+// transaction with the same nonce if it raises both fee caps by the price bump,
+// and when the pool is full, evicts the transaction with the lowest fees of
+// those last in line from other senders if the new transaction's are higher.
+func (p *sequencerTxPool) add(item *txPoolItem, senderNonce uint64) error {
+	nonce := item.tx.Nonce()
+	if nonce < senderNonce {
+		return core.ErrNonceTooLow
+	}
+	if nonce-senderNonce >= uint64(p.config.MaxTxsPerAccount) {
+		return fmt.Errorf("%w: more than %v ahead of the sender's nonce", core.ErrNonceTooHigh, p.config.MaxTxsPerAccount)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	item.arrival = p.now()
+	txs := p.accounts[item.sender]
+	if existing := txs[nonce]; existing != nil {
+		bumpedFeeCap := arbmath.BigMulByUfrac(existing.tx.GasFeeCap(), 100+p.config.PriceBump, 100)
+		bumpedTipCap := arbmath.BigMulByUfrac(existing.tx.GasTipCap(), 100+p.config.PriceBump, 100)
+		if item.tx.GasFeeCapIntCmp(bumpedFeeCap) < 0 || item.tx.GasTipCapIntCmp(bumpedTipCap) < 0 {
+			return core.ErrReplaceUnderpriced
+		}
+		txs[nonce] = item
+		existing.returnResult(ErrTxReplaced)
+		txPoolReplacedCounter.Inc(1)
+		p.signal()
+		return nil
+	}
+	if len(txs) >= p.config.MaxTxsPerAccount {
+		return ErrTxPoolAccountLimit
+	}
+	if p.count >= p.config.MaxTxs {
+		var cheapest *txPoolItem
+		for sender, senderTxs := range p.accounts {
+			if sender == item.sender {
+				continue
+			}
+			var last *txPoolItem
+			for _, tx := range senderTxs {
+				if last == nil || tx.tx.Nonce() > last.tx.Nonce() {
+					last = tx
+				}
+			}
+			if cheapest == nil || txPoolPriorityCmp(last.tx, cheapest.tx) < 0 {
+				cheapest = last
+			}
+		}
+		if cheapest == nil || txPoolPriorityCmp(cheapest.tx, item.tx) >= 0 {
+			return core.ErrTxPoolOverflow
+		}
+		p.remove(cheapest, ErrTxEvicted)
+		txPoolEvictedCounter.Inc(1)
+		txs = p.accounts[item.sender]
+	}
+	if txs == nil {
+		txs = make(map[uint64]*txPoolItem)
+		p.accounts[item.sender] = txs
+	}
+	txs[nonce] = item
+	p.setCount(p.count + 1)
+	p.signal()
+	return nil
+}
+
+// txPoolHeads orders the next pending transaction of each sender by their
+// fees, and then by when they were received.
+type txPoolHeads []*txPoolItem
+
+func (h txPoolHeads) Len() int { return len(h) }
+func (h txPoolHeads) Less(i, j int) bool {
+	if cmp := txPoolPriorityCmp(h[i].tx, h[j].tx); cmp != 0 {
+		return cmp > 0
+	}
+	return h[i].arrival.Before(h[j].arrival)
+}
+func (h txPoolHeads) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *txPoolHeads) Push(x interface{}) { *h = append(*h, x.(*txPoolItem)) }
+func (h *txPoolHeads) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// takeReady removes and returns the pending transactions to sequence next,
+// up to maxSize bytes of them, given the senders' nonces. A sender's
+// transactions are taken in nonce order, and otherwise the transactions with
+// the highest fees are taken first. Transactions whose nonces have been used,
+// whose callers have given up on them, or which have been queued behind a
+// nonce gap for too long are dropped.
+func (p *sequencerTxPool) takeReady(nonceAt func(common.Address) uint64, maxSize int) []*txPoolItem {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := p.now()
+	heads := &txPoolHeads{}
+	for sender, txs := range p.accounts {
+		senderNonce := nonceAt(sender)
+		pendingEnd := senderNonce
+		for txs[pendingEnd] != nil {
+			pendingEnd++
+		}
+		for nonce, item := range txs {
+			if nonce < senderNonce {
+				p.remove(item, core.ErrNonceTooLow)
+			} else if err := item.ctx.Err(); err != nil {
+				p.remove(item, err)
+			} else if nonce > pendingEnd && now.Sub(item.arrival) >= p.config.MaxQueuedTime {
+				p.remove(item, errTxPoolNonceGapExpired)
+				txPoolExpiredCounter.Inc(1)
+			}
+		}
+		// A pending transaction may have been dropped above, if its caller
+		// gave up on it, leaving the transactions after it queued
+		if head := txs[senderNonce]; head != nil {
+			heads.Push(head)
+		}
+	}
+	heap.Init(heads)
+	var taken []*txPoolItem
+	size := 0
+	for heads.Len() > 0 {
+		item := (*heads)[0]
+		if size+item.size > maxSize {
+			// leave the rest for the next block
+			p.signal()
+			break
+		}
+		heap.Pop(heads)
+		txs := p.accounts[item.sender]
+		p.remove(item, nil)
+		size += item.size
+		taken = append(taken, item)
+		if next := txs[item.tx.Nonce()+1]; next != nil {
+			heap.Push(heads, next)
+		}
+	}
+	return taken
+}
+
+// takeAll removes and returns all of the pool's transactions, in nonce order
+// for each sender.
+func (p *sequencerTxPool) takeAll() []*txPoolItem {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var taken []*txPoolItem
+	for _, txs := range p.accounts {
+		for _, item := range txs {
+			taken = append(taken, item)
+		}
+	}
+	sort.Slice(taken, func(i, j int) bool {
+		if cmp := bytes.Compare(taken[i].sender[:], taken[j].sender[:]); cmp != 0 {
+			return cmp < 0
+		}
+		return taken[i].tx.Nonce() < taken[j].tx.Nonce()
+	})
+	p.accounts = make(map[common.Address]map[uint64]*txPoolItem)
+	p.setCount(0)
+	return taken
+}
+
+// requeue puts back transactions which were taken but couldn't be sequenced,
+// unless they've been replaced in the meantime. The pool's limits aren't
+// applied to them, as they'd already been accepted.
+func (p *sequencerTxPool) requeue(items []*txPoolItem) {
+	if len(items) == 0 {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, item := range items {
+		txs := p.accounts[item.sender]
+		if txs == nil {
+			txs = make(map[uint64]*txPoolItem)
+			p.accounts[item.sender] = txs
+		}
+		if txs[item.tx.Nonce()] != nil {
+			item.returnResult(ErrTxReplaced)
+			continue
+		}
+		txs[item.tx.Nonce()] = item
+		p.setCount(p.count + 1)
+	}
+	p.signal()
+}
+
+// content returns the pool's pending and queued transactions by sender, given
+// the senders' nonces.
+func (p *sequencerTxPool) content(nonceAt func(common.Address) uint64) (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	pending := make(map[common.Address]types.Transactions)
+	queued := make(map[common.Address]types.Transactions)
+	for sender, txs := range p.accounts {
+		nonces := make([]uint64, 0, len(txs))
+		for nonce := range txs {
+			nonces = append(nonces, nonce)
+		}
+		sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+		nextNonce := nonceAt(sender)
+		for _, nonce := range nonces {
+			if nonce == nextNonce {
+				pending[sender] = append(pending[sender], txs[nonce].tx)
+				nextNonce++
+			} else {
+				queued[sender] = append(queued[sender], txs[nonce].tx)
+			}
+		}
+	}
+	return pending, queued
+}
@@ -0,0 +1,181 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+type testTxPoolSender struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+func newTestTxPoolSender(t *testing.T) *testTxPoolSender {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	Require(t, err)
+	return &testTxPoolSender{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+// addTestTx adds a transaction to the pool, returning the channel its result
+// is returned on.
+func addTestTx(t *testing.T, p *sequencerTxPool, sender *testTxPoolSender, senderNonce uint64, nonce uint64, tipGwei int64) (*types.Transaction, chan error, error) {
+	t.Helper()
+	chainId := big.NewInt(1337)
+	tx, err := types.SignNewTx(sender.key, types.LatestSignerForChainID(chainId), &types.DynamicFeeTx{
+		ChainID:   chainId,
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(tipGwei * params.GWei),
+		GasFeeCap: big.NewInt((tipGwei + 1) * params.GWei),
+		Gas:       params.TxGas,
+	})
+	Require(t, err)
+	resultChan := make(chan error, 1)
+	item := &txPoolItem{
+		txQueueItem: txQueueItem{tx, resultChan, context.Background()},
+		sender:      sender.address,
+		size:        100,
+	}
+	return tx, resultChan, p.add(item, senderNonce)
+}
+
+func expectTxResult(t *testing.T, resultChan chan error, expected error) {
+	t.Helper()
+	select {
+	case err := <-resultChan:
+		if !errors.Is(err, expected) {
+			Fail(t, "expected tx result", expected, "got", err)
+		}
+	default:
+		Fail(t, "expected tx result", expected, "but there was none")
+	}
+}
+
+func expectTaken(t *testing.T, taken []*txPoolItem, expected ...*types.Transaction) {
+	t.Helper()
+	if len(taken) != len(expected) {
+		Fail(t, "expected", len(expected), "txs to be taken, got", len(taken))
+	}
+	for i, item := range taken {
+		if item.tx.Hash() != expected[i].Hash() {
+			Fail(t, "expected tx", i, "taken to have nonce", expected[i].Nonce(), "got", item.tx.Nonce())
+		}
+	}
+}
+
+func TestSequencerTxPoolOrdersAndReplaces(t *testing.T) {
+	config := TestSequencerTxPoolConfig
+	config.PriceBump = 10
+	p := newSequencerTxPool(&config)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	alice := newTestTxPoolSender(t)
+	bob := newTestTxPoolSender(t)
+	nonces := map[common.Address]uint64{alice.address: 5, bob.address: 0}
+	nonceAt := func(sender common.Address) uint64 { return nonces[sender] }
+
+	_, _, err := addTestTx(t, p, alice, 5, 4, 1)
+	if !errors.Is(err, core.ErrNonceTooLow) {
+		Fail(t, "expected a used nonce to be rejected, got", err)
+	}
+	alice6, _, err := addTestTx(t, p, alice, 5, 6, 1)
+	Require(t, err)
+	alice5, _, err := addTestTx(t, p, alice, 5, 5, 1)
+	Require(t, err)
+	_, alice8Result, err := addTestTx(t, p, alice, 5, 8, 1)
+	Require(t, err)
+	bob0, bob0Result, err := addTestTx(t, p, bob, 0, 0, 2)
+	Require(t, err)
+
+	// Replacing a tx requires raising its fees by the price bump
+	if _, _, err := addTestTx(t, p, bob, 0, 0, 2); !errors.Is(err, core.ErrReplaceUnderpriced) {
+		Fail(t, "expected a replacement without higher fees to be rejected, got", err)
+	}
+	bob0, _, err = addTestTx(t, p, bob, 0, 0, 3)
+	Require(t, err)
+	expectTxResult(t, bob0Result, ErrTxReplaced)
+
+	pending, queued := p.content(nonceAt)
+	if len(pending[alice.address]) != 2 || len(queued[alice.address]) != 1 || len(pending[bob.address]) != 1 {
+		Fail(t, "expected alice to have 2 pending and 1 queued tx, and bob 1 pending, got", pending, queued)
+	}
+
+	// Higher fees go first, but each sender's txs stay in nonce order, and the
+	// tx behind a nonce gap is held
+	expectTaken(t, p.takeReady(nonceAt, 1000), bob0, alice5, alice6)
+	if p.Len() != 1 {
+		Fail(t, "expected the tx behind a nonce gap to be held, got", p.Len(), "txs in the pool")
+	}
+
+	// until it's been held for the max queued time
+	nonces[alice.address] = 7
+	now = now.Add(config.MaxQueuedTime)
+	expectTaken(t, p.takeReady(nonceAt, 1000))
+	expectTxResult(t, alice8Result, core.ErrNonceTooHigh)
+	if p.Len() != 0 {
+		Fail(t, "expected the expired tx to be dropped")
+	}
+
+	// Txs are taken up to the max size, and the rest left for the next block
+	bob1, _, err := addTestTx(t, p, bob, 1, 1, 1)
+	Require(t, err)
+	bob2, _, err := addTestTx(t, p, bob, 1, 2, 5)
+	Require(t, err)
+	nonces[bob.address] = 1
+	expectTaken(t, p.takeReady(nonceAt, 100), bob1)
+	p.requeue([]*txPoolItem{{txQueueItem: txQueueItem{bob1, make(chan error, 1), context.Background()}, sender: bob.address}})
+	expectTaken(t, p.takeReady(nonceAt, 1000), bob1, bob2)
+}
+
+func TestSequencerTxPoolLimits(t *testing.T) {
+	config := TestSequencerTxPoolConfig
+	config.MaxTxs = 3
+	config.MaxTxsPerAccount = 2
+	p := newSequencerTxPool(&config)
+	alice := newTestTxPoolSender(t)
+	bob := newTestTxPoolSender(t)
+	carol := newTestTxPoolSender(t)
+
+	if _, _, err := addTestTx(t, p, alice, 0, 2, 1); !errors.Is(err, core.ErrNonceTooHigh) {
+		Fail(t, "expected a tx too far ahead of its sender's nonce to be rejected, got", err)
+	}
+	_, _, err := addTestTx(t, p, alice, 0, 0, 1)
+	Require(t, err)
+	_, alice1Result, err := addTestTx(t, p, alice, 0, 1, 1)
+	Require(t, err)
+	if _, _, err := addTestTx(t, p, alice, 1, 2, 1); !errors.Is(err, ErrTxPoolAccountLimit) {
+		Fail(t, "expected a sender's txs to be limited, got", err)
+	}
+	_, _, err = addTestTx(t, p, bob, 0, 0, 3)
+	Require(t, err)
+
+	// A full pool evicts the last tx of the sender with the lowest fees, if the
+	// new tx has higher fees
+	if _, _, err := addTestTx(t, p, carol, 0, 0, 1); !errors.Is(err, core.ErrTxPoolOverflow) {
+		Fail(t, "expected a tx without higher fees to be rejected from the full pool, got", err)
+	}
+	_, _, err = addTestTx(t, p, carol, 0, 0, 2)
+	Require(t, err)
+	expectTxResult(t, alice1Result, ErrTxEvicted)
+	if p.Len() != 3 {
+		Fail(t, "expected the pool to stay full, got", p.Len(), "txs")
+	}
+
+	// Forwarding takes everything
+	if taken := p.takeAll(); len(taken) != 3 || p.Len() != 0 {
+		Fail(t, "expected all txs to be taken, got", len(taken))
+	}
+}
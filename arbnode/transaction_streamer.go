@@ -20,6 +20,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/offchainlabs/nitro/arbos"
 	"github.com/offchainlabs/nitro/arbstate"
@@ -29,6 +30,8 @@ import (
 	"github.com/offchainlabs/nitro/validator"
 )
 
+var feedLagGauge = metrics.NewRegisteredGauge("arb/feed/lag", nil)
+
 // Produces blocks from a node's L1 messages, storing the results in the blockchain and recording their positions
 // The streamer is notified when there's new batches to process
 type TransactionStreamer struct {
@@ -244,6 +247,14 @@ func (s *TransactionStreamer) AddBroadcastMessages(pos arbutil.MessageIndex, mes
 		return err
 	}
 
+	// How many sequence numbers the local messages are behind the feed's
+	feedEnd := pos + arbutil.MessageIndex(len(messages))
+	if currentMessageCount < pos {
+		feedLagGauge.Update(int64(feedEnd - currentMessageCount))
+	} else {
+		feedLagGauge.Update(0)
+	}
+
 	if currentMessageCount >= pos {
 		s.broadcasterQueuedMessages = s.broadcasterQueuedMessages[:0]
 		s.broadcasterQueuedMessagesPos = 0
@@ -0,0 +1,256 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbstate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// DecodedBatch is a breakdown of a sequencer batch, for inspecting its contents.
+type DecodedBatch struct {
+	Header      *DecodedBatchHeader    `json:"header,omitempty"`
+	Format      string                 `json:"format"`
+	PayloadSize int                    `json:"payloadSize"`
+	Segments    []*DecodedBatchSegment `json:"segments"`
+	Messages    []*DecodedBatchMessage `json:"messages"`
+	// Delayed messages read after the batch's last segment, to reach the
+	// header's delayed message count
+	TrailingDelayedMessages uint64 `json:"trailingDelayedMessages,omitempty"`
+	Error                   string `json:"error,omitempty"`
+}
+
+// DecodedBatchHeader is the header the sequencer inbox adds to a batch.
+type DecodedBatchHeader struct {
+	MinTimestamp         uint64 `json:"minTimestamp"`
+	MaxTimestamp         uint64 `json:"maxTimestamp"`
+	MinL1Block           uint64 `json:"minL1Block"`
+	MaxL1Block           uint64 `json:"maxL1Block"`
+	AfterDelayedMessages uint64 `json:"afterDelayedMessages"`
+}
+
+type DecodedBatchSegment struct {
+	Kind    string `json:"kind"`
+	Size    int    `json:"size"`
+	Advance uint64 `json:"advance,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DecodedBatchMessage is a message read from a batch, as the inbox multiplexer
+// would read it. Delayed messages are only identified by their sequence number,
+// as their contents are read from the delayed inbox.
+type DecodedBatchMessage struct {
+	Segment        int                `json:"segment"`
+	Kind           string             `json:"kind"`
+	Timestamp      uint64             `json:"timestamp,omitempty"`
+	L1BlockNumber  uint64             `json:"l1BlockNumber,omitempty"`
+	DelayedMessage *uint64            `json:"delayedMessage,omitempty"`
+	L2Msg          hexutil.Bytes      `json:"l2Msg,omitempty"`
+	Transactions   types.Transactions `json:"transactions,omitempty"`
+	Error          string             `json:"error,omitempty"`
+}
+
+const (
+	DecodedMessageKindL2      = "l2"
+	DecodedMessageKindDelayed = "delayed"
+	DecodedMessageKindInvalid = "invalid"
+)
+
+func batchFormat(headerByte byte) string {
+	switch {
+	case IsDASMessageHeaderByte(headerByte) && IsZeroheavyEncodedHeaderByte(headerByte):
+		return "das-zeroheavy"
+	case IsDASMessageHeaderByte(headerByte):
+		return "das"
+	case headerByte == 0:
+		return "brotli"
+	default:
+		return "unknown"
+	}
+}
+
+func segmentKindName(kind uint8) string {
+	switch kind {
+	case BatchSegmentKindL2Message:
+		return "l2Message"
+	case BatchSegmentKindL2MessageBrotli:
+		return "l2MessageBrotli"
+	case BatchSegmentKindDelayedMessages:
+		return "delayedMessages"
+	case BatchSegmentKindAdvanceTimestamp:
+		return "advanceTimestamp"
+	case BatchSegmentKindAdvanceL1BlockNumber:
+		return "advanceL1BlockNumber"
+	default:
+		return "unknown"
+	}
+}
+
+// DecodeBatch decodes a sequencer batch as read from L1 by the inbox reader, its
+// 40 byte header followed by its data. delayedMessagesRead is the number of
+// delayed messages read before the batch, and the batch's L2 messages are only
+// parsed into transactions if chainId isn't nil. If the batch's data can't be
+// fully decoded, the error is returned along with what was decoded before it.
+func DecodeBatch(ctx context.Context, data []byte, das DataAvailabilityServiceReader, delayedMessagesRead uint64, chainId *big.Int) (*DecodedBatch, error) {
+	seqMsg, err := decodeSequencerMessageHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 40 {
+		seqMsg.segments, err = decodeBatchSegments(ctx, data[40:], das)
+	}
+	header := &DecodedBatchHeader{
+		MinTimestamp:         seqMsg.minTimestamp,
+		MaxTimestamp:         seqMsg.maxTimestamp,
+		MinL1Block:           seqMsg.minL1Block,
+		MaxL1Block:           seqMsg.maxL1Block,
+		AfterDelayedMessages: seqMsg.afterDelayedMessages,
+	}
+	return decodeBatch(header, data[40:], seqMsg, err, delayedMessagesRead, chainId)
+}
+
+// DecodeBatchData decodes the data of a batch without its header, as posted to
+// the sequencer inbox. Without a header, the batch's messages aren't clamped to
+// its time bounds, and it's taken to read as many delayed messages as its
+// segments say.
+func DecodeBatchData(ctx context.Context, data []byte, das DataAvailabilityServiceReader, delayedMessagesRead uint64, chainId *big.Int) (*DecodedBatch, error) {
+	seqMsg := &sequencerMessage{
+		maxTimestamp:         math.MaxUint64,
+		maxL1Block:           math.MaxUint64,
+		afterDelayedMessages: math.MaxUint64,
+	}
+	var err error
+	if len(data) > 0 {
+		seqMsg.segments, err = decodeBatchSegments(ctx, data, das)
+	}
+	return decodeBatch(nil, data, seqMsg, err, delayedMessagesRead, chainId)
+}
+
+// decodeBatchSegments decodes the segments of a batch's data like the inbox
+// multiplexer, but returns an error for an empty payload, which the multiplexer
+// panics reading.
+func decodeBatchSegments(ctx context.Context, data []byte, das DataAvailabilityServiceReader) ([][]byte, error) {
+	payload, found, err := sequencerPayload(ctx, data, das)
+	if !found {
+		return nil, err
+	}
+	if len(payload) == 0 {
+		if err == nil {
+			err = errors.New("empty sequencer message payload")
+		}
+		return nil, err
+	}
+	segments, segmentsErr := decodeSegments(payload[1:])
+	if err == nil {
+		err = segmentsErr
+	}
+	return segments, err
+}
+
+func decodeBatch(header *DecodedBatchHeader, data []byte, seqMsg *sequencerMessage, err error, delayedMessagesRead uint64, chainId *big.Int) (*DecodedBatch, error) {
+	batch := &DecodedBatch{
+		Header:      header,
+		Format:      "empty",
+		PayloadSize: len(data),
+	}
+	if len(data) > 0 {
+		batch.Format = batchFormat(data[0])
+	}
+	if err != nil {
+		batch.Error = err.Error()
+	}
+
+	var timestamp, blockNumber uint64
+	for i, segment := range seqMsg.segments {
+		decodedSegment := &DecodedBatchSegment{Kind: "empty", Size: len(segment)}
+		batch.Segments = append(batch.Segments, decodedSegment)
+		if len(segment) == 0 {
+			continue
+		}
+		kind := segment[0]
+		decodedSegment.Kind = segmentKindName(kind)
+		switch kind {
+		case BatchSegmentKindAdvanceTimestamp, BatchSegmentKindAdvanceL1BlockNumber:
+			advancing, err := rlp.NewStream(bytes.NewReader(segment[1:]), 16).Uint64()
+			if err != nil {
+				decodedSegment.Error = err.Error()
+				continue
+			}
+			decodedSegment.Advance = advancing
+			if kind == BatchSegmentKindAdvanceTimestamp {
+				timestamp += advancing
+			} else {
+				blockNumber += advancing
+			}
+		case BatchSegmentKindL2Message, BatchSegmentKindL2MessageBrotli:
+			msg := &DecodedBatchMessage{
+				Segment:       i,
+				Kind:          DecodedMessageKindL2,
+				Timestamp:     clampToRange(timestamp, seqMsg.minTimestamp, seqMsg.maxTimestamp),
+				L1BlockNumber: clampToRange(blockNumber, seqMsg.minL1Block, seqMsg.maxL1Block),
+			}
+			batch.Messages = append(batch.Messages, msg)
+			if kind == BatchSegmentKindL2MessageBrotli && len(segment) == 1 {
+				// The inbox multiplexer can't read this, and panics
+				msg.Kind = DecodedMessageKindInvalid
+				msg.Error = "empty compressed message segment"
+				continue
+			}
+			l2msg, err := l2MessageFromSegment(kind, segment[1:])
+			if err != nil {
+				msg.Kind = DecodedMessageKindInvalid
+				msg.Error = err.Error()
+				continue
+			}
+			msg.L2Msg = l2msg
+			if chainId != nil {
+				txs, err := newSequencerL2Message(l2msg, msg.L1BlockNumber, msg.Timestamp).ParseL2Transactions(chainId)
+				if err != nil {
+					msg.Kind = DecodedMessageKindInvalid
+					msg.Error = err.Error()
+					continue
+				}
+				msg.Transactions = txs
+			}
+		case BatchSegmentKindDelayedMessages:
+			msg := &DecodedBatchMessage{Segment: i, Kind: DecodedMessageKindDelayed}
+			batch.Messages = append(batch.Messages, msg)
+			if delayedMessagesRead >= seqMsg.afterDelayedMessages {
+				msg.Kind = DecodedMessageKindInvalid
+				msg.Error = "attempt to read past batch delayed message count"
+				continue
+			}
+			seqNum := delayedMessagesRead
+			msg.DelayedMessage = &seqNum
+			delayedMessagesRead++
+		default:
+			decodedSegment.Error = fmt.Sprintf("bad sequencer message segment kind %v", kind)
+		}
+	}
+	if header != nil && delayedMessagesRead < header.AfterDelayedMessages {
+		batch.TrailingDelayedMessages = header.AfterDelayedMessages - delayedMessagesRead
+	}
+	if batch.Error != "" {
+		return batch, errors.New(batch.Error)
+	}
+	return batch, nil
+}
+
+func clampToRange(value, min, max uint64) uint64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
@@ -8,8 +8,11 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math/bits"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/offchainlabs/nitro/blsSignatures"
 )
 
@@ -21,6 +24,10 @@ type DataAvailabilityServiceReader interface {
 // which will retrieve the full batch data.
 const DASMessageHeaderFlag byte = 0x80
 
+// Indicates that this DAS certificate is versioned, with its header byte followed by
+// a version byte and the hash of the keyset that signed it.
+const DASVersionedCertHeaderFlag byte = 0x10
+
 // Indicates that this message was authenticated by L1. Currently unused.
 const L1AuthenticatedMessageHeaderFlag byte = 0x40
 
@@ -35,7 +42,20 @@ func IsZeroheavyEncodedHeaderByte(header byte) bool {
 	return (ZeroheavyMessageHeaderFlag & header) > 0
 }
 
+func IsVersionedDASCertHeaderByte(header byte) bool {
+	return (DASVersionedCertHeaderFlag & header) > 0
+}
+
+const (
+	// Certificates without a keyset hash, signed by the committee configured at the time.
+	DASCertVersionLegacy uint8 = 0
+	// Certificates naming the keyset whose members signed them.
+	DASCertVersionKeyset uint8 = 1
+)
+
 type DataAvailabilityCertificate struct {
+	Version     uint8
+	KeysetHash  [32]byte // only set if Version >= DASCertVersionKeyset
 	DataHash    [32]byte
 	Timeout     uint64
 	SignersMask uint64
@@ -54,6 +74,20 @@ func DeserializeDASCertFrom(rd io.Reader) (c *DataAvailabilityCertificate, err e
 		return nil, errors.New("Tried to deserialize a message that doesn't have the DAS header.")
 	}
 
+	if IsVersionedDASCertHeaderByte(header) {
+		c.Version, err = r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c.Version != DASCertVersionKeyset {
+			return nil, fmt.Errorf("Unsupported DAS certificate version %d.", c.Version)
+		}
+		_, err = io.ReadFull(r, c.KeysetHash[:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	_, err = io.ReadFull(r, c.DataHash[:])
 	if err != nil {
 		return nil, err
@@ -85,3 +119,121 @@ func DeserializeDASCertFrom(rd io.Reader) (c *DataAvailabilityCertificate, err e
 
 	return c, nil
 }
+
+// DataAvailabilityKeyset is a DAS committee. The member with PubKeys[i] signs
+// under the single bit SignersMasks[i] of a certificate's SignersMask, and
+// K=len(PubKeys)+1-AssumedHonest signers are required.
+type DataAvailabilityKeyset struct {
+	AssumedHonest uint64
+	SignersMasks  []uint64
+	PubKeys       []blsSignatures.PublicKey
+}
+
+func (keyset *DataAvailabilityKeyset) Serialize() []byte {
+	var buf []byte
+	var intData [8]byte
+	binary.BigEndian.PutUint64(intData[:], keyset.AssumedHonest)
+	buf = append(buf, intData[:]...)
+	binary.BigEndian.PutUint64(intData[:], uint64(len(keyset.PubKeys)))
+	buf = append(buf, intData[:]...)
+	for i, pubKey := range keyset.PubKeys {
+		binary.BigEndian.PutUint64(intData[:], keyset.SignersMasks[i])
+		buf = append(buf, intData[:]...)
+		pubKeyBytes := blsSignatures.PublicKeyToBytes(pubKey)
+		var lenData [2]byte
+		binary.BigEndian.PutUint16(lenData[:], uint16(len(pubKeyBytes)))
+		buf = append(buf, lenData[:]...)
+		buf = append(buf, pubKeyBytes...)
+	}
+	return buf
+}
+
+func (keyset *DataAvailabilityKeyset) Hash() [32]byte {
+	var hash [32]byte
+	copy(hash[:], crypto.Keccak256(keyset.Serialize()))
+	return hash
+}
+
+// DeserializeKeyset reads a keyset serialized by DataAvailabilityKeyset.Serialize.
+// Public keys without a validity proof are only accepted if assumeKeysetValid is set,
+// eg for keysets from the node's own configuration.
+func DeserializeKeyset(rd io.Reader, assumeKeysetValid bool) (*DataAvailabilityKeyset, error) {
+	var intData [8]byte
+	_, err := io.ReadFull(rd, intData[:])
+	if err != nil {
+		return nil, err
+	}
+	assumedHonest := binary.BigEndian.Uint64(intData[:])
+	_, err = io.ReadFull(rd, intData[:])
+	if err != nil {
+		return nil, err
+	}
+	numKeys := binary.BigEndian.Uint64(intData[:])
+	if numKeys > 64 {
+		return nil, fmt.Errorf("Keyset has %d public keys, at most 64 are supported.", numKeys)
+	}
+	if assumedHonest == 0 || assumedHonest > numKeys {
+		return nil, fmt.Errorf("Keyset has %d public keys and invalid assumed honest count %d.", numKeys, assumedHonest)
+	}
+	keyset := &DataAvailabilityKeyset{AssumedHonest: assumedHonest}
+	var allSignersMasks uint64
+	for i := uint64(0); i < numKeys; i++ {
+		_, err = io.ReadFull(rd, intData[:])
+		if err != nil {
+			return nil, err
+		}
+		signersMask := binary.BigEndian.Uint64(intData[:])
+		if bits.OnesCount64(signersMask) != 1 || allSignersMasks&signersMask != 0 {
+			return nil, fmt.Errorf("Keyset has invalid or duplicate signers mask %X.", signersMask)
+		}
+		allSignersMasks |= signersMask
+		var lenData [2]byte
+		_, err = io.ReadFull(rd, lenData[:])
+		if err != nil {
+			return nil, err
+		}
+		pubKeyBytes := make([]byte, binary.BigEndian.Uint16(lenData[:]))
+		_, err = io.ReadFull(rd, pubKeyBytes)
+		if err != nil {
+			return nil, err
+		}
+		pubKey, err := blsSignatures.PublicKeyFromBytes(pubKeyBytes, assumeKeysetValid)
+		if err != nil {
+			return nil, err
+		}
+		keyset.SignersMasks = append(keyset.SignersMasks, signersMask)
+		keyset.PubKeys = append(keyset.PubKeys, pubKey)
+	}
+	return keyset, nil
+}
+
+func (keyset *DataAvailabilityKeyset) RequiredSigners() int {
+	return len(keyset.PubKeys) + 1 - int(keyset.AssumedHonest)
+}
+
+// VerifySignature checks that sig over data was made by enough members of the keyset,
+// namely those selected by signersMask.
+func (keyset *DataAvailabilityKeyset) VerifySignature(signersMask uint64, data []byte, sig blsSignatures.Signature) error {
+	var allSignersMasks uint64
+	var pubKeys []blsSignatures.PublicKey
+	for i, pubKey := range keyset.PubKeys {
+		allSignersMasks |= keyset.SignersMasks[i]
+		if signersMask&keyset.SignersMasks[i] != 0 {
+			pubKeys = append(pubKeys, pubKey)
+		}
+	}
+	if signersMask&^allSignersMasks != 0 {
+		return fmt.Errorf("Signers mask %X refers to signers outside of the keyset of %d.", signersMask, len(keyset.PubKeys))
+	}
+	if len(pubKeys) < keyset.RequiredSigners() {
+		return fmt.Errorf("Data was only signed by %d DASes, %d required.", len(pubKeys), keyset.RequiredSigners())
+	}
+	verified, err := blsSignatures.VerifySignature(sig, data, blsSignatures.AggregatePublicKeys(pubKeys))
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return errors.New("Signature of data doesn't match the keyset.")
+	}
+	return nil
+}
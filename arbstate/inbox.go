@@ -8,7 +8,7 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
-	"github.com/offchainlabs/nitro/zeroheavy"
+	"fmt"
 	"io"
 	"math/big"
 
@@ -18,6 +18,7 @@ import (
 	"github.com/offchainlabs/nitro/arbcompress"
 	"github.com/offchainlabs/nitro/arbos"
 	"github.com/offchainlabs/nitro/arbos/l1pricing"
+	"github.com/offchainlabs/nitro/zeroheavy"
 )
 
 type InboxBackend interface {
@@ -55,76 +56,148 @@ const maxDecompressedLen int = 1024 * 1024 * 16 // 16 MiB
 const maxZeroheavyDecompressedLen = 101*maxDecompressedLen/100 + 64
 const MaxSegmentsPerSequencerMessage = 100 * 1024
 
-func parseSequencerMessage(ctx context.Context, data []byte, das DataAvailabilityServiceReader) *sequencerMessage {
+// decodeSequencerMessageHeader parses the header of a sequencer message as read
+// from L1, returning the message without its segments.
+func decodeSequencerMessageHeader(data []byte) (*sequencerMessage, error) {
 	if len(data) < 40 {
-		panic("sequencer message missing L1 header")
+		return nil, errors.New("sequencer message missing L1 header")
 	}
-	minTimestamp := binary.BigEndian.Uint64(data[:8])
-	maxTimestamp := binary.BigEndian.Uint64(data[8:16])
-	minL1Block := binary.BigEndian.Uint64(data[16:24])
-	maxL1Block := binary.BigEndian.Uint64(data[24:32])
-	afterDelayedMessages := binary.BigEndian.Uint64(data[32:40])
-	var segments [][]byte
+	return &sequencerMessage{
+		minTimestamp:         binary.BigEndian.Uint64(data[:8]),
+		maxTimestamp:         binary.BigEndian.Uint64(data[8:16]),
+		minL1Block:           binary.BigEndian.Uint64(data[16:24]),
+		maxL1Block:           binary.BigEndian.Uint64(data[24:32]),
+		afterDelayedMessages: binary.BigEndian.Uint64(data[32:40]),
+	}, nil
+}
 
-	var payload []byte
-	if len(data) >= 41 {
+func parseSequencerMessage(ctx context.Context, data []byte, das DataAvailabilityServiceReader) *sequencerMessage {
+	seqMsg, err := decodeSequencerMessageHeader(data)
+	if err != nil {
+		panic(err.Error())
+	}
+	if len(data) == 40 {
+		return seqMsg
+	}
+	seqMsg.segments, err = decodeSequencerData(ctx, data[40:], das)
+	if err != nil {
 		if IsDASMessageHeaderByte(data[40]) {
-			if das == nil {
-				log.Error("No DAS configured, but sequencer message found with DAS header")
-			} else {
-				var err error
-				payload, err = das.Retrieve(ctx, data[40:])
-				if err != nil {
-					log.Error("Reading from DAS failed", "err", err)
-				}
+			log.Error("error reading sequencer message from DAS", "err", err)
+		} else {
+			log.Warn("error parsing sequencer message", "err", err)
+		}
+	}
+	return seqMsg
+}
 
+// sequencerPayload returns the payload of a sequencer message's data, its
+// header byte followed by its compressed segments, retrieving it from the DAS
+// and zeroheavy decoding it as the header byte says. It returns false if the
+// data has no payload. If the DAS or the zeroheavy decoder fails, the error is
+// returned with whatever payload they gave, which may be empty.
+func sequencerPayload(ctx context.Context, data []byte, das DataAvailabilityServiceReader) ([]byte, bool, error) {
+	var payload []byte
+	var err error
+	if IsDASMessageHeaderByte(data[0]) {
+		if das == nil {
+			err = errors.New("no DAS configured, but sequencer message found with DAS header")
+		} else {
+			payload, err = das.Retrieve(ctx, data)
+			if err != nil {
+				err = fmt.Errorf("reading from DAS failed: %w", err)
 			}
-		} else if data[40] == 0 {
-			payload = data[40:]
 		}
+	} else if data[0] == 0 {
+		payload = data
+	}
+	if len(payload) == 0 {
+		if err == nil {
+			err = fmt.Errorf("unknown sequencer message format, with header byte %#x", data[0])
+		}
+		return nil, false, err
+	}
+	if IsZeroheavyEncodedHeaderByte(data[0]) {
+		pl, zeroheavyErr := decodeZeroheavy(payload)
+		if zeroheavyErr != nil {
+			err = zeroheavyErr
+			pl = []byte{}
+		}
+		payload = pl
+	}
+	return payload, true, err
+}
 
-		if len(payload) > 0 {
-			if IsZeroheavyEncodedHeaderByte(data[40]) {
-				pl, err := io.ReadAll(io.LimitReader(zeroheavy.NewZeroheavyDecoder(bytes.NewReader(payload)), int64(maxZeroheavyDecompressedLen)))
-				if err != nil {
-					log.Warn("error reading from zeroheavy decoder", err.Error())
-					pl = []byte{}
-				}
-				payload = pl
-			}
-			decompressed, err := arbcompress.Decompress(payload[1:], maxDecompressedLen)
-			if err == nil {
-				reader := bytes.NewReader(decompressed)
-				stream := rlp.NewStream(reader, uint64(maxDecompressedLen))
-				for {
-					var segment []byte
-					err := stream.Decode(&segment)
-					if err != nil {
-						if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
-							log.Warn("error parsing sequencer message segment", "err", err.Error())
-						}
-						break
-					}
-					if len(segments) >= MaxSegmentsPerSequencerMessage {
-						log.Warn("too many segments in sequence batch")
-						break
-					}
-					segments = append(segments, segment)
-				}
-			} else {
-				log.Warn("sequencer msg decompression failed", "err", err)
+// decodeSequencerData decodes the segments of a sequencer message's data, as the
+// inbox multiplexer reads them. If the data can't be fully decoded, the segments
+// decoded before the error are returned with it.
+func decodeSequencerData(ctx context.Context, data []byte, das DataAvailabilityServiceReader) ([][]byte, error) {
+	payload, found, err := sequencerPayload(ctx, data, das)
+	if !found {
+		return nil, err
+	}
+	segments, segmentsErr := decodeSegments(payload[1:])
+	if err == nil {
+		err = segmentsErr
+	}
+	return segments, err
+}
+
+// decodeSegments decompresses the segments of a sequencer message. If a segment
+// can't be decoded, the segments before it are returned along with the error.
+func decodeSegments(compressed []byte) ([][]byte, error) {
+	decompressed, err := arbcompress.Decompress(compressed, maxDecompressedLen)
+	if err != nil {
+		return nil, fmt.Errorf("sequencer msg decompression failed: %w", err)
+	}
+	stream := rlp.NewStream(bytes.NewReader(decompressed), uint64(maxDecompressedLen))
+	var segments [][]byte
+	for {
+		var segment []byte
+		err := stream.Decode(&segment)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return segments, fmt.Errorf("error parsing sequencer message segment: %w", err)
 			}
-		} else {
-			log.Warn("unknown sequencer message format")
+			return segments, nil
+		}
+		if len(segments) >= MaxSegmentsPerSequencerMessage {
+			return segments, errors.New("too many segments in sequence batch")
 		}
+		segments = append(segments, segment)
 	}
-	return &sequencerMessage{
-		minTimestamp:         minTimestamp,
-		maxTimestamp:         maxTimestamp,
-		minL1Block:           minL1Block,
-		maxL1Block:           maxL1Block,
-		afterDelayedMessages: afterDelayedMessages,
-		segments:             segments,
+}
+
+// decodeZeroheavy returns the zeroheavy decoding of data.
+func decodeZeroheavy(data []byte) ([]byte, error) {
+	decoded, err := io.ReadAll(io.LimitReader(zeroheavy.NewZeroheavyDecoder(bytes.NewReader(data)), int64(maxZeroheavyDecompressedLen)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading from zeroheavy decoder: %w", err)
+	}
+	return decoded, nil
+}
+
+// l2MessageFromSegment returns the L2 message in a segment of one of the L2
+// message kinds, after the segment's kind byte.
+func l2MessageFromSegment(kind uint8, segment []byte) ([]byte, error) {
+	if kind != BatchSegmentKindL2MessageBrotli {
+		return segment, nil
+	}
+	return arbcompress.Decompress(segment[1:], arbos.MaxL2MessageSize)
+}
+
+// newSequencerL2Message returns the message the sequencer sent in an L2 message
+// segment of a batch.
+func newSequencerL2Message(l2msg []byte, blockNumber uint64, timestamp uint64) *arbos.L1IncomingMessage {
+	return &arbos.L1IncomingMessage{
+		Header: &arbos.L1IncomingMessageHeader{
+			Kind:        arbos.L1MessageType_L2Message,
+			Poster:      l1pricing.SequencerAddress,
+			BlockNumber: blockNumber,
+			Timestamp:   timestamp,
+			RequestId:   nil,
+			L1BaseFee:   big.NewInt(0),
+		},
+		L2msg: l2msg,
 	}
 }
 
@@ -298,28 +371,13 @@ func (r *inboxMultiplexer) getNextMsg() (*MessageWithMetadata, error) {
 	segment = segment[1:]
 	var msg *MessageWithMetadata
 	if kind == BatchSegmentKindL2Message || kind == BatchSegmentKindL2MessageBrotli {
-
-		if kind == BatchSegmentKindL2MessageBrotli {
-			decompressed, err := arbcompress.Decompress(segment[1:], arbos.MaxL2MessageSize)
-			if err != nil {
-				log.Info("dropping compressed message", "err", err, "delayedMsg", r.delayedMessagesRead)
-				return nil, nil
-			}
-			segment = decompressed
+		l2msg, err := l2MessageFromSegment(kind, segment)
+		if err != nil {
+			log.Info("dropping compressed message", "err", err, "delayedMsg", r.delayedMessagesRead)
+			return nil, nil
 		}
-
 		msg = &MessageWithMetadata{
-			Message: &arbos.L1IncomingMessage{
-				Header: &arbos.L1IncomingMessageHeader{
-					Kind:        arbos.L1MessageType_L2Message,
-					Poster:      l1pricing.SequencerAddress,
-					BlockNumber: blockNumber,
-					Timestamp:   timestamp,
-					RequestId:   nil,
-					L1BaseFee:   big.NewInt(0),
-				},
-				L2msg: segment,
-			},
+			Message:             newSequencerL2Message(l2msg, blockNumber, timestamp),
 			DelayedMessagesRead: r.delayedMessagesRead,
 		}
 	} else if kind == BatchSegmentKindDelayedMessages {
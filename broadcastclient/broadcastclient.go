@@ -4,22 +4,30 @@
 package broadcastclient
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"io"
 	"math/big"
 	"net"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/gobwas/httphead"
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/broadcaster"
@@ -27,6 +35,12 @@ import (
 	"github.com/offchainlabs/nitro/wsbroadcastserver"
 )
 
+var (
+	receivedMessagesMeter = metrics.NewRegisteredMeter("arb/feed/client/messages", nil)
+	receivedBytesMeter    = metrics.NewRegisteredMeter("arb/feed/client/bytes", nil)
+	reconnectsCounter     = metrics.NewRegisteredCounter("arb/feed/client/reconnects", nil)
+)
+
 type FeedConfig struct {
 	Output wsbroadcastserver.BroadcasterConfig `koanf:"output"`
 	Input  BroadcastClientConfig               `koanf:"input"`
@@ -47,8 +61,26 @@ var FeedConfigDefault = FeedConfig{
 }
 
 type BroadcastClientConfig struct {
-	Timeout time.Duration `koanf:"timeout"`
-	URLs    []string      `koanf:"url"`
+	Timeout           time.Duration               `koanf:"timeout"`
+	URLs              []string                    `koanf:"url"`
+	Verify            BroadcastClientVerifyConfig `koanf:"verify"`
+	EnableCompression bool                        `koanf:"enable-compression"`
+	EnableBinary      bool                        `koanf:"enable-binary"`
+}
+
+type BroadcastClientVerifyConfig struct {
+	Signer    string `koanf:"signer"`
+	AlertOnly bool   `koanf:"alert-only"`
+}
+
+func BroadcastClientVerifyConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".signer", DefaultBroadcastClientVerifyConfig.Signer, "address of the sequencer feed messages must be signed by (empty = don't verify signatures)")
+	f.Bool(prefix+".alert-only", DefaultBroadcastClientVerifyConfig.AlertOnly, "log feed messages with invalid signatures instead of dropping them")
+}
+
+var DefaultBroadcastClientVerifyConfig = BroadcastClientVerifyConfig{
+	Signer:    "",
+	AlertOnly: false,
 }
 
 func (c *BroadcastClientConfig) Enable() bool {
@@ -58,17 +90,37 @@ func (c *BroadcastClientConfig) Enable() bool {
 func BroadcastClientConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.StringSlice(prefix+".url", DefaultBroadcastClientConfig.URLs, "URL of sequencer feed source")
 	f.Duration(prefix+".timeout", DefaultBroadcastClientConfig.Timeout, "duration to wait before timing out connection to sequencer feed")
+	BroadcastClientVerifyConfigAddOptions(prefix+".verify", f)
+	f.Bool(prefix+".enable-compression", DefaultBroadcastClientConfig.EnableCompression, "request per message deflate compression from the sequencer feed")
+	f.Bool(prefix+".enable-binary", DefaultBroadcastClientConfig.EnableBinary, "request the binary message encoding from the sequencer feed")
 }
 
 var DefaultBroadcastClientConfig = BroadcastClientConfig{
-	URLs:    []string{""},
-	Timeout: 20 * time.Second,
+	URLs:              []string{""},
+	Timeout:           20 * time.Second,
+	Verify:            DefaultBroadcastClientVerifyConfig,
+	EnableCompression: false,
+	EnableBinary:      false,
 }
 
 type TransactionStreamerInterface interface {
 	AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error
 }
 
+// FeedMessageReceiver can be implemented by the consumer of a BroadcastClient, such
+// as a relay, to receive the feed messages as they were sent, including their
+// signatures, rather than only their contents.
+type FeedMessageReceiver interface {
+	AddBroadcastFeedMessages(messages []*broadcaster.BroadcastFeedMessage) error
+}
+
+// MessageCounter can be implemented by the consumer of a BroadcastClient, such as
+// the transaction streamer, so that on (re)connecting the client requests the
+// messages after those the consumer already has.
+type MessageCounter interface {
+	GetMessageCount() (arbutil.MessageIndex, error)
+}
+
 type BroadcastClient struct {
 	stopwaiter.StopWaiter
 
@@ -81,14 +133,27 @@ type BroadcastClient struct {
 
 	retryCount int64
 
+	// The sequence number after the last message received, requested on reconnecting
+	// so the server only sends the messages the client is missing, if txStreamer
+	// doesn't implement MessageCounter.
+	nextSeqNum uint64
+
 	retrying                        bool
 	shuttingDown                    bool
 	ConfirmedSequenceNumberListener chan arbutil.MessageIndex
 	idleTimeout                     time.Duration
 	txStreamer                      TransactionStreamerInterface
+	feedReceiver                    FeedMessageReceiver // txStreamer, if it implements FeedMessageReceiver
+	messageCounter                  MessageCounter      // txStreamer, if it implements MessageCounter
+	signer                          *common.Address     // if not nil, the address feed messages must be signed by
+	alertOnly                       bool
+	enableCompression               bool
+	compression                     bool // whether permessage-deflate was negotiated on the current connection
+	enableBinary                    bool
+	binary                          bool // whether the binary encoding was negotiated on the current connection
 }
 
-func NewBroadcastClient(websocketUrl string, lastInboxSeqNum *big.Int, idleTimeout time.Duration, txStreamer TransactionStreamerInterface) *BroadcastClient {
+func NewBroadcastClient(websocketUrl string, lastInboxSeqNum *big.Int, config *BroadcastClientConfig, txStreamer TransactionStreamerInterface) (*BroadcastClient, error) {
 	var seqNum *big.Int
 	if lastInboxSeqNum == nil {
 		seqNum = big.NewInt(0)
@@ -96,19 +161,36 @@ func NewBroadcastClient(websocketUrl string, lastInboxSeqNum *big.Int, idleTimeo
 		seqNum = lastInboxSeqNum
 	}
 
-	return &BroadcastClient{
-		websocketUrl:    websocketUrl,
-		lastInboxSeqNum: seqNum,
-		idleTimeout:     idleTimeout,
-		txStreamer:      txStreamer,
+	var signer *common.Address
+	if config.Verify.Signer != "" {
+		if !common.IsHexAddress(config.Verify.Signer) {
+			return nil, fmt.Errorf("invalid feed signer address \"%s\"", config.Verify.Signer)
+		}
+		address := common.HexToAddress(config.Verify.Signer)
+		signer = &address
 	}
+	feedReceiver, _ := txStreamer.(FeedMessageReceiver)
+	messageCounter, _ := txStreamer.(MessageCounter)
+
+	return &BroadcastClient{
+		websocketUrl:      websocketUrl,
+		lastInboxSeqNum:   seqNum,
+		idleTimeout:       config.Timeout,
+		txStreamer:        txStreamer,
+		feedReceiver:      feedReceiver,
+		messageCounter:    messageCounter,
+		signer:            signer,
+		alertOnly:         config.Verify.AlertOnly,
+		enableCompression: config.EnableCompression,
+		enableBinary:      config.EnableBinary,
+	}, nil
 }
 
 func (bc *BroadcastClient) Start(ctxIn context.Context) {
 	bc.StopWaiter.Start(ctxIn)
 	bc.LaunchThread(func(ctx context.Context) {
 		for {
-			earlyFrameData, err := bc.connect(ctx)
+			earlyFrameData, err := bc.connect(ctx, bc.requestedSeqNum())
 			if err == nil {
 				bc.startBackgroundReader(earlyFrameData)
 				break
@@ -125,29 +207,66 @@ func (bc *BroadcastClient) Start(ctxIn context.Context) {
 	})
 }
 
-func (bc *BroadcastClient) connect(ctx context.Context) (earlyFrameData io.Reader, err error) {
+// requestedSeqNum returns the sequence number of the first message to request on
+// connecting: the consumer's message count if it has one, or otherwise the one
+// after the last message received.
+func (bc *BroadcastClient) requestedSeqNum() uint64 {
+	if bc.messageCounter != nil {
+		count, err := bc.messageCounter.GetMessageCount()
+		if err == nil {
+			return uint64(count)
+		}
+		log.Warn("unable to get message count to request sequencer feed messages from", "url", bc.websocketUrl, "err", err)
+	}
+	return atomic.LoadUint64(&bc.nextSeqNum)
+}
+
+func (bc *BroadcastClient) connect(ctx context.Context, nextSeqNum uint64) (earlyFrameData io.Reader, err error) {
 	if len(bc.websocketUrl) == 0 {
 		// Nothing to do
 		return
 	}
 
-	log.Info("connecting to arbitrum inbox message broadcaster", "url", bc.websocketUrl)
+	log.Info("connecting to arbitrum inbox message broadcaster", "url", bc.websocketUrl, "requestedSeqNum", nextSeqNum)
 	timeoutDialer := ws.Dialer{
 		Timeout: 10 * time.Second,
 		TLSConfig: &tls.Config{
 			MinVersion: tls.VersionTLS12,
 		},
 	}
+	if nextSeqNum > 0 {
+		timeoutDialer.Header = ws.HandshakeHeaderHTTP(http.Header{
+			wsbroadcastserver.HTTPHeaderRequestedSequenceNumber: []string{strconv.FormatUint(nextSeqNum, 10)},
+		})
+	}
+	if bc.enableCompression {
+		timeoutDialer.Extensions = []httphead.Option{wsflate.DefaultParameters.Option()}
+	}
+	if bc.enableBinary {
+		timeoutDialer.Protocols = []string{wsbroadcastserver.BinaryEncodingProtocol}
+	}
 
 	if bc.isShuttingDown() {
 		return
 	}
 
-	conn, br, _, err := timeoutDialer.Dial(ctx, bc.websocketUrl)
+	conn, br, hs, err := timeoutDialer.Dial(ctx, bc.websocketUrl)
 	if err != nil {
 		return nil, errors.Wrap(err, "broadcast client unable to connect")
 	}
 
+	compression := false
+	for _, extension := range hs.Extensions {
+		if bytes.Equal(extension.Name, wsflate.ExtensionNameBytes) {
+			var params wsflate.Parameters
+			if err := params.Parse(extension); err != nil {
+				_ = conn.Close()
+				return nil, errors.Wrap(err, "broadcast client unable to parse compression parameters")
+			}
+			compression = true
+		}
+	}
+
 	if br != nil {
 		// Depending on how long the client takes to read the response, there may be
 		// data after the WebSocket upgrade response in a single read from the socket,
@@ -159,11 +278,15 @@ func (bc *BroadcastClient) connect(ctx context.Context) (earlyFrameData io.Reade
 		earlyFrameData = io.LimitReader(br, int64(br.Buffered()))
 	}
 
+	binary := hs.Protocol == wsbroadcastserver.BinaryEncodingProtocol
+
 	bc.connMutex.Lock()
 	bc.conn = conn
+	bc.compression = compression
+	bc.binary = binary
 	bc.connMutex.Unlock()
 
-	log.Info("Connected")
+	log.Info("Connected", "compression", compression, "binary", binary)
 
 	return
 }
@@ -177,7 +300,7 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 			default:
 			}
 
-			msg, op, err := wsbroadcastserver.ReadData(ctx, bc.conn, earlyFrameData, bc.idleTimeout, ws.StateClientSide)
+			msg, op, err := wsbroadcastserver.ReadData(ctx, bc.conn, earlyFrameData, bc.idleTimeout, ws.StateClientSide, bc.compression)
 			if err != nil {
 				if bc.isShuttingDown() {
 					return
@@ -193,13 +316,19 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 			}
 
 			if msg != nil {
+				receivedBytesMeter.Mark(int64(len(msg)))
 				res := broadcaster.BroadcastMessage{}
-				err = json.Unmarshal(msg, &res)
+				if op == ws.OpBinary {
+					err = res.UnmarshalBinary(msg)
+				} else {
+					err = json.Unmarshal(msg, &res)
+				}
 				if err != nil {
 					log.Error("error unmarshalling message", "msg", msg, "err", err)
 					continue
 				}
 
+				receivedMessagesMeter.Mark(int64(len(res.Messages)))
 				if len(res.Messages) > 0 {
 					log.Debug("received batch item", "count", len(res.Messages), "first seq", res.Messages[0].SequenceNumber)
 				} else if res.ConfirmedSequenceNumberMessage != nil {
@@ -208,13 +337,9 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 					log.Debug("received broadcast with no messages populated", "length", len(msg))
 				}
 
-				if res.Version == 1 {
-					if len(res.Messages) > 0 {
-						messages := []arbstate.MessageWithMetadata{}
-						for _, message := range res.Messages {
-							messages = append(messages, message.Message)
-						}
-						if err := bc.txStreamer.AddBroadcastMessages(res.Messages[0].SequenceNumber, messages); err != nil {
+				if res.Version >= 1 && res.Version <= broadcaster.SignedBroadcastMessageVersion {
+					if feedMessages := bc.verifyMessages(res.Messages); len(feedMessages) > 0 {
+						if err := bc.addMessages(feedMessages); err != nil {
 							log.Error("Error adding message from Sequencer Feed", "err", err)
 						}
 					}
@@ -227,6 +352,52 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 	})
 }
 
+// verifyMessages returns the messages with valid signatures, if signatures are
+// being verified. Messages are added as a contiguous range, so all those after
+// the first one with an invalid signature are dropped too.
+func (bc *BroadcastClient) verifyMessages(messages []*broadcaster.BroadcastFeedMessage) []*broadcaster.BroadcastFeedMessage {
+	if bc.signer == nil {
+		return messages
+	}
+	for i, message := range messages {
+		signer, err := message.RecoverSigner()
+		if err == nil && signer != *bc.signer {
+			err = fmt.Errorf("signed by %v instead of %v", signer, *bc.signer)
+		}
+		if err == nil {
+			continue
+		}
+		if bc.alertOnly {
+			log.Error("Sequencer feed message has an invalid signature", "url", bc.websocketUrl, "seqNum", message.SequenceNumber, "err", err)
+			continue
+		}
+		log.Error("Dropping sequencer feed messages starting from one with an invalid signature", "url", bc.websocketUrl, "seqNum", message.SequenceNumber, "dropped", len(messages)-i, "err", err)
+		return messages[:i]
+	}
+	return messages
+}
+
+func (bc *BroadcastClient) addMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	var err error
+	if bc.feedReceiver != nil {
+		err = bc.feedReceiver.AddBroadcastFeedMessages(feedMessages)
+	} else {
+		messages := []arbstate.MessageWithMetadata{}
+		for _, message := range feedMessages {
+			messages = append(messages, message.Message)
+		}
+		err = bc.txStreamer.AddBroadcastMessages(feedMessages[0].SequenceNumber, messages)
+	}
+	if err != nil {
+		return err
+	}
+	nextSeqNum := uint64(feedMessages[len(feedMessages)-1].SequenceNumber) + 1
+	if nextSeqNum > atomic.LoadUint64(&bc.nextSeqNum) {
+		atomic.StoreUint64(&bc.nextSeqNum, nextSeqNum)
+	}
+	return nil
+}
+
 func (bc *BroadcastClient) GetRetryCount() int64 {
 	return atomic.LoadInt64(&bc.retryCount)
 }
@@ -252,7 +423,8 @@ func (bc *BroadcastClient) retryConnect(ctx context.Context) io.Reader {
 		}
 
 		atomic.AddInt64(&bc.retryCount, 1)
-		earlyFrameData, err := bc.connect(ctx)
+		reconnectsCounter.Inc(1)
+		earlyFrameData, err := bc.connect(ctx, bc.requestedSeqNum())
 		if err == nil {
 			bc.retrying = false
 			return earlyFrameData
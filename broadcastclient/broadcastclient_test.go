@@ -5,12 +5,15 @@ package broadcastclient
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/broadcaster"
@@ -34,9 +37,12 @@ func TestReceiveMessages(t *testing.T) {
 	messageCount := 1000
 	clientCount := 2
 
-	b := broadcaster.NewBroadcaster(settings)
+	b, err := broadcaster.NewBroadcaster(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	err := b.Start(ctx)
+	err = b.Start(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -77,14 +83,35 @@ func (ts *dummyTransactionStreamer) AddBroadcastMessages(pos arbutil.MessageInde
 	return nil
 }
 
-func newTestBroadcastClient(listenerAddress net.Addr, idleTimeout time.Duration, txStreamer TransactionStreamerInterface) *BroadcastClient {
+// countingTransactionStreamer knows how many messages it has, as the node's
+// transaction streamer does.
+type countingTransactionStreamer struct {
+	*dummyTransactionStreamer
+	messageCount arbutil.MessageIndex
+}
+
+func (ts *countingTransactionStreamer) GetMessageCount() (arbutil.MessageIndex, error) {
+	return ts.messageCount, nil
+}
+
+func newTestBroadcastClient(t *testing.T, listenerAddress net.Addr, idleTimeout time.Duration, txStreamer TransactionStreamerInterface) *BroadcastClient {
+	config := DefaultBroadcastClientConfig
+	config.Timeout = idleTimeout
+	return newTestBroadcastClientWithConfig(t, listenerAddress, &config, txStreamer)
+}
+
+func newTestBroadcastClientWithConfig(t *testing.T, listenerAddress net.Addr, config *BroadcastClientConfig, txStreamer TransactionStreamerInterface) *BroadcastClient {
 	port := listenerAddress.(*net.TCPAddr).Port
-	return NewBroadcastClient(fmt.Sprintf("ws://127.0.0.1:%d/", port), nil, idleTimeout, txStreamer)
+	client, err := NewBroadcastClient(fmt.Sprintf("ws://127.0.0.1:%d/", port), nil, config, txStreamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
 }
 
 func startMakeBroadcastClient(ctx context.Context, t *testing.T, addr net.Addr, index int, expectedCount int, wg *sync.WaitGroup) {
 	ts := NewDummyTransactionStreamer()
-	broadcastClient := newTestBroadcastClient(addr, 20*time.Second, ts)
+	broadcastClient := newTestBroadcastClient(t, addr, 20*time.Second, ts)
 	broadcastClient.Start(ctx)
 	messageCount := 0
 
@@ -130,16 +157,19 @@ func TestServerClientDisconnect(t *testing.T) {
 		Workers:       128,
 	}
 
-	b := broadcaster.NewBroadcaster(settings)
+	b, err := broadcaster.NewBroadcaster(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	err := b.Start(ctx)
+	err = b.Start(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer b.StopAndWait()
 
 	ts := NewDummyTransactionStreamer()
-	broadcastClient := newTestBroadcastClient(b.ListenerAddr(), 20*time.Second, ts)
+	broadcastClient := newTestBroadcastClient(t, b.ListenerAddr(), 20*time.Second, ts)
 	broadcastClient.Start(ctx)
 
 	b.BroadcastSingle(arbstate.MessageWithMetadata{}, 0)
@@ -186,15 +216,18 @@ func TestBroadcastClientReconnectsOnServerDisconnect(t *testing.T) {
 		Workers:       128,
 	}
 
-	b1 := broadcaster.NewBroadcaster(settings)
+	b1, err := broadcaster.NewBroadcaster(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	err := b1.Start(ctx)
+	err = b1.Start(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer b1.StopAndWait()
 
-	broadcastClient := newTestBroadcastClient(b1.ListenerAddr(), 2*time.Second, nil)
+	broadcastClient := newTestBroadcastClient(t, b1.ListenerAddr(), 2*time.Second, nil)
 
 	broadcastClient.Start(ctx)
 
@@ -225,9 +258,12 @@ func TestBroadcasterSendsCachedMessagesOnClientConnect(t *testing.T) {
 		Workers:       128,
 	}
 
-	b := broadcaster.NewBroadcaster(settings)
+	b, err := broadcaster.NewBroadcaster(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	err := b.Start(ctx)
+	err = b.Start(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -286,7 +322,7 @@ func TestBroadcasterSendsCachedMessagesOnClientConnect(t *testing.T) {
 
 func connectAndGetCachedMessages(ctx context.Context, addr net.Addr, t *testing.T, clientIndex int, wg *sync.WaitGroup) {
 	ts := NewDummyTransactionStreamer()
-	broadcastClient := newTestBroadcastClient(addr, 60*time.Second, ts)
+	broadcastClient := newTestBroadcastClient(t, addr, 60*time.Second, ts)
 	broadcastClient.Start(ctx)
 
 	go func() {
@@ -327,3 +363,280 @@ func connectAndGetCachedMessages(ctx context.Context, addr net.Addr, t *testing.
 
 	}()
 }
+
+func TestBroadcastClientVerifiesSignatures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sequencerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := wsbroadcastserver.BroadcasterConfig{
+		Addr:          "0.0.0.0",
+		IOTimeout:     2 * time.Second,
+		Port:          "0",
+		Ping:          5 * time.Second,
+		ClientTimeout: 15 * time.Second,
+		Queue:         1,
+		Workers:       128,
+		SigningKey:    hex.EncodeToString(crypto.FromECDSA(sequencerKey)),
+	}
+
+	b, err := broadcaster.NewBroadcaster(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopAndWait()
+
+	// Clients get the cached message when they connect
+	b.BroadcastSingle(arbstate.MessageWithMetadata{}, 0)
+
+	for _, tc := range []struct {
+		name           string
+		signer         *ecdsa.PrivateKey
+		alertOnly      bool
+		expectMessages bool
+	}{
+		{"sequencer signer", sequencerKey, false, true},
+		{"wrong signer", otherKey, false, false},
+		{"wrong signer, alert only", otherKey, true, true},
+	} {
+		config := DefaultBroadcastClientConfig
+		config.Timeout = 20 * time.Second
+		config.Verify.Signer = crypto.PubkeyToAddress(tc.signer.PublicKey).Hex()
+		config.Verify.AlertOnly = tc.alertOnly
+		ts := NewDummyTransactionStreamer()
+		broadcastClient := newTestBroadcastClientWithConfig(t, b.ListenerAddr(), &config, ts)
+		broadcastClient.Start(ctx)
+
+		timer := time.NewTimer(2 * time.Second)
+		select {
+		case <-ts.messageReceiver:
+			if !tc.expectMessages {
+				t.Error(tc.name, "client received message with invalid signature")
+			}
+		case <-timer.C:
+			if tc.expectMessages {
+				t.Error(tc.name, "client did not receive message")
+			}
+		}
+		timer.Stop()
+		broadcastClient.StopAndWait()
+	}
+}
+
+func TestBroadcastClientRequestsMissingMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.BroadcasterConfig{
+		Addr:          "0.0.0.0",
+		IOTimeout:     2 * time.Second,
+		Port:          "0",
+		Ping:          5 * time.Second,
+		ClientTimeout: 15 * time.Second,
+		Queue:         1,
+		Workers:       128,
+	}
+
+	b, err := broadcaster.NewBroadcaster(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopAndWait()
+
+	for i := 0; i < 5; i++ {
+		b.BroadcastSingle(arbstate.MessageWithMetadata{}, arbutil.MessageIndex(i))
+	}
+
+	for _, tc := range []struct {
+		nextSeqNum    uint64
+		messageCount  *arbutil.MessageIndex
+		expectedFirst arbutil.MessageIndex
+	}{
+		{0, nil, 0},
+		{3, nil, 3},
+		// The consumer's message count takes priority over the messages received
+		{3, new(arbutil.MessageIndex), 0},
+	} {
+		ts := NewDummyTransactionStreamer()
+		var txStreamer TransactionStreamerInterface = ts
+		if tc.messageCount != nil {
+			txStreamer = &countingTransactionStreamer{ts, *tc.messageCount}
+		}
+		broadcastClient := newTestBroadcastClient(t, b.ListenerAddr(), 20*time.Second, txStreamer)
+		// As if it had already received the earlier messages before reconnecting
+		broadcastClient.nextSeqNum = tc.nextSeqNum
+		broadcastClient.Start(ctx)
+
+		timer := time.NewTimer(5 * time.Second)
+		for expected := tc.expectedFirst; expected < 5; expected++ {
+			select {
+			case receivedMsg := <-ts.messageReceiver:
+				if receivedMsg.SequenceNumber != expected {
+					t.Fatal("requested", tc.nextSeqNum, "expected message", expected, "got", receivedMsg.SequenceNumber)
+				}
+			case <-timer.C:
+				t.Fatal("requested", tc.nextSeqNum, "client did not receive message", expected)
+			}
+		}
+		timer.Stop()
+		broadcastClient.StopAndWait()
+		if broadcastClient.nextSeqNum != 5 {
+			t.Error("client should next request message 5, got", broadcastClient.nextSeqNum)
+		}
+	}
+}
+
+func TestBroadcastClientCompression(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range []struct {
+		serverCompression   bool
+		clientCompression   bool
+		expectedCompression bool
+	}{
+		{true, true, true},
+		{true, false, false},
+		{false, true, false},
+	} {
+		settings := wsbroadcastserver.BroadcasterConfig{
+			Addr:              "0.0.0.0",
+			IOTimeout:         2 * time.Second,
+			Port:              "0",
+			Ping:              5 * time.Second,
+			ClientTimeout:     15 * time.Second,
+			Queue:             1,
+			Workers:           128,
+			EnableCompression: tc.serverCompression,
+		}
+
+		b, err := broadcaster.NewBroadcaster(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Start(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		config := DefaultBroadcastClientConfig
+		config.EnableCompression = tc.clientCompression
+		ts := NewDummyTransactionStreamer()
+		broadcastClient := newTestBroadcastClientWithConfig(t, b.ListenerAddr(), &config, ts)
+		broadcastClient.Start(ctx)
+
+		for i := 0; i < 5; i++ {
+			b.BroadcastSingle(arbstate.MessageWithMetadata{}, arbutil.MessageIndex(i))
+		}
+
+		timer := time.NewTimer(5 * time.Second)
+		for expected := arbutil.MessageIndex(0); expected < 5; expected++ {
+			select {
+			case receivedMsg := <-ts.messageReceiver:
+				if receivedMsg.SequenceNumber != expected {
+					t.Fatal("expected message", expected, "got", receivedMsg.SequenceNumber)
+				}
+			case <-timer.C:
+				t.Fatal("server compression", tc.serverCompression, "client compression", tc.clientCompression, "client did not receive message", expected)
+			}
+		}
+		timer.Stop()
+
+		broadcastClient.connMutex.Lock()
+		compression := broadcastClient.compression
+		broadcastClient.connMutex.Unlock()
+		if compression != tc.expectedCompression {
+			t.Error("server compression", tc.serverCompression, "client compression", tc.clientCompression, "expected negotiated compression", tc.expectedCompression, "got", compression)
+		}
+
+		broadcastClient.StopAndWait()
+		b.StopAndWait()
+	}
+}
+
+func TestBroadcastClientBinaryEncoding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range []struct {
+		serverBinary   bool
+		clientBinary   bool
+		expectedBinary bool
+	}{
+		{true, true, true},
+		{true, false, false},
+		{false, true, false},
+	} {
+		settings := wsbroadcastserver.BroadcasterConfig{
+			Addr:          "0.0.0.0",
+			IOTimeout:     2 * time.Second,
+			Port:          "0",
+			Ping:          5 * time.Second,
+			ClientTimeout: 15 * time.Second,
+			Queue:         1,
+			Workers:       128,
+			EnableBinary:  tc.serverBinary,
+		}
+
+		b, err := broadcaster.NewBroadcaster(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Start(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		config := DefaultBroadcastClientConfig
+		config.EnableBinary = tc.clientBinary
+		ts := NewDummyTransactionStreamer()
+		broadcastClient := newTestBroadcastClientWithConfig(t, b.ListenerAddr(), &config, ts)
+		broadcastClient.Start(ctx)
+
+		for i := 0; i < 5; i++ {
+			b.BroadcastSingle(arbstate.MessageWithMetadata{DelayedMessagesRead: uint64(i)}, arbutil.MessageIndex(i))
+		}
+
+		timer := time.NewTimer(5 * time.Second)
+		for expected := arbutil.MessageIndex(0); expected < 5; expected++ {
+			select {
+			case receivedMsg := <-ts.messageReceiver:
+				if receivedMsg.SequenceNumber != expected || receivedMsg.Message.DelayedMessagesRead != uint64(expected) {
+					t.Fatal("expected message", expected, "got", receivedMsg.SequenceNumber)
+				}
+			case <-timer.C:
+				t.Fatal("server binary", tc.serverBinary, "client binary", tc.clientBinary, "client did not receive message", expected)
+			}
+		}
+		timer.Stop()
+
+		broadcastClient.connMutex.Lock()
+		binary := broadcastClient.binary
+		broadcastClient.connMutex.Unlock()
+		if binary != tc.expectedBinary {
+			t.Error("server binary", tc.serverBinary, "client binary", tc.clientBinary, "expected negotiated binary encoding", tc.expectedBinary, "got", binary)
+		}
+
+		broadcastClient.StopAndWait()
+		b.StopAndWait()
+	}
+}
@@ -0,0 +1,435 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+const (
+	backlogSegmentSuffix = ".feed"
+	backlogConfirmedFile = "confirmed"
+
+	// Each record is the message's sequence number, then the length and CRC32
+	// checksum of the message's JSON encoding, then the JSON itself.
+	backlogRecordHeaderSize = 16
+)
+
+type backlogEntry struct {
+	seqNum arbutil.MessageIndex
+	offset int64
+	length uint32
+}
+
+// backlogSegment is a file holding the backlog's messages from a range of
+// sequence numbers, starting at first.
+type backlogSegment struct {
+	first     arbutil.MessageIndex
+	path      string
+	entries   []backlogEntry
+	size      int64
+	lastWrite time.Time
+}
+
+// diskBacklog persists broadcast feed messages to segment files, each holding
+// the messages from a range of SegmentMessages sequence numbers. Once the backlog
+// is too large or old its oldest segments are deleted. Messages are only ever
+// appended in increasing sequence number order, though there may be gaps.
+// Clients catching up read it concurrently with the broadcaster appending to it.
+type diskBacklog struct {
+	config *wsbroadcastserver.BacklogConfig
+
+	mutex    sync.Mutex        // protects the fields below
+	segments []*backlogSegment // oldest first
+	file     *os.File          // the last segment, open for appending
+
+	last    arbutil.MessageIndex // last sequence number stored
+	hasLast bool
+
+	confirmed    arbutil.MessageIndex
+	hasConfirmed bool
+
+	// Overridden in tests to simulate the passage of time.
+	now func() time.Time
+}
+
+func segmentPath(dir string, first arbutil.MessageIndex) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", first, backlogSegmentSuffix))
+}
+
+// openDiskBacklog loads the backlog stored in the configured directory, creating
+// it if needed.
+func openDiskBacklog(config *wsbroadcastserver.BacklogConfig) (*diskBacklog, error) {
+	if config.Dir == "" {
+		return nil, errors.New("feed backlog enabled without a directory to store it in")
+	}
+	if config.SegmentMessages == 0 {
+		return nil, errors.New("feed backlog segment-messages must be positive")
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+	b := &diskBacklog{
+		config: config,
+		now:    time.Now,
+	}
+
+	dirEntries, err := os.ReadDir(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var firsts []arbutil.MessageIndex
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || !strings.HasSuffix(name, backlogSegmentSuffix) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, backlogSegmentSuffix), 10, 64)
+		if err != nil {
+			log.Warn("ignoring unexpected file in feed backlog directory", "file", name)
+			continue
+		}
+		firsts = append(firsts, arbutil.MessageIndex(first))
+	}
+	sort.Slice(firsts, func(i, j int) bool { return firsts[i] < firsts[j] })
+	for _, first := range firsts {
+		segment, err := b.loadSegment(first)
+		if err != nil {
+			return nil, err
+		}
+		if segment != nil {
+			b.segments = append(b.segments, segment)
+		}
+	}
+
+	confirmed, err := os.ReadFile(filepath.Join(config.Dir, backlogConfirmedFile))
+	if err == nil {
+		seqNum, err := strconv.ParseUint(strings.TrimSpace(string(confirmed)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid confirmed sequence number in feed backlog: %w", err)
+		}
+		b.confirmed = arbutil.MessageIndex(seqNum)
+		b.hasConfirmed = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if len(b.segments) > 0 {
+		b.file, err = os.OpenFile(b.segments[len(b.segments)-1].path, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+	b.prune()
+	return b, nil
+}
+
+// loadSegment indexes the messages in a segment file, truncating it after the
+// last intact message, as the last one may have been partly written when the
+// process stopped. Segments left without messages are deleted.
+func (b *diskBacklog) loadSegment(first arbutil.MessageIndex) (*backlogSegment, error) {
+	path := segmentPath(b.config.Dir, first)
+	file, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	segment := &backlogSegment{
+		first:     first,
+		path:      path,
+		lastWrite: info.ModTime(),
+	}
+	minSeqNum := first
+	if b.hasLast && b.last >= minSeqNum {
+		minSeqNum = b.last + 1
+	}
+	reader := bufio.NewReader(file)
+	header := make([]byte, backlogRecordHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+		seqNum := arbutil.MessageIndex(binary.BigEndian.Uint64(header))
+		length := binary.BigEndian.Uint32(header[8:])
+		checksum := binary.BigEndian.Uint32(header[12:])
+		if seqNum < minSeqNum || int64(length) > info.Size()-segment.size-backlogRecordHeaderSize {
+			break
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+		if crc32.ChecksumIEEE(data) != checksum {
+			break
+		}
+		segment.entries = append(segment.entries, backlogEntry{seqNum: seqNum, offset: segment.size, length: length})
+		segment.size += backlogRecordHeaderSize + int64(length)
+		minSeqNum = seqNum + 1
+	}
+
+	if segment.size < info.Size() {
+		log.Warn("truncating feed backlog segment after its last intact message", "file", path, "size", info.Size(), "truncatedSize", segment.size)
+		if err := file.Truncate(segment.size); err != nil {
+			return nil, err
+		}
+	}
+	if len(segment.entries) == 0 {
+		return nil, os.Remove(path)
+	}
+	b.last = segment.entries[len(segment.entries)-1].seqNum
+	b.hasLast = true
+	return segment, nil
+}
+
+// append stores a message, unless a message with the same or a later sequence
+// number is already stored.
+func (b *diskBacklog) append(msg *BroadcastFeedMessage) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.hasLast && msg.SequenceNumber <= b.last {
+		return nil
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	rangeStart := msg.SequenceNumber - msg.SequenceNumber%arbutil.MessageIndex(b.config.SegmentMessages)
+	if len(b.segments) == 0 || rangeStart > b.segments[len(b.segments)-1].first {
+		if err := b.startSegment(rangeStart); err != nil {
+			return err
+		}
+	}
+	segment := b.segments[len(b.segments)-1]
+
+	record := make([]byte, backlogRecordHeaderSize+len(data))
+	binary.BigEndian.PutUint64(record, uint64(msg.SequenceNumber))
+	binary.BigEndian.PutUint32(record[8:], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[12:], crc32.ChecksumIEEE(data))
+	copy(record[backlogRecordHeaderSize:], data)
+	if _, err := b.file.Write(record); err != nil {
+		// Don't leave a partly written record for later ones to be appended after
+		if truncateErr := b.file.Truncate(segment.size); truncateErr != nil {
+			log.Error("error truncating feed backlog segment after failed write", "file", segment.path, "err", truncateErr)
+		}
+		return err
+	}
+	segment.entries = append(segment.entries, backlogEntry{seqNum: msg.SequenceNumber, offset: segment.size, length: uint32(len(data))})
+	segment.size += int64(len(record))
+	segment.lastWrite = b.now()
+	b.last = msg.SequenceNumber
+	b.hasLast = true
+	return nil
+}
+
+// startSegment closes the segment being appended to, and starts a new one.
+func (b *diskBacklog) startSegment(first arbutil.MessageIndex) error {
+	if err := b.closeFile(); err != nil {
+		return err
+	}
+	path := segmentPath(b.config.Dir, first)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	b.file = file
+	b.segments = append(b.segments, &backlogSegment{
+		first:     first,
+		path:      path,
+		lastWrite: b.now(),
+	})
+	b.prune()
+	return nil
+}
+
+// read returns up to limit stored messages, with sequence numbers from start up
+// to but not including end.
+func (b *diskBacklog) read(start, end arbutil.MessageIndex, limit int) ([]*BroadcastFeedMessage, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.readLocked(start, end, limit)
+}
+
+func (b *diskBacklog) readLocked(start, end arbutil.MessageIndex, limit int) ([]*BroadcastFeedMessage, error) {
+	var messages []*BroadcastFeedMessage
+	for _, segment := range b.segments {
+		if len(messages) >= limit {
+			break
+		}
+		entries := segment.entries
+		i := sort.Search(len(entries), func(i int) bool { return entries[i].seqNum >= start })
+		j := sort.Search(len(entries), func(i int) bool { return entries[i].seqNum >= end })
+		if j-i > limit-len(messages) {
+			j = i + limit - len(messages)
+		}
+		if i >= j {
+			continue
+		}
+		segmentMessages, err := segment.read(entries[i:j])
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, segmentMessages...)
+	}
+	return messages, nil
+}
+
+func (s *backlogSegment) read(entries []backlogEntry) ([]*BroadcastFeedMessage, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	first, last := entries[0], entries[len(entries)-1]
+	data := make([]byte, last.offset+backlogRecordHeaderSize+int64(last.length)-first.offset)
+	if _, err := file.ReadAt(data, first.offset); err != nil {
+		return nil, err
+	}
+	messages := make([]*BroadcastFeedMessage, 0, len(entries))
+	for _, entry := range entries {
+		record := data[entry.offset-first.offset:]
+		payload := record[backlogRecordHeaderSize : backlogRecordHeaderSize+entry.length]
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(record[12:]) {
+			return nil, fmt.Errorf("feed backlog segment %v corrupt at sequence number %v", s.path, entry.seqNum)
+		}
+		msg := &BroadcastFeedMessage{}
+		if err := json.Unmarshal(payload, msg); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// unconfirmed returns the stored messages after the last confirmed sequence
+// number, as far back as they're sequential, but no more than the latest limit
+// of them (0 = no limit). They're read a chunk at a time, so only those returned
+// are held at once.
+func (b *diskBacklog) unconfirmed(limit uint64) ([]*BroadcastFeedMessage, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.hasLast {
+		return nil, nil
+	}
+	var start arbutil.MessageIndex
+	if b.hasConfirmed {
+		start = b.confirmed + 1
+	}
+	if limit > 0 && uint64(b.last) >= limit && b.last+1-arbutil.MessageIndex(limit) > start {
+		start = b.last + 1 - arbutil.MessageIndex(limit)
+	}
+	var messages []*BroadcastFeedMessage
+	for start <= b.last {
+		chunk, err := b.readLocked(start, b.last+1, backlogCatchupChunkSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		for _, msg := range chunk {
+			if len(messages) > 0 && msg.SequenceNumber != messages[len(messages)-1].SequenceNumber+1 {
+				messages = nil
+			}
+			messages = append(messages, msg)
+		}
+		start = chunk[len(chunk)-1].SequenceNumber + 1
+	}
+	return messages, nil
+}
+
+// confirm records the confirmed sequence number, so that only the messages after
+// it are restored to the catchup buffer on restart.
+func (b *diskBacklog) confirm(seqNum arbutil.MessageIndex) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.hasConfirmed && seqNum <= b.confirmed {
+		return nil
+	}
+	path := filepath.Join(b.config.Dir, backlogConfirmedFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.FormatUint(uint64(seqNum), 10)), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	b.confirmed = seqNum
+	b.hasConfirmed = true
+	b.prune()
+	return nil
+}
+
+// prune deletes the oldest segments while the backlog is too large or old,
+// always keeping the segment being appended to.
+func (b *diskBacklog) prune() {
+	var size int64
+	for _, segment := range b.segments {
+		size += segment.size
+	}
+	now := b.now()
+	for len(b.segments) > 1 {
+		oldest := b.segments[0]
+		tooLarge := b.config.MaxSize > 0 && uint64(size) > b.config.MaxSize
+		tooOld := b.config.MaxAge > 0 && now.Sub(oldest.lastWrite) > b.config.MaxAge
+		if !tooLarge && !tooOld {
+			return
+		}
+		if err := os.Remove(oldest.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn("error deleting feed backlog segment", "file", oldest.path, "err", err)
+			return
+		}
+		size -= oldest.size
+		b.segments = b.segments[1:]
+	}
+}
+
+func (b *diskBacklog) closeFile() error {
+	if b.file == nil {
+		return nil
+	}
+	file := b.file
+	b.file = nil
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// close syncs the segment being appended to and closes it.
+func (b *diskBacklog) close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.closeFile()
+}
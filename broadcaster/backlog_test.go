@@ -0,0 +1,253 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func testBacklogConfig(t *testing.T) *wsbroadcastserver.BacklogConfig {
+	return &wsbroadcastserver.BacklogConfig{
+		Enable:          true,
+		Dir:             t.TempDir(),
+		SegmentMessages: 10,
+	}
+}
+
+func appendMessages(t *testing.T, backlog *diskBacklog, from, to arbutil.MessageIndex) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		msg := &BroadcastFeedMessage{
+			SequenceNumber: i,
+			Message:        arbstate.MessageWithMetadata{DelayedMessagesRead: uint64(i)},
+		}
+		Require(t, backlog.append(msg))
+	}
+}
+
+func expectSequenceNumbers(t *testing.T, messages []*BroadcastFeedMessage, from, to arbutil.MessageIndex) {
+	t.Helper()
+	if len(messages) != int(to-from) {
+		Fail(t, "expected messages", from, "to", to, "got", len(messages), "messages")
+	}
+	for i, msg := range messages {
+		expected := from + arbutil.MessageIndex(i)
+		if msg.SequenceNumber != expected || msg.Message.DelayedMessagesRead != uint64(expected) {
+			Fail(t, "expected message", expected, "got", msg.SequenceNumber)
+		}
+	}
+}
+
+func TestDiskBacklogAppendAndRead(t *testing.T) {
+	config := testBacklogConfig(t)
+	backlog, err := openDiskBacklog(config)
+	Require(t, err)
+
+	appendMessages(t, backlog, 5, 25)
+	// Already stored messages aren't stored again
+	appendMessages(t, backlog, 20, 25)
+	// A gap in the sequence numbers
+	appendMessages(t, backlog, 28, 35)
+	if len(backlog.segments) != 4 {
+		Fail(t, "expected 4 segments, got", len(backlog.segments))
+	}
+
+	readAndCheck := func(backlog *diskBacklog) {
+		messages, err := backlog.read(0, math.MaxUint64, math.MaxInt)
+		Require(t, err)
+		expectSequenceNumbers(t, messages[:20], 5, 25)
+		expectSequenceNumbers(t, messages[20:], 28, 35)
+
+		messages, err = backlog.read(8, 17, math.MaxInt)
+		Require(t, err)
+		expectSequenceNumbers(t, messages, 8, 17)
+
+		messages, err = backlog.read(12, math.MaxUint64, 3)
+		Require(t, err)
+		expectSequenceNumbers(t, messages, 12, 15)
+
+		messages, err = backlog.read(35, math.MaxUint64, math.MaxInt)
+		Require(t, err)
+		expectSequenceNumbers(t, messages, 35, 35)
+	}
+	readAndCheck(backlog)
+	Require(t, backlog.close())
+
+	backlog, err = openDiskBacklog(config)
+	Require(t, err)
+	readAndCheck(backlog)
+	appendMessages(t, backlog, 35, 37)
+	messages, err := backlog.read(30, math.MaxUint64, math.MaxInt)
+	Require(t, err)
+	expectSequenceNumbers(t, messages, 30, 37)
+	Require(t, backlog.close())
+}
+
+func TestDiskBacklogUnconfirmed(t *testing.T) {
+	config := testBacklogConfig(t)
+	backlog, err := openDiskBacklog(config)
+	Require(t, err)
+
+	appendMessages(t, backlog, 0, 15)
+	appendMessages(t, backlog, 18, 22)
+	messages, err := backlog.unconfirmed(0)
+	Require(t, err)
+	// Only the messages after the gap are sequential with the latest
+	expectSequenceNumbers(t, messages, 18, 22)
+
+	Require(t, backlog.confirm(19))
+	Require(t, backlog.confirm(3))
+	Require(t, backlog.close())
+
+	backlog, err = openDiskBacklog(config)
+	Require(t, err)
+	messages, err = backlog.unconfirmed(0)
+	Require(t, err)
+	expectSequenceNumbers(t, messages, 20, 22)
+	// Only the latest messages are restored beyond the limit
+	messages, err = backlog.unconfirmed(1)
+	Require(t, err)
+	expectSequenceNumbers(t, messages, 21, 22)
+	Require(t, backlog.close())
+}
+
+func TestDiskBacklogTruncatesPartialMessage(t *testing.T) {
+	config := testBacklogConfig(t)
+	backlog, err := openDiskBacklog(config)
+	Require(t, err)
+	appendMessages(t, backlog, 0, 15)
+	lastSegment := backlog.segments[len(backlog.segments)-1]
+	intactSize := lastSegment.size
+	Require(t, backlog.close())
+
+	// Simulate the process stopping partway through writing a message
+	file, err := os.OpenFile(lastSegment.path, os.O_WRONLY|os.O_APPEND, 0600)
+	Require(t, err)
+	_, err = file.Write([]byte{0, 0, 0, 0, 0, 0, 0, 15, 0, 0, 1})
+	Require(t, err)
+	Require(t, file.Close())
+
+	backlog, err = openDiskBacklog(config)
+	Require(t, err)
+	info, err := os.Stat(lastSegment.path)
+	Require(t, err)
+	if info.Size() != intactSize {
+		Fail(t, "expected the partial message to be truncated, size", info.Size(), "expected", intactSize)
+	}
+	appendMessages(t, backlog, 15, 17)
+	messages, err := backlog.read(0, math.MaxUint64, math.MaxInt)
+	Require(t, err)
+	expectSequenceNumbers(t, messages, 0, 17)
+	Require(t, backlog.close())
+}
+
+func TestDiskBacklogRetention(t *testing.T) {
+	config := testBacklogConfig(t)
+	backlog, err := openDiskBacklog(config)
+	Require(t, err)
+	now := time.Now()
+	backlog.now = func() time.Time { return now }
+
+	appendMessages(t, backlog, 0, 10)
+	segmentSize := backlog.segments[0].size
+	Require(t, backlog.close())
+
+	config.MaxSize = uint64(segmentSize) * 2
+	backlog, err = openDiskBacklog(config)
+	Require(t, err)
+	backlog.now = func() time.Time { return now }
+	appendMessages(t, backlog, 10, 40)
+	if len(backlog.segments) != 2 || backlog.segments[0].first != 20 {
+		Fail(t, "expected the oldest segments to be deleted once the backlog is too large, got", len(backlog.segments), "segments")
+	}
+	if _, err := os.Stat(segmentPath(config.Dir, 0)); !os.IsNotExist(err) {
+		Fail(t, "expected the oldest segment's file to be deleted", err)
+	}
+
+	config.MaxSize = 0
+	config.MaxAge = time.Hour
+	appendMessages(t, backlog, 40, 50)
+	now = now.Add(90 * time.Minute)
+	appendMessages(t, backlog, 50, 52)
+	if len(backlog.segments) != 1 || backlog.segments[0].first != 50 {
+		Fail(t, "expected the segments written over an hour ago to be deleted, got", len(backlog.segments), "segments")
+	}
+	Require(t, backlog.close())
+}
+
+func TestBroadcasterServesBacklogAfterRestart(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	broadcasterSettings := wsbroadcastserver.BroadcasterConfig{
+		Addr:          "127.0.0.1",
+		IOTimeout:     2 * time.Second,
+		Port:          "0",
+		Ping:          5 * time.Second,
+		ClientTimeout: 30 * time.Second,
+		Queue:         1,
+		Workers:       128,
+		Backlog:       *testBacklogConfig(t),
+	}
+
+	b, err := NewBroadcaster(broadcasterSettings)
+	Require(t, err)
+	Require(t, b.Start(ctx))
+	for i := 0; i < 25; i++ {
+		b.BroadcastSingle(arbstate.MessageWithMetadata{DelayedMessagesRead: uint64(i)}, arbutil.MessageIndex(i))
+	}
+	b.Confirm(19)
+	waitUntilUpdated(t, &messageCountPredicate{b, 5, "after confirming 20 of 25 messages", 0})
+	b.StopAndWait()
+
+	b, err = NewBroadcaster(broadcasterSettings)
+	Require(t, err)
+	if b.GetCachedMessageCount() != 5 {
+		Fail(t, "expected the 5 unconfirmed messages to be restored, got", b.GetCachedMessageCount())
+	}
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	readMessages := func(requestedSeqNum arbutil.MessageIndex, expectedCount int) []*BroadcastFeedMessage {
+		dialer := ws.Dialer{
+			Timeout: 5 * time.Second,
+			Header: ws.HandshakeHeaderHTTP(http.Header{
+				wsbroadcastserver.HTTPHeaderRequestedSequenceNumber: []string{fmt.Sprint(requestedSeqNum)},
+			}),
+		}
+		conn, _, _, err := dialer.Dial(ctx, fmt.Sprintf("ws://%s/", b.ListenerAddr().String()))
+		Require(t, err)
+		defer conn.Close()
+		var messages []*BroadcastFeedMessage
+		for len(messages) < expectedCount {
+			data, _, err := wsbroadcastserver.ReadData(ctx, conn, nil, 5*time.Second, ws.StateClientSide, false)
+			Require(t, err)
+			if len(data) == 0 {
+				continue
+			}
+			var msg BroadcastMessage
+			Require(t, json.Unmarshal(data, &msg))
+			messages = append(messages, msg.Messages...)
+		}
+		return messages
+	}
+
+	// Confirmed messages are served from the backlog, followed by the cached ones
+	expectSequenceNumbers(t, readMessages(3, 22), 3, 25)
+	expectSequenceNumbers(t, readMessages(22, 3), 22, 25)
+	// New clients are only sent the cached messages
+	expectSequenceNumbers(t, readMessages(0, 5), 20, 25)
+}
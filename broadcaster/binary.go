@@ -0,0 +1,85 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/offchainlabs/nitro/arbos"
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
+)
+
+// binaryBroadcastMessage is the RLP encoding of a BroadcastMessage sent to
+// clients negotiating wsbroadcastserver.BinaryEncodingProtocol. The version
+// comes first, as in the JSON encoding, and decoding ignores fields added
+// after the known ones, here and in each feed message, so that the format
+// stays forwards compatible.
+type binaryBroadcastMessage struct {
+	Version                        uint64
+	Messages                       []binaryFeedMessage
+	ConfirmedSequenceNumberMessage *ConfirmedSequenceNumberMessage `rlp:"nil"`
+	SequenceNumberHeartbeatMessage *SequenceNumberHeartbeatMessage `rlp:"nil"`
+	Rest                           []rlp.RawValue                  `rlp:"tail"`
+}
+
+type binaryFeedMessage struct {
+	SequenceNumber      arbutil.MessageIndex
+	Message             *arbos.L1IncomingMessage `rlp:"nil"`
+	DelayedMessagesRead uint64
+	Signature           []byte
+	Rest                []rlp.RawValue `rlp:"tail"`
+}
+
+// MarshalBinary encodes the message as sent to clients which negotiated the
+// binary encoding.
+func (m BroadcastMessage) MarshalBinary() ([]byte, error) {
+	if m.Version < 0 {
+		return nil, fmt.Errorf("invalid broadcast message version %v", m.Version)
+	}
+	encoded := binaryBroadcastMessage{
+		Version:                        uint64(m.Version),
+		ConfirmedSequenceNumberMessage: m.ConfirmedSequenceNumberMessage,
+		SequenceNumberHeartbeatMessage: m.SequenceNumberHeartbeatMessage,
+	}
+	for _, msg := range m.Messages {
+		encoded.Messages = append(encoded.Messages, binaryFeedMessage{
+			SequenceNumber:      msg.SequenceNumber,
+			Message:             msg.Message.Message,
+			DelayedMessagesRead: msg.Message.DelayedMessagesRead,
+			Signature:           msg.Signature,
+		})
+	}
+	return rlp.EncodeToBytes(&encoded)
+}
+
+// UnmarshalBinary decodes a message encoded by MarshalBinary.
+func (m *BroadcastMessage) UnmarshalBinary(data []byte) error {
+	var decoded binaryBroadcastMessage
+	if err := rlp.DecodeBytes(data, &decoded); err != nil {
+		return err
+	}
+	*m = BroadcastMessage{
+		Version:                        int(decoded.Version),
+		ConfirmedSequenceNumberMessage: decoded.ConfirmedSequenceNumberMessage,
+		SequenceNumberHeartbeatMessage: decoded.SequenceNumberHeartbeatMessage,
+	}
+	for _, msg := range decoded.Messages {
+		var signature []byte
+		if len(msg.Signature) > 0 {
+			signature = msg.Signature
+		}
+		m.Messages = append(m.Messages, &BroadcastFeedMessage{
+			SequenceNumber: msg.SequenceNumber,
+			Message: arbstate.MessageWithMetadata{
+				Message:             msg.Message,
+				DelayedMessagesRead: msg.DelayedMessagesRead,
+			},
+			Signature: signature,
+		})
+	}
+	return nil
+}
@@ -5,20 +5,52 @@ package broadcaster
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math"
 	"net"
 	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/das"
 	"github.com/offchainlabs/nitro/wsbroadcastserver"
 )
 
+var (
+	messagesBroadcastMeter = metrics.NewRegisteredMeter("arb/feed/messages", nil)
+	cachedMessagesGauge    = metrics.NewRegisteredGauge("arb/feed/cached", nil)
+	catchupTimer           = metrics.NewRegisteredTimer("arb/feed/catchup/duration", nil)
+	catchupMessagesMeter   = metrics.NewRegisteredMeter("arb/feed/catchup/messages", nil)
+)
+
 type Broadcaster struct {
 	server        *wsbroadcastserver.WSBroadcastServer
 	catchupBuffer *SequenceNumberCatchupBuffer
+	signingKey    *ecdsa.PrivateKey // if not nil, the key feed messages are signed with
+}
+
+// BroadcastMessageVersion is the version of broadcast messages without sequencer
+// signatures, which all clients accept.
+const BroadcastMessageVersion = 1
+
+// SignedBroadcastMessageVersion added sequencer signatures to feed messages.
+// Clients predating it only accept version 1, so it's only sent for signed messages.
+const SignedBroadcastMessageVersion = 2
+
+// broadcastMessageVersion returns the version to send the messages with.
+func broadcastMessageVersion(messages []*BroadcastFeedMessage) int {
+	for _, message := range messages {
+		if len(message.Signature) > 0 {
+			return SignedBroadcastMessageVersion
+		}
+	}
+	return BroadcastMessageVersion
 }
 
 /*
@@ -42,33 +74,149 @@ type BroadcastMessage struct {
 	// TODO better name than messages since there are different types of messages
 	Messages                       []*BroadcastFeedMessage         `json:"messages,omitempty"`
 	ConfirmedSequenceNumberMessage *ConfirmedSequenceNumberMessage `json:"confirmedSequenceNumberMessage,omitempty"`
+	SequenceNumberHeartbeatMessage *SequenceNumberHeartbeatMessage `json:"sequenceNumberHeartbeatMessage,omitempty"`
 }
 
 type BroadcastFeedMessage struct {
 	SequenceNumber arbutil.MessageIndex         `json:"sequenceNumber"`
 	Message        arbstate.MessageWithMetadata `json:"message"`
+	Signature      hexutil.Bytes                `json:"signature,omitempty"`
+
+	// if not nil, shares the message's transaction addresses between feed filters
+	txAddresses *feedMessageTxAddresses
 }
 
 type ConfirmedSequenceNumberMessage struct {
 	SequenceNumber arbutil.MessageIndex `json:"sequenceNumber"`
 }
 
+// SequenceNumberHeartbeatMessage is sent to clients with a feed filter, when
+// messages are filtered out, with the latest sequence number broadcast, so that
+// they can tell filtered messages from missing ones.
+type SequenceNumberHeartbeatMessage struct {
+	SequenceNumber arbutil.MessageIndex `json:"sequenceNumber"`
+}
+
+// Maximum number of messages read from the backlog and sent to a client at once
+const backlogCatchupChunkSize = 1000
+
 type SequenceNumberCatchupBuffer struct {
 	messages     []*BroadcastFeedMessage
 	messageCount int32
+	backlog      *diskBacklog // if not nil, where messages are persisted
 }
 
 func NewSequenceNumberCatchupBuffer() *SequenceNumberCatchupBuffer {
 	return &SequenceNumberCatchupBuffer{}
 }
 
+// getCacheMessages returns the cached messages starting from requestedSeqNum.
+func (b *SequenceNumberCatchupBuffer) getCacheMessages(requestedSeqNum arbutil.MessageIndex) []*BroadcastFeedMessage {
+	if len(b.messages) == 0 {
+		return nil
+	}
+	firstCachedSeqNum := b.messages[0].SequenceNumber
+	if requestedSeqNum <= firstCachedSeqNum {
+		// The client is new or missing messages older than the buffer, send everything we've got
+		return b.messages
+	}
+	startingIndex := uint64(requestedSeqNum - firstCachedSeqNum)
+	if startingIndex >= uint64(len(b.messages)) {
+		// The client already has all the cached messages
+		return nil
+	}
+	if b.messages[startingIndex].SequenceNumber != requestedSeqNum {
+		log.Error("Invariant violation: Non-sequential messages stored in SequenceNumberCatchupBuffer, sending client all of them", "found", b.messages[startingIndex].SequenceNumber, "expected", requestedSeqNum)
+		return b.messages
+	}
+	return b.messages[startingIndex:]
+}
+
+// restoreBacklog makes the buffer persist messages to the backlog, restoring the
+// unconfirmed messages stored in it.
+func (b *SequenceNumberCatchupBuffer) restoreBacklog(backlog *diskBacklog) error {
+	messages, err := backlog.unconfirmed(backlog.config.MaxRestored)
+	if err != nil {
+		return err
+	}
+	b.backlog = backlog
+	b.messages = messages
+	atomic.StoreInt32(&b.messageCount, int32(len(b.messages)))
+	return nil
+}
+
+// sendBacklog sends the client the messages stored in the backlog, with sequence
+// numbers from start up to but not including end, a chunk at a time.
+func (b *SequenceNumberCatchupBuffer) sendBacklog(ctx context.Context, clientConnection *wsbroadcastserver.ClientConnection, start, end arbutil.MessageIndex) (int, error) {
+	sentCount := 0
+	for start < end {
+		if ctx.Err() != nil {
+			return sentCount, ctx.Err()
+		}
+		messages, err := b.backlog.read(start, end, backlogCatchupChunkSize)
+		if err != nil {
+			return sentCount, err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		bm := BroadcastMessage{
+			Version:  broadcastMessageVersion(messages),
+			Messages: messages,
+		}
+		if err := clientConnection.Write(bm); err != nil {
+			return sentCount, err
+		}
+		sentCount += len(messages)
+		start = messages[len(messages)-1].SequenceNumber + 1
+	}
+	return sentCount, nil
+}
+
 func (b *SequenceNumberCatchupBuffer) OnRegisterClient(ctx context.Context, clientConnection *wsbroadcastserver.ClientConnection) error {
 	start := time.Now()
-	if len(b.messages) > 0 {
-		// send the newly connected client all the messages we've got...
+	requestedSeqNum := clientConnection.RequestedSeqNum()
+	messages := b.getCacheMessages(requestedSeqNum)
+	if b.backlog != nil && requestedSeqNum > 0 && (len(b.messages) == 0 || requestedSeqNum < b.messages[0].SequenceNumber) {
+		// The client requested messages older than the cache, so they're sent from
+		// the backlog, followed by the cached ones, on the client's own goroutine.
+		end := arbutil.MessageIndex(math.MaxUint64)
+		if len(b.messages) > 0 {
+			end = b.messages[0].SequenceNumber
+		}
+		clientConnection.CatchupInBackground(func(ctx context.Context) error {
+			if b.backlog.config.CatchupTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, b.backlog.config.CatchupTimeout)
+				defer cancel()
+			}
+			backlogCount, err := b.sendBacklog(ctx, clientConnection, requestedSeqNum, end)
+			if err != nil {
+				log.Warn("error sending client backlog messages", "err", err, "client", clientConnection.Name, "sentCount", backlogCount, "elapsed", time.Since(start))
+				return err
+			}
+			if len(messages) > 0 {
+				bm := BroadcastMessage{
+					Version:  broadcastMessageVersion(messages),
+					Messages: messages,
+				}
+				if err := clientConnection.Write(bm); err != nil {
+					log.Error("error sending client cached messages", "err", err, "client", clientConnection.Name, "elapsed", time.Since(start))
+					return err
+				}
+			}
+			catchupTimer.UpdateSince(start)
+			catchupMessagesMeter.Mark(int64(backlogCount + len(messages)))
+			log.Info("client caught up from backlog", "client", clientConnection.Name, "requestedSeqNum", requestedSeqNum, "sentCount", backlogCount+len(messages), "elapsed", time.Since(start))
+			return nil
+		})
+		return nil
+	}
+	if len(messages) > 0 {
+		// send the newly connected client all the messages it's missing...
 		bm := BroadcastMessage{
-			Version:  1,
-			Messages: b.messages,
+			Version:  broadcastMessageVersion(messages),
+			Messages: messages,
 		}
 
 		err := clientConnection.Write(bm)
@@ -78,7 +226,9 @@ func (b *SequenceNumberCatchupBuffer) OnRegisterClient(ctx context.Context, clie
 		}
 	}
 
-	log.Info("client registered", "client", clientConnection.Name, "elapsed", time.Since(start))
+	catchupTimer.UpdateSince(start)
+	catchupMessagesMeter.Mark(int64(len(messages)))
+	log.Info("client registered", "client", clientConnection.Name, "requestedSeqNum", requestedSeqNum, "sentCount", len(messages), "elapsed", time.Since(start))
 
 	return nil
 }
@@ -88,9 +238,17 @@ func (b *SequenceNumberCatchupBuffer) OnDoBroadcast(bmi interface{}) error {
 	if !ok {
 		log.Crit("Requested to broadcast messasge of unknown type")
 	}
-	defer func() { atomic.StoreInt32(&b.messageCount, int32(len(b.messages))) }()
+	defer func() {
+		atomic.StoreInt32(&b.messageCount, int32(len(b.messages)))
+		cachedMessagesGauge.Update(int64(len(b.messages)))
+	}()
 
 	if confirmMsg := broadcastMessage.ConfirmedSequenceNumberMessage; confirmMsg != nil {
+		if b.backlog != nil {
+			if err := b.backlog.confirm(confirmMsg.SequenceNumber); err != nil {
+				log.Error("error recording confirmed sequence number in feed backlog", "seqNum", confirmMsg.SequenceNumber, "err", err)
+			}
+		}
 		if len(b.messages) == 0 {
 			return nil
 		}
@@ -120,7 +278,13 @@ func (b *SequenceNumberCatchupBuffer) OnDoBroadcast(bmi interface{}) error {
 		return nil
 	}
 
+	messagesBroadcastMeter.Mark(int64(len(broadcastMessage.Messages)))
 	for _, newMsg := range broadcastMessage.Messages {
+		if b.backlog != nil {
+			if err := b.backlog.append(newMsg); err != nil {
+				log.Error("error persisting message to feed backlog", "seqNum", newMsg.SequenceNumber, "err", err)
+			}
+		}
 		if len(b.messages) == 0 {
 			b.messages = append(b.messages, newMsg)
 		} else if expectedSequenceNumber := b.messages[len(b.messages)-1].SequenceNumber + 1; newMsg.SequenceNumber == expectedSequenceNumber {
@@ -146,35 +310,60 @@ func (b *SequenceNumberCatchupBuffer) GetMessageCount() int {
 	return int(atomic.LoadInt32(&b.messageCount))
 }
 
-func NewBroadcaster(settings wsbroadcastserver.BroadcasterConfig) *Broadcaster {
+func NewBroadcaster(settings wsbroadcastserver.BroadcasterConfig) (*Broadcaster, error) {
+	signingKey, err := das.LoadECDSAPrivKey(settings.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load feed signing key: %w", err)
+	}
 	catchupBuffer := NewSequenceNumberCatchupBuffer()
+	if settings.Backlog.Enable {
+		backlog, err := openDiskBacklog(&settings.Backlog)
+		if err != nil {
+			return nil, err
+		}
+		if err := catchupBuffer.restoreBacklog(backlog); err != nil {
+			_ = backlog.close()
+			return nil, err
+		}
+		log.Info("loaded feed backlog", "dir", settings.Backlog.Dir, "segments", len(backlog.segments), "restoredMessages", len(catchupBuffer.messages))
+	}
 	return &Broadcaster{
-		server:        wsbroadcastserver.NewWSBroadcastServer(settings, catchupBuffer),
+		server:        wsbroadcastserver.NewWSBroadcastServer(settings, catchupBuffer, parseClientFilter),
 		catchupBuffer: catchupBuffer,
-	}
+		signingKey:    signingKey,
+	}, nil
 }
 
 func (b *Broadcaster) BroadcastSingle(msg arbstate.MessageWithMetadata, seq arbutil.MessageIndex) {
-	var broadcastMessages []*BroadcastFeedMessage
-
 	bfm := BroadcastFeedMessage{SequenceNumber: seq, Message: msg}
-	broadcastMessages = append(broadcastMessages, &bfm)
+	if b.signingKey != nil {
+		if err := bfm.Sign(b.signingKey); err != nil {
+			log.Error("error signing feed message, broadcasting it unsigned", "seqNum", seq, "err", err)
+		}
+	}
+	b.BroadcastFeedMessages([]*BroadcastFeedMessage{&bfm})
+}
 
+// BroadcastFeedMessages broadcasts already built feed messages as they are, eg
+// when relaying them, keeping their signatures.
+func (b *Broadcaster) BroadcastFeedMessages(messages []*BroadcastFeedMessage) {
+	shareTxAddresses(messages)
 	bm := BroadcastMessage{
-		Version:  1,
-		Messages: broadcastMessages,
+		Version:  broadcastMessageVersion(messages),
+		Messages: messages,
 	}
 
 	b.server.Broadcast(bm)
 }
 
 func (b *Broadcaster) Broadcast(msg BroadcastMessage) {
+	shareTxAddresses(msg.Messages)
 	b.server.Broadcast(msg)
 }
 
 func (b *Broadcaster) Confirm(seq arbutil.MessageIndex) {
 	b.server.Broadcast(BroadcastMessage{
-		Version:                        1,
+		Version:                        BroadcastMessageVersion,
 		ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{seq}})
 }
 
@@ -196,4 +385,9 @@ func (b *Broadcaster) Start(ctx context.Context) error {
 
 func (b *Broadcaster) StopAndWait() {
 	b.server.StopAndWait()
+	if b.catchupBuffer.backlog != nil {
+		if err := b.catchupBuffer.backlog.close(); err != nil {
+			log.Error("error closing feed backlog", "err", err)
+		}
+	}
 }
@@ -8,15 +8,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/offchainlabs/nitro/arbos"
 	"github.com/offchainlabs/nitro/arbstate"
 )
 
-func ExampleBroadcastMessage_broadcastfeedmessage() {
+func broadcastFeedMessageFixture() BroadcastMessage {
 	var requestId common.Hash
-	msg := BroadcastMessage{
+	return BroadcastMessage{
 		Version: 1,
 		Messages: []*BroadcastFeedMessage{
 			{
@@ -38,6 +40,25 @@ func ExampleBroadcastMessage_broadcastfeedmessage() {
 			},
 		},
 	}
+}
+
+func emptyMessageFixture() BroadcastMessage {
+	return BroadcastMessage{
+		Version: 1,
+	}
+}
+
+func confirmedSeqNumFixture() BroadcastMessage {
+	return BroadcastMessage{
+		Version: 1,
+		ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{
+			SequenceNumber: 1234,
+		},
+	}
+}
+
+func ExampleBroadcastMessage_broadcastfeedmessage() {
+	msg := broadcastFeedMessageFixture()
 	var buf bytes.Buffer
 	encoder := json.NewEncoder(&buf)
 	_ = encoder.Encode(msg)
@@ -46,9 +67,7 @@ func ExampleBroadcastMessage_broadcastfeedmessage() {
 }
 
 func ExampleBroadcastMessage_emptymessage() {
-	msg := BroadcastMessage{
-		Version: 1,
-	}
+	msg := emptyMessageFixture()
 	var buf bytes.Buffer
 	encoder := json.NewEncoder(&buf)
 	_ = encoder.Encode(msg)
@@ -57,15 +76,81 @@ func ExampleBroadcastMessage_emptymessage() {
 }
 
 func ExampleBroadcastMessage_confirmedseqnum() {
-	msg := BroadcastMessage{
-		Version: 1,
-		ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{
-			SequenceNumber: 1234,
-		},
-	}
+	msg := confirmedSeqNumFixture()
 	var buf bytes.Buffer
 	encoder := json.NewEncoder(&buf)
 	_ = encoder.Encode(msg)
 	fmt.Println(buf.String())
 	// Output: {"version":1,"confirmedSequenceNumberMessage":{"sequenceNumber":1234}}
 }
+
+func TestBinaryEncodingMatchesJSON(t *testing.T) {
+	signed := broadcastFeedMessageFixture()
+	signed.Version = SignedBroadcastMessageVersion
+	signed.Messages[0].Signature = bytes.Repeat([]byte{0xab}, 65)
+	heartbeat := emptyMessageFixture()
+	heartbeat.SequenceNumberHeartbeatMessage = &SequenceNumberHeartbeatMessage{SequenceNumber: 12}
+
+	for _, msg := range []BroadcastMessage{
+		broadcastFeedMessageFixture(),
+		emptyMessageFixture(),
+		confirmedSeqNumFixture(),
+		signed,
+		heartbeat,
+	} {
+		expected, err := json.Marshal(msg)
+		Require(t, err)
+
+		encoded, err := msg.MarshalBinary()
+		Require(t, err)
+		var decoded BroadcastMessage
+		Require(t, decoded.UnmarshalBinary(encoded))
+		roundTripped, err := json.Marshal(decoded)
+		Require(t, err)
+		if !bytes.Equal(roundTripped, expected) {
+			Fail(t, "binary encoding round tripped", string(expected), "to", string(roundTripped))
+		}
+		if len(encoded) >= len(expected) {
+			Fail(t, "expected binary encoding of", string(expected), "to be smaller, got", len(encoded), "bytes")
+		}
+	}
+}
+
+func TestBinaryEncodingIgnoresNewFields(t *testing.T) {
+	encoded, err := confirmedSeqNumFixture().MarshalBinary()
+	Require(t, err)
+	// Re-encode the message with an extra field, as a later version might add
+	var fields []rlp.RawValue
+	Require(t, rlp.DecodeBytes(encoded, &fields))
+	extended, err := rlp.EncodeToBytes(append(fields, rlp.RawValue{0x2a}))
+	Require(t, err)
+
+	var decoded BroadcastMessage
+	Require(t, decoded.UnmarshalBinary(extended))
+	if decoded.Version != 1 || decoded.ConfirmedSequenceNumberMessage == nil || decoded.ConfirmedSequenceNumberMessage.SequenceNumber != 1234 {
+		Fail(t, "unexpected message decoded with an extra field", decoded)
+	}
+
+	// Likewise with an extra field in a feed message
+	encoded, err = broadcastFeedMessageFixture().MarshalBinary()
+	Require(t, err)
+	fields = nil
+	Require(t, rlp.DecodeBytes(encoded, &fields))
+	var feedMessages [][]rlp.RawValue
+	Require(t, rlp.DecodeBytes(fields[1], &feedMessages))
+	feedMessages[0] = append(feedMessages[0], rlp.RawValue{0x2a})
+	fields[1], err = rlp.EncodeToBytes(feedMessages)
+	Require(t, err)
+	extended, err = rlp.EncodeToBytes(fields)
+	Require(t, err)
+
+	expected, err := json.Marshal(broadcastFeedMessageFixture())
+	Require(t, err)
+	decoded = BroadcastMessage{}
+	Require(t, decoded.UnmarshalBinary(extended))
+	roundTripped, err := json.Marshal(decoded)
+	Require(t, err)
+	if !bytes.Equal(roundTripped, expected) {
+		Fail(t, "feed message with an extra field decoded to", string(roundTripped), "expected", string(expected))
+	}
+}
@@ -4,12 +4,25 @@
 package broadcaster
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobwas/httphead"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
+	"github.com/offchainlabs/nitro/arbos"
 	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/util/testhelpers"
 	"github.com/offchainlabs/nitro/wsbroadcastserver"
 )
@@ -65,7 +78,8 @@ func TestBroadcasterMessagesRemovedOnConfirmation(t *testing.T) {
 		Workers:       128,
 	}
 
-	b := NewBroadcaster(broadcasterSettings)
+	b, err := NewBroadcaster(broadcasterSettings)
+	Require(t, err)
 	Require(t, b.Start(ctx))
 	defer b.StopAndWait()
 
@@ -136,3 +150,169 @@ func Fail(t *testing.T, printables ...interface{}) {
 	t.Helper()
 	testhelpers.FailImpl(t, printables...)
 }
+
+func TestCatchupBufferSendsMessagesFromRequestedSeqNum(t *testing.T) {
+	buffer := NewSequenceNumberCatchupBuffer()
+	var messages []*BroadcastFeedMessage
+	for i := 5; i < 10; i++ {
+		messages = append(messages, &BroadcastFeedMessage{SequenceNumber: arbutil.MessageIndex(i)})
+	}
+	Require(t, buffer.OnDoBroadcast(BroadcastMessage{Version: BroadcastMessageVersion, Messages: messages}))
+
+	for _, tc := range []struct {
+		requestedSeqNum arbutil.MessageIndex
+		expectedFirst   arbutil.MessageIndex
+		expectedCount   int
+	}{
+		{0, 5, 5}, // client not requesting a sequence number
+		{3, 5, 5}, // client missing messages older than the buffer
+		{5, 5, 5},
+		{7, 7, 3},
+		{9, 9, 1},
+		{10, 0, 0}, // client has every cached message
+		{12, 0, 0},
+	} {
+		sent := buffer.getCacheMessages(tc.requestedSeqNum)
+		if len(sent) != tc.expectedCount {
+			Fail(t, "requested", tc.requestedSeqNum, "expected", tc.expectedCount, "messages, got", len(sent))
+		}
+		if len(sent) > 0 && sent[0].SequenceNumber != tc.expectedFirst {
+			Fail(t, "requested", tc.requestedSeqNum, "expected first message", tc.expectedFirst, "got", sent[0].SequenceNumber)
+		}
+	}
+}
+
+// countingConn counts the bytes read from the wire, before any decompression.
+type countingConn struct {
+	net.Conn
+	read int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+// benchmarkBroadcast broadcasts to four clients, the first compressingClients of
+// which request compression.
+func benchmarkBroadcast(b *testing.B, serverCompression bool, compressingClients int) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	broadcasterSettings := wsbroadcastserver.BroadcasterConfig{
+		Addr:              "127.0.0.1",
+		IOTimeout:         2 * time.Second,
+		Port:              "0",
+		Ping:              5 * time.Second,
+		ClientTimeout:     30 * time.Second,
+		Queue:             100,
+		Workers:           128,
+		EnableCompression: serverCompression,
+	}
+
+	bc, err := NewBroadcaster(broadcasterSettings)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := bc.Start(ctx); err != nil {
+		b.Fatal(err)
+	}
+	defer bc.StopAndWait()
+
+	// Transaction data compresses well, mostly being zero padded ABI encoding.
+	var requestId common.Hash
+	message := arbstate.MessageWithMetadata{
+		Message: &arbos.L1IncomingMessage{
+			Header: &arbos.L1IncomingMessageHeader{
+				RequestId: &requestId,
+				L1BaseFee: big.NewInt(0),
+			},
+			L2msg: bytes.Repeat(append(make([]byte, 28), 0xde, 0xad, 0xbe, 0xef), 32),
+		},
+	}
+
+	url := fmt.Sprintf("ws://%s/", bc.ListenerAddr().String())
+	lastSeqNum := arbutil.MessageIndex(b.N - 1)
+	clientCount := 4
+	var conns []*countingConn
+	var wg sync.WaitGroup
+	for i := 0; i < clientCount; i++ {
+		dialer := ws.Dialer{Timeout: 5 * time.Second}
+		if i < compressingClients {
+			dialer.Extensions = []httphead.Option{wsflate.DefaultParameters.Option()}
+		}
+		conn, br, hs, err := dialer.Dial(ctx, url)
+		if err != nil {
+			b.Fatal(err)
+		}
+		compression := len(hs.Extensions) > 0
+		if compression != (serverCompression && i < compressingClients) {
+			b.Fatal("unexpected compression negotiation result", compression)
+		}
+		var earlyFrameData io.Reader
+		if br != nil {
+			earlyFrameData = io.LimitReader(br, int64(br.Buffered()))
+		}
+		counted := &countingConn{Conn: conn}
+		conns = append(conns, counted)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer counted.Close()
+			for {
+				data, _, err := wsbroadcastserver.ReadData(ctx, counted, earlyFrameData, 10*time.Second, ws.StateClientSide, compression)
+				earlyFrameData = nil
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				if len(data) == 0 {
+					continue
+				}
+				var msg BroadcastMessage
+				if err := json.Unmarshal(data, &msg); err != nil {
+					b.Error(err)
+					return
+				}
+				for _, feedMessage := range msg.Messages {
+					if feedMessage.SequenceNumber == lastSeqNum {
+						return
+					}
+				}
+			}
+		}()
+	}
+	for bc.ClientCount() < int32(clientCount) {
+		time.Sleep(time.Millisecond)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bc.BroadcastSingle(message, arbutil.MessageIndex(i))
+	}
+	wg.Wait()
+	b.StopTimer()
+
+	var read int64
+	for _, conn := range conns {
+		read += atomic.LoadInt64(&conn.read)
+	}
+	b.ReportMetric(float64(read)/float64(b.N*clientCount), "wire-bytes/msg")
+}
+
+func BenchmarkBroadcastUncompressed(b *testing.B) {
+	benchmarkBroadcast(b, false, 0)
+}
+
+func BenchmarkBroadcastCompressed(b *testing.B) {
+	benchmarkBroadcast(b, true, 4)
+}
+
+func BenchmarkBroadcastCompressionMixedClients(b *testing.B) {
+	benchmarkBroadcast(b, true, 2)
+}
+
+func BenchmarkBroadcastCompressionNotRequested(b *testing.B) {
+	benchmarkBroadcast(b, true, 0)
+}
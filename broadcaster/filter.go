@@ -0,0 +1,211 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/nitro/arbos/util"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+// FeedFilter selects the feed messages sent to a client, which requests it by
+// setting the wsbroadcastserver.HTTPHeaderFeedFilter header or the
+// wsbroadcastserver.FeedFilterQueryParam query parameter to its JSON encoding.
+// Confirmations are always sent, and when messages are filtered out the client
+// is sent a SequenceNumberHeartbeatMessage instead.
+type FeedFilter struct {
+	// L1 message kinds to send, or any kind if empty.
+	Kinds []int `json:"kinds,omitempty"`
+	// If not empty, only messages with transactions to or from one of these
+	// addresses are sent. The message's L1 sender counts as a transaction
+	// sender, as does its address remapped to L2.
+	Addresses []common.Address `json:"addresses,omitempty"`
+
+	kinds     map[uint8]bool
+	addresses map[common.Address]bool
+	key       string
+}
+
+// ParseFeedFilter parses and validates a JSON encoded FeedFilter.
+func ParseFeedFilter(value string) (*FeedFilter, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.DisallowUnknownFields()
+	filter := &FeedFilter{}
+	if err := decoder.Decode(filter); err != nil {
+		return nil, err
+	}
+	if len(filter.Kinds) == 0 && len(filter.Addresses) == 0 {
+		return nil, errors.New("feed filter has no kinds or addresses")
+	}
+
+	filter.kinds = make(map[uint8]bool)
+	for _, kind := range filter.Kinds {
+		if kind < 0 || kind > 0xff {
+			return nil, fmt.Errorf("invalid L1 message kind %v", kind)
+		}
+		filter.kinds[uint8(kind)] = true
+	}
+	filter.addresses = make(map[common.Address]bool)
+	for _, address := range filter.Addresses {
+		filter.addresses[address] = true
+	}
+
+	// Filters selecting the same messages are given the same key, however they
+	// were written, so that clients using them can share serialized messages.
+	filter.Kinds = filter.Kinds[:0]
+	for kind := range filter.kinds {
+		filter.Kinds = append(filter.Kinds, int(kind))
+	}
+	sort.Ints(filter.Kinds)
+	filter.Addresses = filter.Addresses[:0]
+	for address := range filter.addresses {
+		filter.Addresses = append(filter.Addresses, address)
+	}
+	sort.Slice(filter.Addresses, func(i, j int) bool {
+		return bytes.Compare(filter.Addresses[i][:], filter.Addresses[j][:]) < 0
+	})
+	key, err := json.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
+	filter.key = string(key)
+	return filter, nil
+}
+
+func parseClientFilter(value string) (wsbroadcastserver.ClientFilter, error) {
+	filter, err := ParseFeedFilter(value)
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func (f *FeedFilter) String() string {
+	return f.key
+}
+
+// Filter removes the feed messages not matching the filter from a broadcast
+// message, replacing them with a heartbeat.
+func (f *FeedFilter) Filter(bmi interface{}) interface{} {
+	bm, ok := bmi.(BroadcastMessage)
+	if !ok || len(bm.Messages) == 0 {
+		return bmi
+	}
+	filtered := bm
+	filtered.Messages = nil
+	for _, msg := range bm.Messages {
+		if f.Matches(msg) {
+			filtered.Messages = append(filtered.Messages, msg)
+		}
+	}
+	if len(filtered.Messages) < len(bm.Messages) {
+		filtered.SequenceNumberHeartbeatMessage = &SequenceNumberHeartbeatMessage{
+			SequenceNumber: bm.Messages[len(bm.Messages)-1].SequenceNumber,
+		}
+	}
+	return filtered
+}
+
+// Matches returns whether the feed message should be sent to clients using the
+// filter. Messages with transactions that can't be parsed don't match any
+// addresses.
+func (f *FeedFilter) Matches(msg *BroadcastFeedMessage) bool {
+	l1Message := msg.Message.Message
+	if l1Message == nil || l1Message.Header == nil {
+		return false
+	}
+	if len(f.kinds) > 0 && !f.kinds[l1Message.Header.Kind] {
+		return false
+	}
+	if len(f.addresses) == 0 {
+		return true
+	}
+	poster := l1Message.Header.Poster
+	if f.addresses[poster] || f.addresses[util.RemapL1Address(poster)] {
+		return true
+	}
+	var txAddresses []common.Address
+	if msg.txAddresses != nil {
+		txAddresses = msg.txAddresses.get(msg)
+	} else {
+		txAddresses = parseTxAddresses(msg)
+	}
+	for _, address := range txAddresses {
+		if f.addresses[address] {
+			return true
+		}
+	}
+	return false
+}
+
+// feedMessageTxAddresses holds the addresses of a feed message's transactions,
+// so that they're only parsed and recovered once for all the filters it's
+// matched against, however many clients request them.
+type feedMessageTxAddresses struct {
+	once      sync.Once
+	addresses []common.Address
+}
+
+func (a *feedMessageTxAddresses) get(msg *BroadcastFeedMessage) []common.Address {
+	a.once.Do(func() {
+		a.addresses = parseTxAddresses(msg)
+	})
+	return a.addresses
+}
+
+// shareTxAddresses has the messages' transaction addresses shared between the
+// filters they're matched against as they're broadcast.
+func shareTxAddresses(messages []*BroadcastFeedMessage) {
+	for _, msg := range messages {
+		if msg.txAddresses == nil {
+			msg.txAddresses = &feedMessageTxAddresses{}
+		}
+	}
+}
+
+// parseTxAddresses returns the recipients of a feed message's transactions,
+// followed by the senders of those signed by their senders. Messages with
+// transactions that can't be parsed have none.
+func parseTxAddresses(msg *BroadcastFeedMessage) []common.Address {
+	// The chain id is only used to build the transactions, not to check their
+	// signatures, so it doesn't matter here.
+	txs, err := msg.Message.Message.ParseL2Transactions(new(big.Int))
+	if err != nil {
+		return nil
+	}
+	var addresses []common.Address
+	for _, tx := range txs {
+		if to := tx.To(); to != nil {
+			addresses = append(addresses, *to)
+		}
+	}
+	for _, tx := range txs {
+		if sender, ok := signedTxSender(tx); ok {
+			addresses = append(addresses, sender)
+		}
+	}
+	return addresses
+}
+
+// signedTxSender recovers the sender of a transaction signed by its sender, as
+// opposed to one from a delayed message, whose sender is the message's.
+func signedTxSender(tx *types.Transaction) (common.Address, bool) {
+	switch tx.Type() {
+	case types.LegacyTxType, types.AccessListTxType, types.DynamicFeeTxType:
+		sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		return sender, err == nil
+	default:
+		return common.Address{}, false
+	}
+}
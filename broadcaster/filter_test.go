@@ -0,0 +1,246 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gobwas/ws"
+
+	"github.com/offchainlabs/nitro/arbos"
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var (
+	filterTestPoster   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	filterTestContract = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	filterTestOther    = common.HexToAddress("0x3000000000000000000000000000000000000003")
+)
+
+// signedTxMessage builds an L2 message holding a transaction to the address,
+// signed by the key.
+func signedTxMessage(t *testing.T, key string, to common.Address) arbstate.MessageWithMetadata {
+	t.Helper()
+	privateKey, err := crypto.HexToECDSA(key)
+	Require(t, err)
+	chainId := big.NewInt(412346)
+	tx, err := types.SignNewTx(privateKey, types.LatestSignerForChainID(chainId), &types.DynamicFeeTx{
+		ChainID:   chainId,
+		Gas:       21000,
+		GasFeeCap: big.NewInt(1),
+		GasTipCap: big.NewInt(1),
+		To:        &to,
+	})
+	Require(t, err)
+	txBytes, err := tx.MarshalBinary()
+	Require(t, err)
+	return arbstate.MessageWithMetadata{
+		Message: &arbos.L1IncomingMessage{
+			Header: &arbos.L1IncomingMessageHeader{
+				Kind:      arbos.L1MessageType_L2Message,
+				Poster:    filterTestPoster,
+				L1BaseFee: big.NewInt(0),
+			},
+			L2msg: append([]byte{arbos.L2MessageKind_SignedTx}, txBytes...),
+		},
+	}
+}
+
+func endOfBlockMessage() arbstate.MessageWithMetadata {
+	return arbstate.MessageWithMetadata{
+		Message: &arbos.L1IncomingMessage{
+			Header: &arbos.L1IncomingMessageHeader{
+				Kind:      arbos.L1MessageType_EndOfBlock,
+				Poster:    filterTestPoster,
+				L1BaseFee: big.NewInt(0),
+			},
+		},
+	}
+}
+
+const (
+	filterTestKey1 = "b6b15c8cb491557369f3c7d2c287b053eb229daa9c22138887752191c9520659"
+	filterTestKey2 = "a8f6c8a48f2d1a9e7ae3bd1cb4f1c7e6f4a8f6b3f7a2d5c1e8b4a7d3c2f1e0d9"
+)
+
+func filterTestMessages(t *testing.T) []*BroadcastFeedMessage {
+	return []*BroadcastFeedMessage{
+		{SequenceNumber: 0, Message: signedTxMessage(t, filterTestKey1, filterTestContract)},
+		{SequenceNumber: 1, Message: signedTxMessage(t, filterTestKey2, filterTestOther)},
+		{SequenceNumber: 2, Message: endOfBlockMessage()},
+		{SequenceNumber: 3, Message: signedTxMessage(t, filterTestKey2, filterTestContract)},
+	}
+}
+
+func expectFiltered(t *testing.T, filtered interface{}, heartbeat arbutil.MessageIndex, expected ...arbutil.MessageIndex) {
+	t.Helper()
+	bm, ok := filtered.(BroadcastMessage)
+	if !ok {
+		Fail(t, "expected a broadcast message, got", filtered)
+	}
+	if len(bm.Messages) != len(expected) {
+		Fail(t, "expected messages", expected, "got", len(bm.Messages), "messages")
+	}
+	for i, msg := range bm.Messages {
+		if msg.SequenceNumber != expected[i] {
+			Fail(t, "expected messages", expected, "got", msg.SequenceNumber, "at", i)
+		}
+	}
+	if bm.SequenceNumberHeartbeatMessage == nil || bm.SequenceNumberHeartbeatMessage.SequenceNumber != heartbeat {
+		Fail(t, "expected heartbeat with sequence number", heartbeat, "got", bm.SequenceNumberHeartbeatMessage)
+	}
+}
+
+func TestFeedFilter(t *testing.T) {
+	messages := filterTestMessages(t)
+	bm := BroadcastMessage{Version: BroadcastMessageVersion, Messages: messages}
+	key2, err := crypto.HexToECDSA(filterTestKey2)
+	Require(t, err)
+	sender2 := crypto.PubkeyToAddress(key2.PublicKey)
+
+	for _, tc := range []struct {
+		filter   string
+		expected []arbutil.MessageIndex
+	}{
+		{fmt.Sprintf(`{"addresses":["%v"]}`, filterTestContract), []arbutil.MessageIndex{0, 3}},
+		{fmt.Sprintf(`{"addresses":["%v"]}`, sender2), []arbutil.MessageIndex{1, 3}},
+		{fmt.Sprintf(`{"kinds":[%v]}`, arbos.L1MessageType_EndOfBlock), []arbutil.MessageIndex{2}},
+		{fmt.Sprintf(`{"kinds":[%v],"addresses":["%v"]}`, arbos.L1MessageType_EndOfBlock, filterTestContract), nil},
+		{`{"addresses":["0x4000000000000000000000000000000000000004"]}`, nil},
+	} {
+		filter, err := ParseFeedFilter(tc.filter)
+		Require(t, err, tc.filter)
+		expectFiltered(t, filter.Filter(bm), 3, tc.expected...)
+	}
+
+	// Messages from the L1 sender match, as do all messages with any kind filtered for
+	for _, value := range []string{
+		fmt.Sprintf(`{"addresses":["%v"]}`, filterTestPoster),
+		fmt.Sprintf(`{"kinds":[%v,%v]}`, arbos.L1MessageType_L2Message, arbos.L1MessageType_EndOfBlock),
+	} {
+		filter, err := ParseFeedFilter(value)
+		Require(t, err)
+		filtered, ok := filter.Filter(bm).(BroadcastMessage)
+		if !ok || len(filtered.Messages) != len(messages) || filtered.SequenceNumberHeartbeatMessage != nil {
+			Fail(t, "expected every message to pass", value, "without a heartbeat")
+		}
+	}
+
+	// Confirmations are sent as they are
+	filter, err := ParseFeedFilter(`{"kinds":[3]}`)
+	Require(t, err)
+	confirm := BroadcastMessage{Version: BroadcastMessageVersion, ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{2}}
+	if filtered, ok := filter.Filter(confirm).(BroadcastMessage); !ok || filtered.ConfirmedSequenceNumberMessage == nil || filtered.SequenceNumberHeartbeatMessage != nil {
+		Fail(t, "expected confirmation to be sent unchanged")
+	}
+}
+
+func TestParseFeedFilter(t *testing.T) {
+	for _, value := range []string{
+		``,
+		`{}`,
+		`{"kinds":[256]}`,
+		`{"kinds":[-1]}`,
+		`{"addresses":["not an address"]}`,
+		`{"senders":["0x1000000000000000000000000000000000000001"]}`,
+	} {
+		if _, err := ParseFeedFilter(value); err == nil {
+			Fail(t, "expected invalid filter", value, "to be rejected")
+		}
+	}
+
+	filter1, err := ParseFeedFilter(fmt.Sprintf(`{"addresses":["%v","%v"],"kinds":[7,3,7]}`, filterTestOther, filterTestContract))
+	Require(t, err)
+	filter2, err := ParseFeedFilter(fmt.Sprintf(`{"kinds":[3,7],"addresses":["%v","%v"]}`, filterTestContract, filterTestOther))
+	Require(t, err)
+	if filter1.String() != filter2.String() {
+		Fail(t, "expected equivalent filters to have the same key", filter1, filter2)
+	}
+}
+
+func TestBroadcasterFiltersClientMessages(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	broadcasterSettings := wsbroadcastserver.BroadcasterConfig{
+		Addr:          "127.0.0.1",
+		IOTimeout:     2 * time.Second,
+		Port:          "0",
+		Ping:          5 * time.Second,
+		ClientTimeout: 30 * time.Second,
+		Queue:         1,
+		Workers:       128,
+	}
+	b, err := NewBroadcaster(broadcasterSettings)
+	Require(t, err)
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	messages := filterTestMessages(t)
+	// Sent to the client from the catchup buffer on connecting
+	b.BroadcastFeedMessages(messages[:2])
+	waitUntilUpdated(t, &messageCountPredicate{b, 2, "after broadcasting 2 messages", 0})
+
+	url := fmt.Sprintf("ws://%s/", b.ListenerAddr().String())
+	dial := func(filter string) (*BroadcastMessage, func() *BroadcastMessage, error) {
+		dialer := ws.Dialer{
+			Timeout: 5 * time.Second,
+			Header: ws.HandshakeHeaderHTTP(http.Header{
+				wsbroadcastserver.HTTPHeaderFeedFilter: []string{filter},
+			}),
+		}
+		conn, _, _, err := dialer.Dial(ctx, url)
+		if err != nil {
+			return nil, nil, err
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		read := func() *BroadcastMessage {
+			for {
+				data, _, err := wsbroadcastserver.ReadData(ctx, conn, nil, 5*time.Second, ws.StateClientSide, false)
+				Require(t, err)
+				if len(data) == 0 {
+					continue
+				}
+				var bm BroadcastMessage
+				Require(t, json.Unmarshal(data, &bm))
+				return &bm
+			}
+		}
+		return read(), read, nil
+	}
+
+	_, _, err = dial(`{"kinds":[300]}`)
+	var statusErr ws.StatusError
+	if !errors.As(err, &statusErr) || int(statusErr) != http.StatusBadRequest {
+		Fail(t, "expected invalid filter to be refused with a bad request status, got", err)
+	}
+
+	catchup, read, err := dial(fmt.Sprintf(`{"addresses":["%v"]}`, filterTestContract))
+	Require(t, err)
+	expectFiltered(t, *catchup, 1, 0)
+
+	b.BroadcastFeedMessages(messages[2:3])
+	expectFiltered(t, *read(), 2)
+	b.BroadcastFeedMessages(messages[3:])
+	bm := read()
+	if len(bm.Messages) != 1 || bm.Messages[0].SequenceNumber != 3 || bm.SequenceNumberHeartbeatMessage != nil {
+		Fail(t, "expected only matching message 3 to be sent", bm)
+	}
+	b.Confirm(1)
+	if bm := read(); bm.ConfirmedSequenceNumberMessage == nil || bm.ConfirmedSequenceNumberMessage.SequenceNumber != 1 {
+		Fail(t, "expected confirmation to be sent", bm)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/offchainlabs/nitro/arbos"
+)
+
+// Hash is what the sequencer signs for a feed message: its sequence number
+// along with a hash of the message, like SeqCoordinator's redis messages.
+func (m *BroadcastFeedMessage) Hash() common.Hash {
+	var seqNumBytes, delayedMessagesReadBytes [8]byte
+	binary.BigEndian.PutUint64(seqNumBytes[:], uint64(m.SequenceNumber))
+	binary.BigEndian.PutUint64(delayedMessagesReadBytes[:], m.Message.DelayedMessagesRead)
+	return crypto.Keccak256Hash(seqNumBytes[:], delayedMessagesReadBytes[:], incomingMessageHash(m.Message.Message).Bytes())
+}
+
+// incomingMessageHash hashes all of a message's fields. Unlike the message's
+// Serialize, it accepts messages without a RequestId or L1BaseFee, as sequenced
+// messages are.
+func incomingMessageHash(msg *arbos.L1IncomingMessage) common.Hash {
+	if msg == nil || msg.Header == nil {
+		return crypto.Keccak256Hash()
+	}
+	header := msg.Header
+	var blockNumberBytes, timestampBytes [8]byte
+	binary.BigEndian.PutUint64(blockNumberBytes[:], header.BlockNumber)
+	binary.BigEndian.PutUint64(timestampBytes[:], header.Timestamp)
+	hasRequestId := []byte{0}
+	var requestId common.Hash
+	if header.RequestId != nil {
+		hasRequestId[0] = 1
+		requestId = *header.RequestId
+	}
+	var l1BaseFee common.Hash
+	if header.L1BaseFee != nil {
+		l1BaseFee = common.BigToHash(header.L1BaseFee)
+	}
+	return crypto.Keccak256Hash(
+		[]byte{header.Kind},
+		header.Poster.Bytes(),
+		blockNumberBytes[:],
+		timestampBytes[:],
+		hasRequestId,
+		requestId.Bytes(),
+		l1BaseFee.Bytes(),
+		msg.L2msg,
+	)
+}
+
+func (m *BroadcastFeedMessage) Sign(signingKey *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(m.Hash().Bytes(), signingKey)
+	if err != nil {
+		return err
+	}
+	m.Signature = sig
+	return nil
+}
+
+// RecoverSigner returns the address which signed the feed message.
+func (m *BroadcastFeedMessage) RecoverSigner() (common.Address, error) {
+	if len(m.Signature) == 0 {
+		return common.Address{}, fmt.Errorf("feed message %v is unsigned", m.SequenceNumber)
+	}
+	if len(m.Signature) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("feed message %v signature has length %d, expected %d", m.SequenceNumber, len(m.Signature), crypto.SignatureLength)
+	}
+	pubKey, err := crypto.SigToPub(m.Hash().Bytes(), m.Signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubKey), nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/offchainlabs/nitro/arbos"
+	"github.com/offchainlabs/nitro/arbstate"
+)
+
+func TestFeedMessageSignature(t *testing.T) {
+	signingKey, err := crypto.GenerateKey()
+	Require(t, err)
+	message := &BroadcastFeedMessage{
+		SequenceNumber: 7,
+		Message: arbstate.MessageWithMetadata{
+			Message: &arbos.L1IncomingMessage{
+				Header: &arbos.L1IncomingMessageHeader{
+					Kind:        arbos.L1MessageType_L2Message,
+					Poster:      common.HexToAddress("0x1234"),
+					BlockNumber: 100,
+					Timestamp:   1000,
+					L1BaseFee:   big.NewInt(10),
+				},
+				L2msg: []byte("a sequenced message"),
+			},
+			DelayedMessagesRead: 1,
+		},
+	}
+	if _, err := message.RecoverSigner(); err == nil {
+		Fail(t, "Recovered signer of unsigned message")
+	}
+	Require(t, message.Sign(signingKey))
+	signer, err := message.RecoverSigner()
+	Require(t, err)
+	if signer != crypto.PubkeyToAddress(signingKey.PublicKey) {
+		Fail(t, "Recovered wrong signer", signer)
+	}
+
+	// Any change to the message must invalidate the signature.
+	for _, tamper := range []func(m *BroadcastFeedMessage){
+		func(m *BroadcastFeedMessage) { m.SequenceNumber++ },
+		func(m *BroadcastFeedMessage) { m.Message.DelayedMessagesRead++ },
+		func(m *BroadcastFeedMessage) { m.Message.Message.Header.Timestamp++ },
+		func(m *BroadcastFeedMessage) { m.Message.Message.L2msg = []byte("an injected message") },
+	} {
+		tampered := *message
+		header := *message.Message.Message.Header
+		tampered.Message.Message = &arbos.L1IncomingMessage{Header: &header, L2msg: message.Message.Message.L2msg}
+		tamper(&tampered)
+		signer, err := tampered.RecoverSigner()
+		if err == nil && signer == crypto.PubkeyToAddress(signingKey.PublicKey) {
+			Fail(t, "Signature still valid for tampered message", tampered)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	koanfjson "github.com/knadh/koanf/parsers/json"
 	"github.com/knadh/koanf/providers/confmap"
@@ -23,10 +24,16 @@ import (
 )
 
 type DAServerConfig struct {
-	Port       uint64                     `koanf:"port"`
-	LogLevel   int                        `koanf:"log-level"`
-	DAConf     das.DataAvailabilityConfig `koanf:"data-availability"`
-	ConfConfig conf.ConfConfig            `koanf:"conf"`
+	Addr                 string                     `koanf:"addr"`
+	Port                 uint64                     `koanf:"port"`
+	TLS                  dasrpc.ServerTLSConfig     `koanf:"tls"`
+	EnableREST           bool                       `koanf:"enable-rest"`
+	RESTAddr             string                     `koanf:"rest-addr"`
+	RESTPort             uint64                     `koanf:"rest-port"`
+	StoreSignerAddresses []string                   `koanf:"store-signer-addresses"`
+	LogLevel             int                        `koanf:"log-level"`
+	DAConf               das.DataAvailabilityConfig `koanf:"data-availability"`
+	ConfConfig           conf.ConfConfig            `koanf:"conf"`
 }
 
 func main() {
@@ -45,7 +52,13 @@ func parseDAServer(args []string) (*DAServerConfig, error) {
 	f := flag.NewFlagSet("daserver", flag.ContinueOnError)
 
 	f.Int("log-level", int(log.LvlInfo), "log level")
+	f.String("addr", "localhost", "Address to listen on")
 	f.Uint64("port", 9876, "Port to listen on")
+	dasrpc.ServerTLSConfigAddOptions("tls", f)
+	f.Bool("enable-rest", false, "Enable the read-only REST server, serving stored batches by hash")
+	f.String("rest-addr", "localhost", "Address the REST server listens on")
+	f.Uint64("rest-port", 9877, "Port the REST server listens on")
+	f.StringSlice("store-signer-addresses", nil, "Addresses allowed to sign Store requests, eg the batch poster's. If empty, unsigned Store requests are accepted from anyone")
 	das.DataAvailabilityConfigAddOptions("data-availability", f)
 	conf.ConfConfigAddOptions("conf", f)
 
@@ -97,7 +110,7 @@ func startup() error {
 	glogger.Verbosity(log.Lvl(serverConfig.LogLevel))
 	log.Root().SetHandler(glogger)
 
-	log.Info("Starting daserver", "port", serverConfig.Port)
+	log.Info("Starting daserver", "addr", serverConfig.Addr, "port", serverConfig.Port, "tls", serverConfig.TLS.Enabled())
 
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
@@ -110,27 +123,72 @@ func startup() error {
 		return err
 	}
 	var dasImpl das.DataAvailabilityService
+	dasLifecycleManager := das.LifecycleManager{}
 	switch mode {
 	case das.LocalDataAvailability:
-		dasImpl, err = das.NewLocalDiskDAS(serverConfig.DAConf.LocalDiskDASConfig)
+		localDiskDAS, err := das.NewLocalDiskDAS(serverConfig.DAConf.LocalDiskDASConfig)
 		if err != nil {
 			return err
 		}
+		dasLifecycleManager.Register(localDiskDAS)
+		dasImpl = localDiskDAS
+	case das.LocalDBDataAvailability:
+		localDBDAS, err := das.NewLocalDBDAS(serverConfig.DAConf.LocalDBDASConfig)
+		if err != nil {
+			return err
+		}
+		dasLifecycleManager.Register(localDBDAS)
+		dasImpl = localDBDAS
 	case das.AggregatorDataAvailability:
-		dasImpl, err = dasrpc.NewRPCAggregator(serverConfig.DAConf.AggregatorConfig)
+		aggregator, err := dasrpc.NewRPCAggregator(serverConfig.DAConf.AggregatorConfig)
 		if err != nil {
 			return err
 		}
+		dasLifecycleManager.Register(aggregator)
+		dasImpl = aggregator
 	default:
 		panic("Only local DAS implementation supported for daserver currently.")
 	}
+	if serverConfig.DAConf.CacheConfig.Enable {
+		dasImpl = das.NewCacheWrapper(serverConfig.DAConf.CacheConfig, dasImpl)
+	}
+
+	dasLifecycleManager.Start(ctx)
+	defer dasLifecycleManager.StopAndWait()
+
+	var storeSigners []common.Address
+	for _, address := range serverConfig.StoreSignerAddresses {
+		if !common.IsHexAddress(address) {
+			return fmt.Errorf("invalid store signer address %s", address)
+		}
+		storeSigners = append(storeSigners, common.HexToAddress(address))
+	}
+	if len(storeSigners) == 0 {
+		log.Warn("No store signer addresses configured, accepting unsigned Store requests from anyone")
+	}
 
-	server, err := dasrpc.StartDASRPCServer(ctx, serverConfig.Port, dasImpl)
+	server, err := dasrpc.StartDASRPCServer(ctx, serverConfig.Addr, serverConfig.Port, serverConfig.TLS, dasImpl, storeSigners)
 	if err != nil {
 		return err
 	}
+
+	var restServer *das.RestfulDasServer
+	if serverConfig.EnableREST {
+		log.Info("Starting REST server", "addr", serverConfig.RESTAddr, "port", serverConfig.RESTPort)
+		restServer, err = das.NewRestfulDasServer(serverConfig.RESTAddr, serverConfig.RESTPort, dasImpl)
+		if err != nil {
+			return err
+		}
+	}
+
 	<-sigint
 	server.Stop()
+	if restServer != nil {
+		err = restServer.Shutdown(context.Background())
+		if err != nil {
+			log.Warn("Error shutting down REST server", "err", err)
+		}
+	}
 
 	return nil
 }
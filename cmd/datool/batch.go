@@ -0,0 +1,247 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/offchainlabs/nitro/arbnode"
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/cmd/conf"
+	"github.com/offchainlabs/nitro/cmd/util"
+	"github.com/offchainlabs/nitro/das/dasrpc"
+	flag "github.com/spf13/pflag"
+)
+
+// datool batch ...
+
+func startBatch(args []string) error {
+	if len(args) == 0 {
+		return errors.New("datool batch requires an argument, valid arguments are 'decode' and 'dry-run'")
+	}
+	switch args[0] {
+	case "decode":
+		return startBatchDecode(args[1:])
+	case "dry-run":
+		return startBatchDryRun(args[1:])
+	}
+	return fmt.Errorf("datool batch '%s' not supported, valid arguments are 'decode' and 'dry-run'", args[0])
+}
+
+func printJSON(value interface{}) error {
+	encoded, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(encoded))
+	return nil
+}
+
+// datool batch decode
+
+type BatchDecodeConfig struct {
+	Data                  string                 `koanf:"data"`
+	WithHeader            bool                   `koanf:"with-header"`
+	Cert                  string                 `koanf:"cert"`
+	TxHash                string                 `koanf:"tx-hash"`
+	L1URL                 string                 `koanf:"l1-url"`
+	SequencerInboxAddress string                 `koanf:"sequencer-inbox-address"`
+	DASURL                string                 `koanf:"das-url"`
+	DASTLS                dasrpc.ClientTLSConfig `koanf:"das-tls"`
+	DelayedMessagesRead   uint64                 `koanf:"delayed-messages-read"`
+	ChainID               uint64                 `koanf:"chain-id"`
+	ConfConfig            conf.ConfConfig        `koanf:"conf"`
+}
+
+func parseBatchDecodeConfig(args []string) (*BatchDecodeConfig, error) {
+	f := flag.NewFlagSet("datool batch decode", flag.ContinueOnError)
+	f.String("data", "", "Hex encoded batch data to decode, as posted to the sequencer inbox")
+	f.Bool("with-header", false, "The batch data starts with the 40 byte header the sequencer inbox adds to it")
+	f.String("cert", "", "Base64 encoded DAS certificate of the batch to decode")
+	f.String("tx-hash", "", "Hash of the L1 transaction which posted the batch to decode")
+	f.String("l1-url", "", "URL of the L1 node to read the batch from, with --tx-hash")
+	f.String("sequencer-inbox-address", "", "Address of the SequencerInbox contract, with --tx-hash")
+	f.String("das-url", "", "URL of DAS server to retrieve batches stored in the DAS from")
+	dasrpc.ClientTLSConfigAddOptions("das-tls", f)
+	f.Uint64("delayed-messages-read", 0, "Number of delayed messages read before the batch, to number the delayed messages it reads")
+	f.Uint64("chain-id", 42161, "L2 chain ID, to decode the batch's transactions with (0 = don't decode transactions)")
+	conf.ConfConfigAddOptions("conf", f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config BatchDecodeConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	sources := 0
+	for _, source := range []string{config.Data, config.Cert, config.TxHash} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, errors.New("exactly one of --data, --cert or --tx-hash must be specified")
+	}
+	if config.TxHash != "" && (config.L1URL == "" || !common.IsHexAddress(config.SequencerInboxAddress)) {
+		return nil, errors.New("--tx-hash requires --l1-url and a valid --sequencer-inbox-address")
+	}
+	return &config, nil
+}
+
+func startBatchDecode(args []string) error {
+	config, err := parseBatchDecodeConfig(args)
+	if err != nil {
+		return err
+	}
+
+	var dasReader arbstate.DataAvailabilityServiceReader
+	if config.DASURL != "" {
+		dasReader, err = dasrpc.NewDASRPCClient(config.DASURL, &config.DASTLS, nil)
+		if err != nil {
+			return err
+		}
+	}
+	var chainId *big.Int
+	if config.ChainID != 0 {
+		chainId = new(big.Int).SetUint64(config.ChainID)
+	}
+
+	ctx := context.Background()
+	switch {
+	case config.Data != "":
+		data, err := hexutil.Decode(config.Data)
+		if err != nil {
+			return fmt.Errorf("invalid --data: %w", err)
+		}
+		if config.WithHeader {
+			return printDecodedBatch(arbstate.DecodeBatch(ctx, data, dasReader, config.DelayedMessagesRead, chainId))
+		}
+		return printDecodedBatch(arbstate.DecodeBatchData(ctx, data, dasReader, config.DelayedMessagesRead, chainId))
+	case config.Cert != "":
+		cert, err := base64.StdEncoding.DecodeString(config.Cert)
+		if err != nil {
+			return fmt.Errorf("invalid --cert: %w", err)
+		}
+		if dasReader == nil {
+			return errors.New("--cert requires --das-url")
+		}
+		return printDecodedBatch(arbstate.DecodeBatchData(ctx, cert, dasReader, config.DelayedMessagesRead, chainId))
+	default:
+		l1Client, err := ethclient.DialContext(ctx, config.L1URL)
+		if err != nil {
+			return err
+		}
+		sequencerInbox, err := arbnode.NewSequencerInbox(l1Client, common.HexToAddress(config.SequencerInboxAddress), 0)
+		if err != nil {
+			return err
+		}
+		batches, err := sequencerInbox.LookupBatchesInTx(ctx, common.HexToHash(config.TxHash))
+		if err != nil {
+			return err
+		}
+		if len(batches) == 0 {
+			return fmt.Errorf("no batches were posted by transaction %v", config.TxHash)
+		}
+		delayedMessagesRead := config.DelayedMessagesRead
+		var decoded []*postedBatch
+		for _, batch := range batches {
+			data, err := batch.Serialize(ctx, l1Client)
+			if err != nil {
+				return err
+			}
+			decodedBatch, err := arbstate.DecodeBatch(ctx, data, dasReader, delayedMessagesRead, chainId)
+			if decodedBatch != nil {
+				decoded = append(decoded, &postedBatch{
+					SequenceNumber: batch.SequenceNumber,
+					L1BlockNumber:  batch.BlockNumber,
+					Batch:          decodedBatch,
+				})
+			}
+			if err != nil {
+				if printErr := printJSON(decoded); printErr != nil {
+					return printErr
+				}
+				return fmt.Errorf("error decoding batch %d: %w", batch.SequenceNumber, err)
+			}
+			delayedMessagesRead = batch.AfterDelayedCount
+		}
+		return printJSON(decoded)
+	}
+}
+
+// postedBatch is a decoded batch, along with where it was posted.
+type postedBatch struct {
+	SequenceNumber uint64                 `json:"sequenceNumber"`
+	L1BlockNumber  uint64                 `json:"l1BlockNumber"`
+	Batch          *arbstate.DecodedBatch `json:"batch"`
+}
+
+// printDecodedBatch prints what was decoded of a batch, even if it couldn't be
+// fully decoded, before returning the error.
+func printDecodedBatch(batch *arbstate.DecodedBatch, decodeErr error) error {
+	if batch != nil {
+		if err := printJSON(batch); err != nil {
+			return err
+		}
+	}
+	return decodeErr
+}
+
+// datool batch dry-run
+
+type BatchDryRunConfig struct {
+	URL        string          `koanf:"url"`
+	ConfConfig conf.ConfConfig `koanf:"conf"`
+}
+
+func parseBatchDryRunConfig(args []string) (*BatchDryRunConfig, error) {
+	f := flag.NewFlagSet("datool batch dry-run", flag.ContinueOnError)
+	f.String("url", "", "URL of the batch poster's RPC, with the arbbatchposter API enabled")
+	conf.ConfConfigAddOptions("conf", f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config BatchDryRunConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	if config.URL == "" {
+		return nil, errors.New("--url must be specified")
+	}
+	return &config, nil
+}
+
+func startBatchDryRun(args []string) error {
+	config, err := parseBatchDryRunConfig(args)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	client, err := rpc.DialContext(ctx, config.URL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	var dryRun arbnode.BatchDryRun
+	if err := client.CallContext(ctx, &dryRun, "arbbatchposter_dryRunBatch"); err != nil {
+		return err
+	}
+	return printJSON(&dryRun)
+}
@@ -6,11 +6,14 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/offchainlabs/nitro/cmd/conf"
 	"github.com/offchainlabs/nitro/cmd/util"
 	"github.com/offchainlabs/nitro/das"
@@ -21,17 +24,25 @@ import (
 func main() {
 	args := os.Args
 	if len(args) < 2 {
-		panic("Usage: datool [client|keygen] ...")
+		panic("Usage: datool [batch|client|keygen|keyset|migrate|sync] ...")
 	}
 
 	var err error
 	switch strings.ToLower(args[1]) {
+	case "batch":
+		err = startBatch(args[2:])
 	case "client":
 		err = startClient(args[2:])
 	case "keygen":
 		err = startKeyGen(args[2:])
+	case "keyset":
+		err = startKeyset(args[2:])
+	case "migrate":
+		err = startMigrate(args[2:])
+	case "sync":
+		err = startSync(args[2:])
 	default:
-		panic(fmt.Sprintf("Unknown tool '%s' specified, valid tools are 'client', 'keygen'", args[1]))
+		panic(fmt.Sprintf("Unknown tool '%s' specified, valid tools are 'batch', 'client', 'keygen', 'keyset', 'migrate', 'sync'", args[1]))
 	}
 	if err != nil {
 		panic(err)
@@ -53,11 +64,12 @@ func startClient(args []string) error {
 // datool client store
 
 type ClientStoreConfig struct {
-	URL                string        `koanf:"url"`
-	Message            string        `koanf:"message"`
-	DASRetentionPeriod time.Duration `koanf:"das-retention-period"`
-	// TODO ECDSA private key to sign message with
-	ConfConfig conf.ConfConfig `koanf:"conf"`
+	URL                string                 `koanf:"url"`
+	Message            string                 `koanf:"message"`
+	DASRetentionPeriod time.Duration          `koanf:"das-retention-period"`
+	SigningKey         string                 `koanf:"signing-key"`
+	TLS                dasrpc.ClientTLSConfig `koanf:"tls"`
+	ConfConfig         conf.ConfConfig        `koanf:"conf"`
 }
 
 func parseClientStoreConfig(args []string) (*ClientStoreConfig, error) {
@@ -65,6 +77,8 @@ func parseClientStoreConfig(args []string) (*ClientStoreConfig, error) {
 	f.String("url", "", "URL of DAS server to connect to.")
 	f.String("message", "", "Message to send.")
 	f.Duration("das-retention-period", 24*time.Hour, "The period which DASes are requested to retain the stored batches.")
+	f.String("signing-key", "", "ECDSA private key (hex, or path to a file containing it) to sign the Store request with.")
+	dasrpc.ClientTLSConfigAddOptions("tls", f)
 	conf.ConfConfigAddOptions("conf", f)
 
 	k, err := util.BeginCommonParse(f, args)
@@ -85,7 +99,12 @@ func startClientStore(args []string) error {
 		return err
 	}
 
-	client, err := dasrpc.NewDASRPCClient(config.URL)
+	signingKey, err := das.LoadECDSAPrivKey(config.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	client, err := dasrpc.NewDASRPCClient(config.URL, &config.TLS, signingKey)
 	if err != nil {
 		return err
 	}
@@ -108,15 +127,17 @@ func startClientStore(args []string) error {
 // datool client retrieve
 
 type ClientRetrieveConfig struct {
-	URL        string          `koanf:"url"`
-	Cert       string          `koanf:"cert"`
-	ConfConfig conf.ConfConfig `koanf:"conf"`
+	URL        string                 `koanf:"url"`
+	Cert       string                 `koanf:"cert"`
+	TLS        dasrpc.ClientTLSConfig `koanf:"tls"`
+	ConfConfig conf.ConfConfig        `koanf:"conf"`
 }
 
 func parseClientRetrieveConfig(args []string) (*ClientRetrieveConfig, error) {
 	f := flag.NewFlagSet("datool client retrieve", flag.ContinueOnError)
 	f.String("url", "", "URL of DAS server to connect to.")
 	f.String("cert", "", "Base64 encodeded DAS certificate of message to retrieve.")
+	dasrpc.ClientTLSConfigAddOptions("tls", f)
 	conf.ConfConfigAddOptions("conf", f)
 
 	k, err := util.BeginCommonParse(f, args)
@@ -137,7 +158,7 @@ func startClientRetrieve(args []string) error {
 		return err
 	}
 
-	client, err := dasrpc.NewDASRPCClient(config.URL)
+	client, err := dasrpc.NewDASRPCClient(config.URL, &config.TLS, nil)
 	if err != nil {
 		return err
 	}
@@ -192,3 +213,97 @@ func startKeyGen(args []string) error {
 	}
 	return nil
 }
+
+// datool keyset
+
+type KeysetConfig struct {
+	AssumedHonest int             `koanf:"assumed-honest"`
+	Backends      string          `koanf:"backends"`
+	ConfConfig    conf.ConfConfig `koanf:"conf"`
+}
+
+func parseKeysetConfig(args []string) (*KeysetConfig, error) {
+	f := flag.NewFlagSet("datool keyset", flag.ContinueOnError)
+	f.Int("assumed-honest", 0, "Number of assumed honest backends (H) of the committee")
+	f.String("backends", "", "JSON RPC backend configuration of the committee, as passed to --data-availability.aggregator.backends")
+	conf.ConfConfigAddOptions("conf", f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config KeysetConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func startKeyset(args []string) error {
+	config, err := parseKeysetConfig(args)
+	if err != nil {
+		return err
+	}
+
+	keyset, err := dasrpc.KeysetFromBackends(config.AssumedHonest, config.Backends)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Keyset: %s\n", hexutil.Encode(keyset.Serialize()))
+	fmt.Printf("Keyset hash: %s\n", common.Hash(keyset.Hash()))
+	return nil
+}
+
+// datool migrate
+
+type MigrateConfig struct {
+	SrcDataDir            string          `koanf:"src-data-dir"`
+	DestDataDir           string          `koanf:"dest-data-dir"`
+	LegacyRetentionPeriod time.Duration   `koanf:"legacy-retention-period"`
+	ConfConfig            conf.ConfConfig `koanf:"conf"`
+}
+
+func parseMigrateConfig(args []string) (*MigrateConfig, error) {
+	f := flag.NewFlagSet("datool migrate", flag.ContinueOnError)
+	f.String("src-data-dir", "", "The data dir of the local disk DAS to import batches from")
+	f.String("dest-data-dir", "", "The data dir of the local db DAS to import batches into")
+	f.Duration("legacy-retention-period", time.Hour*24*15, "The period to retain batches stored without an expiry for, counted from the import")
+	conf.ConfConfigAddOptions("conf", f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config MigrateConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	if config.SrcDataDir == "" || config.DestDataDir == "" {
+		return nil, errors.New("--src-data-dir and --dest-data-dir must both be specified")
+	}
+	return &config, nil
+}
+
+func startMigrate(args []string) error {
+	config, err := parseMigrateConfig(args)
+	if err != nil {
+		return err
+	}
+
+	dbConfig := das.DefaultLocalDBDASConfig
+	dbConfig.DataDir = config.DestDataDir
+	db, err := das.OpenLocalDBDASDatabase(dbConfig, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	imported, skipped, err := das.ImportLocalDiskDAS(context.Background(), config.SrcDataDir, db, config.LegacyRetentionPeriod)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d batches, skipped %d expired or invalid batches\n", imported, skipped)
+	return nil
+}
@@ -0,0 +1,249 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/offchainlabs/nitro/arbnode"
+	"github.com/offchainlabs/nitro/cmd/conf"
+	"github.com/offchainlabs/nitro/cmd/util"
+	"github.com/offchainlabs/nitro/das"
+	"github.com/offchainlabs/nitro/das/dasrpc"
+	flag "github.com/spf13/pflag"
+)
+
+// datool sync
+
+type SyncConfig struct {
+	L1URL                 string                     `koanf:"l1-url"`
+	SequencerInboxAddress string                     `koanf:"sequencer-inbox-address"`
+	FromBlock             uint64                     `koanf:"from-block"`
+	ToBlock               uint64                     `koanf:"to-block"`
+	BlocksPerQuery        uint64                     `koanf:"blocks-per-query"`
+	SourceRPCURLs         []string                   `koanf:"source-rpc-urls"`
+	SourceRPCTLS          dasrpc.ClientTLSConfig     `koanf:"source-rpc-tls"`
+	SourceRESTURLs        []string                   `koanf:"source-rest-urls"`
+	StateFile             string                     `koanf:"state-file"`
+	LogLevel              int                        `koanf:"log-level"`
+	DAConf                das.DataAvailabilityConfig `koanf:"data-availability"`
+	ConfConfig            conf.ConfConfig            `koanf:"conf"`
+
+	// Set if --from-block was passed, so it takes priority over the state file
+	fromBlockSet bool
+}
+
+func parseSyncConfig(args []string) (*SyncConfig, error) {
+	f := flag.NewFlagSet("datool sync", flag.ContinueOnError)
+	f.String("l1-url", "", "URL of the L1 node to read sequencer batches from")
+	f.String("sequencer-inbox-address", "", "Address of the SequencerInbox contract")
+	f.Uint64("from-block", 0, "First L1 block to sync batches from, eg the rollup's deployment block")
+	f.Uint64("to-block", 0, "Last L1 block to sync batches from (0 = the latest block)")
+	f.Uint64("blocks-per-query", 1000, "Number of L1 blocks to look up batches in at a time")
+	f.StringSlice("source-rpc-urls", nil, "URLs of DAS RPC backends to fetch missing batches from")
+	dasrpc.ClientTLSConfigAddOptions("source-rpc-tls", f)
+	f.StringSlice("source-rest-urls", nil, "URLs of REST DAS mirrors to fetch missing batches from")
+	f.String("state-file", "", "File to record sync progress in, to resume from on the next run")
+	f.Int("log-level", int(log.LvlInfo), "log level")
+	das.DataAvailabilityConfigAddOptions("data-availability", f)
+	conf.ConfConfigAddOptions("conf", f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config SyncConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	config.fromBlockSet = f.Changed("from-block")
+	if config.L1URL == "" || !common.IsHexAddress(config.SequencerInboxAddress) {
+		return nil, errors.New("--l1-url and a valid --sequencer-inbox-address must be specified")
+	}
+	if len(config.SourceRPCURLs) == 0 && len(config.SourceRESTURLs) == 0 {
+		return nil, errors.New("at least one of --source-rpc-urls or --source-rest-urls must be specified")
+	}
+	if config.BlocksPerQuery == 0 {
+		return nil, errors.New("--blocks-per-query must be positive")
+	}
+	return &config, nil
+}
+
+type syncState struct {
+	NextBlock uint64 `json:"nextBlock"`
+}
+
+func readSyncState(path string) (*syncState, error) {
+	contents, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state syncState
+	if err := json.Unmarshal(contents, &state); err != nil {
+		return nil, fmt.Errorf("invalid sync state file %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+func writeSyncState(path string, state syncState) error {
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Write and rename so an interrupted write can't corrupt the state.
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, contents, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func openSyncDestination(config das.DataAvailabilityConfig) (das.DataAvailabilityService, func(), error) {
+	mode, err := config.Mode()
+	if err != nil {
+		return nil, nil, err
+	}
+	switch mode {
+	case das.LocalDataAvailability:
+		localDiskDAS, err := das.NewLocalDiskDAS(config.LocalDiskDASConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		return localDiskDAS, func() {}, nil
+	case das.LocalDBDataAvailability:
+		localDBDAS, err := das.NewLocalDBDAS(config.LocalDBDASConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		return localDBDAS, localDBDAS.StopAndWait, nil
+	default:
+		return nil, nil, errors.New("datool sync only supports the local and local-db data availability modes as its destination")
+	}
+}
+
+func startSync(args []string) error {
+	config, err := parseSyncConfig(args)
+	if err != nil {
+		return err
+	}
+
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(config.LogLevel))
+	log.Root().SetHandler(glogger)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	dest, closeDest, err := openSyncDestination(config.DAConf)
+	if err != nil {
+		return err
+	}
+	defer closeDest()
+
+	var sources []das.DataAvailabilityServiceHashReader
+	for _, url := range config.SourceRPCURLs {
+		client, err := dasrpc.NewDASRPCClient(url, &config.SourceRPCTLS, nil)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, client)
+	}
+	if len(config.SourceRESTURLs) > 0 {
+		restConfig := das.DefaultRestfulClientAggregatorConfig
+		restConfig.Urls = config.SourceRESTURLs
+		mirrors, err := das.NewRestfulClientAggregator(restConfig)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, mirrors)
+	}
+
+	l1Client, err := ethclient.DialContext(ctx, config.L1URL)
+	if err != nil {
+		return err
+	}
+	sequencerInbox, err := arbnode.NewSequencerInbox(l1Client, common.HexToAddress(config.SequencerInboxAddress), int64(config.FromBlock))
+	if err != nil {
+		return err
+	}
+	syncer, err := das.NewSyncer(sequencerInbox, sources, dest)
+	if err != nil {
+		return err
+	}
+
+	from := config.FromBlock
+	if config.StateFile != "" {
+		state, err := readSyncState(config.StateFile)
+		if err != nil {
+			return err
+		}
+		if state != nil {
+			if config.fromBlockSet {
+				fmt.Printf("Syncing from block %d as requested, instead of resuming from block %d\n", from, state.NextBlock)
+			} else {
+				fmt.Printf("Resuming sync from block %d\n", state.NextBlock)
+				from = state.NextBlock
+			}
+		}
+	}
+	to := config.ToBlock
+	if to == 0 {
+		to, err = l1Client.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var total das.SyncStats
+	// Progress is only saved up to the first range with batches that failed to
+	// sync, so they're retried on the next run.
+	saveProgress := config.StateFile != ""
+	for start := from; start <= to; {
+		end := start + config.BlocksPerQuery - 1
+		if end > to {
+			end = to
+		}
+		stats, err := syncer.SyncBlockRange(ctx, start, end)
+		total.Add(stats)
+		if err != nil {
+			return fmt.Errorf("sync of blocks %d to %d failed, rerun to resume: %w", start, end, err)
+		}
+		if saveProgress && stats.Failed > 0 {
+			saveProgress = false
+			fmt.Printf("Batches in blocks %d to %d failed to sync, the next run will resume from block %d\n", start, end, start)
+		}
+		if saveProgress {
+			if err := writeSyncState(config.StateFile, syncState{NextBlock: end + 1}); err != nil {
+				return err
+			}
+		}
+		progress := 100.0
+		if to > from {
+			progress = float64(end-from) * 100 / float64(to-from)
+		}
+		fmt.Printf(
+			"Synced blocks %d to %d (%.1f%%): %d batches, %d DAS certificates, %d fetched, %d already present, %d expired, %d failed\n",
+			start, end, progress, total.Batches, total.Certs, total.Fetched, total.Present, total.Expired, total.Failed,
+		)
+		start = end + 1
+	}
+	if total.Failed > 0 {
+		return fmt.Errorf("%d batches couldn't be synced, sync their blocks again to retry", total.Failed)
+	}
+	return nil
+}
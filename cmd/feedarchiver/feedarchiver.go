@@ -0,0 +1,176 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/exp"
+	"github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/offchainlabs/nitro/cmd/conf"
+	"github.com/offchainlabs/nitro/cmd/util"
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+
+	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/feedarchiver"
+)
+
+func init() {
+	http.DefaultServeMux = http.NewServeMux()
+}
+
+func main() {
+	if err := startup(); err != nil {
+		log.Error("Error running feed archiver", "err", err)
+	}
+}
+
+func printSampleUsage() {
+	progname := os.Args[0]
+	fmt.Printf("\n")
+	fmt.Printf("Sample usage:                  %s --help \n", progname)
+}
+
+func startup() error {
+	ctx := context.Background()
+
+	vcsRevision, vcsTime := conf.GetVersion()
+	archiverConfig, err := ParseFeedArchiver(ctx, os.Args[1:])
+	if err != nil {
+		fmt.Printf("\nrevision: %v, vcs.time: %v\n", vcsRevision, vcsTime)
+		printSampleUsage()
+		if !strings.Contains(err.Error(), "help requested") {
+			fmt.Printf("%s\n", err.Error())
+		}
+
+		return nil
+	}
+
+	logFormat, err := conf.ParseLogType(archiverConfig.LogType)
+	if err != nil {
+		flag.Usage()
+		panic(fmt.Sprintf("Error parsing log type: %v", err))
+	}
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, logFormat))
+	glogger.Verbosity(log.Lvl(archiverConfig.LogLevel))
+	log.Root().SetHandler(glogger)
+
+	log.Info("Running Arbitrum nitro feed archiver", "revision", vcsRevision, "vcs.time", vcsTime)
+
+	if archiverConfig.Metrics {
+		go metrics.CollectProcessMetrics(3 * time.Second)
+
+		if archiverConfig.MetricsServer.Addr != "" {
+			address := fmt.Sprintf("%v:%v", archiverConfig.MetricsServer.Addr, archiverConfig.MetricsServer.Port)
+			exp.Setup(address)
+		}
+	}
+
+	defer log.Info("Cleanly shutting down feed archiver")
+
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+
+	if archiverConfig.Archiver.Replay.Enable {
+		replayer, err := feedarchiver.NewReplayer(archiverConfig.Feed.Output, &archiverConfig.Archiver)
+		if err != nil {
+			return err
+		}
+		if err := replayer.Start(ctx); err != nil {
+			return err
+		}
+		<-sigint
+		replayer.StopAndWait()
+		return nil
+	}
+
+	archiver, err := feedarchiver.NewArchiver(archiverConfig.Feed.Input, &archiverConfig.Archiver)
+	if err != nil {
+		return err
+	}
+	archiver.Start(ctx)
+	<-sigint
+	archiver.StopAndWait()
+	return nil
+}
+
+type FeedArchiverConfig struct {
+	Conf          conf.ConfConfig            `koanf:"conf"`
+	LogLevel      int                        `koanf:"log-level"`
+	LogType       string                     `koanf:"log-type"`
+	Metrics       bool                       `koanf:"metrics"`
+	MetricsServer conf.MetricsServerConfig   `koanf:"metrics-server"`
+	Feed          broadcastclient.FeedConfig `koanf:"feed"`
+	Archiver      feedarchiver.Config        `koanf:"archiver"`
+}
+
+var FeedArchiverConfigDefault = FeedArchiverConfig{
+	Conf:          conf.ConfConfigDefault,
+	LogLevel:      int(log.LvlInfo),
+	LogType:       "plaintext",
+	Metrics:       false,
+	MetricsServer: conf.MetricsServerConfigDefault,
+	Feed:          broadcastclient.FeedConfigDefault,
+	Archiver:      feedarchiver.DefaultConfig,
+}
+
+func FeedArchiverConfigAddOptions(f *flag.FlagSet) {
+	conf.ConfConfigAddOptions("conf", f)
+	f.Int("log-level", FeedArchiverConfigDefault.LogLevel, "log level")
+	f.String("log-type", FeedArchiverConfigDefault.LogType, "log type")
+	f.Bool("metrics", FeedArchiverConfigDefault.Metrics, "enable metrics")
+	conf.MetricsServerAddOptions("metrics-server", f)
+	// The feed input is archived, and the output serves replays
+	broadcastclient.FeedConfigAddOptions("feed", f, true, true)
+	feedarchiver.ConfigAddOptions("archiver", f)
+}
+
+func ParseFeedArchiver(_ context.Context, args []string) (*FeedArchiverConfig, error) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+
+	FeedArchiverConfigAddOptions(f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var archiverConfig FeedArchiverConfig
+	if err := util.EndCommonParse(k, &archiverConfig); err != nil {
+		return nil, err
+	}
+
+	if archiverConfig.Conf.Dump {
+		// Print out current configuration
+
+		// Don't keep printing configuration file and don't print wallet passwords
+		err := k.Load(confmap.Provider(map[string]interface{}{
+			"conf.dump": false,
+		}, "."), nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error removing extra parameters before dump")
+		}
+
+		c, err := k.Marshal(json.Parser())
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to marshal config file to JSON")
+		}
+
+		fmt.Println(string(c))
+		os.Exit(0)
+	}
+
+	return &archiverConfig, nil
+}
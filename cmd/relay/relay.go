@@ -11,8 +11,11 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/exp"
 	"github.com/knadh/koanf/parsers/json"
 	"github.com/knadh/koanf/providers/confmap"
 	"github.com/offchainlabs/nitro/cmd/conf"
@@ -67,19 +70,35 @@ func startup() error {
 
 	log.Info("Running Arbitrum nitro relay", "revision", vcsRevision, "vcs.time", vcsTime)
 
+	if relayConfig.Metrics {
+		go metrics.CollectProcessMetrics(3 * time.Second)
+
+		if relayConfig.MetricsServer.Addr != "" {
+			address := fmt.Sprintf("%v:%v", relayConfig.MetricsServer.Addr, relayConfig.MetricsServer.Port)
+			exp.Setup(address)
+		}
+	}
+
 	serverConf := wsbroadcastserver.BroadcasterConfig{
-		Addr:          relayConfig.Node.Feed.Output.Addr,
-		IOTimeout:     relayConfig.Node.Feed.Output.IOTimeout,
-		Port:          relayConfig.Node.Feed.Output.Port,
-		Ping:          relayConfig.Node.Feed.Output.Ping,
-		ClientTimeout: relayConfig.Node.Feed.Output.ClientTimeout,
-		Queue:         relayConfig.Node.Feed.Output.Queue,
-		Workers:       relayConfig.Node.Feed.Output.Workers,
+		Addr:              relayConfig.Node.Feed.Output.Addr,
+		IOTimeout:         relayConfig.Node.Feed.Output.IOTimeout,
+		Port:              relayConfig.Node.Feed.Output.Port,
+		Ping:              relayConfig.Node.Feed.Output.Ping,
+		ClientTimeout:     relayConfig.Node.Feed.Output.ClientTimeout,
+		Queue:             relayConfig.Node.Feed.Output.Queue,
+		Workers:           relayConfig.Node.Feed.Output.Workers,
+		EnableCompression: relayConfig.Node.Feed.Output.EnableCompression,
+		EnableBinary:      relayConfig.Node.Feed.Output.EnableBinary,
+		ConnectionLimits:  relayConfig.Node.Feed.Output.ConnectionLimits,
+		Backlog:           relayConfig.Node.Feed.Output.Backlog,
 	}
 
 	clientConf := broadcastclient.BroadcastClientConfig{
-		Timeout: relayConfig.Node.Feed.Input.Timeout,
-		URLs:    relayConfig.Node.Feed.Input.URLs,
+		Timeout:           relayConfig.Node.Feed.Input.Timeout,
+		URLs:              relayConfig.Node.Feed.Input.URLs,
+		Verify:            relayConfig.Node.Feed.Input.Verify,
+		EnableCompression: relayConfig.Node.Feed.Input.EnableCompression,
+		EnableBinary:      relayConfig.Node.Feed.Input.EnableBinary,
 	}
 
 	defer log.Info("Cleanly shutting down relay")
@@ -88,7 +107,10 @@ func startup() error {
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 
 	// Start up an arbitrum sequencer relay
-	newRelay := relay.NewRelay(serverConf, clientConf)
+	newRelay, err := relay.NewRelay(serverConf, clientConf, &relayConfig.Relay)
+	if err != nil {
+		return err
+	}
 	err = newRelay.Start(ctx)
 	if err != nil {
 		return err
@@ -99,24 +121,33 @@ func startup() error {
 }
 
 type RelayConfig struct {
-	Conf     conf.ConfConfig `koanf:"conf"`
-	LogLevel int             `koanf:"log-level"`
-	LogType  string          `koanf:"log-type"`
-	Node     RelayNodeConfig `koanf:"node"`
+	Conf          conf.ConfConfig          `koanf:"conf"`
+	LogLevel      int                      `koanf:"log-level"`
+	LogType       string                   `koanf:"log-type"`
+	Metrics       bool                     `koanf:"metrics"`
+	MetricsServer conf.MetricsServerConfig `koanf:"metrics-server"`
+	Node          RelayNodeConfig          `koanf:"node"`
+	Relay         relay.Config             `koanf:"relay"`
 }
 
 var RelayConfigDefault = RelayConfig{
-	Conf:     conf.ConfConfigDefault,
-	LogLevel: int(log.LvlInfo),
-	LogType:  "plaintext",
-	Node:     RelayNodeConfigDefault,
+	Conf:          conf.ConfConfigDefault,
+	LogLevel:      int(log.LvlInfo),
+	LogType:       "plaintext",
+	Metrics:       false,
+	MetricsServer: conf.MetricsServerConfigDefault,
+	Node:          RelayNodeConfigDefault,
+	Relay:         relay.DefaultConfig,
 }
 
 func RelayConfigAddOptions(f *flag.FlagSet) {
 	conf.ConfConfigAddOptions("conf", f)
 	f.Int("log-level", RelayConfigDefault.LogLevel, "log level")
 	f.String("log-type", RelayConfigDefault.LogType, "log type")
+	f.Bool("metrics", RelayConfigDefault.Metrics, "enable metrics")
+	conf.MetricsServerAddOptions("metrics-server", f)
 	RelayNodeConfigAddOptions("node", f)
+	relay.ConfigAddOptions("relay", f)
 }
 
 type RelayNodeConfig struct {
@@ -9,30 +9,66 @@ import (
 	"errors"
 	"fmt"
 	"math/bits"
+	"sync"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/blsSignatures"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
 	flag "github.com/spf13/pflag"
 )
 
 type AggregatorConfig struct {
 	// sequencer public key
-	AssumedHonest int    `koanf:"assumed-honest"`
-	Backends      string `koanf:"backends"`
+	AssumedHonest                 int           `koanf:"assumed-honest"`
+	Backends                      string        `koanf:"backends"`
+	StoreSigningKey               string        `koanf:"store-signing-key"`
+	BackendStoreTimeout           time.Duration `koanf:"backend-store-timeout"`
+	StoreRetries                  int           `koanf:"store-retries"`
+	StoreRetryDelay               time.Duration `koanf:"store-retry-delay"`
+	BackgroundDeliveryConcurrency int           `koanf:"background-delivery-concurrency"`
+	HistoricalKeysets             []string      `koanf:"historical-keysets"`
+	KeysetCerts                   bool          `koanf:"keyset-certs"`
 }
 
-var DefaultAggregatorConfig = AggregatorConfig{}
+var DefaultAggregatorConfig = AggregatorConfig{
+	BackendStoreTimeout:           time.Minute,
+	StoreRetries:                  3,
+	StoreRetryDelay:               5 * time.Second,
+	BackgroundDeliveryConcurrency: 16,
+}
 
 func AggregatorConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Int(prefix+".assumed-honest", DefaultAggregatorConfig.AssumedHonest, "Number of assumed honest backends (H). If there are N backends, K=N+1-H valid responses are required to consider an Store request to be successful.")
 	f.String(prefix+".backends", DefaultAggregatorConfig.Backends, "JSON RPC backend configuration")
+	f.String(prefix+".store-signing-key", DefaultAggregatorConfig.StoreSigningKey, "ECDSA private key (hex, or path to a file containing it) used to sign Store requests to backends, eg the batch poster's")
+	f.Duration(prefix+".backend-store-timeout", DefaultAggregatorConfig.BackendStoreTimeout, "Timeout of each Store attempt to a single backend (0 = no timeout)")
+	f.Int(prefix+".store-retries", DefaultAggregatorConfig.StoreRetries, "Number of times a failed Store to a backend is retried, including after the aggregated Store has returned")
+	f.Duration(prefix+".store-retry-delay", DefaultAggregatorConfig.StoreRetryDelay, "Delay before retrying a failed Store to a backend")
+	f.Int(prefix+".background-delivery-concurrency", DefaultAggregatorConfig.BackgroundDeliveryConcurrency, "Maximum number of Store retries and background Stores to backends in flight at once")
+	f.StringSlice(prefix+".historical-keysets", DefaultAggregatorConfig.HistoricalKeysets, "Hex encoded keysets (as output by 'datool keyset') of previous committees, to verify certificates they signed")
+	f.Bool(prefix+".keyset-certs", DefaultAggregatorConfig.KeysetCerts, "Issue and accept versioned certificates naming the keyset that signed them, which only nodes and validators supporting them can read (otherwise legacy certificates are issued)")
 }
 
+// Aggregator stores to and retrieves from a committee of backend DASes. Once
+// started, Stores to backends that haven't responded by the time K of them have
+// signed continue in the background, independent of the Store caller's context.
 type Aggregator struct {
+	stopwaiter.StopWaiter
 	config   AggregatorConfig
 	services []ServiceDetails
+	stats    []*backendStats // indexed like services
+
+	keyset     *arbstate.DataAvailabilityKeyset // of the current services
+	keysetHash [32]byte
+	keysets    *KeysetRegistry
+
+	// Bounds the number of Store retries and background Stores in flight,
+	// shared by all Stores.
+	retrySlots chan struct{}
 
 	/// calculated fields
 	requiredServicesForStore       int
@@ -58,19 +94,51 @@ func NewServiceDetails(service DataAvailabilityService, pubKey blsSignatures.Pub
 
 func NewAggregator(config AggregatorConfig, services []ServiceDetails) (*Aggregator, error) {
 	var aggSignersMask uint64
+	var signersMasks []uint64
+	var pubKeys []blsSignatures.PublicKey
 	for _, d := range services {
 		if bits.OnesCount64(d.signersMask) != 1 {
 			return nil, fmt.Errorf("Tried to configure backend DAS %v with invalid signersMask %X", d.service, d.signersMask)
 		}
 		aggSignersMask |= d.signersMask
+		signersMasks = append(signersMasks, d.signersMask)
+		pubKeys = append(pubKeys, d.pubKey)
 	}
 	if bits.OnesCount64(aggSignersMask) != len(services) {
 		return nil, errors.New("At least two signers share a mask")
 	}
 
+	keyset, err := NewKeyset(config.AssumedHonest, signersMasks, pubKeys)
+	if err != nil {
+		return nil, err
+	}
+	keysets := NewKeysetRegistry()
+	keysetHash := keysets.Register(keyset)
+	for _, historicalKeyset := range config.HistoricalKeysets {
+		hash, err := keysets.RegisterSerialized(historicalKeyset)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Registered historical DAS keyset", "hash", common.Hash(hash))
+	}
+
+	var stats []*backendStats
+	for _, d := range services {
+		stats = append(stats, &backendStats{status: BackendStatus{Backend: d.service.String(), SignersMask: d.signersMask}})
+	}
+	retryConcurrency := config.BackgroundDeliveryConcurrency
+	if retryConcurrency < 1 {
+		retryConcurrency = 1
+	}
+
 	return &Aggregator{
 		config:                         config,
 		services:                       services,
+		stats:                          stats,
+		keyset:                         keyset,
+		keysetHash:                     keysetHash,
+		keysets:                        keysets,
+		retrySlots:                     make(chan struct{}, retryConcurrency),
 		requiredServicesForStore:       len(services) + 1 - config.AssumedHonest,
 		maxAllowedServiceStoreFailures: config.AssumedHonest - 1,
 	}, nil
@@ -86,43 +154,52 @@ func (a *Aggregator) Retrieve(ctx context.Context, cert []byte) ([]byte, error)
 		return nil, err
 	}
 
-	// Cert is the aggregate cert, validate it against DAS public keys
-	var servicesThatSignedCert []ServiceDetails
-	var pubKeys []blsSignatures.PublicKey
-	for _, d := range a.services {
-		if requestedCert.SignersMask&d.signersMask != 0 {
-			servicesThatSignedCert = append(servicesThatSignedCert, d)
-			pubKeys = append(pubKeys, d.pubKey)
+	// Cert is the aggregate cert, validate it against the keyset that signed it.
+	// Legacy certs don't name their keyset and are validated against the current one.
+	keyset := a.keyset
+	if requestedCert.Version >= arbstate.DASCertVersionKeyset {
+		if !a.config.KeysetCerts {
+			return nil, fmt.Errorf("Unsupported DAS certificate version %d, keyset certs aren't enabled.", requestedCert.Version)
+		}
+		keyset, err = a.keysets.Get(requestedCert.KeysetHash)
+		if err != nil {
+			return nil, err
 		}
 	}
-	if len(servicesThatSignedCert) < a.requiredServicesForStore {
-		return nil, fmt.Errorf("Cert %v was only signed by %d DASes, %d required.", requestedCert, len(servicesThatSignedCert), a.requiredServicesForStore)
-	}
-
-	signedBlob := serializeSignableFields(*requestedCert)
-	sigMatch, err := blsSignatures.VerifySignature(requestedCert.Sig, signedBlob, blsSignatures.AggregatePublicKeys(pubKeys))
+	err = keyset.VerifySignature(requestedCert.SignersMask, serializeSignableFields(*requestedCert), requestedCert.Sig)
 	if err != nil {
-		return nil, err
-	}
-	if !sigMatch {
-		return nil, errors.New("Signature of data in cert passed in doesn't match")
+		return nil, fmt.Errorf("Cert %v failed validation: %w", requestedCert, err)
 	}
 
 	// Query all services, even those that didn't sign.
 	// They may have been late in returning a response after storing the data,
 	// or got the data by some other means.
+	return a.retrieveFromAnyService(ctx, requestedCert.DataHash, func(ctx context.Context, d ServiceDetails) ([]byte, error) {
+		return d.service.Retrieve(ctx, cert)
+	})
+}
+
+// GetByHash calls GetByHash on each backend DAS in parallel and returns immediately
+// on the first successful response where the data matches the requested hash.
+func (a *Aggregator) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	return a.retrieveFromAnyService(ctx, hash, func(ctx context.Context, d ServiceDetails) ([]byte, error) {
+		return d.service.GetByHash(ctx, hash)
+	})
+}
+
+func (a *Aggregator) retrieveFromAnyService(ctx context.Context, hash common.Hash, retrieve func(context.Context, ServiceDetails) ([]byte, error)) ([]byte, error) {
 	blobChan := make(chan []byte, len(a.services))
 	errorChan := make(chan error, len(a.services))
 	subCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	for _, d := range a.services {
 		go func(ctx context.Context, d ServiceDetails) {
-			blob, err := d.service.Retrieve(ctx, cert)
+			blob, err := retrieve(ctx, d)
 			if err != nil {
 				errorChan <- err
 				return
 			}
-			if bytes.Equal(crypto.Keccak256(blob), requestedCert.DataHash[:]) {
+			if common.BytesToHash(crypto.Keccak256(blob)) == hash {
 				blobChan <- blob
 			} else {
 				errorChan <- fmt.Errorf("DAS (mask %X) returned data that doesn't match requested hash!", d.signersMask)
@@ -136,12 +213,12 @@ func (a *Aggregator) Retrieve(ctx context.Context, cert []byte) ([]byte, error)
 		select {
 		case blob := <-blobChan:
 			return blob, nil
-		case err = <-errorChan:
+		case err := <-errorChan:
 			errorCollection = append(errorCollection, err)
 			log.Warn("Couldn't retrieve message from DAS", "err", err)
 			errorCount++
 		case <-ctx.Done():
-			break
+			return nil, fmt.Errorf("Data wasn't able to be retrieved from any DAS before %w: %v", ctx.Err(), errorCollection)
 		}
 	}
 
@@ -154,12 +231,172 @@ type storeResponse struct {
 	err     error
 }
 
+// storeToBackend makes a single Store attempt to a backend and verifies its response.
+// Errors from the backend's Store are retryable, verification failures are not.
+func (a *Aggregator) storeToBackend(ctx context.Context, d ServiceDetails, message []byte, timeout uint64, expectedHash []byte) (blsSignatures.Signature, bool, error) {
+	if a.config.BackendStoreTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.config.BackendStoreTimeout)
+		defer cancel()
+	}
+	cert, err := d.service.Store(ctx, message, timeout)
+	if err != nil {
+		return nil, true, err
+	}
+
+	verified, err := blsSignatures.VerifySignature(cert.Sig, serializeSignableFields(*cert), d.pubKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if !verified {
+		return nil, false, errors.New("Signature verification failed.")
+	}
+
+	// SignersMask from backend DAS is ignored.
+
+	if !bytes.Equal(cert.DataHash[:], expectedHash) {
+		return nil, false, errors.New("Hash verification failed.")
+	}
+	if cert.Timeout != timeout {
+		return nil, false, fmt.Errorf("Timeout was %d, expected %d", cert.Timeout, timeout)
+	}
+	return cert.Sig, false, nil
+}
+
+// storeDelivery tracks the Store of a message to a single backend. Once the
+// aggregated Store has returned, deliveries still running continue in the
+// background only while holding one of the aggregator's retry slots, which
+// bounds them along with the retries.
+type storeDelivery struct {
+	slots  chan struct{}
+	cancel context.CancelFunc
+
+	mutex      sync.Mutex // protects the fields below
+	done       bool
+	background bool // set once the aggregated Store has returned
+	holdsSlot  bool
+}
+
+// acquireSlot waits for a retry slot, unless the delivery already holds one.
+func (d *storeDelivery) acquireSlot(ctx context.Context) error {
+	d.mutex.Lock()
+	holdsSlot := d.holdsSlot
+	d.mutex.Unlock()
+	if holdsSlot {
+		return nil
+	}
+	select {
+	case d.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.holdsSlot {
+		// moveToBackground gave the delivery a slot in the meantime
+		<-d.slots
+	}
+	d.holdsSlot = true
+	return nil
+}
+
+// releaseSlot releases the slot held for a retry, unless the delivery has moved
+// to the background, where it keeps its slot until it's done.
+func (d *storeDelivery) releaseSlot() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.holdsSlot && !d.background {
+		<-d.slots
+		d.holdsSlot = false
+	}
+}
+
+// finish marks the delivery as done, returning whether it was done in the background.
+func (d *storeDelivery) finish() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.done = true
+	if d.holdsSlot {
+		<-d.slots
+		d.holdsSlot = false
+	}
+	return d.background
+}
+
+// moveToBackground is called once the aggregated Store returns. If bounded is
+// set and the delivery is still running, it takes a retry slot for it, or
+// cancels it if none are free, returning false.
+func (d *storeDelivery) moveToBackground(bounded bool) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.done {
+		return true
+	}
+	d.background = true
+	if !bounded || d.holdsSlot {
+		return true
+	}
+	select {
+	case d.slots <- struct{}{}:
+		d.holdsSlot = true
+		return true
+	default:
+		d.cancel()
+		return false
+	}
+}
+
+// deliver stores the message to the backend at index, retrying failed attempts up
+// to StoreRetries times. Retries wait for one of the aggregator's retry slots.
+func (a *Aggregator) deliver(ctx context.Context, index int, message []byte, timeout uint64, expectedHash []byte, delivery *storeDelivery) (blsSignatures.Signature, error) {
+	d := a.services[index]
+	stats := a.stats[index]
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			stats.retried()
+			timer := time.NewTimer(a.config.StoreRetryDelay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				delivery.finish()
+				stats.deliveryFailed(ctx.Err())
+				return nil, ctx.Err()
+			}
+			if err := delivery.acquireSlot(ctx); err != nil {
+				delivery.finish()
+				stats.deliveryFailed(err)
+				return nil, err
+			}
+		}
+		attemptStart := time.Now()
+		sig, retryable, err := a.storeToBackend(ctx, d, message, timeout, expectedHash)
+		delivery.releaseSlot()
+		if err == nil {
+			late := delivery.finish()
+			stats.deliverySucceeded(time.Since(attemptStart), late)
+			return sig, nil
+		}
+		if !retryable || attempt >= a.config.StoreRetries || ctx.Err() != nil {
+			delivery.finish()
+			stats.deliveryFailed(err)
+			return nil, err
+		}
+		log.Warn("Store to DAS backend failed, retrying", "backend", d.service, "attempt", attempt+1, "err", err)
+	}
+}
+
 // Store calls Store on each backend DAS in parallel and collects responses.
 // If there were at least K responses then it aggregates the signatures and
 // signersMasks from each DAS together into the DataAvailabilityCertificate
-// then Store returns immediately. If there were any backend Store subroutines
-// that were still running when Aggregator.Store returns, they are allowed to
-// continue running until the context is canceled (eg via TimeoutWrapper),
+// then Store returns immediately. Failed backend Stores are retried up to
+// StoreRetries times.
+//
+// If the aggregator was started, backend Stores still running when Store
+// returns keep going in the background until they succeed, run out of
+// retries, or the aggregator is stopped. They each take one of the retry
+// slots, and are abandoned if there are none free. Otherwise they are allowed to
+// continue running until Store's context is canceled (eg via TimeoutWrapper),
 // with their results discarded.
 //
 // If Store gets enough errors that K successes is impossible, then it stops early
@@ -170,38 +407,34 @@ type storeResponse struct {
 func (a *Aggregator) Store(ctx context.Context, message []byte, timeout uint64) (*arbstate.DataAvailabilityCertificate, error) {
 	responses := make(chan storeResponse, len(a.services))
 
-	expectedHash := crypto.Keccak256(message)
-	for _, d := range a.services {
-		go func(ctx context.Context, d ServiceDetails) {
-			cert, err := d.service.Store(ctx, message, timeout)
-			if err != nil {
-				responses <- storeResponse{d, nil, err}
-				return
-			}
-
-			verified, err := blsSignatures.VerifySignature(cert.Sig, serializeSignableFields(*cert), d.pubKey)
-			if err != nil {
-				responses <- storeResponse{d, nil, err}
-				return
-			}
-			if !verified {
-				responses <- storeResponse{d, nil, errors.New("Signature verification failed.")}
-				return
-			}
-
-			// SignersMask from backend DAS is ignored.
-
-			if !bytes.Equal(cert.DataHash[:], expectedHash) {
-				responses <- storeResponse{d, nil, errors.New("Hash verification failed.")}
-				return
-			}
-			if cert.Timeout != timeout {
-				responses <- storeResponse{d, nil, fmt.Errorf("Timeout was %d, expected %d", cert.Timeout, timeout)}
-				return
+	// Once started, backend Stores are tied to the aggregator's context rather than ctx.
+	deliveryParentCtx := ctx
+	launch := func(f func()) { go f() }
+	if a.Started() {
+		deliveryParentCtx = a.GetContext()
+		launch = func(f func()) { a.LaunchThread(func(context.Context) { f() }) }
+	}
+	deliveries := make([]*storeDelivery, len(a.services))
+	defer func() {
+		for i, delivery := range deliveries {
+			if !delivery.moveToBackground(a.Started()) {
+				log.Warn("Too many Stores to DAS backends in the background, abandoning one", "backend", a.services[i].service)
 			}
+		}
+	}()
 
-			responses <- storeResponse{d, cert.Sig, nil}
-		}(ctx, d)
+	expectedHash := crypto.Keccak256(message)
+	for i, d := range a.services {
+		i, d := i, d
+		deliveryCtx, cancel := context.WithCancel(deliveryParentCtx)
+		delivery := &storeDelivery{slots: a.retrySlots, cancel: cancel}
+		deliveries[i] = delivery
+		a.stats[i].deliveryStarted()
+		launch(func() {
+			defer cancel()
+			sig, err := a.deliver(deliveryCtx, i, message, timeout, expectedHash, delivery)
+			responses <- storeResponse{d, sig, err}
+		})
 	}
 
 	var pubKeys []blsSignatures.PublicKey
@@ -210,10 +443,12 @@ func (a *Aggregator) Store(ctx context.Context, message []byte, timeout uint64)
 	var aggSignersMask uint64
 	var storeFailures, successfullyStoredCount int
 	var errs []error
+collectResponses:
 	for i := 0; i < len(a.services) && storeFailures <= a.maxAllowedServiceStoreFailures && successfullyStoredCount < a.requiredServicesForStore; i++ {
 		select {
 		case <-ctx.Done():
-			break
+			errs = append(errs, ctx.Err())
+			break collectResponses
 		case r := <-responses:
 			if r.err != nil {
 				storeFailures++
@@ -235,6 +470,10 @@ func (a *Aggregator) Store(ctx context.Context, message []byte, timeout uint64)
 	aggCert.Sig = blsSignatures.AggregateSignatures(sigs)
 	aggPubKey := blsSignatures.AggregatePublicKeys(pubKeys)
 	aggCert.SignersMask = aggSignersMask
+	if a.config.KeysetCerts {
+		aggCert.Version = arbstate.DASCertVersionKeyset
+		aggCert.KeysetHash = a.keysetHash
+	}
 	copy(aggCert.DataHash[:], expectedHash)
 	aggCert.Timeout = timeout
 
@@ -248,6 +487,11 @@ func (a *Aggregator) Store(ctx context.Context, message []byte, timeout uint64)
 	return &aggCert, nil
 }
 
+// Keyset returns the keyset of the aggregator's current backends.
+func (a *Aggregator) Keyset() *arbstate.DataAvailabilityKeyset {
+	return a.keyset
+}
+
 func (a *Aggregator) String() string {
 	var b bytes.Buffer
 	b.WriteString("das.Aggregator{")
@@ -16,6 +16,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/offchainlabs/nitro/arbstate"
 )
@@ -358,3 +359,189 @@ func TestDAS_RetrieveFailureFromAllDASes(t *testing.T) {
 		testConfigurableRetrieveFailures(t, true)
 	}
 }
+
+type flakyStore struct {
+	mutex        sync.Mutex
+	failuresLeft int
+	gate         chan struct{} // if not nil, Store waits for it to be closed
+	DataAvailabilityService
+}
+
+func (w *flakyStore) Store(ctx context.Context, message []byte, timeout uint64) (*arbstate.DataAvailabilityCertificate, error) {
+	if w.gate != nil {
+		select {
+		case <-w.gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	w.mutex.Lock()
+	if w.failuresLeft > 0 {
+		w.failuresLeft--
+		w.mutex.Unlock()
+		return nil, errors.New("Expected Store failure")
+	}
+	w.mutex.Unlock()
+	return w.DataAvailabilityService.Store(ctx, message, timeout)
+}
+
+func TestDAS_StoreQuorumWithBackgroundDelivery(t *testing.T) {
+	gate := make(chan struct{})
+	wrappers := []*flakyStore{
+		{},
+		{failuresLeft: 1},
+		{gate: gate},
+	}
+	var backends []ServiceDetails
+	for i, w := range wrappers {
+		dbPath, err := ioutil.TempDir("/tmp", "das_test")
+		Require(t, err)
+		defer os.RemoveAll(dbPath)
+
+		config := LocalDiskDASConfig{
+			KeyDir:            dbPath,
+			DataDir:           dbPath,
+			AllowGenerateKeys: true,
+		}
+		das, err := NewLocalDiskDAS(config)
+		Require(t, err)
+		pubKey, _, err := ReadKeysFromFile(dbPath)
+		Require(t, err)
+		w.DataAvailabilityService = das
+		details, err := NewServiceDetails(w, *pubKey, uint64(1<<i))
+		Require(t, err)
+		backends = append(backends, *details)
+	}
+
+	// K=2 of 3 backends, so Store can return before the gated backend responds.
+	aggregator, err := NewAggregator(AggregatorConfig{
+		AssumedHonest:                 2,
+		StoreRetries:                  1,
+		StoreRetryDelay:               10 * time.Millisecond,
+		BackgroundDeliveryConcurrency: 1,
+	}, backends)
+	Require(t, err)
+	aggregator.Start(context.Background())
+	defer aggregator.StopAndWait()
+
+	storeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	rawMsg := []byte("It's time for you to see the fnords.")
+	cert, err := aggregator.Store(storeCtx, rawMsg, uint64(time.Now().Add(time.Hour).Unix()))
+	// Background delivery must not depend on the Store caller's context.
+	cancel()
+	Require(t, err, "Error storing message")
+	if cert.SignersMask != 0b011 {
+		Fail(t, "Expected cert signed by the first two backends, got signers mask", cert.SignersMask)
+	}
+
+	status := aggregator.BackendStatus()
+	if status[1].StoreRetries != 1 || status[1].StoreSuccesses != 1 {
+		Fail(t, "Expected flaky backend to succeed after one retry, got", status[1])
+	}
+	if status[2].PendingStores != 1 || status[2].StoreSuccesses != 0 {
+		Fail(t, "Expected gated backend Store to be pending, got", status[2])
+	}
+
+	close(gate)
+	for i := 0; ; i++ {
+		status = aggregator.BackendStatus()
+		if status[2].StoreSuccesses == 1 {
+			break
+		}
+		if i == 500 {
+			Fail(t, "Gated backend never completed its Store in the background, got", status[2])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status[2].LateStores != 1 || status[2].PendingStores != 0 {
+		Fail(t, "Expected gated backend Store to be counted as late, got", status[2])
+	}
+
+	messageRetrieved, err := aggregator.Retrieve(context.Background(), Serialize(*cert))
+	Require(t, err, "Failed to retrieve message")
+	if !bytes.Equal(rawMsg, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+}
+
+func TestDAS_KeysetRotation(t *testing.T) {
+	// Signers masks need not be contiguous.
+	signersMasks := []uint64{1 << 0, 1 << 1, 1 << 2, 1 << 5}
+	var backends []ServiceDetails
+	for i := 0; i < 4; i++ {
+		dbPath, err := ioutil.TempDir("/tmp", "das_test")
+		Require(t, err)
+		defer os.RemoveAll(dbPath)
+
+		config := LocalDiskDASConfig{
+			KeyDir:            dbPath,
+			DataDir:           dbPath,
+			AllowGenerateKeys: true,
+		}
+		das, err := NewLocalDiskDAS(config)
+		Require(t, err)
+		pubKey, _, err := ReadKeysFromFile(dbPath)
+		Require(t, err)
+		backends = append(backends, ServiceDetails{das, *pubKey, signersMasks[i]})
+	}
+	// The fourth backend replaces the third one in the new committee.
+	oldCommittee := backends[:3]
+	newCommittee := []ServiceDetails{backends[0], backends[1], backends[3]}
+
+	ctx := context.Background()
+	rawMsg := []byte("It's time for you to see the fnords.")
+	timeout := uint64(time.Now().Add(time.Hour).Unix())
+
+	// Legacy certs are issued unless keyset certs are enabled, and keyset certs
+	// aren't accepted either.
+	legacyAggregator, err := NewAggregator(AggregatorConfig{AssumedHonest: 1}, oldCommittee)
+	Require(t, err)
+	cert, err := legacyAggregator.Store(ctx, rawMsg, timeout)
+	Require(t, err, "Error storing message")
+	if cert.Version != arbstate.DASCertVersionLegacy || Serialize(*cert)[0] != arbstate.DASMessageHeaderFlag {
+		Fail(t, "Expected a legacy cert without keyset certs enabled")
+	}
+
+	oldAggregator, err := NewAggregator(AggregatorConfig{AssumedHonest: 1, KeysetCerts: true}, oldCommittee)
+	Require(t, err)
+	cert, err = oldAggregator.Store(ctx, rawMsg, timeout)
+	Require(t, err, "Error storing message")
+	_, err = legacyAggregator.Retrieve(ctx, Serialize(*cert))
+	if err == nil {
+		Fail(t, "Expected keyset cert to be rejected without keyset certs enabled")
+	}
+	if cert.Version != arbstate.DASCertVersionKeyset || cert.KeysetHash != oldAggregator.Keyset().Hash() {
+		Fail(t, "Expected cert to name the old committee's keyset")
+	}
+	deserializedCert, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(Serialize(*cert)))
+	Require(t, err)
+	if deserializedCert.KeysetHash != cert.KeysetHash || deserializedCert.DataHash != cert.DataHash {
+		Fail(t, "Cert didn't survive serialization")
+	}
+
+	newAggregator, err := NewAggregator(AggregatorConfig{AssumedHonest: 1, KeysetCerts: true}, newCommittee)
+	Require(t, err)
+	_, err = newAggregator.Retrieve(ctx, Serialize(*cert))
+	if err == nil {
+		Fail(t, "Expected cert of unknown keyset to be rejected")
+	}
+
+	oldKeysetHex := hexutil.Encode(oldAggregator.Keyset().Serialize())
+	newAggregator, err = NewAggregator(AggregatorConfig{AssumedHonest: 1, HistoricalKeysets: []string{oldKeysetHex}, KeysetCerts: true}, newCommittee)
+	Require(t, err)
+	messageRetrieved, err := newAggregator.Retrieve(ctx, Serialize(*cert))
+	Require(t, err, "Failed to retrieve message with cert of historical keyset")
+	if !bytes.Equal(rawMsg, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+
+	// Legacy certs are validated against the current committee.
+	legacyCert := *cert
+	legacyCert.Version = arbstate.DASCertVersionLegacy
+	_, err = oldAggregator.Retrieve(ctx, Serialize(legacyCert))
+	Require(t, err, "Failed to retrieve message with legacy cert")
+	_, err = newAggregator.Retrieve(ctx, Serialize(legacyCert))
+	if err == nil {
+		Fail(t, "Expected legacy cert signed by the old committee to be rejected by the new one")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"sync"
+	"time"
+)
+
+// BackendStatus summarizes how a backend of the Aggregator has been performing
+// on Stores. Latencies are of successful Store attempts.
+type BackendStatus struct {
+	Backend          string        `json:"backend"`
+	SignersMask      uint64        `json:"signersMask"`
+	StoreSuccesses   uint64        `json:"storeSuccesses"`
+	StoreFailures    uint64        `json:"storeFailures"`
+	StoreRetries     uint64        `json:"storeRetries"`
+	LateStores       uint64        `json:"lateStores"` // succeeded after the aggregated Store returned
+	PendingStores    int           `json:"pendingStores"`
+	LastStoreLatency time.Duration `json:"lastStoreLatency"`
+	AvgStoreLatency  time.Duration `json:"avgStoreLatency"` // exponential moving average
+	LastError        string        `json:"lastError,omitempty"`
+	LastErrorTime    time.Time     `json:"lastErrorTime,omitempty"`
+	LastSuccessTime  time.Time     `json:"lastSuccessTime,omitempty"`
+}
+
+// Weight of the latest latency in the moving average.
+const backendLatencyAvgWeight = 0.1
+
+type backendStats struct {
+	mutex  sync.Mutex
+	status BackendStatus
+}
+
+func (s *backendStats) deliveryStarted() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status.PendingStores++
+}
+
+func (s *backendStats) retried() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status.StoreRetries++
+}
+
+func (s *backendStats) deliverySucceeded(latency time.Duration, late bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status.PendingStores--
+	s.status.StoreSuccesses++
+	if late {
+		s.status.LateStores++
+	}
+	s.status.LastStoreLatency = latency
+	if s.status.StoreSuccesses == 1 {
+		s.status.AvgStoreLatency = latency
+	} else {
+		s.status.AvgStoreLatency += time.Duration(backendLatencyAvgWeight * float64(latency-s.status.AvgStoreLatency))
+	}
+	s.status.LastSuccessTime = time.Now()
+}
+
+func (s *backendStats) deliveryFailed(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status.PendingStores--
+	s.status.StoreFailures++
+	s.status.LastError = err.Error()
+	s.status.LastErrorTime = time.Now()
+}
+
+func (s *backendStats) get() BackendStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.status
+}
+
+// BackendStatus returns the Store stats of each backend, in configuration order.
+func (a *Aggregator) BackendStatus() []BackendStatus {
+	statuses := make([]BackendStatus, 0, len(a.stats))
+	for _, stats := range a.stats {
+		statuses = append(statuses, stats.get())
+	}
+	return statuses
+}
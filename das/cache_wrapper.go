@@ -0,0 +1,194 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/offchainlabs/nitro/arbstate"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	cacheHitCounter  = metrics.NewRegisteredCounter("arb/das/cache/hits", nil)
+	cacheMissCounter = metrics.NewRegisteredCounter("arb/das/cache/misses", nil)
+	cacheSizeGauge   = metrics.NewRegisteredGauge("arb/das/cache/size", nil)
+)
+
+type CacheConfig struct {
+	Enable   bool   `koanf:"enable"`
+	Capacity uint64 `koanf:"capacity"`
+}
+
+var DefaultCacheConfig = CacheConfig{
+	Enable:   false,
+	Capacity: 256 * 1024 * 1024,
+}
+
+func CacheConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultCacheConfig.Enable, "Enable an in-memory cache in front of the data availability service")
+	f.Uint64(prefix+".capacity", DefaultCacheConfig.Capacity, "Maximum total size in bytes of the batches kept in the cache")
+}
+
+type cacheEntry struct {
+	hash [32]byte
+	data []byte
+	// Hashes of the certs the backend served or issued this data for
+	certs map[common.Hash]struct{}
+}
+
+// Bounds the certs remembered for each entry, there's normally only one.
+const maxCertsPerCacheEntry = 8
+
+// CacheWrapper keeps recently retrieved and stored batches in memory, evicting
+// the least recently used ones once their total size exceeds the capacity.
+// Retrieve only serves a batch from the cache for an unexpired cert the backend
+// has already accepted, leaving the validation of any other cert to the backend.
+type CacheWrapper struct {
+	DataAvailabilityService
+
+	capacity uint64
+
+	mutex   sync.Mutex // protects size, lru and entries
+	size    uint64
+	lru     *list.List // of *cacheEntry, most recently used at the front
+	entries map[[32]byte]*list.Element
+}
+
+func NewCacheWrapper(config CacheConfig, das DataAvailabilityService) *CacheWrapper {
+	return &CacheWrapper{
+		DataAvailabilityService: das,
+		capacity:                config.Capacity,
+		lru:                     list.New(),
+		entries:                 make(map[[32]byte]*list.Element),
+	}
+}
+
+// get returns the cached data with the given hash. If certHash isn't nil, the
+// data is only returned if the backend accepted the cert with that hash.
+func (w *CacheWrapper) get(hash [32]byte, certHash *common.Hash) ([]byte, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	elem, ok := w.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if certHash != nil {
+		if _, ok := entry.certs[*certHash]; !ok {
+			return nil, false
+		}
+	}
+	w.lru.MoveToFront(elem)
+	return entry.data, true
+}
+
+// add caches data with the given hash, along with the hash of the cert the
+// backend accepted or issued for it, if any.
+func (w *CacheWrapper) add(hash [32]byte, data []byte, certHash *common.Hash) {
+	size := uint64(len(data))
+	if size > w.capacity {
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if elem, ok := w.entries[hash]; ok {
+		w.lru.MoveToFront(elem)
+		elem.Value.(*cacheEntry).addCert(certHash)
+		return
+	}
+	for w.size+size > w.capacity {
+		oldest := w.lru.Back()
+		entry := w.lru.Remove(oldest).(*cacheEntry)
+		delete(w.entries, entry.hash)
+		w.size -= uint64(len(entry.data))
+	}
+	// Copy so callers mutating their slice can't corrupt the cache.
+	entry := &cacheEntry{hash: hash, data: append([]byte{}, data...)}
+	entry.addCert(certHash)
+	w.entries[hash] = w.lru.PushFront(entry)
+	w.size += size
+	cacheSizeGauge.Update(int64(w.size))
+}
+
+func (e *cacheEntry) addCert(certHash *common.Hash) {
+	if certHash == nil {
+		return
+	}
+	if e.certs == nil || len(e.certs) >= maxCertsPerCacheEntry {
+		e.certs = make(map[common.Hash]struct{})
+	}
+	e.certs[*certHash] = struct{}{}
+}
+
+func (w *CacheWrapper) Retrieve(ctx context.Context, certBytes []byte) ([]byte, error) {
+	cert, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(certBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	certHash := common.BytesToHash(crypto.Keccak256(certBytes))
+	// Certs without a timeout never expire
+	if cert.Timeout == 0 || cert.Timeout >= uint64(time.Now().Unix()) {
+		if data, ok := w.get(cert.DataHash, &certHash); ok {
+			cacheHitCounter.Inc(1)
+			return append([]byte{}, data...), nil
+		}
+	}
+	cacheMissCounter.Inc(1)
+
+	data, err := w.DataAvailabilityService.Retrieve(ctx, certBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(crypto.Keccak256(data), cert.DataHash[:]) {
+		return nil, errors.New("Retrieved message hash doesn't match requested hash, not caching it.")
+	}
+	w.add(cert.DataHash, data, &certHash)
+	return data, nil
+}
+
+func (w *CacheWrapper) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	if data, ok := w.get(hash, nil); ok {
+		cacheHitCounter.Inc(1)
+		return append([]byte{}, data...), nil
+	}
+	cacheMissCounter.Inc(1)
+
+	data, err := w.DataAvailabilityService.GetByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if common.BytesToHash(crypto.Keccak256(data)) != hash {
+		return nil, errors.New("Retrieved message hash doesn't match requested hash, not caching it.")
+	}
+	w.add(hash, data, nil)
+	return data, nil
+}
+
+func (w *CacheWrapper) Store(ctx context.Context, message []byte, timeout uint64) (*arbstate.DataAvailabilityCertificate, error) {
+	cert, err := w.DataAvailabilityService.Store(ctx, message, timeout)
+	if err != nil {
+		return nil, err
+	}
+	var hash [32]byte
+	copy(hash[:], crypto.Keccak256(message))
+	certHash := common.BytesToHash(crypto.Keccak256(Serialize(*cert)))
+	w.add(hash, message, &certHash)
+	return cert, nil
+}
+
+func (w *CacheWrapper) String() string {
+	return fmt.Sprintf("CacheWrapper{capacity:%d,%v}", w.capacity, w.DataAvailabilityService)
+}
@@ -0,0 +1,130 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbstate"
+)
+
+type countingRetrieve struct {
+	retrieves int
+	corrupt   bool
+	DataAvailabilityService
+}
+
+func (w *countingRetrieve) Retrieve(ctx context.Context, cert []byte) ([]byte, error) {
+	w.retrieves++
+	data, err := w.DataAvailabilityService.Retrieve(ctx, cert)
+	if err != nil {
+		return nil, err
+	}
+	if w.corrupt {
+		data[0] = ^data[0]
+	}
+	return data, nil
+}
+
+func TestDASCacheWrapper(t *testing.T) {
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(dbPath)
+	Require(t, err)
+
+	config := LocalDiskDASConfig{
+		KeyDir:            dbPath,
+		DataDir:           dbPath,
+		AllowGenerateKeys: true,
+	}
+	localDAS, err := NewLocalDiskDAS(config)
+	Require(t, err, "no das")
+	backend := &countingRetrieve{DataAvailabilityService: localDAS}
+	cache := NewCacheWrapper(CacheConfig{Enable: true, Capacity: 25}, backend)
+	ctx := context.Background()
+	timeout := uint64(time.Now().Add(time.Hour).Unix())
+
+	var certs [][]byte
+	for i := 0; i < 3; i++ {
+		// Store directly on the backend so the cache isn't filled on Store.
+		cert, err := localDAS.Store(ctx, []byte(fmt.Sprintf("message number %d", i)), timeout)
+		Require(t, err, "Error storing message")
+		certs = append(certs, Serialize(*cert))
+	}
+
+	retrieve := func(certIndex int, expectedBackendRetrieves int) {
+		t.Helper()
+		message, err := cache.Retrieve(ctx, certs[certIndex])
+		Require(t, err, "Failed to retrieve message")
+		if !bytes.Equal(message, []byte(fmt.Sprintf("message number %d", certIndex))) {
+			Fail(t, "Retrieved message is not the same as stored one.")
+		}
+		if backend.retrieves != expectedBackendRetrieves {
+			Fail(t, fmt.Sprintf("Expected %d backend retrieves, got %d", expectedBackendRetrieves, backend.retrieves))
+		}
+		// Callers mutating the returned message must not affect the cache.
+		message[0] = ^message[0]
+	}
+
+	retrieve(0, 1)
+	retrieve(0, 1)
+	// Each message is 16 bytes, so only one fits in the cache at a time.
+	retrieve(1, 2)
+	retrieve(1, 2)
+	retrieve(0, 3)
+
+	// Data not matching the requested hash is rejected and not cached.
+	backend.corrupt = true
+	_, err = cache.Retrieve(ctx, certs[2])
+	if err == nil {
+		Fail(t, "Expected an error when the backend returned corrupted data.")
+	}
+	backend.corrupt = false
+	retrieve(2, 5)
+	retrieve(2, 5)
+
+	// Certs the backend hasn't accepted, or which have expired, are left to it to
+	// validate, even though their data is cached.
+	unacceptedCert, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(certs[2]))
+	Require(t, err)
+	unacceptedCert.SignersMask = 1
+	expiredCert, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(certs[2]))
+	Require(t, err)
+	expiredCert.Timeout = uint64(time.Now().Add(-time.Hour).Unix())
+	certs = append(certs, Serialize(*unacceptedCert), Serialize(*expiredCert))
+	retrieveMessage2 := func(certIndex int, expectedBackendRetrieves int) {
+		t.Helper()
+		_, err := cache.Retrieve(ctx, certs[certIndex])
+		Require(t, err, "Failed to retrieve message")
+		if backend.retrieves != expectedBackendRetrieves {
+			Fail(t, fmt.Sprintf("Expected %d backend retrieves, got %d", expectedBackendRetrieves, backend.retrieves))
+		}
+	}
+	retrieveMessage2(3, 6)
+	retrieveMessage2(3, 6)
+	retrieveMessage2(4, 7)
+	retrieveMessage2(4, 8)
+
+	// Certs without a timeout never expire, so are served from the cache.
+	unexpiringCert, err := localDAS.Store(ctx, []byte("never expires"), 0)
+	Require(t, err, "Error storing message")
+	certs = append(certs, Serialize(*unexpiringCert))
+	retrieveMessage2(5, 9)
+	retrieveMessage2(5, 9)
+
+	// Stored messages are cached.
+	stored := []byte("stored through cache")
+	cert, err := cache.Store(ctx, stored, timeout)
+	Require(t, err, "Error storing message")
+	message, err := cache.Retrieve(ctx, Serialize(*cert))
+	Require(t, err, "Failed to retrieve message")
+	if !bytes.Equal(message, stored) || backend.retrieves != 9 {
+		Fail(t, "Expected stored message to be retrieved from the cache.")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/ethereum/go-ethereum/common"
 	flag "github.com/spf13/pflag"
 
 	"github.com/offchainlabs/nitro/arbstate"
@@ -21,8 +22,16 @@ type DataAvailabilityServiceWriter interface {
 	Store(ctx context.Context, message []byte, timeout uint64) (*arbstate.DataAvailabilityCertificate, error)
 }
 
+var ErrDASDataNotFound = errors.New("data availability service data not found")
+
+type DataAvailabilityServiceHashReader interface {
+	// Returns the message whose keccak256 hash is hash, without requiring a certificate for it.
+	GetByHash(ctx context.Context, hash common.Hash) ([]byte, error)
+}
+
 type DataAvailabilityService interface {
 	arbstate.DataAvailabilityServiceReader
+	DataAvailabilityServiceHashReader
 	DataAvailabilityServiceWriter
 	fmt.Stringer
 }
@@ -33,17 +42,29 @@ const (
 	OnchainDataAvailability DataAvailabilityMode = iota
 	LocalDataAvailability
 	AggregatorDataAvailability
+	LocalDBDataAvailability
+	RestfulDataAvailability
 	// TODO RemoteDataAvailability
 )
 
 type DataAvailabilityConfig struct {
 	ModeImpl           string             `koanf:"mode"`
 	LocalDiskDASConfig LocalDiskDASConfig `koanf:"local-disk"`
+	LocalDBDASConfig   LocalDBDASConfig   `koanf:"local-db"`
 	AggregatorConfig   AggregatorConfig   `koanf:"aggregator"`
+	CacheConfig        CacheConfig        `koanf:"cache"`
+
+	RestfulClientAggregatorConfig RestfulClientAggregatorConfig `koanf:"rest-aggregator"`
 }
 
 var DefaultDataAvailabilityConfig = DataAvailabilityConfig{
-	ModeImpl: "onchain",
+	ModeImpl:           "onchain",
+	LocalDiskDASConfig: DefaultLocalDiskDASConfig,
+	LocalDBDASConfig:   DefaultLocalDBDASConfig,
+	AggregatorConfig:   DefaultAggregatorConfig,
+	CacheConfig:        DefaultCacheConfig,
+
+	RestfulClientAggregatorConfig: DefaultRestfulClientAggregatorConfig,
 }
 
 func (c *DataAvailabilityConfig) Mode() (DataAvailabilityMode, error) {
@@ -63,6 +84,14 @@ func (c *DataAvailabilityConfig) Mode() (DataAvailabilityMode, error) {
 		return LocalDataAvailability, nil
 	}
 
+	if c.ModeImpl == "local-db" {
+		if c.LocalDBDASConfig.DataDir == "" || (c.LocalDBDASConfig.KeyDir == "" && c.LocalDBDASConfig.PrivKey == "") {
+			flag.Usage()
+			return 0, errors.New("--data-availability.local-db.data-dir and .key-dir must be specified if mode is set to local-db")
+		}
+		return LocalDBDataAvailability, nil
+	}
+
 	if c.ModeImpl == "aggregator" {
 		if reflect.DeepEqual(c.AggregatorConfig, DefaultAggregatorConfig) {
 			flag.Usage()
@@ -71,14 +100,25 @@ func (c *DataAvailabilityConfig) Mode() (DataAvailabilityMode, error) {
 		return AggregatorDataAvailability, nil
 	}
 
+	if c.ModeImpl == "rest" {
+		if len(c.RestfulClientAggregatorConfig.Urls) == 0 {
+			flag.Usage()
+			return 0, errors.New("--data-availability.rest-aggregator.urls must be specified if mode is set to rest")
+		}
+		return RestfulDataAvailability, nil
+	}
+
 	flag.Usage()
 	return 0, errors.New("--data-availability.mode " + c.ModeImpl + " not recognized")
 }
 
 func DataAvailabilityConfigAddOptions(prefix string, f *flag.FlagSet) {
-	f.String(prefix+".mode", DefaultDataAvailabilityConfig.ModeImpl, "mode ('onchain', 'local', or 'aggregator')")
+	f.String(prefix+".mode", DefaultDataAvailabilityConfig.ModeImpl, "mode ('onchain', 'local', 'local-db', 'aggregator', or 'rest' to read from REST mirrors)")
 	LocalDiskDASConfigAddOptions(prefix+".local-disk", f)
+	LocalDBDASConfigAddOptions(prefix+".local-db", f)
 	AggregatorConfigAddOptions(prefix+".aggregator", f)
+	CacheConfigAddOptions(prefix+".cache", f)
+	RestfulClientAggregatorConfigAddOptions(prefix+".rest-aggregator", f)
 }
 
 func serializeSignableFields(c arbstate.DataAvailabilityCertificate) []byte {
@@ -95,7 +135,12 @@ func serializeSignableFields(c arbstate.DataAvailabilityCertificate) []byte {
 func Serialize(c arbstate.DataAvailabilityCertificate) []byte {
 	buf := make([]byte, 0)
 
-	buf = append(buf, arbstate.DASMessageHeaderFlag)
+	if c.Version >= arbstate.DASCertVersionKeyset {
+		buf = append(buf, arbstate.DASMessageHeaderFlag|arbstate.DASVersionedCertHeaderFlag, c.Version)
+		buf = append(buf, c.KeysetHash[:]...)
+	} else {
+		buf = append(buf, arbstate.DASMessageHeaderFlag)
+	}
 
 	buf = append(buf, serializeSignableFields(c)...)
 
@@ -6,12 +6,15 @@ package das
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/offchainlabs/nitro/util/testhelpers"
 )
 
@@ -91,6 +94,158 @@ func TestDASMissingMessage(t *testing.T) {
 	}
 }
 
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestDASExpiryAndPruning(t *testing.T) {
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(dbPath)
+	Require(t, err)
+
+	config := LocalDiskDASConfig{
+		KeyDir:            dbPath,
+		DataDir:           dbPath,
+		AllowGenerateKeys: true,
+		ExpiryGracePeriod: time.Hour,
+	}
+	das, err := NewLocalDiskDAS(config)
+	Require(t, err, "no das")
+	clock := &fakeClock{time.Now()}
+	das.now = clock.Now
+
+	ctx := context.Background()
+
+	shortLivedMessage := []byte("hello world")
+	shortLivedCert, err := das.Store(ctx, shortLivedMessage, uint64(clock.Now().Add(time.Hour).Unix()))
+	Require(t, err, "Error storing message")
+	longLivedMessage := []byte("goodbye world")
+	longLivedCert, err := das.Store(ctx, longLivedMessage, uint64(clock.Now().Add(time.Hour*24).Unix()))
+	Require(t, err, "Error storing message")
+
+	messageRetrieved, err := das.Retrieve(ctx, Serialize(*shortLivedCert))
+	Require(t, err, "Failed to retrieve message")
+	if !bytes.Equal(shortLivedMessage, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+
+	// Past the timeout but within the grace period, the data is still on disk
+	// but may not be retrieved.
+	clock.Advance(time.Hour + time.Minute)
+	_, err = das.Retrieve(ctx, Serialize(*shortLivedCert))
+	if !errors.Is(err, ErrDASDataExpired) {
+		Fail(t, "Expected expired error when retrieving message past its timeout, got", err)
+	}
+	pruned, err := das.pruneExpired(ctx)
+	Require(t, err, "Error pruning")
+	if pruned != 0 {
+		Fail(t, fmt.Sprintf("Expected nothing to be pruned within the grace period, pruned %d", pruned))
+	}
+
+	// Past the grace period the data is deleted.
+	clock.Advance(time.Hour)
+	pruned, err = das.pruneExpired(ctx)
+	Require(t, err, "Error pruning")
+	if pruned != 1 {
+		Fail(t, fmt.Sprintf("Expected 1 message to be pruned, pruned %d", pruned))
+	}
+	_, err = das.Retrieve(ctx, Serialize(*shortLivedCert))
+	if !errors.Is(err, ErrDASDataNotFound) {
+		Fail(t, "Expected pruned message to be missing, got", err)
+	}
+
+	// The BLS keys sharing the data dir must survive pruning.
+	_, _, err = ReadKeysFromFile(dbPath)
+	Require(t, err, "Keys were pruned")
+
+	messageRetrieved, err = das.Retrieve(ctx, Serialize(*longLivedCert))
+	Require(t, err, "Failed to retrieve message")
+	if !bytes.Equal(longLivedMessage, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+}
+
+func TestDASBackgroundPruning(t *testing.T) {
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(dbPath)
+	Require(t, err)
+
+	config := LocalDiskDASConfig{
+		KeyDir:            dbPath,
+		DataDir:           dbPath,
+		AllowGenerateKeys: true,
+		ExpiryGracePeriod: time.Hour,
+		PruneInterval:     time.Millisecond * 10,
+	}
+	das, err := NewLocalDiskDAS(config)
+	Require(t, err, "no das")
+	clock := &fakeClock{time.Now()}
+	das.now = clock.Now
+
+	ctx := context.Background()
+	cert, err := das.Store(ctx, []byte("hello world"), uint64(clock.Now().Unix()))
+	Require(t, err, "Error storing message")
+	path := das.pathForHash(cert.DataHash)
+
+	// Advance the clock before starting the pruner so it isn't read concurrently.
+	clock.Advance(time.Hour * 2)
+	das.Start(ctx)
+	defer das.StopAndWait()
+
+	for i := 0; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		if i >= 100 {
+			Fail(t, "Expired message was not pruned in the background")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestDASLegacyFiles(t *testing.T) {
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(dbPath)
+	Require(t, err)
+
+	config := LocalDiskDASConfig{
+		KeyDir:            dbPath,
+		DataDir:           dbPath,
+		AllowGenerateKeys: true,
+	}
+	das, err := NewLocalDiskDAS(config)
+	Require(t, err, "no das")
+	clock := &fakeClock{time.Now()}
+	das.now = clock.Now
+
+	// Files written before expiries were recorded hold just the message.
+	ctx := context.Background()
+	message := []byte("hello world")
+	hash := common.BytesToHash(crypto.Keccak256(message))
+	err = os.WriteFile(das.pathForHash(hash), message, 0600)
+	Require(t, err)
+
+	clock.Advance(time.Hour * 24 * 365)
+	pruned, err := das.pruneExpired(ctx)
+	Require(t, err, "Error pruning")
+	if pruned != 0 {
+		Fail(t, fmt.Sprintf("Expected legacy messages not to be pruned, pruned %d", pruned))
+	}
+	messageRetrieved, err := das.GetByHash(ctx, hash)
+	Require(t, err, "Failed to retrieve legacy message")
+	if !bytes.Equal(message, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+}
+
 func Require(t *testing.T, err error, printables ...interface{}) {
 	t.Helper()
 	testhelpers.RequireImpl(t, err, printables...)
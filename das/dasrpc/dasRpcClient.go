@@ -5,26 +5,34 @@ package dasrpc
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"fmt"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/blsSignatures"
+	"github.com/offchainlabs/nitro/das"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 type DASRPCClient struct { // implements DataAvailabilityService
-	clnt DASServiceImplClient
+	clnt       DASServiceImplClient
+	signingKey *ecdsa.PrivateKey // if not nil, used to sign Store requests
 }
 
-func NewDASRPCClient(target string) (*DASRPCClient, error) {
-	// TODO revisit insecure setting
-	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// NewDASRPCClient connects to the DAS gRPC server at target. If tlsConfig is nil or
+// isn't enabled, the connection is unencrypted.
+func NewDASRPCClient(target string, tlsConfig *ClientTLSConfig, signingKey *ecdsa.PrivateKey) (*DASRPCClient, error) {
+	creds, err := tlsConfig.transportCredentials()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		return nil, err
 	}
 	clnt := NewDASServiceImplClient(conn)
-	return &DASRPCClient{clnt: clnt}, nil
+	return &DASRPCClient{clnt: clnt, signingKey: signingKey}, nil
 }
 
 func (clnt *DASRPCClient) Retrieve(ctx context.Context, cert []byte) ([]byte, error) {
@@ -35,8 +43,24 @@ func (clnt *DASRPCClient) Retrieve(ctx context.Context, cert []byte) ([]byte, er
 	return response.Result, nil
 }
 
+func (clnt *DASRPCClient) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	response, err := clnt.clnt.GetByHash(ctx, &GetByHashRequest{Hash: hash.Bytes()})
+	if err != nil {
+		return nil, err
+	}
+	return response.Result, nil
+}
+
 func (clnt *DASRPCClient) Store(ctx context.Context, message []byte, timeout uint64) (*arbstate.DataAvailabilityCertificate, error) {
-	response, err := clnt.clnt.Store(ctx, &StoreRequest{Message: message, Timeout: timeout})
+	var requestSig []byte
+	if clnt.signingKey != nil {
+		var err error
+		requestSig, err = das.SignStoreRequest(clnt.signingKey, message, timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	response, err := clnt.clnt.Store(ctx, &StoreRequest{Message: message, Timeout: timeout, Sig: requestSig})
 	if err != nil {
 		return nil, err
 	}
@@ -5,26 +5,50 @@ package dasrpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/offchainlabs/nitro/blsSignatures"
 	"github.com/offchainlabs/nitro/das"
 	"google.golang.org/grpc"
-	"net"
 )
 
+var ErrStoreRequestUnsigned = errors.New("Store request is not signed")
+var ErrStoreRequestSignerNotAllowed = errors.New("Store request signer is not allowed")
+
 type DASRPCServer struct {
 	UnimplementedDASServiceImplServer // this allows grpc to verify its version invariant
 	grpcServer                        *grpc.Server
+	listener                          net.Listener
 	localDAS                          das.DataAvailabilityService
+
+	// If not empty, only Store requests signed by one of these addresses are accepted.
+	storeSigners map[common.Address]bool
+}
+
+func newStoreSignersAllowList(storeSigners []common.Address) map[common.Address]bool {
+	allowList := make(map[common.Address]bool)
+	for _, signer := range storeSigners {
+		allowList[signer] = true
+	}
+	return allowList
 }
 
-func StartDASRPCServer(ctx context.Context, portNum uint64, localDAS das.DataAvailabilityService) (*DASRPCServer, error) {
-	grpcServer := grpc.NewServer()
-	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", portNum))
+func StartDASRPCServer(ctx context.Context, addr string, portNum uint64, tlsConfig ServerTLSConfig, localDAS das.DataAvailabilityService, storeSigners []common.Address) (*DASRPCServer, error) {
+	creds, err := tlsConfig.transportCredentials()
+	if err != nil {
+		return nil, err
+	}
+	grpcServer := grpc.NewServer(grpc.Creds(creds))
+	listener, err := net.Listen("tcp", net.JoinHostPort(addr, strconv.FormatUint(portNum, 10)))
 	if err != nil {
 		return nil, err
 	}
-	dasServer := &DASRPCServer{grpcServer: grpcServer, localDAS: localDAS}
+	dasServer := &DASRPCServer{grpcServer: grpcServer, listener: listener, localDAS: localDAS, storeSigners: newStoreSignersAllowList(storeSigners)}
 	RegisterDASServiceImplServer(grpcServer, dasServer)
 	go func() {
 		err := grpcServer.Serve(listener)
@@ -39,11 +63,37 @@ func StartDASRPCServer(ctx context.Context, portNum uint64, localDAS das.DataAva
 	return dasServer, nil
 }
 
+// Addr returns the address the server is listening on, useful when started on port 0.
+func (serv *DASRPCServer) Addr() net.Addr {
+	return serv.listener.Addr()
+}
+
 func (serv *DASRPCServer) Stop() {
 	serv.grpcServer.GracefulStop()
 }
 
+func (serv *DASRPCServer) checkStoreRequestSignature(req *StoreRequest) error {
+	if len(serv.storeSigners) == 0 {
+		return nil
+	}
+	if len(req.Sig) == 0 {
+		return ErrStoreRequestUnsigned
+	}
+	signer, err := das.RecoverStoreRequestSigner(req.Message, req.Timeout, req.Sig)
+	if err != nil {
+		return err
+	}
+	if !serv.storeSigners[signer] {
+		return fmt.Errorf("%w: %v", ErrStoreRequestSignerNotAllowed, signer)
+	}
+	return nil
+}
+
 func (serv *DASRPCServer) Store(ctx context.Context, req *StoreRequest) (*StoreResponse, error) {
+	if err := serv.checkStoreRequestSignature(req); err != nil {
+		log.Warn("Rejecting Store request", "err", err)
+		return nil, err
+	}
 	cert, err := serv.localDAS.Store(ctx, req.Message, req.Timeout)
 	if err != nil {
 		return nil, err
@@ -63,3 +113,14 @@ func (serv *DASRPCServer) Retrieve(ctx context.Context, req *RetrieveRequest) (*
 	}
 	return &RetrieveResponse{Result: result}, nil
 }
+
+func (serv *DASRPCServer) GetByHash(ctx context.Context, req *GetByHashRequest) (*GetByHashResponse, error) {
+	if len(req.Hash) != common.HashLength {
+		return nil, fmt.Errorf("hash has length %d, expected %d", len(req.Hash), common.HashLength)
+	}
+	result, err := serv.localDAS.GetByHash(ctx, common.BytesToHash(req.Hash))
+	if err != nil {
+		return nil, err
+	}
+	return &GetByHashResponse{Result: result}, nil
+}
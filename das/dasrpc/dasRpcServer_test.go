@@ -0,0 +1,85 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package dasrpc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/offchainlabs/nitro/das"
+	"github.com/offchainlabs/nitro/util/testhelpers"
+)
+
+func TestDASRPCServerStoreSignatures(t *testing.T) {
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(dbPath)
+	Require(t, err)
+
+	localDAS, err := das.NewLocalDiskDAS(das.LocalDiskDASConfig{
+		KeyDir:            dbPath,
+		DataDir:           dbPath,
+		AllowGenerateKeys: true,
+	})
+	Require(t, err)
+
+	allowedKey, err := crypto.GenerateKey()
+	Require(t, err)
+	unknownKey, err := crypto.GenerateKey()
+	Require(t, err)
+	server := &DASRPCServer{
+		localDAS:     localDAS,
+		storeSigners: newStoreSignersAllowList([]common.Address{crypto.PubkeyToAddress(allowedKey.PublicKey)}),
+	}
+
+	ctx := context.Background()
+	message := []byte("hello world")
+	timeout := uint64(time.Now().Add(time.Hour).Unix())
+
+	_, err = server.Store(ctx, &StoreRequest{Message: message, Timeout: timeout})
+	if !errors.Is(err, ErrStoreRequestUnsigned) {
+		Fail(t, "Expected unsigned Store request to be rejected, got", err)
+	}
+
+	unknownSig, err := das.SignStoreRequest(unknownKey, message, timeout)
+	Require(t, err)
+	_, err = server.Store(ctx, &StoreRequest{Message: message, Timeout: timeout, Sig: unknownSig})
+	if !errors.Is(err, ErrStoreRequestSignerNotAllowed) {
+		Fail(t, "Expected Store request signed by unknown signer to be rejected, got", err)
+	}
+
+	allowedSig, err := das.SignStoreRequest(allowedKey, message, timeout)
+	Require(t, err)
+	// The signature covers the timeout, so it can't be replayed with another one.
+	_, err = server.Store(ctx, &StoreRequest{Message: message, Timeout: timeout + 1, Sig: allowedSig})
+	if !errors.Is(err, ErrStoreRequestSignerNotAllowed) {
+		Fail(t, "Expected Store request with a modified timeout to be rejected, got", err)
+	}
+
+	response, err := server.Store(ctx, &StoreRequest{Message: message, Timeout: timeout, Sig: allowedSig})
+	Require(t, err, "Store request signed by allowed signer failed")
+	if response.Timeout != timeout {
+		Fail(t, "Unexpected timeout in Store response", response.Timeout)
+	}
+
+	// Without an allow list, unsigned requests are accepted.
+	openServer := &DASRPCServer{localDAS: localDAS, storeSigners: newStoreSignersAllowList(nil)}
+	_, err = openServer.Store(ctx, &StoreRequest{Message: message, Timeout: timeout})
+	Require(t, err, "Unsigned Store request failed without an allow list")
+}
+
+func Require(t *testing.T, err error, printables ...interface{}) {
+	t.Helper()
+	testhelpers.RequireImpl(t, err, printables...)
+}
+
+func Fail(t *testing.T, printables ...interface{}) {
+	t.Helper()
+	testhelpers.FailImpl(t, printables...)
+}
@@ -6,6 +6,8 @@ package dasrpc
 import (
 	"encoding/json"
 
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/blsSignatures"
 	"github.com/offchainlabs/nitro/das"
 )
 
@@ -13,6 +15,30 @@ type BackendConfig struct {
 	URL                 string `json:"url"`
 	PubKeyBase64Encoded string `json:"pubkey"`
 	SignerMask          uint64 `json:"signermask"`
+
+	// If set, the backend is connected to over TLS.
+	TLS *ClientTLSConfig `json:"tls,omitempty"`
+}
+
+// KeysetFromBackends returns the keyset of the committee in a backends config,
+// in the JSON format of --data-availability.aggregator.backends.
+func KeysetFromBackends(assumedHonest int, backends string) (*arbstate.DataAvailabilityKeyset, error) {
+	var cs []BackendConfig
+	err := json.Unmarshal([]byte(backends), &cs)
+	if err != nil {
+		return nil, err
+	}
+	var signersMasks []uint64
+	var pubKeys []blsSignatures.PublicKey
+	for _, b := range cs {
+		pubKey, err := das.DecodeBase64BLSPublicKey([]byte(b.PubKeyBase64Encoded))
+		if err != nil {
+			return nil, err
+		}
+		signersMasks = append(signersMasks, b.SignerMask)
+		pubKeys = append(pubKeys, *pubKey)
+	}
+	return das.NewKeyset(assumedHonest, signersMasks, pubKeys)
 }
 
 func NewRPCAggregator(config das.AggregatorConfig) (*das.Aggregator, error) {
@@ -22,10 +48,15 @@ func NewRPCAggregator(config das.AggregatorConfig) (*das.Aggregator, error) {
 		return nil, err
 	}
 
+	signingKey, err := das.LoadECDSAPrivKey(config.StoreSigningKey)
+	if err != nil {
+		return nil, err
+	}
+
 	var services []das.ServiceDetails
 
 	for _, b := range cs {
-		service, err := NewDASRPCClient(b.URL)
+		service, err := NewDASRPCClient(b.URL, b.TLS, signingKey)
 		if err != nil {
 			return nil, err
 		}
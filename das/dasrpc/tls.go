@@ -0,0 +1,141 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package dasrpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	flag "github.com/spf13/pflag"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type ServerTLSConfig struct {
+	CertFile     string `koanf:"cert-file"`
+	KeyFile      string `koanf:"key-file"`
+	ClientCAFile string `koanf:"client-ca-file"`
+}
+
+var DefaultServerTLSConfig = ServerTLSConfig{}
+
+func ServerTLSConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".cert-file", DefaultServerTLSConfig.CertFile, "PEM encoded TLS certificate for the server; if empty, TLS is disabled")
+	f.String(prefix+".key-file", DefaultServerTLSConfig.KeyFile, "PEM encoded private key for the server's TLS certificate")
+	f.String(prefix+".client-ca-file", DefaultServerTLSConfig.ClientCAFile, "PEM encoded CA bundle to verify client certificates against; if set, clients must present a certificate signed by it")
+}
+
+func (c *ServerTLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+func (c *ServerTLSConfig) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("the server TLS certificate and its key must be set together")
+	}
+	if c.ClientCAFile != "" && !c.Enabled() {
+		return errors.New("client certificate verification requires a server TLS certificate")
+	}
+	return nil
+}
+
+func (c *ServerTLSConfig) transportCredentials() (credentials.TransportCredentials, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if !c.Enabled() {
+		return insecure.NewCredentials(), nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.ClientCAFile != "" {
+		tlsConfig.ClientCAs, err = loadCertPool(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// ClientTLSConfig is configured per backend in the aggregator's backends JSON,
+// eg {"url":..., "tls":{"enable":true,"cafile":"/path/ca.pem"}}.
+type ClientTLSConfig struct {
+	Enable   bool   `json:"enable" koanf:"enable"`
+	CAFile   string `json:"cafile" koanf:"ca-file"`
+	CertFile string `json:"certfile" koanf:"cert-file"`
+	KeyFile  string `json:"keyfile" koanf:"key-file"`
+}
+
+func ClientTLSConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", false, "connect over TLS, verifying the server's certificate against the system's root CAs unless a CA bundle is set")
+	f.String(prefix+".ca-file", "", "PEM encoded CA bundle to verify the server's certificate against")
+	f.String(prefix+".cert-file", "", "PEM encoded TLS client certificate, for servers requiring client certificates")
+	f.String(prefix+".key-file", "", "PEM encoded private key for the TLS client certificate")
+}
+
+func (c *ClientTLSConfig) Enabled() bool {
+	return c != nil && c.Enable
+}
+
+func (c *ClientTLSConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("the TLS client certificate and its key must be set together")
+	}
+	if !c.Enable && (c.CAFile != "" || c.CertFile != "") {
+		return errors.New("TLS options are set, but TLS isn't enabled")
+	}
+	return nil
+}
+
+func (c *ClientTLSConfig) transportCredentials() (credentials.TransportCredentials, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if !c.Enabled() {
+		return insecure.NewCredentials(), nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		var err error
+		tlsConfig.RootCAs, err = loadCertPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", caFile)
+	}
+	return pool, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package dasrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/das"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// writeTestCert creates a certificate signed by parent (self-signed if parent is nil),
+// writing it and its key as PEM files named name.pem and name-key.pem into dir.
+func writeTestCert(t *testing.T, dir, name string, serial int64, parent *testCert, template *x509.Certificate) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Require(t, err)
+	template.SerialNumber = big.NewInt(serial)
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	Require(t, err)
+	cert, err := x509.ParseCertificate(der)
+	Require(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Require(t, err)
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	Require(t, ioutil.WriteFile(filepath.Join(dir, name+".pem"), certPem, 0600))
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	Require(t, ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), keyPem, 0600))
+	return &testCert{cert, key}
+}
+
+func TestDASRPCMutualTLS(t *testing.T) {
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(dbPath)
+	Require(t, err)
+	certPath := func(name string) string { return filepath.Join(dbPath, name+".pem") }
+	keyPath := func(name string) string { return filepath.Join(dbPath, name+"-key.pem") }
+
+	ca := writeTestCert(t, dbPath, "ca", 1, nil, &x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	writeTestCert(t, dbPath, "server", 2, ca, &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	writeTestCert(t, dbPath, "client", 3, ca, &x509.Certificate{
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	// A client certificate not signed by the CA the server trusts.
+	writeTestCert(t, dbPath, "untrusted", 4, nil, &x509.Certificate{
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	localDAS, err := das.NewLocalDiskDAS(das.LocalDiskDASConfig{
+		KeyDir:            dbPath,
+		DataDir:           dbPath,
+		AllowGenerateKeys: true,
+	})
+	Require(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := StartDASRPCServer(ctx, "127.0.0.1", 0, ServerTLSConfig{
+		CertFile:     certPath("server"),
+		KeyFile:      keyPath("server"),
+		ClientCAFile: certPath("ca"),
+	}, localDAS, nil)
+	Require(t, err)
+	defer server.Stop()
+	target := server.Addr().String()
+
+	message := []byte("hello world")
+	timeout := uint64(time.Now().Add(time.Hour).Unix())
+
+	client, err := NewDASRPCClient(target, &ClientTLSConfig{
+		Enable:   true,
+		CAFile:   certPath("ca"),
+		CertFile: certPath("client"),
+		KeyFile:  keyPath("client"),
+	}, nil)
+	Require(t, err)
+	cert, err := client.Store(ctx, message, timeout)
+	Require(t, err, "Store over mutual TLS failed")
+	retrieved, err := client.Retrieve(ctx, das.Serialize(*cert))
+	Require(t, err, "Retrieve over mutual TLS failed")
+	if !bytes.Equal(retrieved, message) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+
+	rejectedClients := map[string]*ClientTLSConfig{
+		"plaintext":             nil,
+		"no client certificate": {Enable: true, CAFile: certPath("ca")},
+		"untrusted client":      {Enable: true, CAFile: certPath("ca"), CertFile: certPath("untrusted"), KeyFile: keyPath("untrusted")},
+		"untrusted server":      {Enable: true, CAFile: certPath("untrusted"), CertFile: certPath("client"), KeyFile: keyPath("client")},
+		"system root CAs":       {Enable: true, CertFile: certPath("client"), KeyFile: keyPath("client")},
+	}
+	for name, tlsConfig := range rejectedClients {
+		client, err := NewDASRPCClient(target, tlsConfig, nil)
+		Require(t, err)
+		callCtx, callCancel := context.WithTimeout(ctx, 5*time.Second)
+		_, err = client.Retrieve(callCtx, das.Serialize(*cert))
+		callCancel()
+		if err == nil {
+			Fail(t, "Expected request from", name, "client to be rejected")
+		}
+	}
+
+	invalidClients := map[string]*ClientTLSConfig{
+		"cert without key": {Enable: true, CertFile: certPath("client")},
+		"key without cert": {Enable: true, KeyFile: keyPath("client")},
+		"TLS not enabled":  {CAFile: certPath("ca")},
+	}
+	for name, tlsConfig := range invalidClients {
+		if _, err := NewDASRPCClient(target, tlsConfig, nil); err == nil {
+			Fail(t, "Expected", name, "client config to be rejected")
+		}
+	}
+}
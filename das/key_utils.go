@@ -6,6 +6,7 @@ package das
 import (
 	"bytes"
 	"encoding/base64"
+	"fmt"
 	"io/ioutil"
 	"os"
 
@@ -106,3 +107,31 @@ func ReadPrivKeyFromFile(privKeyPath string) (*blsSignatures.PrivateKey, error)
 	}
 	return privKey, nil
 }
+
+// loadBLSPrivKey decodes privKeyBase64 if set, otherwise it reads the key from
+// keyDir, generating a new keypair there if allowed and none exists yet.
+func loadBLSPrivKey(privKeyBase64 string, keyDir string, allowGenerateKeys bool) (*blsSignatures.PrivateKey, error) {
+	if len(privKeyBase64) != 0 {
+		privKey, err := DecodeBase64BLSPrivateKey([]byte(privKeyBase64))
+		if err != nil {
+			return nil, fmt.Errorf("'priv-key' was invalid: %w", err)
+		}
+		return privKey, nil
+	}
+
+	_, privKey, err := ReadKeysFromFile(keyDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if allowGenerateKeys {
+				_, privKey, err = GenerateAndStoreKeys(keyDir)
+				if err != nil {
+					return nil, err
+				}
+				return privKey, nil
+			}
+			return nil, fmt.Errorf("Required BLS keypair did not exist at %s", keyDir)
+		}
+		return nil, err
+	}
+	return privKey, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/blsSignatures"
+)
+
+// NewKeyset builds the keyset of a committee whose members sign with pubKeys[i]
+// under signersMasks[i]. Each mask must be a single bit, distinct from the others.
+func NewKeyset(assumedHonest int, signersMasks []uint64, pubKeys []blsSignatures.PublicKey) (*arbstate.DataAvailabilityKeyset, error) {
+	if len(signersMasks) != len(pubKeys) {
+		return nil, errors.New("Number of signers masks and public keys differ")
+	}
+	if assumedHonest < 1 || assumedHonest > len(pubKeys) {
+		return nil, fmt.Errorf("Assumed honest %d is invalid for %d backends", assumedHonest, len(pubKeys))
+	}
+	var seen uint64
+	for _, mask := range signersMasks {
+		if bits.OnesCount64(mask) != 1 {
+			return nil, fmt.Errorf("Signers mask %X is invalid, it must be a single bit", mask)
+		}
+		if seen&mask != 0 {
+			return nil, fmt.Errorf("Signers mask %X is shared by more than one backend", mask)
+		}
+		seen |= mask
+	}
+	return &arbstate.DataAvailabilityKeyset{
+		AssumedHonest: uint64(assumedHonest),
+		SignersMasks:  append([]uint64{}, signersMasks...),
+		PubKeys:       append([]blsSignatures.PublicKey{}, pubKeys...),
+	}, nil
+}
+
+// KeysetRegistry maps keyset hashes to keysets, so certificates signed by
+// previous committees can still be verified.
+type KeysetRegistry struct {
+	mutex   sync.RWMutex
+	keysets map[[32]byte]*arbstate.DataAvailabilityKeyset
+}
+
+func NewKeysetRegistry() *KeysetRegistry {
+	return &KeysetRegistry{keysets: make(map[[32]byte]*arbstate.DataAvailabilityKeyset)}
+}
+
+func (r *KeysetRegistry) Register(keyset *arbstate.DataAvailabilityKeyset) [32]byte {
+	hash := keyset.Hash()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.keysets[hash] = keyset
+	return hash
+}
+
+// RegisterSerialized registers a hex encoded keyset, as output by `datool keyset`.
+func (r *KeysetRegistry) RegisterSerialized(keysetHex string) ([32]byte, error) {
+	keysetHex = strings.TrimSpace(keysetHex)
+	if !strings.HasPrefix(keysetHex, "0x") {
+		keysetHex = "0x" + keysetHex
+	}
+	keysetBytes, err := hexutil.Decode(keysetHex)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("invalid keyset hex: %w", err)
+	}
+	keyset, err := arbstate.DeserializeKeyset(bytes.NewReader(keysetBytes), true)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return r.Register(keyset), nil
+}
+
+func (r *KeysetRegistry) Get(hash [32]byte) (*arbstate.DataAvailabilityKeyset, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	keyset, ok := r.keysets[hash]
+	if !ok {
+		return nil, fmt.Errorf("Unknown DAS keyset %v", common.Hash(hash))
+	}
+	return keyset, nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"context"
+)
+
+// Lifecycle is implemented by DataAvailabilityServices which run background
+// threads, eg LocalDiskDAS's pruning of expired batches.
+type Lifecycle interface {
+	Start(ctx context.Context)
+	StopAndWait()
+}
+
+// LifecycleManager starts and stops the background threads of every
+// DataAvailabilityService registered with it.
+type LifecycleManager struct {
+	lifecycles []Lifecycle
+}
+
+func (m *LifecycleManager) Register(l Lifecycle) {
+	m.lifecycles = append(m.lifecycles, l)
+}
+
+func (m *LifecycleManager) Start(ctx context.Context) {
+	for _, l := range m.lifecycles {
+		l.Start(ctx)
+	}
+}
+
+// StopAndWait stops the registered services in the reverse order they were
+// registered in, so wrappers are stopped before the services they wrap.
+func (m *LifecycleManager) StopAndWait() {
+	for i := len(m.lifecycles) - 1; i >= 0; i-- {
+		m.lifecycles[i].StopAndWait()
+	}
+}
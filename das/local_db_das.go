@@ -0,0 +1,329 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/blsSignatures"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	localDBDASMessagePrefix []byte = []byte("m") // maps a batch hash to its expiry followed by the batch
+	localDBDASExpiryPrefix  []byte = []byte("e") // maps an expiry followed by a batch hash to nothing, ordered by expiry for pruning
+)
+
+// A batch stored without a timeout never expires, as in a LocalDiskDAS, and
+// has no expiry index entry.
+const localDBDASNoExpiry uint64 = 0
+
+type LocalDBDASConfig struct {
+	KeyDir            string        `koanf:"key-dir"`
+	PrivKey           string        `koanf:"priv-key"`
+	DataDir           string        `koanf:"data-dir"`
+	AllowGenerateKeys bool          `koanf:"allow-generate-keys"`
+	Cache             int           `koanf:"cache"`
+	Handles           int           `koanf:"handles"`
+	ExpiryGracePeriod time.Duration `koanf:"expiry-grace-period"`
+	PruneInterval     time.Duration `koanf:"prune-interval"`
+}
+
+var DefaultLocalDBDASConfig = LocalDBDASConfig{
+	AllowGenerateKeys: false,
+	Cache:             16,
+	Handles:           16,
+	ExpiryGracePeriod: time.Hour * 24,
+	PruneInterval:     time.Hour,
+}
+
+func LocalDBDASConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".key-dir", DefaultLocalDBDASConfig.KeyDir, fmt.Sprintf("The directory to read the bls keypair ('%s' and '%s') from", DefaultPubKeyFilename, DefaultPrivKeyFilename))
+	f.String(prefix+".priv-key", DefaultLocalDBDASConfig.PrivKey, "The base64 BLS private key to use for signing DAS certificates")
+	f.String(prefix+".data-dir", DefaultLocalDBDASConfig.DataDir, "The directory to store the DAS LevelDB database in")
+	f.Bool(prefix+".allow-generate-keys", DefaultLocalDBDASConfig.AllowGenerateKeys, "Allow the local db DAS to generate its own keys in key-dir if they don't already exist")
+	f.Int(prefix+".cache", DefaultLocalDBDASConfig.Cache, "Megabytes of memory allocated to the database's internal caching")
+	f.Int(prefix+".handles", DefaultLocalDBDASConfig.Handles, "Number of open file handles the database may use")
+	f.Duration(prefix+".expiry-grace-period", DefaultLocalDBDASConfig.ExpiryGracePeriod, "How long to keep batches in the database after their timeout has passed before pruning them")
+	f.Duration(prefix+".prune-interval", DefaultLocalDBDASConfig.PruneInterval, "How often to prune expired batches from the database (0 to disable pruning)")
+}
+
+// LocalDBDAS is a DataAvailabilityService storing batches in an embedded
+// key-value database, rather than in a file per batch like LocalDiskDAS.
+type LocalDBDAS struct {
+	stopwaiter.StopWaiter
+	config  LocalDBDASConfig
+	privKey *blsSignatures.PrivateKey
+	db      ethdb.Database
+
+	// Protects the read-modify-write of a batch's expiry and its index entry.
+	writeMutex sync.Mutex
+
+	// Overridden in tests to simulate the passage of time.
+	now func() time.Time
+}
+
+func OpenLocalDBDASDatabase(config LocalDBDASConfig, readonly bool) (ethdb.Database, error) {
+	return rawdb.NewLevelDBDatabase(config.DataDir, config.Cache, config.Handles, "das/", readonly)
+}
+
+func NewLocalDBDAS(config LocalDBDASConfig) (*LocalDBDAS, error) {
+	privKey, err := loadBLSPrivKey(config.PrivKey, config.KeyDir, config.AllowGenerateKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := OpenLocalDBDASDatabase(config, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalDBDAS{
+		config:  config,
+		privKey: privKey,
+		db:      db,
+		now:     time.Now,
+	}, nil
+}
+
+func (das *LocalDBDAS) Start(ctxIn context.Context) {
+	das.StopWaiter.Start(ctxIn)
+	if das.config.PruneInterval == 0 {
+		return
+	}
+	das.CallIteratively(func(ctx context.Context) time.Duration {
+		pruned, err := das.pruneExpired(ctx)
+		if err != nil {
+			log.Error("error pruning expired DAS data", "err", err)
+		} else if pruned > 0 {
+			log.Info("pruned expired DAS data", "count", pruned)
+		}
+		return das.config.PruneInterval
+	})
+}
+
+func (das *LocalDBDAS) StopAndWait() {
+	das.StopWaiter.StopAndWait()
+	err := das.db.Close()
+	if err != nil {
+		log.Warn("error closing DAS database", "err", err)
+	}
+}
+
+func localDBDASMessageKey(hash []byte) []byte {
+	return append(append([]byte{}, localDBDASMessagePrefix...), hash...)
+}
+
+func localDBDASExpiryKey(expiry uint64, hash []byte) []byte {
+	key := make([]byte, 0, len(localDBDASExpiryPrefix)+8+len(hash))
+	key = append(key, localDBDASExpiryPrefix...)
+	var expiryBuf [8]byte
+	binary.BigEndian.PutUint64(expiryBuf[:], expiry)
+	key = append(key, expiryBuf[:]...)
+	return append(key, hash...)
+}
+
+// writeLocalDBDASMessage atomically stores the message and its expiry index entry.
+// If the message is already stored, the later of the two expiries is kept.
+func writeLocalDBDASMessage(db ethdb.KeyValueStore, message []byte, expiry uint64) error {
+	hash := crypto.Keccak256(message)
+	messageKey := localDBDASMessageKey(hash)
+
+	batch := db.NewBatch()
+	existing, err := db.Get(messageKey)
+	if err == nil && len(existing) >= 8 {
+		existingExpiry := binary.BigEndian.Uint64(existing[:8])
+		if existingExpiry == localDBDASNoExpiry || (expiry != localDBDASNoExpiry && existingExpiry >= expiry) {
+			return nil
+		}
+		err = batch.Delete(localDBDASExpiryKey(existingExpiry, hash))
+		if err != nil {
+			return err
+		}
+	}
+
+	value := make([]byte, 8, 8+len(message))
+	binary.BigEndian.PutUint64(value, expiry)
+	value = append(value, message...)
+	err = batch.Put(messageKey, value)
+	if err != nil {
+		return err
+	}
+	if expiry != localDBDASNoExpiry {
+		err = batch.Put(localDBDASExpiryKey(expiry, hash), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+func (das *LocalDBDAS) Store(ctx context.Context, message []byte, timeout uint64) (c *arbstate.DataAvailabilityCertificate, err error) {
+	c = &arbstate.DataAvailabilityCertificate{}
+	copy(c.DataHash[:], crypto.Keccak256(message))
+
+	c.Timeout = timeout
+	c.SignersMask = 0 // The aggregator decides on the mask for each signer.
+
+	fields := serializeSignableFields(*c)
+	c.Sig, err = blsSignatures.SignMessage(*das.privKey, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("Storing message", "hash", c.DataHash)
+
+	das.writeMutex.Lock()
+	defer das.writeMutex.Unlock()
+	err = writeLocalDBDASMessage(das.db, message, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (das *LocalDBDAS) Retrieve(ctx context.Context, certBytes []byte) ([]byte, error) {
+	cert, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(certBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	// The cert passed in may have an aggregate signature, so we don't
+	// check the signature against this DAS's public key here.
+
+	return das.GetByHash(ctx, cert.DataHash)
+}
+
+func (das *LocalDBDAS) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	log.Debug("Retrieving message", "hash", hash)
+
+	key := localDBDASMessageKey(hash[:])
+	has, err := das.db.Has(key)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, fmt.Errorf("%w: %v", ErrDASDataNotFound, hash)
+	}
+	value, err := das.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) < 8 {
+		return nil, fmt.Errorf("Stored message %v is missing its expiry", hash)
+	}
+
+	expiry := binary.BigEndian.Uint64(value[:8])
+	if expiry != localDBDASNoExpiry && uint64(das.now().Unix()) > expiry {
+		return nil, fmt.Errorf("%w: expired at %v", ErrDASDataExpired, time.Unix(int64(expiry), 0))
+	}
+
+	originalMessage := value[8:]
+	if common.BytesToHash(crypto.Keccak256(originalMessage)) != hash {
+		return nil, errors.New("Retrieved message stored hash doesn't match calculated hash.")
+	}
+
+	return originalMessage, nil
+}
+
+// pruneExpired deletes all batches whose expiry plus the configured grace period
+// has passed, and returns how many were deleted. The expiry index is ordered by
+// expiry, so iteration stops at the first batch that hasn't expired.
+func (das *LocalDBDAS) pruneExpired(ctx context.Context) (int, error) {
+	pruneBefore := uint64(das.now().Add(-das.config.ExpiryGracePeriod).Unix())
+
+	das.writeMutex.Lock()
+	defer das.writeMutex.Unlock()
+
+	iter := das.db.NewIterator(localDBDASExpiryPrefix, nil)
+	defer iter.Release()
+
+	batch := das.db.NewBatch()
+	pruned := 0
+	for iter.Next() {
+		if ctx.Err() != nil {
+			break
+		}
+		key := iter.Key()
+		if len(key) != len(localDBDASExpiryPrefix)+8+32 {
+			continue
+		}
+		expiry := binary.BigEndian.Uint64(key[len(localDBDASExpiryPrefix):])
+		if expiry >= pruneBefore {
+			break
+		}
+		hash := key[len(localDBDASExpiryPrefix)+8:]
+		log.Debug("Pruning expired message", "hash", hash, "expiry", expiry)
+		if err := batch.Delete(localDBDASMessageKey(hash)); err != nil {
+			return 0, err
+		}
+		if err := batch.Delete(append([]byte{}, key...)); err != nil {
+			return 0, err
+		}
+		pruned++
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return 0, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	return pruned, ctx.Err()
+}
+
+// ImportLocalDiskDAS copies every unexpired batch stored by a LocalDiskDAS in
+// srcDataDir into a LocalDBDAS database, keeping each batch's expiry. Batches
+// stored without an expiry, including those in legacy headerless files, are
+// given one legacyRetentionPeriod from now. Batches whose contents don't match
+// their file name's hash are skipped.
+func ImportLocalDiskDAS(ctx context.Context, srcDataDir string, db ethdb.KeyValueStore, legacyRetentionPeriod time.Duration) (imported int, skipped int, err error) {
+	now := time.Now()
+	legacyExpiry := uint64(now.Add(legacyRetentionPeriod).Unix())
+	err = forEachLocalDiskDASFile(ctx, srcDataDir, func(path string, hash [32]byte) error {
+		expiry, message, err := ReadLocalDiskDASFile(path, hash)
+		if err != nil {
+			log.Warn("unable to read stored DAS message, skipping", "path", path, "err", err)
+			skipped++
+			return nil
+		}
+		if expiry == localDiskDASNoExpiry {
+			expiry = legacyExpiry
+		}
+		if uint64(now.Unix()) > expiry {
+			skipped++
+			return nil
+		}
+		if err := writeLocalDBDASMessage(db, message, expiry); err != nil {
+			return err
+		}
+		imported++
+		return nil
+	})
+	return imported, skipped, err
+}
+
+func (das *LocalDBDAS) String() string {
+	return fmt.Sprintf("LocalDBDAS{config:%v}", das.config)
+}
@@ -0,0 +1,187 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func newTestLocalDBDAS(t *testing.T, dbPath string) *LocalDBDAS {
+	t.Helper()
+	config := DefaultLocalDBDASConfig
+	config.KeyDir = dbPath
+	config.DataDir = dbPath + "/db"
+	config.AllowGenerateKeys = true
+	config.ExpiryGracePeriod = time.Hour
+	das, err := NewLocalDBDAS(config)
+	Require(t, err, "no das")
+	return das
+}
+
+func TestLocalDBDASStoreRetrieve(t *testing.T) {
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(dbPath)
+	Require(t, err)
+
+	das := newTestLocalDBDAS(t, dbPath)
+	ctx := context.Background()
+
+	timeout := uint64(time.Now().Add(time.Hour * 24).Unix())
+	messageSaved := []byte("hello world")
+	cert, err := das.Store(ctx, messageSaved, timeout)
+	Require(t, err, "Error storing message")
+	if cert.Timeout != timeout {
+		Fail(t, fmt.Sprintf("Expected timeout of %d in cert, was %d", timeout, cert.Timeout))
+	}
+
+	messageRetrieved, err := das.Retrieve(ctx, Serialize(*cert))
+	Require(t, err, "Failed to retrieve message")
+	if !bytes.Equal(messageSaved, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+
+	// Reopening the database keeps the data.
+	das.StopAndWait()
+	das = newTestLocalDBDAS(t, dbPath)
+	defer das.StopAndWait()
+	messageRetrieved, err = das.Retrieve(ctx, Serialize(*cert))
+	Require(t, err, "Failed to retrieve message")
+	if !bytes.Equal(messageSaved, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+
+	cert.DataHash[0] += 1
+	_, err = das.Retrieve(ctx, Serialize(*cert))
+	if err == nil {
+		Fail(t, "Expected an error when retrieving message that is not in the store.")
+	}
+}
+
+func TestLocalDBDASExpiryAndPruning(t *testing.T) {
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(dbPath)
+	Require(t, err)
+
+	das := newTestLocalDBDAS(t, dbPath)
+	defer das.StopAndWait()
+	clock := &fakeClock{time.Now()}
+	das.now = clock.Now
+	ctx := context.Background()
+
+	shortLivedMessage := []byte("hello world")
+	shortLivedCert, err := das.Store(ctx, shortLivedMessage, uint64(clock.Now().Add(time.Hour).Unix()))
+	Require(t, err, "Error storing message")
+	extendedMessage := []byte("goodbye world")
+	_, err = das.Store(ctx, extendedMessage, uint64(clock.Now().Add(time.Hour).Unix()))
+	Require(t, err, "Error storing message")
+	// Storing the same message again with a later timeout extends its expiry.
+	extendedCert, err := das.Store(ctx, extendedMessage, uint64(clock.Now().Add(time.Hour*24).Unix()))
+	Require(t, err, "Error storing message")
+	// Messages stored without a timeout never expire, even if stored again with one.
+	unexpiringMessage := []byte("hello forever")
+	unexpiringCert, err := das.Store(ctx, unexpiringMessage, 0)
+	Require(t, err, "Error storing message")
+	_, err = das.Store(ctx, unexpiringMessage, uint64(clock.Now().Add(time.Hour).Unix()))
+	Require(t, err, "Error storing message")
+
+	clock.Advance(time.Hour + time.Minute)
+	_, err = das.Retrieve(ctx, Serialize(*shortLivedCert))
+	if !errors.Is(err, ErrDASDataExpired) {
+		Fail(t, "Expected expired error when retrieving message past its timeout, got", err)
+	}
+	pruned, err := das.pruneExpired(ctx)
+	Require(t, err, "Error pruning")
+	if pruned != 0 {
+		Fail(t, fmt.Sprintf("Expected nothing to be pruned within the grace period, pruned %d", pruned))
+	}
+
+	clock.Advance(time.Hour)
+	pruned, err = das.pruneExpired(ctx)
+	Require(t, err, "Error pruning")
+	if pruned != 1 {
+		Fail(t, fmt.Sprintf("Expected 1 message to be pruned, pruned %d", pruned))
+	}
+	has, err := das.db.Has(localDBDASMessageKey(shortLivedCert.DataHash[:]))
+	Require(t, err)
+	if has {
+		Fail(t, "Expected pruned message to be deleted")
+	}
+
+	messageRetrieved, err := das.Retrieve(ctx, Serialize(*extendedCert))
+	Require(t, err, "Failed to retrieve message")
+	if !bytes.Equal(extendedMessage, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+	messageRetrieved, err = das.Retrieve(ctx, Serialize(*unexpiringCert))
+	Require(t, err, "Failed to retrieve message stored without a timeout")
+	if !bytes.Equal(unexpiringMessage, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+}
+
+func TestImportLocalDiskDAS(t *testing.T) {
+	diskPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(diskPath)
+	Require(t, err)
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(dbPath)
+	Require(t, err)
+
+	config := LocalDiskDASConfig{
+		KeyDir:            diskPath,
+		DataDir:           diskPath,
+		AllowGenerateKeys: true,
+	}
+	diskDAS, err := NewLocalDiskDAS(config)
+	Require(t, err, "no das")
+	ctx := context.Background()
+
+	var certs [][]byte
+	var messages [][]byte
+	for i := 0; i < 10; i++ {
+		message := []byte(fmt.Sprintf("message %d", i))
+		cert, err := diskDAS.Store(ctx, message, uint64(time.Now().Add(time.Hour).Unix()))
+		Require(t, err, "Error storing message")
+		certs = append(certs, Serialize(*cert))
+		messages = append(messages, message)
+	}
+	_, err = diskDAS.Store(ctx, []byte("expired"), uint64(time.Now().Add(-time.Hour).Unix()))
+	Require(t, err, "Error storing message")
+	// Legacy files without an expiry header are imported too.
+	legacyMessage := []byte("legacy")
+	legacyHash := common.BytesToHash(crypto.Keccak256(legacyMessage))
+	err = os.WriteFile(diskDAS.pathForHash(legacyHash), legacyMessage, 0600)
+	Require(t, err)
+
+	dbDAS := newTestLocalDBDAS(t, dbPath)
+	defer dbDAS.StopAndWait()
+	imported, skipped, err := ImportLocalDiskDAS(ctx, diskPath, dbDAS.db, time.Hour*24)
+	Require(t, err, "Error importing")
+	if imported != len(messages)+1 || skipped != 1 {
+		Fail(t, fmt.Sprintf("Expected %d imported and 1 skipped, got %d imported and %d skipped", len(messages)+1, imported, skipped))
+	}
+	messageRetrieved, err := dbDAS.GetByHash(ctx, legacyHash)
+	Require(t, err, "Failed to retrieve imported legacy message")
+	if !bytes.Equal(legacyMessage, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as imported one.")
+	}
+
+	for i, cert := range certs {
+		messageRetrieved, err := dbDAS.Retrieve(ctx, cert)
+		Require(t, err, "Failed to retrieve imported message")
+		if !bytes.Equal(messages[i], messageRetrieved) {
+			Fail(t, "Retrieved message is not the same as imported one.")
+		}
+	}
+}
@@ -7,68 +7,102 @@ import (
 	"bytes"
 	"context"
 	"encoding/base32"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/blsSignatures"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
 	flag "github.com/spf13/pflag"
 )
 
+var ErrDASDataExpired = errors.New("data availability service data has expired")
+
 type LocalDiskDASConfig struct {
-	KeyDir            string `koanf:"key-dir"`
-	PrivKey           string `koanf:"priv-key"`
-	DataDir           string `koanf:"data-dir"`
-	AllowGenerateKeys bool   `koanf:"allow-generate-keys"`
+	KeyDir            string        `koanf:"key-dir"`
+	PrivKey           string        `koanf:"priv-key"`
+	DataDir           string        `koanf:"data-dir"`
+	AllowGenerateKeys bool          `koanf:"allow-generate-keys"`
+	ExpiryGracePeriod time.Duration `koanf:"expiry-grace-period"`
+	PruneInterval     time.Duration `koanf:"prune-interval"`
+}
+
+var DefaultLocalDiskDASConfig = LocalDiskDASConfig{
+	AllowGenerateKeys: false,
+	ExpiryGracePeriod: time.Hour * 24,
+	PruneInterval:     time.Hour,
 }
 
 func LocalDiskDASConfigAddOptions(prefix string, f *flag.FlagSet) {
-	f.String(prefix+".key-dir", "", fmt.Sprintf("The directory to read the bls keypair ('%s' and '%s') from", DefaultPubKeyFilename, DefaultPrivKeyFilename))
-	f.String(prefix+".priv-key", "", "The base64 BLS private key to use for signing DAS certificates")
-	f.String(prefix+".data-dir", "", "The directory to use as the DAS file-based database")
-	f.Bool(prefix+".allow-generate-keys", false, "Allow the local disk DAS to generate its own keys in key-dir if they don't already exist")
+	f.String(prefix+".key-dir", DefaultLocalDiskDASConfig.KeyDir, fmt.Sprintf("The directory to read the bls keypair ('%s' and '%s') from", DefaultPubKeyFilename, DefaultPrivKeyFilename))
+	f.String(prefix+".priv-key", DefaultLocalDiskDASConfig.PrivKey, "The base64 BLS private key to use for signing DAS certificates")
+	f.String(prefix+".data-dir", DefaultLocalDiskDASConfig.DataDir, "The directory to use as the DAS file-based database")
+	f.Bool(prefix+".allow-generate-keys", DefaultLocalDiskDASConfig.AllowGenerateKeys, "Allow the local disk DAS to generate its own keys in key-dir if they don't already exist")
+	f.Duration(prefix+".expiry-grace-period", DefaultLocalDiskDASConfig.ExpiryGracePeriod, "How long to keep batches on disk after their timeout has passed before pruning them")
+	f.Duration(prefix+".prune-interval", DefaultLocalDiskDASConfig.PruneInterval, "How often to prune expired batches from disk (0 to disable pruning)")
 }
 
+// Each batch is stored in its own file named after the base32 encoding of its
+// hash. The file starts with a header of the magic bytes, the format version and
+// the big endian expiry (the timeout the batch was stored with, in unix epoch
+// seconds), followed by the batch itself. Files written before expiries were
+// recorded hold just the batch, and are told apart by checking the hash.
+var localDiskDASFileMagic = []byte("NDAS")
+
+const localDiskDASFileVersion byte = 1
+const localDiskDASHeaderLen = 4 + 1 + 8
+
+// A batch stored without a timeout, or in a legacy file, never expires.
+const localDiskDASNoExpiry uint64 = 0
+
 type LocalDiskDAS struct {
+	stopwaiter.StopWaiter
 	config  LocalDiskDASConfig
 	privKey *blsSignatures.PrivateKey
+
+	// Overridden in tests to simulate the passage of time.
+	now func() time.Time
 }
 
 func NewLocalDiskDAS(config LocalDiskDASConfig) (*LocalDiskDAS, error) {
-	var privKey *blsSignatures.PrivateKey
-	var err error
-	if len(config.PrivKey) != 0 {
-		privKey, err = DecodeBase64BLSPrivateKey([]byte(config.PrivKey))
-		if err != nil {
-			return nil, fmt.Errorf("'priv-key' was invalid: %w", err)
-		}
-	} else {
-		_, privKey, err = ReadKeysFromFile(config.KeyDir)
-		if err != nil {
-			if os.IsNotExist(err) {
-				if config.AllowGenerateKeys {
-					_, privKey, err = GenerateAndStoreKeys(config.KeyDir)
-					if err != nil {
-						return nil, err
-					}
-				} else {
-					return nil, fmt.Errorf("Required BLS keypair did not exist at %s", config.KeyDir)
-				}
-			} else {
-				return nil, err
-			}
-		}
+	privKey, err := loadBLSPrivKey(config.PrivKey, config.KeyDir, config.AllowGenerateKeys)
+	if err != nil {
+		return nil, err
 	}
 
 	return &LocalDiskDAS{
 		config:  config,
 		privKey: privKey,
+		now:     time.Now,
 	}, nil
 }
 
+func (das *LocalDiskDAS) Start(ctxIn context.Context) {
+	das.StopWaiter.Start(ctxIn)
+	if das.config.PruneInterval == 0 {
+		return
+	}
+	das.CallIteratively(func(ctx context.Context) time.Duration {
+		pruned, err := das.pruneExpired(ctx)
+		if err != nil {
+			log.Error("error pruning expired DAS data", "err", err)
+		} else if pruned > 0 {
+			log.Info("pruned expired DAS data", "count", pruned)
+		}
+		return das.config.PruneInterval
+	})
+}
+
+func (das *LocalDiskDAS) pathForHash(hash [32]byte) string {
+	return das.config.DataDir + "/" + base32.StdEncoding.EncodeToString(hash[:])
+}
+
 func (das *LocalDiskDAS) Store(ctx context.Context, message []byte, timeout uint64) (c *arbstate.DataAvailabilityCertificate, err error) {
 	c = &arbstate.DataAvailabilityCertificate{}
 	copy(c.DataHash[:], crypto.Keccak256(message))
@@ -82,10 +116,17 @@ func (das *LocalDiskDAS) Store(ctx context.Context, message []byte, timeout uint
 		return nil, err
 	}
 
-	path := das.config.DataDir + "/" + base32.StdEncoding.EncodeToString(c.DataHash[:])
+	path := das.pathForHash(c.DataHash)
 	log.Debug("Storing message at", "path", path)
 
-	err = os.WriteFile(path, message, 0600)
+	contents := make([]byte, 0, localDiskDASHeaderLen+len(message))
+	contents = append(contents, localDiskDASFileMagic...)
+	contents = append(contents, localDiskDASFileVersion)
+	var expiryBuf [8]byte
+	binary.BigEndian.PutUint64(expiryBuf[:], timeout)
+	contents = append(contents, expiryBuf[:]...)
+	contents = append(contents, message...)
+	err = os.WriteFile(path, contents, 0600)
 	if err != nil {
 		return nil, err
 	}
@@ -99,24 +140,109 @@ func (das *LocalDiskDAS) Retrieve(ctx context.Context, certBytes []byte) ([]byte
 		return nil, err
 	}
 
-	path := das.config.DataDir + "/" + base32.StdEncoding.EncodeToString(cert.DataHash[:])
+	// The cert passed in may have an aggregate signature, so we don't
+	// check the signature against this DAS's public key here.
+
+	return das.GetByHash(ctx, cert.DataHash)
+}
+
+func (das *LocalDiskDAS) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	path := das.pathForHash(hash)
 	log.Debug("Retrieving message from", "path", path)
 
-	originalMessage, err := os.ReadFile(path)
+	expiry, originalMessage, err := ReadLocalDiskDASFile(path, hash)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %v", ErrDASDataNotFound, hash)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if das.isExpired(expiry) {
+		return nil, fmt.Errorf("%w: expired at %v", ErrDASDataExpired, time.Unix(int64(expiry), 0))
+	}
 
-	var originalMessageHash [32]byte
-	copy(originalMessageHash[:], crypto.Keccak256(originalMessage))
-	if originalMessageHash != cert.DataHash {
-		return nil, errors.New("Retrieved message stored hash doesn't match calculated hash.")
+	return originalMessage, nil
+}
+
+func (das *LocalDiskDAS) isExpired(expiry uint64) bool {
+	return expiry != localDiskDASNoExpiry && uint64(das.now().Unix()) > expiry
+}
+
+// forEachLocalDiskDASFile calls f with the path and hash of every batch file in
+// dataDir. The data dir may be shared with other files, eg the BLS keys,
+// so only files named after a batch hash are considered.
+func forEachLocalDiskDASFile(ctx context.Context, dataDir string, f func(path string, hash [32]byte) error) error {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return err
 	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.IsDir() {
+			continue
+		}
+		decoded, err := base32.StdEncoding.DecodeString(entry.Name())
+		if err != nil || len(decoded) != 32 {
+			continue
+		}
+		var hash [32]byte
+		copy(hash[:], decoded)
+		if err := f(dataDir+"/"+entry.Name(), hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	// The cert passed in may have an aggregate signature, so we don't
-	// check the signature against this DAS's public key here.
+// pruneExpired deletes all batches whose expiry plus the configured grace period
+// has passed, and returns how many were deleted.
+func (das *LocalDiskDAS) pruneExpired(ctx context.Context) (int, error) {
+	pruneBefore := uint64(das.now().Add(-das.config.ExpiryGracePeriod).Unix())
+	pruned := 0
+	err := forEachLocalDiskDASFile(ctx, das.config.DataDir, func(path string, hash [32]byte) error {
+		expiry, _, err := ReadLocalDiskDASFile(path, hash)
+		if err != nil {
+			log.Warn("unable to read expiry of stored DAS message", "path", path, "err", err)
+			return nil
+		}
+		if expiry == localDiskDASNoExpiry || expiry >= pruneBefore {
+			return nil
+		}
 
-	return originalMessage, nil
+		log.Debug("Pruning expired message", "path", path, "expiry", expiry)
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		pruned++
+		return nil
+	})
+	return pruned, err
+}
+
+// ReadLocalDiskDASFile returns the expiry and contents of the file a
+// LocalDiskDAS stored the batch with the given hash in. Batches stored in
+// legacy files, without a header, are returned with no expiry.
+func ReadLocalDiskDASFile(path string, hash common.Hash) (uint64, []byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(contents) >= localDiskDASHeaderLen &&
+		bytes.HasPrefix(contents, localDiskDASFileMagic) &&
+		contents[len(localDiskDASFileMagic)] == localDiskDASFileVersion {
+		message := contents[localDiskDASHeaderLen:]
+		if common.BytesToHash(crypto.Keccak256(message)) == hash {
+			expiry := binary.BigEndian.Uint64(contents[len(localDiskDASFileMagic)+1 : localDiskDASHeaderLen])
+			return expiry, message, nil
+		}
+	}
+	if common.BytesToHash(crypto.Keccak256(contents)) == hash {
+		return localDiskDASNoExpiry, contents, nil
+	}
+	return 0, nil, errors.New("Retrieved message stored hash doesn't match calculated hash.")
 }
 
 func (d *LocalDiskDAS) String() string {
@@ -0,0 +1,148 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/offchainlabs/nitro/arbstate"
+	flag "github.com/spf13/pflag"
+)
+
+var ErrDASReadOnly = errors.New("data availability service is read-only")
+
+// RestfulDasClient reads batches from a RestfulDasServer. Data is checked against
+// the requested hash, but certificates aren't validated, since mirrors serve data
+// by hash only.
+type RestfulDasClient struct {
+	url        string
+	httpClient *http.Client
+}
+
+func NewRestfulDasClient(url string, timeout time.Duration) *RestfulDasClient {
+	return &RestfulDasClient{
+		url:        strings.TrimSuffix(url, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *RestfulDasClient) Retrieve(ctx context.Context, certBytes []byte) ([]byte, error) {
+	cert, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(certBytes))
+	if err != nil {
+		return nil, err
+	}
+	return c.GetByHash(ctx, cert.DataHash)
+}
+
+func (c *RestfulDasClient) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+restfulGetByHashPath+hash.Hex(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %v at %s", ErrDASDataNotFound, hash, c.url)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("REST DAS %s returned status %s", c.url, response.Status)
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if common.BytesToHash(crypto.Keccak256(data)) != hash {
+		return nil, fmt.Errorf("REST DAS %s returned data that doesn't match requested hash %v", c.url, hash)
+	}
+	return data, nil
+}
+
+func (c *RestfulDasClient) String() string {
+	return fmt.Sprintf("RestfulDasClient{url:%s}", c.url)
+}
+
+type RestfulClientAggregatorConfig struct {
+	Urls    []string      `koanf:"urls"`
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+var DefaultRestfulClientAggregatorConfig = RestfulClientAggregatorConfig{
+	Timeout: 10 * time.Second,
+}
+
+func RestfulClientAggregatorConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.StringSlice(prefix+".urls", DefaultRestfulClientAggregatorConfig.Urls, "URLs of REST DAS mirrors to read batches from")
+	f.Duration(prefix+".timeout", DefaultRestfulClientAggregatorConfig.Timeout, "Timeout of each request to a REST DAS mirror")
+}
+
+// RestfulClientAggregator reads batches from a set of REST DAS mirrors, spreading
+// requests across them and failing over to the next mirror on errors. It is
+// read-only, Store always fails.
+type RestfulClientAggregator struct {
+	clients []*RestfulDasClient
+	next    uint32 // index of the mirror to try first on the next request
+}
+
+func NewRestfulClientAggregator(config RestfulClientAggregatorConfig) (*RestfulClientAggregator, error) {
+	if len(config.Urls) == 0 {
+		return nil, errors.New("no REST DAS mirror URLs configured")
+	}
+	var clients []*RestfulDasClient
+	for _, url := range config.Urls {
+		clients = append(clients, NewRestfulDasClient(url, config.Timeout))
+	}
+	return &RestfulClientAggregator{clients: clients}, nil
+}
+
+func (a *RestfulClientAggregator) Retrieve(ctx context.Context, certBytes []byte) ([]byte, error) {
+	cert, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(certBytes))
+	if err != nil {
+		return nil, err
+	}
+	return a.GetByHash(ctx, cert.DataHash)
+}
+
+func (a *RestfulClientAggregator) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	first := int(atomic.AddUint32(&a.next, 1)-1) % len(a.clients)
+	var errs []error
+	for i := 0; i < len(a.clients); i++ {
+		client := a.clients[(first+i)%len(a.clients)]
+		data, err := client.GetByHash(ctx, hash)
+		if err == nil {
+			return data, nil
+		}
+		log.Warn("Couldn't retrieve message from REST DAS mirror", "mirror", client.url, "err", err)
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("Data wasn't able to be retrieved from any REST DAS mirror: %v", errs)
+}
+
+func (a *RestfulClientAggregator) Store(ctx context.Context, message []byte, timeout uint64) (*arbstate.DataAvailabilityCertificate, error) {
+	return nil, ErrDASReadOnly
+}
+
+func (a *RestfulClientAggregator) String() string {
+	var urls []string
+	for _, client := range a.clients {
+		urls = append(urls, client.url)
+	}
+	return fmt.Sprintf("RestfulClientAggregator{urls:%v}", urls)
+}
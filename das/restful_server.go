@@ -0,0 +1,125 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	restfulGetByHashPath = "/get-by-hash/"
+	restfulHealthPath    = "/health"
+)
+
+// RestfulDasServer is a read-only HTTP mirror of a DAS, serving stored batches by
+// their keccak256 hash. Since the content at a hash never changes, responses can
+// be cached indefinitely by clients and proxies.
+type RestfulDasServer struct {
+	server   *http.Server
+	listener net.Listener
+	storage  DataAvailabilityServiceHashReader
+}
+
+func NewRestfulDasServer(address string, port uint64, storage DataAvailabilityServiceHashReader) (*RestfulDasServer, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.FormatUint(port, 10)))
+	if err != nil {
+		return nil, err
+	}
+	rds := &RestfulDasServer{
+		listener: listener,
+		storage:  storage,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(restfulGetByHashPath, rds.getByHashHandler)
+	mux.HandleFunc(restfulHealthPath, rds.healthHandler)
+	rds.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		err := rds.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("REST DAS server exited", "err", err)
+		}
+	}()
+	return rds, nil
+}
+
+// Addr returns the address the server is listening on, useful when started on port 0.
+func (rds *RestfulDasServer) Addr() net.Addr {
+	return rds.listener.Addr()
+}
+
+func (rds *RestfulDasServer) Shutdown(ctx context.Context) error {
+	return rds.server.Shutdown(ctx)
+}
+
+func (rds *RestfulDasServer) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("OK\n"))
+}
+
+func (rds *RestfulDasServer) getByHashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	hashHex := strings.TrimPrefix(r.URL.Path, restfulGetByHashPath)
+	if !strings.HasPrefix(hashHex, "0x") {
+		hashHex = "0x" + hashHex
+	}
+	hashBytes, err := hexutil.Decode(hashHex)
+	if err != nil || len(hashBytes) != common.HashLength {
+		http.Error(w, "expected a 32 byte hex encoded hash", http.StatusBadRequest)
+		return
+	}
+	hash := common.BytesToHash(hashBytes)
+
+	data, err := rds.storage.GetByHash(r.Context(), hash)
+	if errors.Is(err, ErrDASDataNotFound) || errors.Is(err, ErrDASDataExpired) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Warn("REST DAS server failed to get data", "hash", hash, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if common.BytesToHash(crypto.Keccak256(data)) != hash {
+		log.Error("REST DAS server storage returned data not matching its hash", "hash", hash)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%s\"", hash.Hex())
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+}
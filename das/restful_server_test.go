@@ -0,0 +1,93 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestRestfulDasServerAndClient(t *testing.T) {
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	defer os.RemoveAll(dbPath)
+	Require(t, err)
+
+	localDAS, err := NewLocalDiskDAS(LocalDiskDASConfig{
+		KeyDir:            dbPath,
+		DataDir:           dbPath,
+		AllowGenerateKeys: true,
+	})
+	Require(t, err)
+	ctx := context.Background()
+	message := []byte("It's time for you to see the fnords.")
+	cert, err := localDAS.Store(ctx, message, uint64(time.Now().Add(time.Hour).Unix()))
+	Require(t, err)
+
+	server, err := NewRestfulDasServer("127.0.0.1", 0, localDAS)
+	Require(t, err)
+	defer func() {
+		Require(t, server.Shutdown(ctx))
+	}()
+	url := "http://" + server.Addr().String()
+
+	client := NewRestfulDasClient(url, time.Second)
+	retrieved, err := client.Retrieve(ctx, Serialize(*cert))
+	Require(t, err)
+	if !bytes.Equal(retrieved, message) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+	_, err = client.GetByHash(ctx, common.Hash{1})
+	if !errors.Is(err, ErrDASDataNotFound) {
+		Fail(t, "Expected unknown hash to not be found, got", err)
+	}
+
+	response, err := http.Get(url + "/get-by-hash/" + common.Hash(cert.DataHash).Hex()[2:])
+	Require(t, err)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("Cache-Control") == "" || response.Header.Get("ETag") == "" {
+		Fail(t, "Expected cacheable response, got", response.Status, response.Header)
+	}
+	for path, expectedStatus := range map[string]int{
+		"/get-by-hash/0x1234": http.StatusBadRequest,
+		"/health":             http.StatusOK,
+	} {
+		response, err := http.Get(url + path)
+		Require(t, err)
+		response.Body.Close()
+		if response.StatusCode != expectedStatus {
+			Fail(t, "Unexpected status for", path, response.Status)
+		}
+	}
+
+	// The aggregator fails over from a mirror that isn't listening.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	deadURL := "http://" + listener.Addr().String()
+	Require(t, listener.Close())
+	aggregator, err := NewRestfulClientAggregator(RestfulClientAggregatorConfig{
+		Urls:    []string{deadURL, url},
+		Timeout: time.Second,
+	})
+	Require(t, err)
+	for i := 0; i < 2; i++ {
+		retrieved, err = aggregator.Retrieve(ctx, Serialize(*cert))
+		Require(t, err)
+		if !bytes.Equal(retrieved, message) {
+			Fail(t, "Retrieved message is not the same as stored one.")
+		}
+	}
+	_, err = aggregator.Store(ctx, message, 0)
+	if !errors.Is(err, ErrDASReadOnly) {
+		Fail(t, "Expected Store to REST mirrors to fail, got", err)
+	}
+}
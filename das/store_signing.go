@@ -0,0 +1,62 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// storeRequestHash is the hash signed by the sender of a Store request, binding
+// the signature to both the message and the requested timeout.
+func storeRequestHash(message []byte, timeout uint64) []byte {
+	var timeoutBuf [8]byte
+	binary.BigEndian.PutUint64(timeoutBuf[:], timeout)
+	return crypto.Keccak256(crypto.Keccak256(message), timeoutBuf[:])
+}
+
+func SignStoreRequest(privateKey *ecdsa.PrivateKey, message []byte, timeout uint64) ([]byte, error) {
+	return crypto.Sign(storeRequestHash(message, timeout), privateKey)
+}
+
+func RecoverStoreRequestSigner(message []byte, timeout uint64, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("Store request signature has length %d, expected %d", len(sig), crypto.SignatureLength)
+	}
+	pubKey, err := crypto.SigToPub(storeRequestHash(message, timeout), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubKey), nil
+}
+
+var ecdsaKeyIsHexRegex = regexp.MustCompile("^(0x)?[a-fA-F0-9]{64}$")
+
+// LoadECDSAPrivKey parses keyConfig as a hex private key, or if it isn't one, reads
+// the hex private key from the file at that path. An empty keyConfig means no key.
+func LoadECDSAPrivKey(keyConfig string) (*ecdsa.PrivateKey, error) {
+	if keyConfig == "" {
+		return nil, nil
+	}
+	keyString := keyConfig
+	if !ecdsaKeyIsHexRegex.MatchString(keyConfig) {
+		contents, err := ioutil.ReadFile(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key file: %w", err)
+		}
+		keyString = strings.TrimSpace(string(contents))
+		if !ecdsaKeyIsHexRegex.MatchString(keyString) {
+			return nil, errors.New("signing key file contents are not 32 bytes of hex")
+		}
+	}
+	return crypto.HexToECDSA(strings.TrimPrefix(keyString, "0x"))
+}
@@ -0,0 +1,131 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/offchainlabs/nitro/arbstate"
+)
+
+// Length of the header of a serialized sequencer message, before its data.
+const sequencerMessageHeaderLen = 40
+
+// L1BatchSource finds the sequencer batches posted to L1, eg via the SequencerInbox.
+type L1BatchSource interface {
+	// Returns the serialized sequencer messages of the batches posted in blocks [from, to].
+	LookupSequencerMessagesInRange(ctx context.Context, from, to uint64) ([][]byte, error)
+}
+
+type SyncStats struct {
+	Batches int // sequencer batches seen
+	Certs   int // of which referred to the DAS
+	Present int // already stored locally
+	Fetched int // fetched from another backend and stored locally
+	Expired int // not fetched because the cert's timeout had passed
+	Failed  int // couldn't be fetched from any backend
+}
+
+func (s *SyncStats) Add(other SyncStats) {
+	s.Batches += other.Batches
+	s.Certs += other.Certs
+	s.Present += other.Present
+	s.Fetched += other.Fetched
+	s.Expired += other.Expired
+	s.Failed += other.Failed
+}
+
+// Syncer copies the batches referred to by DAS certificates posted to L1 into a
+// local DAS, fetching those it's missing from other backends.
+type Syncer struct {
+	batches L1BatchSource
+	sources []DataAvailabilityServiceHashReader
+	dest    DataAvailabilityService
+	now     func() time.Time
+}
+
+func NewSyncer(batches L1BatchSource, sources []DataAvailabilityServiceHashReader, dest DataAvailabilityService) (*Syncer, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("no DAS backends to sync from")
+	}
+	return &Syncer{
+		batches: batches,
+		sources: sources,
+		dest:    dest,
+		now:     time.Now,
+	}, nil
+}
+
+// SyncBlockRange syncs the batches posted in L1 blocks [from, to]. Batches which
+// couldn't be fetched are counted in the stats and logged, rather than failing
+// the sync, so they can be retried by syncing the range again.
+func (s *Syncer) SyncBlockRange(ctx context.Context, from, to uint64) (SyncStats, error) {
+	var stats SyncStats
+	messages, err := s.batches.LookupSequencerMessagesInRange(ctx, from, to)
+	if err != nil {
+		return stats, err
+	}
+	for _, message := range messages {
+		stats.Batches++
+		if len(message) <= sequencerMessageHeaderLen || !arbstate.IsDASMessageHeaderByte(message[sequencerMessageHeaderLen]) {
+			continue
+		}
+		stats.Certs++
+		cert, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(message[sequencerMessageHeaderLen:]))
+		if err != nil {
+			log.Warn("Skipping batch with invalid DAS certificate", "err", err)
+			stats.Failed++
+			continue
+		}
+		if cert.Timeout < uint64(s.now().Unix()) {
+			stats.Expired++
+			continue
+		}
+		// Anything but a successful read, eg corrupted data, means it needs fetching.
+		if _, err := s.dest.GetByHash(ctx, cert.DataHash); err == nil {
+			stats.Present++
+			continue
+		}
+		data, err := s.fetch(ctx, cert.DataHash)
+		if err != nil {
+			if ctx.Err() != nil {
+				return stats, ctx.Err()
+			}
+			log.Warn("Couldn't fetch batch from any DAS backend", "hash", common.Hash(cert.DataHash), "err", err)
+			stats.Failed++
+			continue
+		}
+		_, err = s.dest.Store(ctx, data, cert.Timeout)
+		if err != nil {
+			return stats, fmt.Errorf("failed to store batch %v: %w", common.Hash(cert.DataHash), err)
+		}
+		stats.Fetched++
+	}
+	return stats, nil
+}
+
+func (s *Syncer) fetch(ctx context.Context, hash common.Hash) ([]byte, error) {
+	var errs []error
+	for _, source := range s.sources {
+		data, err := source.GetByHash(ctx, hash)
+		if err == nil && common.BytesToHash(crypto.Keccak256(data)) != hash {
+			err = errors.New("data doesn't match requested hash")
+		}
+		if err == nil {
+			return data, nil
+		}
+		errs = append(errs, fmt.Errorf("%v: %w", source, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("%v", errs)
+}
@@ -0,0 +1,97 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/offchainlabs/nitro/arbstate"
+)
+
+type staticBatchSource struct {
+	messages [][]byte
+}
+
+func (s *staticBatchSource) LookupSequencerMessagesInRange(ctx context.Context, from, to uint64) ([][]byte, error) {
+	return s.messages, nil
+}
+
+func newSyncTestDAS(t *testing.T) *LocalDiskDAS {
+	t.Helper()
+	dbPath, err := ioutil.TempDir("/tmp", "das_test")
+	Require(t, err)
+	t.Cleanup(func() { os.RemoveAll(dbPath) })
+	das, err := NewLocalDiskDAS(LocalDiskDASConfig{
+		KeyDir:            dbPath,
+		DataDir:           dbPath,
+		AllowGenerateKeys: true,
+	})
+	Require(t, err)
+	return das
+}
+
+func sequencerMessageWithCert(cert *arbstate.DataAvailabilityCertificate) []byte {
+	return append(make([]byte, sequencerMessageHeaderLen), Serialize(*cert)...)
+}
+
+func TestDASSyncer(t *testing.T) {
+	source := newSyncTestDAS(t)
+	dest := newSyncTestDAS(t)
+	ctx := context.Background()
+	timeout := uint64(time.Now().Add(time.Hour).Unix())
+
+	var messages [][]byte
+	// A batch posted on chain rather than to the DAS.
+	messages = append(messages, append(make([]byte, sequencerMessageHeaderLen), 0, 1, 2, 3))
+	// Batches missing from the destination.
+	var missing [][]byte
+	for _, data := range []string{"first missing batch", "second missing batch"} {
+		cert, err := source.Store(ctx, []byte(data), timeout)
+		Require(t, err)
+		messages = append(messages, sequencerMessageWithCert(cert))
+		missing = append(missing, []byte(data))
+	}
+	// A batch already present.
+	cert, err := dest.Store(ctx, []byte("present batch"), timeout)
+	Require(t, err)
+	messages = append(messages, sequencerMessageWithCert(cert))
+	// An expired batch.
+	expiredCert := &arbstate.DataAvailabilityCertificate{Timeout: uint64(time.Now().Add(-time.Hour).Unix())}
+	copy(expiredCert.DataHash[:], crypto.Keccak256([]byte("expired batch")))
+	messages = append(messages, sequencerMessageWithCert(expiredCert))
+	// A batch none of the sources have.
+	unknownCert := &arbstate.DataAvailabilityCertificate{Timeout: timeout}
+	copy(unknownCert.DataHash[:], crypto.Keccak256([]byte("unknown batch")))
+	messages = append(messages, sequencerMessageWithCert(unknownCert))
+
+	syncer, err := NewSyncer(&staticBatchSource{messages}, []DataAvailabilityServiceHashReader{source}, dest)
+	Require(t, err)
+	stats, err := syncer.SyncBlockRange(ctx, 0, 100)
+	Require(t, err)
+	expected := SyncStats{Batches: 6, Certs: 5, Present: 1, Fetched: 2, Expired: 1, Failed: 1}
+	if stats != expected {
+		Fail(t, "Unexpected sync stats", stats, "expected", expected)
+	}
+	for _, data := range missing {
+		synced, err := dest.GetByHash(ctx, crypto.Keccak256Hash(data))
+		Require(t, err, "Batch wasn't synced")
+		if !bytes.Equal(synced, data) {
+			Fail(t, "Synced batch is not the same as the source one.")
+		}
+	}
+
+	// Syncing again finds everything that could be fetched already present.
+	stats, err = syncer.SyncBlockRange(ctx, 0, 100)
+	Require(t, err)
+	expected = SyncStats{Batches: 6, Certs: 5, Present: 3, Expired: 1, Failed: 1}
+	if stats != expected {
+		Fail(t, "Unexpected sync stats on resync", stats, "expected", expected)
+	}
+}
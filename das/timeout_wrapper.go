@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/offchainlabs/nitro/arbstate"
 )
 
@@ -24,6 +25,12 @@ func (w *TimeoutWrapper) Retrieve(ctx context.Context, cert []byte) ([]byte, err
 	return w.DataAvailabilityService.Retrieve(deadlineCtx, cert)
 }
 
+func (w *TimeoutWrapper) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	deadlineCtx, cancel := context.WithDeadline(ctx, time.Now().Add(w.t))
+	defer cancel()
+	return w.DataAvailabilityService.GetByHash(deadlineCtx, hash)
+}
+
 func (w *TimeoutWrapper) Store(ctx context.Context, message []byte, timeout uint64) (*arbstate.DataAvailabilityCertificate, error) {
 	deadlineCtx, cancel := context.WithDeadline(ctx, time.Now().Add(w.t))
 	// In the case of the aggregator, allow goroutines started by Store(...)
@@ -0,0 +1,237 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package feedarchiver
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	flag "github.com/spf13/pflag"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+type Config struct {
+	Dir          string        `koanf:"dir"`
+	FileMessages uint64        `koanf:"file-messages"`
+	FileAge      time.Duration `koanf:"file-age"`
+	Replay       ReplayConfig  `koanf:"replay"`
+}
+
+func ConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".dir", DefaultConfig.Dir, "directory to write the feed archive to, or replay it from")
+	f.Uint64(prefix+".file-messages", DefaultConfig.FileMessages, "number of messages written to an archive file before starting a new one")
+	f.Duration(prefix+".file-age", DefaultConfig.FileAge, "how long messages are written to an archive file before starting a new one")
+	ReplayConfigAddOptions(prefix+".replay", f)
+}
+
+var DefaultConfig = Config{
+	Dir:          "",
+	FileMessages: 100000,
+	FileAge:      time.Hour,
+	Replay:       DefaultReplayConfig,
+}
+
+func (c *Config) Validate() error {
+	if c.Dir == "" {
+		return errors.New("feed archive dir must be set")
+	}
+	if c.FileMessages == 0 || c.FileAge <= 0 {
+		return errors.New("feed archive file-messages and file-age must be positive")
+	}
+	return c.Replay.Validate()
+}
+
+// ArchivedFeedMessage is a feed message as written to the archive, along with
+// when it was received.
+type ArchivedFeedMessage struct {
+	Received time.Time                         `json:"received"`
+	Message  *broadcaster.BroadcastFeedMessage `json:"message"`
+}
+
+// Archive files are gzip compressed, with a JSON encoded ArchivedFeedMessage
+// per line. They're named for the sequence number of their first message and
+// when they were created, so that they sort in the order they were written.
+const archiveFileSuffix = ".jsonl.gz"
+
+func archiveFilePath(dir string, first arbutil.MessageIndex, created time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d-%020d%s", first, created.UnixNano(), archiveFileSuffix))
+}
+
+type archiveFile struct {
+	path    string
+	first   arbutil.MessageIndex
+	created int64
+}
+
+// listArchiveFiles returns the archive files in dir, ordered by the sequence
+// number of their first message.
+func listArchiveFiles(dir string) ([]archiveFile, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []archiveFile
+	for _, entry := range dirEntries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, archiveFileSuffix) {
+			continue
+		}
+		var file archiveFile
+		if _, err := fmt.Sscanf(strings.TrimSuffix(name, archiveFileSuffix), "%d-%d", &file.first, &file.created); err != nil {
+			log.Warn("ignoring unexpected file in feed archive", "dir", dir, "file", name)
+			continue
+		}
+		file.path = filepath.Join(dir, name)
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].first != files[j].first {
+			return files[i].first < files[j].first
+		}
+		return files[i].created < files[j].created
+	})
+	return files, nil
+}
+
+// errStopReading can be returned by a readArchiveFile callback to stop reading
+// without an error.
+var errStopReading = errors.New("stop reading")
+
+// readArchiveFile calls fn with each message in the archive file, in the order
+// they were written. A file the archiver was stopped partway through writing is
+// read up to its last complete message.
+func readArchiveFile(path string, fn func(*ArchivedFeedMessage) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(bufio.NewReader(file))
+	if errors.Is(err, io.EOF) {
+		// Nothing was written to the file
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg ArchivedFeedMessage
+		err := decoder.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Warn("feed archive file ends with an incomplete message", "file", path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Message == nil {
+			return fmt.Errorf("feed archive file %v has an entry without a message", path)
+		}
+		if err := fn(&msg); err != nil {
+			if errors.Is(err, errStopReading) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// archiveWriter appends messages to the archive, starting a new file once the
+// current one has enough messages or is old enough. Files from earlier runs are
+// left as they are, rather than appended to, so that an incomplete message at
+// the end of one doesn't hide anything written after it.
+type archiveWriter struct {
+	config *Config
+
+	file         *os.File
+	writer       *gzip.Writer
+	encoder      *json.Encoder
+	fileMessages uint64
+	fileCreated  time.Time
+
+	now func() time.Time
+}
+
+func newArchiveWriter(config *Config) (*archiveWriter, error) {
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+	return &archiveWriter{
+		config: config,
+		now:    time.Now,
+	}, nil
+}
+
+// write archives the messages, flushing them to the file once written.
+func (w *archiveWriter) write(messages []*ArchivedFeedMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	for _, msg := range messages {
+		if w.file == nil || w.fileMessages >= w.config.FileMessages || w.now().Sub(w.fileCreated) >= w.config.FileAge {
+			if err := w.startFile(msg.Message.SequenceNumber); err != nil {
+				return err
+			}
+		}
+		if err := w.encoder.Encode(msg); err != nil {
+			return err
+		}
+		w.fileMessages++
+	}
+	return w.writer.Flush()
+}
+
+func (w *archiveWriter) startFile(first arbutil.MessageIndex) error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	created := w.now()
+	path := archiveFilePath(w.config.Dir, first, created)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	log.Info("started feed archive file", "file", path)
+	w.file = file
+	w.writer = gzip.NewWriter(file)
+	w.encoder = json.NewEncoder(w.writer)
+	w.fileMessages = 0
+	w.fileCreated = created
+	return nil
+}
+
+func (w *archiveWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.writer.Close()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	w.writer = nil
+	w.encoder = nil
+	return err
+}
+
+func (w *archiveWriter) close() error {
+	return w.closeFile()
+}
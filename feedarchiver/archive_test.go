@@ -0,0 +1,225 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package feedarchiver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func testConfig(t *testing.T) *Config {
+	config := DefaultConfig
+	config.Dir = t.TempDir()
+	config.FileMessages = 10
+	return &config
+}
+
+func archivedMessages(from, to arbutil.MessageIndex, received time.Time) []*ArchivedFeedMessage {
+	var messages []*ArchivedFeedMessage
+	for i := from; i < to; i++ {
+		messages = append(messages, &ArchivedFeedMessage{
+			Received: received,
+			Message: &broadcaster.BroadcastFeedMessage{
+				SequenceNumber: i,
+				Message:        arbstate.MessageWithMetadata{DelayedMessagesRead: uint64(i)},
+			},
+		})
+	}
+	return messages
+}
+
+func readArchive(t *testing.T, dir string) []*ArchivedFeedMessage {
+	t.Helper()
+	files, err := listArchiveFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []*ArchivedFeedMessage
+	for _, file := range files {
+		err := readArchiveFile(file.path, func(msg *ArchivedFeedMessage) error {
+			messages = append(messages, msg)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return messages
+}
+
+func expectSequenceNumbers(t *testing.T, messages []*ArchivedFeedMessage, expected ...arbutil.MessageIndex) {
+	t.Helper()
+	if len(messages) != len(expected) {
+		t.Fatal("expected messages", expected, "got", len(messages), "messages")
+	}
+	for i, msg := range messages {
+		if msg.Message.SequenceNumber != expected[i] || msg.Message.Message.DelayedMessagesRead != uint64(expected[i]) {
+			t.Fatal("expected messages", expected, "got", msg.Message.SequenceNumber, "at", i)
+		}
+	}
+}
+
+func sequenceNumbers(from, to arbutil.MessageIndex) []arbutil.MessageIndex {
+	var seqNums []arbutil.MessageIndex
+	for i := from; i < to; i++ {
+		seqNums = append(seqNums, i)
+	}
+	return seqNums
+}
+
+func TestArchiveWriterRotatesFiles(t *testing.T) {
+	config := testConfig(t)
+	writer, err := newArchiveWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	writer.now = func() time.Time { return now }
+
+	if err := writer.write(archivedMessages(0, 25, now)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(config.FileAge)
+	if err := writer.write(archivedMessages(25, 27, now)); err != nil {
+		t.Fatal(err)
+	}
+	// The archiver was stopped partway through the file
+	files, err := listArchiveFiles(config.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 || files[0].first != 0 || files[1].first != 10 || files[2].first != 20 || files[3].first != 25 {
+		t.Fatal("expected files to be started every 10 messages and once the last was old enough, got", files)
+	}
+	expectSequenceNumbers(t, readArchive(t, config.Dir), sequenceNumbers(0, 27)...)
+
+	// A message contradicting an earlier one is archived after it
+	writer, err = newArchiveWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Second)
+	writer.now = func() time.Time { return now }
+	if err := writer.write(archivedMessages(26, 28, now)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.close(); err != nil {
+		t.Fatal(err)
+	}
+	expectSequenceNumbers(t, readArchive(t, config.Dir), append(sequenceNumbers(0, 27), 26, 27)...)
+}
+
+type testFeedReceiver chan *broadcaster.BroadcastFeedMessage
+
+func (r testFeedReceiver) AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error {
+	panic("expected feed messages to be added with their signatures")
+}
+
+func (r testFeedReceiver) AddBroadcastFeedMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	for _, msg := range messages {
+		r <- msg
+	}
+	return nil
+}
+
+func testServerConfig() wsbroadcastserver.BroadcasterConfig {
+	return wsbroadcastserver.BroadcasterConfig{
+		Addr:          "127.0.0.1",
+		IOTimeout:     2 * time.Second,
+		Port:          "0",
+		Ping:          5 * time.Second,
+		ClientTimeout: 20 * time.Second,
+		Queue:         1,
+		Workers:       128,
+	}
+}
+
+func TestArchiveAndReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverConf := testServerConfig()
+	serverConf.SigningKey = "b6b15c8cb491557369f3c7d2c287b053eb229daa9c22138887752191c9520659"
+	feed, err := broadcaster.NewBroadcaster(serverConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := feed.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer feed.StopAndWait()
+
+	config := testConfig(t)
+	config.Replay.Speed = 0
+	clientConf := broadcastclient.DefaultBroadcastClientConfig
+	url := fmt.Sprintf("ws://%s/", feed.ListenerAddr().String())
+	// Each message is received from both upstreams, but archived once
+	clientConf.URLs = []string{url, url}
+	archiver, err := NewArchiver(clientConf, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiver.Start(ctx)
+	for feed.ClientCount() < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 25; i++ {
+		feed.BroadcastSingle(arbstate.MessageWithMetadata{DelayedMessagesRead: uint64(i)}, arbutil.MessageIndex(i))
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(readArchive(t, config.Dir)) < 25; {
+		if time.Now().After(deadline) {
+			t.Fatal("messages weren't archived")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	archiver.StopAndWait()
+	archived := readArchive(t, config.Dir)
+	expectSequenceNumbers(t, archived, sequenceNumbers(0, 25)...)
+
+	config.Replay.From = 8
+	config.Replay.To = 21
+	replayer, err := NewReplayer(testServerConfig(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replayer.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer replayer.StopAndWait()
+	select {
+	case <-replayer.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay didn't finish")
+	}
+
+	receiver := make(testFeedReceiver, 100)
+	replayClientConf := broadcastclient.DefaultBroadcastClientConfig
+	client, err := broadcastclient.NewBroadcastClient(fmt.Sprintf("ws://%s/", replayer.ListenerAddr().String()), nil, &replayClientConf, receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start(ctx)
+	defer client.StopAndWait()
+	for expected := arbutil.MessageIndex(8); expected <= 21; expected++ {
+		select {
+		case msg := <-receiver:
+			if msg.SequenceNumber != expected || msg.Message.DelayedMessagesRead != uint64(expected) {
+				t.Fatal("expected replayed message", expected, "got", msg.SequenceNumber)
+			}
+			if string(msg.Signature) != string(archived[expected].Message.Signature) || len(msg.Signature) == 0 {
+				t.Fatal("expected replayed message", expected, "to keep its signature")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("didn't receive replayed message", expected)
+		}
+	}
+}
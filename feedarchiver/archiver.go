@@ -0,0 +1,143 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package feedarchiver
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
+)
+
+var (
+	archivedMessagesMeter = metrics.NewRegisteredMeter("arb/feedarchiver/archived", nil)
+	archiveErrorsCounter  = metrics.NewRegisteredCounter("arb/feedarchiver/errors", nil)
+)
+
+// Number of recently archived messages remembered, so that a message received
+// from several upstreams, or again after reconnecting, is only archived once.
+const recentMessagesRemembered = 10000
+
+// Archiver subscribes to sequencer feeds and writes every message they publish
+// to the archive. Messages are archived as received, so one contradicted by a
+// later message with the same sequence number, or by an L1 batch, is kept.
+type Archiver struct {
+	stopwaiter.StopWaiter
+	config           *Config
+	broadcastClients []*broadcastclient.BroadcastClient
+	queue            chan []*broadcaster.BroadcastFeedMessage
+	writer           *archiveWriter
+
+	recent      map[common.Hash]bool
+	recentOrder []common.Hash
+}
+
+// archiverQueue queues the messages received from an upstream to be archived.
+type archiverQueue chan<- []*broadcaster.BroadcastFeedMessage
+
+func (q archiverQueue) AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error {
+	var feedMessages []*broadcaster.BroadcastFeedMessage
+	for i, message := range messages {
+		feedMessages = append(feedMessages, &broadcaster.BroadcastFeedMessage{
+			SequenceNumber: pos + arbutil.MessageIndex(i),
+			Message:        message,
+		})
+	}
+	q <- feedMessages
+	return nil
+}
+
+// AddBroadcastFeedMessages queues the messages as received, so they're archived
+// with their sequencer signatures.
+func (q archiverQueue) AddBroadcastFeedMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	q <- messages
+	return nil
+}
+
+func NewArchiver(clientConf broadcastclient.BroadcastClientConfig, config *Config) (*Archiver, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	writer, err := newArchiveWriter(config)
+	if err != nil {
+		return nil, err
+	}
+	queue := make(chan []*broadcaster.BroadcastFeedMessage, 100)
+	var broadcastClients []*broadcastclient.BroadcastClient
+	for _, address := range clientConf.URLs {
+		client, err := broadcastclient.NewBroadcastClient(address, nil, &clientConf, archiverQueue(queue))
+		if err != nil {
+			return nil, err
+		}
+		broadcastClients = append(broadcastClients, client)
+	}
+	return &Archiver{
+		config:           config,
+		broadcastClients: broadcastClients,
+		queue:            queue,
+		writer:           writer,
+		recent:           make(map[common.Hash]bool),
+	}, nil
+}
+
+func (a *Archiver) Start(ctx context.Context) {
+	a.StopWaiter.Start(ctx)
+	for _, client := range a.broadcastClients {
+		client.Start(ctx)
+	}
+	a.LaunchThread(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case messages := <-a.queue:
+				a.archive(messages, time.Now())
+			}
+		}
+	})
+}
+
+// archive writes the messages which haven't been archived recently.
+func (a *Archiver) archive(messages []*broadcaster.BroadcastFeedMessage, received time.Time) {
+	var toArchive []*ArchivedFeedMessage
+	for _, msg := range messages {
+		hash := msg.Hash()
+		if a.recent[hash] {
+			continue
+		}
+		a.recent[hash] = true
+		a.recentOrder = append(a.recentOrder, hash)
+		if len(a.recentOrder) > recentMessagesRemembered {
+			delete(a.recent, a.recentOrder[0])
+			a.recentOrder = a.recentOrder[1:]
+		}
+		toArchive = append(toArchive, &ArchivedFeedMessage{Received: received, Message: msg})
+	}
+	if err := a.writer.write(toArchive); err != nil {
+		archiveErrorsCounter.Inc(1)
+		log.Error("error writing feed messages to archive", "count", len(toArchive), "err", err)
+		return
+	}
+	archivedMessagesMeter.Mark(int64(len(toArchive)))
+}
+
+func (a *Archiver) StopAndWait() {
+	// The clients are stopped first, as they may be waiting for their messages
+	// to be queued.
+	for _, client := range a.broadcastClients {
+		client.StopAndWait()
+	}
+	a.StopWaiter.StopAndWait()
+	if err := a.writer.close(); err != nil {
+		log.Error("error closing feed archive", "err", err)
+	}
+}
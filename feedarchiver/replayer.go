@@ -0,0 +1,162 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package feedarchiver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	flag "github.com/spf13/pflag"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+type ReplayConfig struct {
+	Enable bool    `koanf:"enable"`
+	From   uint64  `koanf:"from"`
+	To     uint64  `koanf:"to"`
+	Speed  float64 `koanf:"speed"`
+}
+
+func ReplayConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultReplayConfig.Enable, "serve the archived messages as a feed instead of archiving one")
+	f.Uint64(prefix+".from", DefaultReplayConfig.From, "sequence number of the first archived message to replay")
+	f.Uint64(prefix+".to", DefaultReplayConfig.To, "sequence number of the last archived message to replay (0 = no limit)")
+	f.Float64(prefix+".speed", DefaultReplayConfig.Speed, "how fast to replay messages relative to when they were received, eg 2 for twice as fast (0 = as fast as possible)")
+}
+
+var DefaultReplayConfig = ReplayConfig{
+	Enable: false,
+	From:   0,
+	To:     0,
+	Speed:  1,
+}
+
+func (c *ReplayConfig) Validate() error {
+	if c.Speed < 0 {
+		return errors.New("feed replay speed can't be negative")
+	}
+	if c.To != 0 && c.To < c.From {
+		return errors.New("feed replay to must not be less than from")
+	}
+	return nil
+}
+
+// Replayer serves archived feed messages as a sequencer feed, in the order they
+// were archived and with their original signatures. Messages are never
+// confirmed, so clients connecting partway through are sent all the messages
+// replayed so far.
+type Replayer struct {
+	stopwaiter.StopWaiter
+	config      *Config
+	broadcaster *broadcaster.Broadcaster
+	done        chan struct{}
+}
+
+func NewReplayer(serverConf wsbroadcastserver.BroadcasterConfig, config *Config) (*Replayer, error) {
+	if serverConf.SigningKey != "" {
+		return nil, errors.New("feed replays keep the archived signatures and can't sign feed messages")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	feedBroadcaster, err := broadcaster.NewBroadcaster(serverConf)
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{
+		config:      config,
+		broadcaster: feedBroadcaster,
+		done:        make(chan struct{}),
+	}, nil
+}
+
+func (r *Replayer) Start(ctx context.Context) error {
+	r.StopWaiter.Start(ctx)
+	if err := r.broadcaster.Start(ctx); err != nil {
+		return err
+	}
+	r.LaunchThread(func(ctx context.Context) {
+		count, err := r.replay(ctx)
+		if err != nil {
+			log.Error("error replaying feed archive", "dir", r.config.Dir, "replayed", count, "err", err)
+			return
+		}
+		log.Info("finished replaying feed archive", "dir", r.config.Dir, "replayed", count)
+		close(r.done)
+	})
+	return nil
+}
+
+func (r *Replayer) replay(ctx context.Context) (int, error) {
+	files, err := listArchiveFiles(r.config.Dir)
+	if err != nil {
+		return 0, err
+	}
+	from := arbutil.MessageIndex(r.config.Replay.From)
+	// Skip the files entirely before the first message to replay
+	for len(files) > 1 && files[1].first <= from {
+		files = files[1:]
+	}
+
+	count := 0
+	var firstReceived, started time.Time
+	for _, file := range files {
+		finished := false
+		err := readArchiveFile(file.path, func(msg *ArchivedFeedMessage) error {
+			seqNum := msg.Message.SequenceNumber
+			if r.config.Replay.To != 0 && uint64(seqNum) > r.config.Replay.To {
+				finished = true
+				return errStopReading
+			}
+			if seqNum < from {
+				return nil
+			}
+			if r.config.Replay.Speed > 0 {
+				if count == 0 {
+					firstReceived = msg.Received
+					started = time.Now()
+				}
+				offset := time.Duration(float64(msg.Received.Sub(firstReceived)) / r.config.Replay.Speed)
+				timer := time.NewTimer(time.Until(started.Add(offset)))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+			r.broadcaster.BroadcastFeedMessages([]*broadcaster.BroadcastFeedMessage{msg.Message})
+			count++
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		if finished {
+			break
+		}
+	}
+	return count, nil
+}
+
+// Done is closed once every message to replay has been sent.
+func (r *Replayer) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *Replayer) ListenerAddr() net.Addr {
+	return r.broadcaster.ListenerAddr()
+}
+
+func (r *Replayer) StopAndWait() {
+	r.StopWaiter.StopAndWait()
+	r.broadcaster.StopAndWait()
+}
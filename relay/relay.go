@@ -5,10 +5,15 @@ package relay
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net"
+	"net/http"
 	"time"
 
+	"github.com/ethereum/go-ethereum/log"
+	flag "github.com/spf13/pflag"
+
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/broadcastclient"
@@ -17,55 +22,126 @@ import (
 	"github.com/offchainlabs/nitro/wsbroadcastserver"
 )
 
+type Config struct {
+	MaxGapWait         time.Duration `koanf:"max-gap-wait"`
+	MaxPendingMessages int           `koanf:"max-pending-messages"`
+	MaxUpstreamLag     uint64        `koanf:"max-upstream-lag"`
+	UpstreamTimeout    time.Duration `koanf:"upstream-timeout"`
+	StatusAddr         string        `koanf:"status-addr"`
+}
+
+func ConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Duration(prefix+".max-gap-wait", DefaultConfig.MaxGapWait, "how long to wait for a missing message from any upstream before skipping it")
+	f.Int(prefix+".max-pending-messages", DefaultConfig.MaxPendingMessages, "maximum number of messages to hold back waiting for a missing message")
+	f.Uint64(prefix+".max-upstream-lag", DefaultConfig.MaxUpstreamLag, "number of messages an upstream can fall behind the others before it's considered unhealthy")
+	f.Duration(prefix+".upstream-timeout", DefaultConfig.UpstreamTimeout, "an upstream behind the others and silent for this long is considered unhealthy")
+	f.String(prefix+".status-addr", DefaultConfig.StatusAddr, "if set, address to serve the upstreams' status over HTTP on, eg 127.0.0.1:9643")
+}
+
+var DefaultConfig = Config{
+	MaxGapWait:         2 * time.Second,
+	MaxPendingMessages: 1000,
+	MaxUpstreamLag:     100,
+	UpstreamTimeout:    10 * time.Second,
+	StatusAddr:         "",
+}
+
+var TestConfig = Config{
+	MaxGapWait:         200 * time.Millisecond,
+	MaxPendingMessages: 100,
+	MaxUpstreamLag:     10,
+	UpstreamTimeout:    time.Second,
+	StatusAddr:         "",
+}
+
+func (c *Config) Validate() error {
+	if c.MaxGapWait <= 0 || c.MaxPendingMessages <= 0 || c.UpstreamTimeout <= 0 {
+		return errors.New("relay max-gap-wait, max-pending-messages and upstream-timeout must be positive")
+	}
+	return nil
+}
+
 type Relay struct {
 	stopwaiter.StopWaiter
+	config                      *Config
 	broadcastClients            []*broadcastclient.BroadcastClient
 	broadcaster                 *broadcaster.Broadcaster
 	confirmedSequenceNumberChan chan arbutil.MessageIndex
-	messageChan                 chan broadcastFeedMessage
+	messageChan                 chan upstreamMessage
+	tracker                     *feedTracker
 }
 
-type broadcastFeedMessage struct {
-	message        arbstate.MessageWithMetadata
-	sequenceNumber arbutil.MessageIndex
+type upstreamMessage struct {
+	upstream int
+	message  *broadcaster.BroadcastFeedMessage
 }
 
+// RelayMessageQueue queues the messages received from one upstream.
 type RelayMessageQueue struct {
-	queue chan broadcastFeedMessage
+	upstream int
+	queue    chan upstreamMessage
 }
 
 func (q *RelayMessageQueue) AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error {
 	for i, message := range messages {
-		q.queue <- broadcastFeedMessage{
-			sequenceNumber: pos + arbutil.MessageIndex(i),
-			message:        message,
-		}
+		q.queue <- upstreamMessage{q.upstream, &broadcaster.BroadcastFeedMessage{
+			SequenceNumber: pos + arbutil.MessageIndex(i),
+			Message:        message,
+		}}
 	}
 
 	return nil
 }
 
-func NewRelay(serverConf wsbroadcastserver.BroadcasterConfig, clientConf broadcastclient.BroadcastClientConfig) *Relay {
+// AddBroadcastFeedMessages queues the messages as received, so they are relayed
+// with their sequencer signatures untouched.
+func (q *RelayMessageQueue) AddBroadcastFeedMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	for _, message := range messages {
+		q.queue <- upstreamMessage{q.upstream, message}
+	}
+
+	return nil
+}
+
+func NewRelay(serverConf wsbroadcastserver.BroadcasterConfig, clientConf broadcastclient.BroadcastClientConfig, config *Config) (*Relay, error) {
+	if serverConf.SigningKey != "" {
+		return nil, errors.New("relays forward sequencer signatures and can't sign feed messages")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	var broadcastClients []*broadcastclient.BroadcastClient
 
-	q := RelayMessageQueue{make(chan broadcastFeedMessage, 100)}
+	queue := make(chan upstreamMessage, 100)
 
 	confirmedSequenceNumberListener := make(chan arbutil.MessageIndex, 10)
 
-	for _, address := range clientConf.URLs {
-		client := broadcastclient.NewBroadcastClient(address, nil, clientConf.Timeout, &q)
+	for i, address := range clientConf.URLs {
+		client, err := broadcastclient.NewBroadcastClient(address, nil, &clientConf, &RelayMessageQueue{i, queue})
+		if err != nil {
+			return nil, err
+		}
 		client.ConfirmedSequenceNumberListener = confirmedSequenceNumberListener
 		broadcastClients = append(broadcastClients, client)
 	}
 
+	feedBroadcaster, err := broadcaster.NewBroadcaster(serverConf)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Relay{
-		broadcaster:                 broadcaster.NewBroadcaster(serverConf),
+		config:                      config,
+		broadcaster:                 feedBroadcaster,
 		broadcastClients:            broadcastClients,
 		confirmedSequenceNumberChan: confirmedSequenceNumberListener,
-		messageChan:                 q.queue,
-	}
+		messageChan:                 queue,
+		tracker:                     newFeedTracker(config, clientConf.URLs),
+	}, nil
 }
 
+// How long messages are remembered to compare them against other upstreams
 const RECENT_FEED_ITEM_TTL time.Duration = time.Second * 10
 
 func (r *Relay) Start(ctx context.Context) error {
@@ -79,37 +155,90 @@ func (r *Relay) Start(ctx context.Context) error {
 		client.Start(ctx)
 	}
 
-	recentFeedItems := make(map[arbutil.MessageIndex]time.Time)
 	r.LaunchThread(func(ctx context.Context) {
 		recentFeedItemsCleanup := time.NewTicker(RECENT_FEED_ITEM_TTL)
 		defer recentFeedItemsCleanup.Stop()
+		gapCheck := time.NewTicker(r.config.MaxGapWait / 4)
+		defer gapCheck.Stop()
 		for {
+			var ready []*broadcaster.BroadcastFeedMessage
 			select {
 			case <-ctx.Done():
 				return
 			case msg := <-r.messageChan:
-				if recentFeedItems[msg.sequenceNumber] != (time.Time{}) {
-					continue
-				}
-				recentFeedItems[msg.sequenceNumber] = time.Now()
-				r.broadcaster.BroadcastSingle(msg.message, msg.sequenceNumber)
+				ready = r.tracker.receive(msg.upstream, msg.message, time.Now())
 			case cs := <-r.confirmedSequenceNumberChan:
 				r.broadcaster.Confirm(cs)
+			case <-gapCheck.C:
+				ready = r.tracker.checkGap(time.Now())
 			case <-recentFeedItemsCleanup.C:
-				// Clear expired items from recentFeedItems
-				recentFeedItemExpiry := time.Now().Add(-RECENT_FEED_ITEM_TTL)
-				for acc, created := range recentFeedItems {
-					if created.Before(recentFeedItemExpiry) {
-						delete(recentFeedItems, acc)
-					}
-				}
+				r.tracker.prune(time.Now())
+			}
+			if len(ready) > 0 {
+				r.broadcaster.BroadcastFeedMessages(ready)
 			}
 		}
 	})
 
+	if r.config.StatusAddr != "" {
+		r.LaunchThread(r.launchStatusServer)
+	}
+
 	return nil
 }
 
+// Status returns the state of the relay and its upstreams.
+func (r *Relay) Status() Status {
+	status := r.tracker.status(time.Now())
+	for i, client := range r.broadcastClients {
+		status.Upstreams[i].Retries = client.GetRetryCount()
+	}
+	return status
+}
+
+// ServeHTTP serves the relay's status as JSON, with a 503 status code if no
+// upstream is healthy.
+func (r *Relay) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	status := r.Status()
+	code := http.StatusServiceUnavailable
+	for _, upstream := range status.Upstreams {
+		if upstream.Healthy {
+			code = http.StatusOK
+		}
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set("Cache-Control", "no-store")
+	response.WriteHeader(code)
+	if err := json.NewEncoder(response).Encode(status); err != nil {
+		log.Warn("error writing relay status", "err", err)
+	}
+}
+
+func (r *Relay) launchStatusServer(ctx context.Context) {
+	server := &http.Server{
+		Addr:              r.config.StatusAddr,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		err := server.Shutdown(context.Background())
+		if err != nil {
+			log.Warn("error shutting down relay status server", "err", err)
+		}
+	}()
+
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Warn("error serving relay status", "err", err)
+	}
+}
+
 func (r *Relay) GetListenerAddr() net.Addr {
 	return r.broadcaster.ListenerAddr()
 }
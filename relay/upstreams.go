@@ -0,0 +1,327 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package relay
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var (
+	gapCounter      = metrics.NewRegisteredCounter("arb/relay/gaps", nil)
+	skippedCounter  = metrics.NewRegisteredCounter("arb/relay/skipped", nil)
+	conflictCounter = metrics.NewRegisteredCounter("arb/relay/conflicts", nil)
+
+	forwardedMeter        = metrics.NewRegisteredMeter("arb/relay/forwarded", nil)
+	pendingGauge          = metrics.NewRegisteredGauge("arb/relay/pending", nil)
+	healthyUpstreamsGauge = metrics.NewRegisteredGauge("arb/relay/upstreams/healthy", nil)
+	upstreamLagGauge      = metrics.NewRegisteredGauge("arb/relay/upstreams/lag", nil)
+)
+
+// Weight of each new sample in an upstream's latency moving average
+const latencySampleWeight = 0.1
+
+type UpstreamStatus struct {
+	URL         string               `json:"url"`
+	Head        arbutil.MessageIndex `json:"head"`
+	LastMessage time.Time            `json:"lastMessage"`
+	LatencyMs   float64              `json:"latencyMs"`
+	Messages    uint64               `json:"messages"`
+	Conflicts   uint64               `json:"conflicts"`
+	Retries     int64                `json:"retries"`
+	Healthy     bool                 `json:"healthy"`
+	Preferred   bool                 `json:"preferred"`
+}
+
+type Status struct {
+	NextSequenceNumber arbutil.MessageIndex `json:"nextSequenceNumber"`
+	PendingMessages    int                  `json:"pendingMessages"`
+	Gaps               uint64               `json:"gaps"`
+	Conflicts          uint64               `json:"conflicts"`
+	Upstreams          []UpstreamStatus     `json:"upstreams"`
+}
+
+type upstream struct {
+	url         string
+	head        arbutil.MessageIndex
+	lastMessage time.Time
+	latency     time.Duration // moving average of the delay behind the first upstream to deliver each message
+	messages    uint64
+	conflicts   uint64
+}
+
+type seenMessage struct {
+	hash      common.Hash
+	firstSeen time.Time
+	upstream  int
+}
+
+type pendingMessage struct {
+	message  *broadcaster.BroadcastFeedMessage
+	upstream int
+	received time.Time
+}
+
+// feedTracker dedups the messages received from several upstream feeds and puts
+// them back in sequence number order, waiting a while for missing messages before
+// skipping the gap. Each message is forwarded as soon as any upstream delivers it,
+// so the fastest upstream is followed, and a lagging upstream's messages are never
+// forwarded again. It also tracks the health of each upstream, and detects
+// upstreams disagreeing on the message at a sequence number.
+type feedTracker struct {
+	mutex     sync.Mutex
+	config    *Config
+	upstreams []*upstream
+
+	started bool
+	next    arbutil.MessageIndex // next sequence number to forward
+	pending map[arbutil.MessageIndex]*pendingMessage
+	seen    map[arbutil.MessageIndex]*seenMessage
+
+	gaps      uint64
+	conflicts uint64
+}
+
+func newFeedTracker(config *Config, urls []string) *feedTracker {
+	var upstreams []*upstream
+	for _, url := range urls {
+		upstreams = append(upstreams, &upstream{url: url})
+	}
+	return &feedTracker{
+		config:    config,
+		upstreams: upstreams,
+		pending:   make(map[arbutil.MessageIndex]*pendingMessage),
+		seen:      make(map[arbutil.MessageIndex]*seenMessage),
+	}
+}
+
+// receive records a message from an upstream, returning the messages that can
+// now be forwarded in order.
+func (t *feedTracker) receive(upstreamIndex int, msg *broadcaster.BroadcastFeedMessage, now time.Time) []*broadcaster.BroadcastFeedMessage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	u := t.upstreams[upstreamIndex]
+	u.messages++
+	u.lastMessage = now
+	if msg.SequenceNumber > u.head {
+		u.head = msg.SequenceNumber
+	}
+
+	hash := msg.Hash()
+	seen, exists := t.seen[msg.SequenceNumber]
+	if exists {
+		u.latency += time.Duration(latencySampleWeight * float64(now.Sub(seen.firstSeen)-u.latency))
+		if seen.hash != hash {
+			t.conflicts++
+			u.conflicts++
+			conflictCounter.Inc(1)
+			log.Error(
+				"Relay upstreams disagree on sequencer feed message",
+				"seqNum", msg.SequenceNumber,
+				"upstream", u.url, "hash", hash,
+				"firstUpstream", t.upstreams[seen.upstream].url, "firstHash", seen.hash,
+			)
+			// Messages not yet forwarded are taken from the preferred upstream.
+			if pending, isPending := t.pending[msg.SequenceNumber]; isPending && upstreamIndex == t.preferredUpstream(now) {
+				pending.message = msg
+				pending.upstream = upstreamIndex
+			}
+		}
+	} else {
+		t.seen[msg.SequenceNumber] = &seenMessage{hash: hash, firstSeen: now, upstream: upstreamIndex}
+		u.latency -= time.Duration(latencySampleWeight * float64(u.latency))
+	}
+
+	if !t.started {
+		t.started = true
+		t.next = msg.SequenceNumber
+	}
+	if msg.SequenceNumber < t.next {
+		// Already forwarded or skipped past
+		return nil
+	}
+	if _, isPending := t.pending[msg.SequenceNumber]; isPending {
+		return nil
+	}
+	t.pending[msg.SequenceNumber] = &pendingMessage{message: msg, upstream: upstreamIndex, received: now}
+	if msg.SequenceNumber != t.next && len(t.pending) > t.config.MaxPendingMessages {
+		return t.skipGap()
+	}
+	return t.popReady()
+}
+
+// checkGap skips a gap in the sequence numbers once messages after it have been
+// waiting for longer than the configured maximum.
+func (t *feedTracker) checkGap(now time.Time) []*broadcaster.BroadcastFeedMessage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var oldest time.Time
+	for _, pending := range t.pending {
+		if oldest.IsZero() || pending.received.Before(oldest) {
+			oldest = pending.received
+		}
+	}
+	if oldest.IsZero() || now.Sub(oldest) < t.config.MaxGapWait {
+		return nil
+	}
+	return t.skipGap()
+}
+
+// skipGap moves past the missing messages up to the first pending one.
+// The mutex must be held.
+func (t *feedTracker) skipGap() []*broadcaster.BroadcastFeedMessage {
+	if len(t.pending) == 0 {
+		return nil
+	}
+	first := arbutil.MessageIndex(math.MaxUint64)
+	for seqNum := range t.pending {
+		if seqNum < first {
+			first = seqNum
+		}
+	}
+	if first > t.next {
+		t.gaps++
+		gapCounter.Inc(1)
+		skippedCounter.Inc(int64(first - t.next))
+		log.Warn("Gap in relayed sequencer feed, no upstream sent the missing messages", "from", t.next, "to", first-1)
+		t.next = first
+	}
+	return t.popReady()
+}
+
+// popReady removes and returns the pending messages continuing from the next
+// sequence number. The mutex must be held.
+func (t *feedTracker) popReady() []*broadcaster.BroadcastFeedMessage {
+	var ready []*broadcaster.BroadcastFeedMessage
+	for {
+		pending, exists := t.pending[t.next]
+		if !exists {
+			forwardedMeter.Mark(int64(len(ready)))
+			pendingGauge.Update(int64(len(t.pending)))
+			return ready
+		}
+		delete(t.pending, t.next)
+		ready = append(ready, pending.message)
+		t.next++
+	}
+}
+
+// prune forgets the messages seen long enough ago that they can no longer be
+// compared against the other upstreams.
+func (t *feedTracker) prune(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	expiry := now.Add(-RECENT_FEED_ITEM_TTL)
+	for seqNum, seen := range t.seen {
+		if seen.firstSeen.Before(expiry) && seqNum < t.next {
+			delete(t.seen, seqNum)
+		}
+	}
+	t.updateMetrics(now)
+}
+
+// updateMetrics updates the upstreams' health metrics. The mutex must be held.
+func (t *feedTracker) updateMetrics(now time.Time) {
+	bestHead := t.bestHead()
+	var healthy, maxLag int64
+	for _, u := range t.upstreams {
+		if t.isHealthy(u, bestHead, now) {
+			healthy++
+		}
+		if u.messages > 0 && int64(bestHead-u.head) > maxLag {
+			maxLag = int64(bestHead - u.head)
+		}
+	}
+	healthyUpstreamsGauge.Update(healthy)
+	upstreamLagGauge.Update(maxLag)
+}
+
+// bestHead returns the highest sequence number received from any upstream.
+// The mutex must be held.
+func (t *feedTracker) bestHead() arbutil.MessageIndex {
+	var bestHead arbutil.MessageIndex
+	for _, u := range t.upstreams {
+		if u.head > bestHead {
+			bestHead = u.head
+		}
+	}
+	return bestHead
+}
+
+// isHealthy returns whether the upstream is keeping up with the best upstream.
+// The mutex must be held.
+func (t *feedTracker) isHealthy(u *upstream, bestHead arbutil.MessageIndex, now time.Time) bool {
+	if u.messages == 0 {
+		return false
+	}
+	if u.head >= bestHead {
+		return true
+	}
+	if uint64(bestHead-u.head) > t.config.MaxUpstreamLag {
+		return false
+	}
+	// Behind and not sending anything
+	return now.Sub(u.lastMessage) < t.config.UpstreamTimeout
+}
+
+// preferredUpstream returns the healthy upstream with the lowest latency, or
+// failing that the one furthest ahead. The mutex must be held.
+func (t *feedTracker) preferredUpstream(now time.Time) int {
+	bestHead := t.bestHead()
+	preferred := -1
+	for i, u := range t.upstreams {
+		if !t.isHealthy(u, bestHead, now) {
+			continue
+		}
+		if preferred < 0 || u.latency < t.upstreams[preferred].latency {
+			preferred = i
+		}
+	}
+	if preferred >= 0 {
+		return preferred
+	}
+	for i, u := range t.upstreams {
+		if preferred < 0 || u.head > t.upstreams[preferred].head {
+			preferred = i
+		}
+	}
+	return preferred
+}
+
+func (t *feedTracker) status(now time.Time) Status {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	bestHead := t.bestHead()
+	preferred := t.preferredUpstream(now)
+	status := Status{
+		NextSequenceNumber: t.next,
+		PendingMessages:    len(t.pending),
+		Gaps:               t.gaps,
+		Conflicts:          t.conflicts,
+	}
+	for i, u := range t.upstreams {
+		status.Upstreams = append(status.Upstreams, UpstreamStatus{
+			URL:         u.url,
+			Head:        u.head,
+			LastMessage: u.lastMessage,
+			LatencyMs:   float64(u.latency) / float64(time.Millisecond),
+			Messages:    u.messages,
+			Conflicts:   u.conflicts,
+			Healthy:     t.isHealthy(u, bestHead, now),
+			Preferred:   i == preferred,
+		})
+	}
+	return status
+}
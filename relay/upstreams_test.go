@@ -0,0 +1,127 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func feedMessage(seqNum arbutil.MessageIndex, delayedMessagesRead uint64) *broadcaster.BroadcastFeedMessage {
+	return &broadcaster.BroadcastFeedMessage{
+		SequenceNumber: seqNum,
+		Message:        arbstate.MessageWithMetadata{DelayedMessagesRead: delayedMessagesRead},
+	}
+}
+
+func expectForwarded(t *testing.T, forwarded []*broadcaster.BroadcastFeedMessage, expected ...arbutil.MessageIndex) {
+	t.Helper()
+	if len(forwarded) != len(expected) {
+		t.Fatal("expected to forward", expected, "got", len(forwarded), "messages")
+	}
+	for i, msg := range forwarded {
+		if msg.SequenceNumber != expected[i] {
+			t.Fatal("expected to forward", expected, "got", msg.SequenceNumber, "at", i)
+		}
+	}
+}
+
+func TestFeedTrackerDedupsAndReorders(t *testing.T) {
+	config := TestConfig
+	tracker := newFeedTracker(&config, []string{"a", "b"})
+	now := time.Now()
+
+	expectForwarded(t, tracker.receive(0, feedMessage(5, 0), now), 5)
+	expectForwarded(t, tracker.receive(1, feedMessage(5, 0), now))
+	// Message 7 arrives before 6, and waits for it
+	expectForwarded(t, tracker.receive(0, feedMessage(7, 0), now))
+	expectForwarded(t, tracker.receive(1, feedMessage(6, 0), now), 6, 7)
+	expectForwarded(t, tracker.receive(1, feedMessage(7, 0), now))
+
+	// Nobody sends message 8, so it's skipped once 9 has waited long enough
+	expectForwarded(t, tracker.receive(0, feedMessage(9, 0), now))
+	expectForwarded(t, tracker.checkGap(now.Add(config.MaxGapWait/2)))
+	expectForwarded(t, tracker.checkGap(now.Add(config.MaxGapWait)), 9)
+	expectForwarded(t, tracker.receive(1, feedMessage(8, 0), now))
+
+	status := tracker.status(now)
+	if status.NextSequenceNumber != 10 || status.Gaps != 1 || status.PendingMessages != 0 || status.Conflicts != 0 {
+		t.Fatal("unexpected status", status)
+	}
+}
+
+func TestFeedTrackerSkipsGapWhenTooManyPending(t *testing.T) {
+	config := TestConfig
+	config.MaxPendingMessages = 3
+	tracker := newFeedTracker(&config, []string{"a"})
+	now := time.Now()
+
+	expectForwarded(t, tracker.receive(0, feedMessage(0, 0), now), 0)
+	for i := arbutil.MessageIndex(2); i < 5; i++ {
+		expectForwarded(t, tracker.receive(0, feedMessage(i, 0), now))
+	}
+	expectForwarded(t, tracker.receive(0, feedMessage(5, 0), now), 2, 3, 4, 5)
+}
+
+func TestFeedTrackerDetectsConflicts(t *testing.T) {
+	config := TestConfig
+	tracker := newFeedTracker(&config, []string{"a", "b"})
+	now := time.Now()
+
+	expectForwarded(t, tracker.receive(0, feedMessage(0, 0), now), 0)
+	expectForwarded(t, tracker.receive(1, feedMessage(0, 1), now))
+	status := tracker.status(now)
+	if status.Conflicts != 1 || status.Upstreams[1].Conflicts != 1 || status.Upstreams[0].Conflicts != 0 {
+		t.Fatal("expected a conflict from the second upstream", status)
+	}
+}
+
+func TestFeedTrackerUpstreamHealth(t *testing.T) {
+	config := TestConfig
+	tracker := newFeedTracker(&config, []string{"a", "b"})
+	now := time.Now()
+
+	// Upstream b is slower to deliver the same messages
+	for i := arbutil.MessageIndex(0); i < 5; i++ {
+		expectForwarded(t, tracker.receive(0, feedMessage(i, 0), now), i)
+		expectForwarded(t, tracker.receive(1, feedMessage(i, 0), now.Add(50*time.Millisecond)))
+	}
+	status := tracker.status(now)
+	if !status.Upstreams[0].Healthy || !status.Upstreams[1].Healthy || !status.Upstreams[0].Preferred || status.Upstreams[1].Preferred {
+		t.Fatal("expected both upstreams healthy and the faster one preferred", status)
+	}
+	if status.Upstreams[1].LatencyMs <= status.Upstreams[0].LatencyMs {
+		t.Fatal("expected the second upstream to have higher latency", status)
+	}
+
+	// Upstream b stops sending messages, so falls behind
+	for i := arbutil.MessageIndex(5); i < 5+arbutil.MessageIndex(config.MaxUpstreamLag)+2; i++ {
+		expectForwarded(t, tracker.receive(0, feedMessage(i, 0), now), i)
+	}
+	status = tracker.status(now)
+	if !status.Upstreams[0].Healthy || status.Upstreams[1].Healthy {
+		t.Fatal("expected the lagging upstream to be unhealthy", status)
+	}
+
+	// Its late messages aren't forwarded again
+	expectForwarded(t, tracker.receive(1, feedMessage(5, 0), now.Add(RECENT_FEED_ITEM_TTL*2)))
+	tracker.prune(now.Add(RECENT_FEED_ITEM_TTL * 2))
+	expectForwarded(t, tracker.receive(1, feedMessage(6, 0), now.Add(RECENT_FEED_ITEM_TTL*2)))
+
+	// An upstream behind but still sending stays healthy until it's silent for too long
+	tracker = newFeedTracker(&config, []string{"a", "b"})
+	expectForwarded(t, tracker.receive(1, feedMessage(0, 0), now), 0)
+	expectForwarded(t, tracker.receive(0, feedMessage(0, 0), now))
+	expectForwarded(t, tracker.receive(0, feedMessage(1, 0), now), 1)
+	if status := tracker.status(now); !status.Upstreams[1].Healthy {
+		t.Fatal("expected upstream just behind to be healthy", status)
+	}
+	if status := tracker.status(now.Add(config.UpstreamTimeout)); status.Upstreams[1].Healthy {
+		t.Fatal("expected upstream behind and silent to be unhealthy", status)
+	}
+}
@@ -5,6 +5,7 @@ package arbtest
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -14,6 +15,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/offchainlabs/nitro/arbnode"
 	"github.com/offchainlabs/nitro/broadcastclient"
@@ -81,21 +83,30 @@ func TestRelayedSequencerFeed(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	feedSigningKey, err := crypto.GenerateKey()
+	Require(t, err)
+	feedSigner := crypto.PubkeyToAddress(feedSigningKey.PublicKey).Hex()
+
 	seqNodeConfig := arbnode.ConfigDefaultL2Test()
 	seqNodeConfig.Feed.Output = *newBroadcasterConfigTest(0)
+	seqNodeConfig.Feed.Output.SigningKey = hex.EncodeToString(crypto.FromECDSA(feedSigningKey))
 	l2info1, nodeA, client1 := CreateTestL2WithConfig(t, ctx, nil, seqNodeConfig, true)
 
 	relayServerConf := *newBroadcasterConfigTest(0)
 	port := nodeA.BroadcastServer.ListenerAddr().(*net.TCPAddr).Port
 	relayClientConf := *newBroadcastClientConfigTest(port)
+	relayClientConf.Verify.Signer = feedSigner
 
-	relay := relay.NewRelay(relayServerConf, relayClientConf)
-	err := relay.Start(ctx)
+	relay, err := relay.NewRelay(relayServerConf, relayClientConf, &relay.TestConfig)
+	Require(t, err)
+	err = relay.Start(ctx)
 	Require(t, err)
 
+	// The relay forwards the sequencer's signatures for the node to verify.
 	clientNodeConfig := arbnode.ConfigDefaultL2Test()
 	port = relay.GetListenerAddr().(*net.TCPAddr).Port
 	clientNodeConfig.Feed.Input = *newBroadcastClientConfigTest(port)
+	clientNodeConfig.Feed.Input.Verify.Signer = feedSigner
 	_, nodeC, client3 := CreateTestL2WithConfig(t, ctx, nil, clientNodeConfig, false)
 
 	l2info1.GenerateAccount("User2")
@@ -5,7 +5,6 @@ package wsbroadcastserver
 
 import (
 	"context"
-	"encoding/json"
 	"math/rand"
 	"net"
 	"strconv"
@@ -15,8 +14,8 @@ import (
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/gobwas/ws"
-	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
+	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/util/stopwaiter"
 )
 
@@ -37,23 +36,57 @@ type ClientConnection struct {
 
 	lastHeardUnix int64
 	out           chan []byte
+
+	requestedSeqNum arbutil.MessageIndex
+	compression     bool         // whether permessage-deflate was negotiated
+	binary          bool         // whether the binary encoding was negotiated
+	filter          ClientFilter // if not nil, the filter the client requested
+
+	// If not nil, run on the client's goroutine before it's sent any broadcasts
+	catchup func(ctx context.Context) error
 }
 
-func NewClientConnection(conn net.Conn, desc *netpoll.Desc, clientManager *ClientManager) *ClientConnection {
+func NewClientConnection(conn net.Conn, desc *netpoll.Desc, clientManager *ClientManager, requestedSeqNum arbutil.MessageIndex, compression bool, binary bool, filter ClientFilter) *ClientConnection {
 	return &ClientConnection{
-		conn:          conn,
-		desc:          desc,
-		Name:          conn.RemoteAddr().String() + strconv.Itoa(rand.Intn(10)),
-		clientManager: clientManager,
-		lastHeardUnix: time.Now().Unix(),
-		out:           make(chan []byte, MaxSendQueue),
+		conn:            conn,
+		desc:            desc,
+		Name:            conn.RemoteAddr().String() + strconv.Itoa(rand.Intn(10)),
+		clientManager:   clientManager,
+		lastHeardUnix:   time.Now().Unix(),
+		out:             make(chan []byte, MaxSendQueue),
+		requestedSeqNum: requestedSeqNum,
+		compression:     compression,
+		binary:          binary,
+		filter:          filter,
 	}
 }
 
+// RequestedSeqNum is the first sequence number the client asked to be sent on
+// connecting, or 0 if it didn't ask for any.
+func (cc *ClientConnection) RequestedSeqNum() arbutil.MessageIndex {
+	return cc.requestedSeqNum
+}
+
+// CatchupInBackground has the client sent messages by catchup on its own
+// goroutine once it's started, before any broadcasts queued for it meanwhile,
+// so that catching up a client far behind doesn't hold up the others. The
+// client is disconnected if catchup fails, or if too many broadcasts queue up
+// while it runs.
+func (cc *ClientConnection) CatchupInBackground(catchup func(ctx context.Context) error) {
+	cc.catchup = catchup
+}
+
 func (cc *ClientConnection) Start(parentCtx context.Context) {
 	cc.StopWaiter.Start(parentCtx)
 	cc.LaunchThread(func(ctx context.Context) {
 		defer close(cc.out)
+		if cc.catchup != nil {
+			if err := cc.catchup(ctx); err != nil {
+				log.Warn("error catching up client", "client", cc.Name, "err", err)
+				cc.removeAndDrain(ctx)
+				return
+			}
+		}
 		for {
 			select {
 			case <-ctx.Done():
@@ -62,21 +95,26 @@ func (cc *ClientConnection) Start(parentCtx context.Context) {
 				err := cc.writeRaw(data)
 				if err != nil {
 					log.Error("error writing data to client", "client", cc.Name, "err", err)
-					cc.clientManager.Remove(cc)
-					for {
-						// Consume and ignore channel data until client properly stopped to prevent deadlock
-						select {
-						case <-ctx.Done():
-							return
-						case <-cc.out:
-						}
-					}
+					cc.removeAndDrain(ctx)
+					return
 				}
 			}
 		}
 	})
 }
 
+func (cc *ClientConnection) removeAndDrain(ctx context.Context) {
+	cc.clientManager.Remove(cc)
+	for {
+		// Consume and ignore channel data until client properly stopped to prevent deadlock
+		select {
+		case <-ctx.Done():
+			return
+		case <-cc.out:
+		}
+	}
+}
+
 func (cc *ClientConnection) StopAndWait() {
 	if !cc.Started() {
 		// If client connection never started, need to close channel
@@ -108,28 +146,39 @@ func (cc *ClientConnection) readRequest(ctx context.Context, timeout time.Durati
 
 	atomic.StoreInt64(&cc.lastHeardUnix, time.Now().Unix())
 
-	return ReadData(ctx, cc.conn, nil, timeout, ws.StateServerSide)
+	return ReadData(ctx, cc.conn, nil, timeout, ws.StateServerSide, cc.compression)
 }
 
-func (cc *ClientConnection) Write(x interface{}) error {
-	writer := wsutil.NewWriter(cc.conn, ws.StateServerSide, ws.OpText)
-	encoder := json.NewEncoder(writer)
-
-	cc.ioMutex.Lock()
-	defer cc.ioMutex.Unlock()
+// filterKey identifies the messages the client is sent, so that serialized
+// messages can be shared by clients with the same key.
+func (cc *ClientConnection) filterKey() string {
+	if cc.filter == nil {
+		return ""
+	}
+	return cc.filter.String()
+}
 
-	if err := encoder.Encode(x); err != nil {
+func (cc *ClientConnection) Write(x interface{}) error {
+	if cc.filter != nil {
+		x = cc.filter.Filter(x)
+		if x == nil {
+			return nil
+		}
+	}
+	data, err := serializeMessage(x, cc.compression, cc.binary)
+	if err != nil {
 		return err
 	}
 
-	return writer.Flush()
+	return cc.writeRaw(data)
 }
 
 func (cc *ClientConnection) writeRaw(p []byte) error {
 	cc.ioMutex.Lock()
 	defer cc.ioMutex.Unlock()
 
-	_, err := cc.conn.Write(p)
+	n, err := cc.conn.Write(p)
+	bytesSentMeter.Mark(int64(n))
 
 	return err
 }
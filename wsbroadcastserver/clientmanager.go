@@ -5,22 +5,38 @@ package wsbroadcastserver
 
 import (
 	"bytes"
+	"compress/flate"
 	"context"
+	"encoding"
 	"encoding/json"
+	"io"
 	"net"
 	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/util/stopwaiter"
 	"github.com/pkg/errors"
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws-examples/src/gopool"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
 )
 
+var (
+	clientsConnectedGauge        = metrics.NewRegisteredGauge("arb/feed/clients/connected", nil)
+	clientsRejectedCounter       = metrics.NewRegisteredCounter("arb/feed/clients/rejected", nil)
+	clientsSlowDisconnectCounter = metrics.NewRegisteredCounter("arb/feed/clients/disconnected/slow", nil)
+	clientsTimedOutCounter       = metrics.NewRegisteredCounter("arb/feed/clients/disconnected/timeout", nil)
+	clientQueueHistogram         = metrics.NewRegisteredHistogram("arb/feed/clients/queue", nil, metrics.NewExpDecaySample(1028, 0.015))
+	broadcastsMeter              = metrics.NewRegisteredMeter("arb/feed/broadcasts", nil)
+	bytesSentMeter               = metrics.NewRegisteredMeter("arb/feed/bytes/sent", nil)
+)
+
 /* Protocol-specific client catch-up logic can be injected using this interface. */
 type CatchupBuffer interface {
 	OnRegisterClient(context.Context, *ClientConnection) error
@@ -28,6 +44,19 @@ type CatchupBuffer interface {
 	GetMessageCount() int
 }
 
+// ClientFilter selects what a client which requested it is sent of each message.
+type ClientFilter interface {
+	// Filter returns what to send the client in place of the message, or nil to
+	// send nothing.
+	Filter(interface{}) interface{}
+	// String identifies the filter. Clients with filters identified by the same
+	// string are sent the same messages.
+	String() string
+}
+
+// ClientFilterParser parses the filter requested by a client on connecting.
+type ClientFilterParser func(string) (ClientFilter, error)
+
 // ClientManager manages client connections
 type ClientManager struct {
 	stopwaiter.StopWaiter
@@ -40,6 +69,8 @@ type ClientManager struct {
 	clientAction  chan ClientConnectionAction
 	settings      BroadcasterConfig
 	catchupBuffer CatchupBuffer
+
+	connectionLimiter *connectionLimiter
 }
 
 type ClientConnectionAction struct {
@@ -47,7 +78,7 @@ type ClientConnectionAction struct {
 	create bool
 }
 
-func NewClientManager(poller netpoll.Poller, settings BroadcasterConfig, catchupBuffer CatchupBuffer) *ClientManager {
+func NewClientManager(poller netpoll.Poller, settings BroadcasterConfig, catchupBuffer CatchupBuffer, connectionLimiter *connectionLimiter) *ClientManager {
 	return &ClientManager{
 		poller:        poller,
 		pool:          gopool.NewPool(settings.Workers, settings.Queue, 1),
@@ -56,6 +87,8 @@ func NewClientManager(poller netpoll.Poller, settings BroadcasterConfig, catchup
 		clientAction:  make(chan ClientConnectionAction, 128),
 		settings:      settings,
 		catchupBuffer: catchupBuffer,
+
+		connectionLimiter: connectionLimiter,
 	}
 }
 
@@ -66,15 +99,15 @@ func (cm *ClientManager) registerClient(ctx context.Context, clientConnection *C
 
 	clientConnection.Start(ctx)
 	cm.clientPtrMap[clientConnection] = true
-	atomic.AddInt32(&cm.clientCount, 1)
+	clientsConnectedGauge.Update(int64(atomic.AddInt32(&cm.clientCount, 1)))
 
 	return nil
 }
 
 // Register registers new connection as a Client.
-func (cm *ClientManager) Register(conn net.Conn, desc *netpoll.Desc) *ClientConnection {
+func (cm *ClientManager) Register(conn net.Conn, desc *netpoll.Desc, requestedSeqNum arbutil.MessageIndex, compression bool, binary bool, filter ClientFilter) *ClientConnection {
 	createClient := ClientConnectionAction{
-		NewClientConnection(conn, desc, cm),
+		NewClientConnection(conn, desc, cm, requestedSeqNum, compression, binary, filter),
 		true,
 	}
 
@@ -103,8 +136,9 @@ func (cm *ClientManager) removeClientImpl(clientConnection *ClientConnection) {
 	if err != nil {
 		log.Warn("Failed to close client connection", "err", err)
 	}
+	cm.connectionLimiter.release(remoteIP(clientConnection.conn))
 
-	atomic.AddInt32(&cm.clientCount, -1)
+	clientsConnectedGauge.Update(int64(atomic.AddInt32(&cm.clientCount, -1)))
 }
 
 func (cm *ClientManager) removeClient(clientConnection *ClientConnection) {
@@ -133,33 +167,106 @@ func (cm *ClientManager) Broadcast(bm interface{}) {
 	cm.broadcastChan <- bm
 }
 
-func (cm *ClientManager) doBroadcast(bm interface{}) error {
-	if err := cm.catchupBuffer.OnDoBroadcast(bm); err != nil {
-		return err
+// serializeMessage encodes the message as a websocket frame, compressed with
+// permessage-deflate if compress is set. If binary is set and the message
+// implements encoding.BinaryMarshaler, it's sent in a binary frame with that
+// encoding, and otherwise as JSON in a text frame.
+func serializeMessage(bm interface{}, compress bool, binary bool) ([]byte, error) {
+	var binaryData []byte
+	op := ws.OpText
+	if marshaler, ok := bm.(encoding.BinaryMarshaler); ok && binary {
+		var err error
+		binaryData, err = marshaler.MarshalBinary()
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to encode message")
+		}
+		op = ws.OpBinary
 	}
-
 	var buf bytes.Buffer
-	writer := wsutil.NewWriter(&buf, ws.StateServerSide, ws.OpText)
-	encoder := json.NewEncoder(writer)
-	if err := encoder.Encode(bm); err != nil {
-		return errors.Wrap(err, "unable to encode message")
+	writer := wsutil.NewWriter(&buf, ws.StateServerSide, op)
+	var messageWriter io.Writer = writer
+	var flateWriter *wsflate.Writer
+	if compress {
+		var msgState wsflate.MessageState
+		msgState.SetCompressed(true)
+		writer.SetExtensions(&msgState)
+		flateWriter = wsflate.NewWriter(writer, func(w io.Writer) wsflate.Compressor {
+			// Only fails for an invalid level
+			compressor, _ := flate.NewWriter(w, flate.BestCompression)
+			return compressor
+		})
+		messageWriter = flateWriter
+	}
+	if op == ws.OpBinary {
+		if _, err := messageWriter.Write(binaryData); err != nil {
+			return nil, errors.Wrap(err, "unable to write message")
+		}
+	} else {
+		encoder := json.NewEncoder(messageWriter)
+		if err := encoder.Encode(bm); err != nil {
+			return nil, errors.Wrap(err, "unable to encode message")
+		}
+	}
+	if flateWriter != nil {
+		if err := flateWriter.Flush(); err != nil {
+			return nil, errors.Wrap(err, "unable to compress message")
+		}
 	}
 	if err := writer.Flush(); err != nil {
-		return errors.Wrap(err, "unable to flush message")
+		return nil, errors.Wrap(err, "unable to flush message")
 	}
+	return buf.Bytes(), nil
+}
 
+func (cm *ClientManager) doBroadcast(bm interface{}) error {
+	if err := cm.catchupBuffer.OnDoBroadcast(bm); err != nil {
+		return err
+	}
+	broadcastsMeter.Mark(1)
+
+	// Each message is serialized at most once per filter and form, and shared by
+	// all clients receiving it
+	type serializedKey struct {
+		filter     string
+		compressed bool
+		binary     bool
+	}
+	serialized := make(map[serializedKey][]byte)
 	clientDeleteList := make([]*ClientConnection, 0, len(cm.clientPtrMap))
 	for client := range cm.clientPtrMap {
+		clientQueueHistogram.Update(int64(len(client.out)))
 		if len(client.out) == MaxSendQueue {
 			// Queue for client too backed up, so delete after going through all other clients
 			clientDeleteList = append(clientDeleteList, client)
-		} else {
-			client.out <- buf.Bytes()
+			continue
+		}
+		key := serializedKey{client.filterKey(), client.compression, client.binary}
+		data, exists := serialized[key]
+		if !exists {
+			message := bm
+			if client.filter != nil {
+				message = client.filter.Filter(bm)
+			}
+			if message != nil {
+				var err error
+				data, err = serializeMessage(message, client.compression, client.binary)
+				if err != nil {
+					// Skip every client with this key, rather than only those
+					// not yet sent the message
+					log.Error("error serializing message for clients", "filter", key.filter, "compressed", key.compressed, "binary", key.binary, "err", err)
+					data = nil
+				}
+			}
+			serialized[key] = data
+		}
+		if data != nil {
+			client.out <- data
 		}
 	}
 
 	for _, client := range clientDeleteList {
 		log.Warn("disconnecting client, queue too large", "client", client.Name)
+		clientsSlowDisconnectCounter.Inc(1)
 		cm.Remove(client)
 	}
 
@@ -181,6 +288,7 @@ func (cm *ClientManager) verifyClients() {
 
 	for _, deadClient := range deadClientList {
 		log.Debug("disconnecting because connection timed out", "client", deadClient.Name)
+		clientsTimedOutCounter.Inc(1)
 		cm.Remove(deadClient)
 	}
 
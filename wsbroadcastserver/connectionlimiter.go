@@ -0,0 +1,245 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/time/rate"
+)
+
+type ConnectionLimiterConfig struct {
+	MaxClients          int      `koanf:"max-clients"`
+	MaxClientsPerIP     int      `koanf:"max-clients-per-ip"`
+	ConnectionRate      float64  `koanf:"connection-rate"`
+	ConnectionRatePerIP float64  `koanf:"connection-rate-per-ip"`
+	AllowList           []string `koanf:"allow-list"`
+	DenyList            []string `koanf:"deny-list"`
+}
+
+func ConnectionLimiterConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Int(prefix+".max-clients", DefaultConnectionLimiterConfig.MaxClients, "maximum number of clients connected at once (0 = no limit)")
+	f.Int(prefix+".max-clients-per-ip", DefaultConnectionLimiterConfig.MaxClientsPerIP, "maximum number of clients connected at once from each IP (0 = no limit)")
+	f.Float64(prefix+".connection-rate", DefaultConnectionLimiterConfig.ConnectionRate, "maximum new connections accepted per second (0 = no limit)")
+	f.Float64(prefix+".connection-rate-per-ip", DefaultConnectionLimiterConfig.ConnectionRatePerIP, "maximum new connections accepted per second from each IP (0 = no limit)")
+	f.StringSlice(prefix+".allow-list", DefaultConnectionLimiterConfig.AllowList, "if set, only accept connections from these IPs or CIDR ranges")
+	f.StringSlice(prefix+".deny-list", DefaultConnectionLimiterConfig.DenyList, "reject connections from these IPs or CIDR ranges")
+}
+
+var DefaultConnectionLimiterConfig = ConnectionLimiterConfig{
+	MaxClients:          0,
+	MaxClientsPerIP:     0,
+	ConnectionRate:      0,
+	ConnectionRatePerIP: 0,
+	AllowList:           []string{},
+	DenyList:            []string{},
+}
+
+// connectionLimiter decides whether to accept new connections, before they are
+// upgraded to WebSocket connections, so that rejected clients can be sent an
+// HTTP status explaining why.
+type connectionLimiter struct {
+	mutex  sync.Mutex
+	config *ConnectionLimiterConfig
+	allow  []*net.IPNet
+	deny   []*net.IPNet
+
+	clients      int
+	clientsPerIP map[string]int
+
+	rateLimiter      *rate.Limiter
+	ipRateLimiters   map[string]*ipRateLimiter
+	ipRateRefill     time.Duration // time for an IP's rate limiter to refill
+	lastRateLimitGC  time.Time
+	ipRateLimitBurst int
+}
+
+type ipRateLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+func parseIPNets(entries []string) ([]*net.IPNet, error) {
+	var ipNets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			ipNets = append(ipNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets, nil
+}
+
+// rateBurst allows connections to be made at once up to one second's worth of
+// the rate, and at least one.
+func rateBurst(connectionRate float64) int {
+	return int(math.Max(1, math.Ceil(connectionRate)))
+}
+
+func newConnectionLimiter(config *ConnectionLimiterConfig) (*connectionLimiter, error) {
+	if config.MaxClients < 0 || config.MaxClientsPerIP < 0 || config.ConnectionRate < 0 || config.ConnectionRatePerIP < 0 {
+		return nil, fmt.Errorf("invalid connection limits %+v", *config)
+	}
+	allow, err := parseIPNets(config.AllowList)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allow list: %w", err)
+	}
+	deny, err := parseIPNets(config.DenyList)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deny list: %w", err)
+	}
+	l := &connectionLimiter{
+		config:         config,
+		allow:          allow,
+		deny:           deny,
+		clientsPerIP:   make(map[string]int),
+		ipRateLimiters: make(map[string]*ipRateLimiter),
+	}
+	if config.ConnectionRate > 0 {
+		l.rateLimiter = rate.NewLimiter(rate.Limit(config.ConnectionRate), rateBurst(config.ConnectionRate))
+	}
+	if config.ConnectionRatePerIP > 0 {
+		l.ipRateLimitBurst = rateBurst(config.ConnectionRatePerIP)
+		l.ipRateRefill = time.Duration(float64(l.ipRateLimitBurst) / config.ConnectionRatePerIP * float64(time.Second))
+	}
+	return l, nil
+}
+
+func containsIP(ipNets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range ipNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func rejection(status int, reason string, retryAfter time.Duration) error {
+	options := []ws.RejectOption{
+		ws.RejectionStatus(status),
+		ws.RejectionReason(reason),
+	}
+	if retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		options = append(options, ws.RejectionHeader(ws.HandshakeHeaderHTTP(http.Header{
+			"Retry-After": []string{strconv.Itoa(seconds)},
+		})))
+	}
+	return ws.RejectConnectionError(options...)
+}
+
+// admit returns nil if a connection from the IP should be accepted, counting it
+// as connected until it is released. Otherwise it returns an error to reject the
+// WebSocket upgrade with.
+func (l *connectionLimiter) admit(ip net.IP, now time.Time) error {
+	if len(l.allow) > 0 && !containsIP(l.allow, ip) {
+		return rejection(http.StatusForbidden, "forbidden", 0)
+	}
+	if containsIP(l.deny, ip) {
+		return rejection(http.StatusForbidden, "forbidden", 0)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	key := ip.String()
+	if l.config.MaxClients > 0 && l.clients >= l.config.MaxClients {
+		return rejection(http.StatusServiceUnavailable, "too many clients connected", 0)
+	}
+	if l.config.MaxClientsPerIP > 0 && l.clientsPerIP[key] >= l.config.MaxClientsPerIP {
+		return rejection(http.StatusTooManyRequests, "too many connections from your IP", 0)
+	}
+	if l.ipRateRefill > 0 {
+		l.gcIPRateLimiters(now)
+		ipLimiter, exists := l.ipRateLimiters[key]
+		if !exists {
+			ipLimiter = &ipRateLimiter{limiter: rate.NewLimiter(rate.Limit(l.config.ConnectionRatePerIP), l.ipRateLimitBurst)}
+			l.ipRateLimiters[key] = ipLimiter
+		}
+		ipLimiter.lastUsed = now
+		if !ipLimiter.limiter.AllowN(now, 1) {
+			return rejection(http.StatusTooManyRequests, "too many new connections from your IP", time.Duration(float64(time.Second)/l.config.ConnectionRatePerIP))
+		}
+	}
+	// Checked last so that connections rejected by the per IP limits don't use
+	// up the global rate.
+	if l.rateLimiter != nil && !l.rateLimiter.AllowN(now, 1) {
+		return rejection(http.StatusServiceUnavailable, "too many new connections", time.Second)
+	}
+
+	l.clients++
+	l.clientsPerIP[key]++
+	return nil
+}
+
+// release stops counting a connection admitted from the IP.
+func (l *connectionLimiter) release(ip net.IP) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	key := ip.String()
+	if l.clientsPerIP[key] == 0 {
+		return
+	}
+	l.clients--
+	l.clientsPerIP[key]--
+	if l.clientsPerIP[key] == 0 {
+		delete(l.clientsPerIP, key)
+	}
+}
+
+// gcIPRateLimiters forgets the rate limiters of IPs that haven't connected for
+// long enough that their limiter would have refilled. The mutex must be held.
+func (l *connectionLimiter) gcIPRateLimiters(now time.Time) {
+	if now.Sub(l.lastRateLimitGC) < l.ipRateRefill {
+		return
+	}
+	l.lastRateLimitGC = now
+	for key, ipLimiter := range l.ipRateLimiters {
+		if now.Sub(ipLimiter.lastUsed) >= l.ipRateRefill {
+			delete(l.ipRateLimiters, key)
+		}
+	}
+}
+
+// remoteIP returns the IP of the connection's remote end.
+func remoteIP(conn net.Conn) net.IP {
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return nil
+		}
+		return net.ParseIP(host)
+	}
+}
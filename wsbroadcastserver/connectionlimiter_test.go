@@ -0,0 +1,316 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+)
+
+func expectRejection(t *testing.T, err error, status int) {
+	t.Helper()
+	var rejection *ws.ConnectionRejectedError
+	if !errors.As(err, &rejection) || rejection.StatusCode() != status {
+		t.Fatal("expected rejection with status", status, "got", err)
+	}
+}
+
+func TestConnectionLimiterLimits(t *testing.T) {
+	limiter, err := newConnectionLimiter(&ConnectionLimiterConfig{
+		MaxClients:      3,
+		MaxClientsPerIP: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ip1, ip2, ip3 := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3")
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.admit(ip1, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectRejection(t, limiter.admit(ip1, now), http.StatusTooManyRequests)
+	if err := limiter.admit(ip2, now); err != nil {
+		t.Fatal(err)
+	}
+	expectRejection(t, limiter.admit(ip3, now), http.StatusServiceUnavailable)
+
+	limiter.release(ip1)
+	if err := limiter.admit(ip3, now); err != nil {
+		t.Fatal(err)
+	}
+	// Releasing an IP that isn't connected changes nothing
+	limiter.release(net.ParseIP("10.0.0.4"))
+	expectRejection(t, limiter.admit(ip2, now), http.StatusServiceUnavailable)
+}
+
+func TestConnectionLimiterAllowAndDenyLists(t *testing.T) {
+	limiter, err := newConnectionLimiter(&ConnectionLimiterConfig{
+		AllowList: []string{"10.0.0.0/8", "192.168.1.1"},
+		DenyList:  []string{"10.0.0.5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for ip, allowed := range map[string]bool{
+		"10.1.2.3":    true,
+		"10.0.0.5":    false,
+		"192.168.1.1": true,
+		"192.168.1.2": false,
+		"::1":         false,
+	} {
+		err := limiter.admit(net.ParseIP(ip), now)
+		if allowed && err != nil {
+			t.Fatal("expected", ip, "to be allowed, got", err)
+		}
+		if !allowed {
+			expectRejection(t, err, http.StatusForbidden)
+		}
+	}
+
+	for _, list := range []string{"10.0.0.0/33", "not an ip"} {
+		if _, err := newConnectionLimiter(&ConnectionLimiterConfig{DenyList: []string{list}}); err == nil {
+			t.Fatal("expected invalid deny list", list, "to be rejected")
+		}
+	}
+}
+
+func TestConnectionLimiterRates(t *testing.T) {
+	limiter, err := newConnectionLimiter(&ConnectionLimiterConfig{
+		ConnectionRate:      3,
+		ConnectionRatePerIP: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ip1, ip2 := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.admit(ip1, now); err != nil {
+			t.Fatal(err)
+		}
+		limiter.release(ip1)
+	}
+	expectRejection(t, limiter.admit(ip1, now), http.StatusTooManyRequests)
+	if err := limiter.admit(ip2, now); err != nil {
+		t.Fatal(err)
+	}
+	// IP 1's rejected connection didn't count against the global rate, but IP 2's did
+	expectRejection(t, limiter.admit(ip2, now), http.StatusServiceUnavailable)
+
+	later := now.Add(time.Second)
+	if err := limiter.admit(ip1, later); err != nil {
+		t.Fatal(err)
+	}
+
+	// Idle IPs' rate limiters are forgotten
+	if err := limiter.admit(ip2, later.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(limiter.ipRateLimiters) != 1 {
+		t.Fatal("expected only the last IP's rate limiter to be kept, got", len(limiter.ipRateLimiters))
+	}
+}
+
+type testCatchupBuffer struct{}
+
+func (b *testCatchupBuffer) OnRegisterClient(context.Context, *ClientConnection) error {
+	return nil
+}
+
+func (b *testCatchupBuffer) OnDoBroadcast(interface{}) error {
+	return nil
+}
+
+func (b *testCatchupBuffer) GetMessageCount() int {
+	return 0
+}
+
+func startTestServer(t *testing.T, ctx context.Context, limits ConnectionLimiterConfig) *WSBroadcastServer {
+	t.Helper()
+	settings := BroadcasterConfig{
+		Addr:             "127.0.0.1",
+		IOTimeout:        2 * time.Second,
+		Port:             "0",
+		Ping:             5 * time.Second,
+		ClientTimeout:    15 * time.Second,
+		Queue:            1,
+		Workers:          128,
+		ConnectionLimits: limits,
+	}
+	server := NewWSBroadcastServer(settings, &testCatchupBuffer{}, nil)
+	if err := server.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// dialFrom connects to the server from the given loopback IP, so that clients
+// on different IPs can be simulated.
+func dialFrom(ctx context.Context, server *WSBroadcastServer, ip string) (net.Conn, error) {
+	dialer := ws.Dialer{
+		Timeout: 5 * time.Second,
+		NetDial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			netDialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+			return netDialer.DialContext(ctx, network, addr)
+		},
+	}
+	conn, _, _, err := dialer.Dial(ctx, fmt.Sprintf("ws://%s/", server.ListenerAddr().String()))
+	return conn, err
+}
+
+func expectStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	var statusErr ws.StatusError
+	if !errors.As(err, &statusErr) || int(statusErr) != status {
+		t.Fatal("expected connection to be refused with status", status, "got", err)
+	}
+}
+
+func TestServerConnectionLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := startTestServer(t, ctx, ConnectionLimiterConfig{
+		MaxClients:      12,
+		MaxClientsPerIP: 5,
+		DenyList:        []string{"127.0.0.4"},
+	})
+	defer server.StopAndWait()
+
+	conns := make(map[string][]net.Conn)
+	for _, tc := range []struct {
+		ip       string
+		accepted int
+		status   int
+	}{
+		{"127.0.0.1", 5, http.StatusTooManyRequests},
+		{"127.0.0.2", 5, http.StatusTooManyRequests},
+		{"127.0.0.3", 2, http.StatusServiceUnavailable},
+		{"127.0.0.4", 0, http.StatusForbidden},
+	} {
+		for i := 0; i < 6; i++ {
+			conn, err := dialFrom(ctx, server, tc.ip)
+			if i < tc.accepted {
+				if err != nil {
+					t.Fatal("expected connection", i, "from", tc.ip, "to be accepted, got", err)
+				}
+				conns[tc.ip] = append(conns[tc.ip], conn)
+			} else {
+				expectStatus(t, err, tc.status)
+			}
+		}
+	}
+
+	// Disconnected clients no longer count against the limits
+	for _, conn := range conns["127.0.0.1"] {
+		_ = conn.Close()
+	}
+	timeout := time.Now().Add(5 * time.Second)
+	for server.ClientCount() != 7 {
+		if time.Now().After(timeout) {
+			t.Fatal("expected 7 clients after disconnecting 5, got", server.ClientCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn, err := dialFrom(ctx, server, "127.0.0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	for _, ipConns := range conns {
+		for _, conn := range ipConns {
+			_ = conn.Close()
+		}
+	}
+}
+
+func TestServerConnectionLimitsWithManyClients(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	maxClientsPerIP := 10
+	server := startTestServer(t, ctx, ConnectionLimiterConfig{
+		MaxClientsPerIP: maxClientsPerIP,
+	})
+	defer server.StopAndWait()
+
+	clientCount := 100
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var conns []net.Conn
+	rejected := 0
+	for i := 0; i < clientCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := dialFrom(ctx, server, "127.0.0.1")
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				var statusErr ws.StatusError
+				if !errors.As(err, &statusErr) || int(statusErr) != http.StatusTooManyRequests {
+					t.Error("unexpected error connecting", err)
+				}
+				rejected++
+				return
+			}
+			conns = append(conns, conn)
+		}()
+	}
+	wg.Wait()
+
+	if len(conns) != maxClientsPerIP || rejected != clientCount-maxClientsPerIP {
+		t.Error("expected", maxClientsPerIP, "clients to connect, got", len(conns), "with", rejected, "rejected")
+	}
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+}
+
+func TestServerConnectionRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := startTestServer(t, ctx, ConnectionLimiterConfig{
+		ConnectionRatePerIP: 1,
+	})
+	defer server.StopAndWait()
+
+	var retryAfter string
+	dialer := ws.Dialer{
+		Timeout: 5 * time.Second,
+		OnStatusError: func(status int, reason []byte, resp io.Reader) {
+			response, err := http.ReadResponse(bufio.NewReader(resp), nil)
+			if err == nil {
+				retryAfter = response.Header.Get("Retry-After")
+			}
+		},
+	}
+	url := fmt.Sprintf("ws://%s/", server.ListenerAddr().String())
+	conn, _, _, err := dialer.Dial(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	_, _, _, err = dialer.Dial(ctx, url)
+	expectStatus(t, err, http.StatusTooManyRequests)
+	if retryAfter != "1" {
+		t.Error("expected Retry-After of 1 second, got", retryAfter)
+	}
+}
@@ -4,6 +4,7 @@
 package wsbroadcastserver
 
 import (
+	"compress/flate"
 	"context"
 	"errors"
 	"io"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/gobwas/ws/wsutil"
 )
 
@@ -51,7 +53,7 @@ func (cr *chainedReader) add(r io.Reader) *chainedReader {
 	return cr
 }
 
-func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idleTimeout time.Duration, state ws.State) ([]byte, ws.OpCode, error) {
+func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idleTimeout time.Duration, state ws.State, compression bool) ([]byte, ws.OpCode, error) {
 
 	controlHandler := wsutil.ControlFrameHandler(conn, state)
 	reader := wsutil.Reader{
@@ -61,6 +63,13 @@ func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idle
 		SkipHeaderCheck: false,
 		OnIntermediate:  controlHandler,
 	}
+	var msgState wsflate.MessageState
+	if compression {
+		// Compressed text frames are only valid UTF8 once decompressed
+		reader.State = state.Set(ws.StateExtended)
+		reader.CheckUTF8 = false
+		reader.Extensions = []wsutil.RecvExtension{&msgState}
+	}
 
 	// Remove timeout when leaving this function
 	defer func(conn net.Conn) {
@@ -109,6 +118,14 @@ func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idle
 			continue
 		}
 
+		if msgState.IsCompressed() {
+			flateReader := wsflate.NewReader(&reader, func(r io.Reader) wsflate.Decompressor {
+				return flate.NewReader(r)
+			})
+			data, err := ioutil.ReadAll(flateReader)
+			return data, header.OpCode, err
+		}
+
 		data, err := ioutil.ReadAll(&reader)
 
 		return data, header.OpCode, err
@@ -8,6 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,19 +18,43 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws-examples/src/gopool"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/mailru/easygo/netpoll"
+	"github.com/offchainlabs/nitro/arbutil"
 	flag "github.com/spf13/pflag"
 )
 
+const (
+	// Clients set the header or query parameter to the first sequence number they
+	// want, so that they are only sent the messages they're missing on connect.
+	HTTPHeaderRequestedSequenceNumber = "Arbitrum-Requested-Sequence-Number"
+	RequestedSequenceNumberQueryParam = "requestedSeqNum"
+
+	// Clients set the header or query parameter to have the server filter the
+	// messages they're sent.
+	HTTPHeaderFeedFilter = "Arbitrum-Feed-Filter"
+	FeedFilterQueryParam = "filter"
+
+	// Clients request the WebSocket subprotocol to be sent messages in their
+	// binary encoding, if they have one, rather than as JSON.
+	BinaryEncodingProtocol = "arbitrum-feed-binary"
+)
+
 type BroadcasterConfig struct {
-	Enable        bool          `koanf:"enable"`
-	Addr          string        `koanf:"addr"`
-	IOTimeout     time.Duration `koanf:"io-timeout"`
-	Port          string        `koanf:"port"`
-	Ping          time.Duration `koanf:"ping"`
-	ClientTimeout time.Duration `koanf:"client-timeout"`
-	Queue         int           `koanf:"queue"`
-	Workers       int           `koanf:"workers"`
+	Enable            bool          `koanf:"enable"`
+	Addr              string        `koanf:"addr"`
+	IOTimeout         time.Duration `koanf:"io-timeout"`
+	Port              string        `koanf:"port"`
+	Ping              time.Duration `koanf:"ping"`
+	ClientTimeout     time.Duration `koanf:"client-timeout"`
+	Queue             int           `koanf:"queue"`
+	Workers           int           `koanf:"workers"`
+	SigningKey        string        `koanf:"signing-key"`
+	EnableCompression bool          `koanf:"enable-compression"`
+	EnableBinary      bool          `koanf:"enable-binary"`
+
+	ConnectionLimits ConnectionLimiterConfig `koanf:"connection-limits"`
+	Backlog          BacklogConfig           `koanf:"backlog"`
 }
 
 func BroadcasterConfigAddOptions(prefix string, f *flag.FlagSet) {
@@ -39,17 +66,59 @@ func BroadcasterConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Duration(prefix+".client-timeout", DefaultBroadcasterConfig.ClientTimeout, "duration to wait before timing out connections to client")
 	f.Int(prefix+".queue", DefaultBroadcasterConfig.Queue, "queue size")
 	f.Int(prefix+".workers", DefaultBroadcasterConfig.Workers, "number of threads to reserve for HTTP to WS upgrade")
+	f.String(prefix+".signing-key", DefaultBroadcasterConfig.SigningKey, "hex private key, or a path to a file containing it, to sign feed messages with")
+	f.Bool(prefix+".enable-compression", DefaultBroadcasterConfig.EnableCompression, "enable per message deflate compression support for clients requesting it")
+	f.Bool(prefix+".enable-binary", DefaultBroadcasterConfig.EnableBinary, "enable the binary message encoding for clients requesting it")
+	ConnectionLimiterConfigAddOptions(prefix+".connection-limits", f)
+	BacklogConfigAddOptions(prefix+".backlog", f)
 }
 
 var DefaultBroadcasterConfig = BroadcasterConfig{
-	Enable:        false,
-	Addr:          "",
-	IOTimeout:     5 * time.Second,
-	Port:          "9642",
-	Ping:          5 * time.Second,
-	ClientTimeout: 15 * time.Second,
-	Queue:         100,
-	Workers:       100,
+	Enable:            false,
+	Addr:              "",
+	IOTimeout:         5 * time.Second,
+	Port:              "9642",
+	Ping:              5 * time.Second,
+	ClientTimeout:     15 * time.Second,
+	Queue:             100,
+	Workers:           100,
+	SigningKey:        "",
+	EnableCompression: false,
+	EnableBinary:      false,
+	ConnectionLimits:  DefaultConnectionLimiterConfig,
+	Backlog:           DefaultBacklogConfig,
+}
+
+// BacklogConfig configures the broadcaster's disk backed backlog of feed
+// messages, which clients can catch up from after the broadcaster restarts.
+type BacklogConfig struct {
+	Enable          bool          `koanf:"enable"`
+	Dir             string        `koanf:"dir"`
+	SegmentMessages uint64        `koanf:"segment-messages"`
+	MaxSize         uint64        `koanf:"max-size"`
+	MaxAge          time.Duration `koanf:"max-age"`
+	MaxRestored     uint64        `koanf:"max-restored"`
+	CatchupTimeout  time.Duration `koanf:"catchup-timeout"`
+}
+
+func BacklogConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultBacklogConfig.Enable, "persist recent feed messages to disk, to serve clients catching up even after a restart")
+	f.String(prefix+".dir", DefaultBacklogConfig.Dir, "directory to store the feed backlog in")
+	f.Uint64(prefix+".segment-messages", DefaultBacklogConfig.SegmentMessages, "number of sequence numbers stored in each backlog segment file")
+	f.Uint64(prefix+".max-size", DefaultBacklogConfig.MaxSize, "maximum size in bytes of the backlog, beyond which the oldest segments are deleted (0 = no limit)")
+	f.Duration(prefix+".max-age", DefaultBacklogConfig.MaxAge, "maximum age of the backlog, beyond which the oldest segments are deleted (0 = no limit)")
+	f.Uint64(prefix+".max-restored", DefaultBacklogConfig.MaxRestored, "maximum number of unconfirmed messages restored from the backlog to the in-memory cache on startup (0 = no limit)")
+	f.Duration(prefix+".catchup-timeout", DefaultBacklogConfig.CatchupTimeout, "maximum time spent sending a client messages from the backlog, after which it's disconnected to reconnect from where it got to (0 = no limit)")
+}
+
+var DefaultBacklogConfig = BacklogConfig{
+	Enable:          false,
+	Dir:             "",
+	SegmentMessages: 10000,
+	MaxSize:         1 << 30,
+	MaxAge:          24 * time.Hour,
+	MaxRestored:     100000,
+	CatchupTimeout:  time.Minute,
 }
 
 type WSBroadcastServer struct {
@@ -61,14 +130,16 @@ type WSBroadcastServer struct {
 	started       bool
 	clientManager *ClientManager
 	catchupBuffer CatchupBuffer
+	filterParser  ClientFilterParser // if nil, clients can't request filters
 }
 
-func NewWSBroadcastServer(settings BroadcasterConfig, catchupBuffer CatchupBuffer) *WSBroadcastServer {
+func NewWSBroadcastServer(settings BroadcasterConfig, catchupBuffer CatchupBuffer, filterParser ClientFilterParser) *WSBroadcastServer {
 	return &WSBroadcastServer{
 		startMutex:    &sync.Mutex{},
 		settings:      settings,
 		started:       false,
 		catchupBuffer: catchupBuffer,
+		filterParser:  filterParser,
 	}
 }
 
@@ -79,7 +150,11 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 		return nil
 	}
 
-	var err error
+	connectionLimiter, err := newConnectionLimiter(&s.settings.ConnectionLimits)
+	if err != nil {
+		return err
+	}
+
 	s.poller, err = netpoll.New(nil)
 	if err != nil {
 		log.Error("unable to initialize netpoll for monitoring client connection events", "err", err)
@@ -88,7 +163,7 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 
 	// Make pool of X size, Y sized work queue and one pre-spawned
 	// goroutine.
-	var clientManager = NewClientManager(s.poller, s.settings, s.catchupBuffer)
+	var clientManager = NewClientManager(s.poller, s.settings, s.catchupBuffer, connectionLimiter)
 	clientManager.Start(ctx)
 
 	s.clientManager = clientManager // maintain the pointer in this instance... used for testing
@@ -102,11 +177,71 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 
 		safeConn := deadliner{conn, s.settings.IOTimeout}
 
+		// Check whether to accept the client, while counting it as connected,
+		// rejecting it with an HTTP status if not.
+		clientIP := remoteIP(conn)
+		if err := connectionLimiter.admit(clientIP, time.Now()); err != nil {
+			log.Debug("rejecting websocket connection", "connection_name", nameConn(safeConn), "err", err)
+			clientsRejectedCounter.Inc(1)
+			rejecter := ws.Upgrader{
+				OnRequest: func(uri []byte) error {
+					return err
+				},
+			}
+			_, _ = rejecter.Upgrade(safeConn)
+			_ = safeConn.Close()
+			return
+		}
+
+		var requestedSeqNum arbutil.MessageIndex
+		var filter ClientFilter
+		var compression wsflate.Extension
+		upgrader := ws.Upgrader{
+			OnRequest: func(uri []byte) error {
+				requestURL, err := url.ParseRequestURI(string(uri))
+				if err != nil {
+					return nil // left to the upgrader to handle
+				}
+				query := requestURL.Query()
+				if value := query.Get(RequestedSequenceNumberQueryParam); value != "" {
+					requestedSeqNum, err = parseRequestedSeqNum(value)
+					if err != nil {
+						return err
+					}
+				}
+				if value := query.Get(FeedFilterQueryParam); value != "" {
+					filter, err = s.parseFilter(value)
+				}
+				return err
+			},
+			OnHeader: func(key, value []byte) error {
+				var err error
+				if strings.EqualFold(string(key), HTTPHeaderRequestedSequenceNumber) {
+					requestedSeqNum, err = parseRequestedSeqNum(string(value))
+				} else if strings.EqualFold(string(key), HTTPHeaderFeedFilter) {
+					filter, err = s.parseFilter(string(value))
+				}
+				return err
+			},
+		}
+		if s.settings.EnableCompression {
+			// Without context takeover, each message is compressed independently,
+			// so one compressed broadcast can be shared by all clients.
+			compression.Parameters = wsflate.DefaultParameters
+			upgrader.Negotiate = compression.Negotiate
+		}
+		if s.settings.EnableBinary {
+			upgrader.Protocol = func(protocol []byte) bool {
+				return string(protocol) == BinaryEncodingProtocol
+			}
+		}
+
 		// Zero-copy upgrade to WebSocket connection.
-		hs, err := ws.Upgrade(safeConn)
+		hs, err := upgrader.Upgrade(safeConn)
 		if err != nil {
 			log.Warn("websocket upgrade error", "connection_name", nameConn(safeConn), "err", err)
 			_ = safeConn.Close()
+			connectionLimiter.release(clientIP)
 			return
 		}
 
@@ -117,11 +252,14 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 		if err != nil {
 			log.Warn("error in HandleRead", "connection-name", nameConn(safeConn), "err", err)
 			_ = conn.Close()
+			connectionLimiter.release(clientIP)
 			return
 		}
 
 		// Register incoming client in clientManager.
-		client := clientManager.Register(safeConn, desc)
+		_, compressionAccepted := compression.Accepted()
+		binary := hs.Protocol == BinaryEncodingProtocol
+		client := clientManager.Register(safeConn, desc, requestedSeqNum, compressionAccepted, binary, filter)
 
 		// Subscribe to events about conn.
 		err = s.poller.Start(desc, func(ev netpoll.Event) {
@@ -230,6 +368,34 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 	return nil
 }
 
+func parseRequestedSeqNum(value string) (arbutil.MessageIndex, error) {
+	seqNum, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, ws.RejectConnectionError(
+			ws.RejectionStatus(http.StatusBadRequest),
+			ws.RejectionReason(fmt.Sprintf("invalid requested sequence number %q", value)),
+		)
+	}
+	return arbutil.MessageIndex(seqNum), nil
+}
+
+func (s *WSBroadcastServer) parseFilter(value string) (ClientFilter, error) {
+	if s.filterParser == nil {
+		return nil, ws.RejectConnectionError(
+			ws.RejectionStatus(http.StatusBadRequest),
+			ws.RejectionReason("feed filters aren't supported"),
+		)
+	}
+	filter, err := s.filterParser(value)
+	if err != nil {
+		return nil, ws.RejectConnectionError(
+			ws.RejectionStatus(http.StatusBadRequest),
+			ws.RejectionReason(fmt.Sprintf("invalid feed filter: %v", err)),
+		)
+	}
+	return filter, nil
+}
+
 func (s *WSBroadcastServer) ListenerAddr() net.Addr {
 	return s.listener.Addr()
 }